@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+)
+
+// memRedis 只实现用户缓存用到的Get、Set、Del, 不处理过期
+type memRedis struct {
+	redis.Cmdable
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newMemRedis() *memRedis {
+	return &memRedis{data: make(map[string]string)}
+}
+
+func (m *memRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.data[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(val, nil)
+}
+
+func (m *memRedis) Set(ctx context.Context, key string, value any, expiration time.Duration) *redis.StatusCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	m.data[key] = fmt.Sprint(value)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (m *memRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, key := range keys {
+		if _, ok := m.data[key]; ok {
+			delete(m.data, key)
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// contains 任意键或值中包含s
+func (m *memRedis) contains(s string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, v := range m.data {
+		if strings.Contains(k, s) || strings.Contains(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// testKeys 测试用的主密钥, 数据密钥不再加密
+type testKeys struct{}
+
+func (testKeys) CurrentKey() string { return "k1" }
+
+func (testKeys) Wrap(ctx context.Context, keyId string, dek []byte) ([]byte, error) { return dek, nil }
+
+func (testKeys) Unwrap(ctx context.Context, keyId string, wrapped []byte) ([]byte, error) {
+	return wrapped, nil
+}
+
+func (testKeys) IndexKey() []byte { return bytes.Repeat([]byte{1}, 32) }
+
+func newTestCipher() pii.Cipher {
+	return pii.NewEnvelope(testKeys{})
+}
+
+func newTestLogger() *logger.Logger {
+	return logger.NewLogger(logger.WithWriteFile(false))
+}
+
+// memUserDao 只实现缓存用到的查询方法
+type memUserDao struct {
+	dao.UserI
+	users map[int64]dao.User
+}
+
+func (m *memUserDao) FindUserById(ctx context.Context, uid int64) (dao.User, error) {
+	ue, ok := m.users[uid]
+	if !ok {
+		return dao.User{}, dao.ErrRecordNotFound
+	}
+	return ue, nil
+}
+
+func (m *memUserDao) FindUserByEmail(ctx context.Context, email string) (dao.User, error) {
+	for _, ue := range m.users {
+		if ue.Email == email {
+			return ue, nil
+		}
+	}
+	return dao.User{}, dao.ErrRecordNotFound
+}
+
+func (m *memUserDao) FindPassword(ctx context.Context, uid int64) (string, error) {
+	ue, err := m.FindUserById(ctx, uid)
+	return ue.Password, err
+}
+
+func (m *memUserDao) UpdatePassword(ctx context.Context, uid int64, hash string) error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/Numsina/tk_users/user_srv/dao"
+)
+
+const defaultLocalExpire = 10 * time.Second
+
+type localEntry struct {
+	val      any
+	expireAt time.Time
+}
+
+var _ UserCache = &localUserCache{}
+
+// localUserCache 进程内的LRU缓存, 空值也按相同的过期时间缓存
+type localUserCache struct {
+	lru        *lru.Cache
+	expiration time.Duration
+}
+
+func newLocalUserCache(size int, expiration time.Duration) (*localUserCache, error) {
+	c, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	if expiration <= 0 {
+		expiration = defaultLocalExpire
+	}
+	return &localUserCache{
+		lru:        c,
+		expiration: expiration,
+	}, nil
+}
+
+func (l *localUserCache) key(ctx context.Context, uid int64) string {
+	return tenantKey(ctx, fmt.Sprintf("id:%d", uid))
+}
+
+func (l *localUserCache) emailKey(ctx context.Context, index string) string {
+	return tenantKey(ctx, "email:"+index)
+}
+
+func (l *localUserCache) get(key string) (any, error) {
+	val, ok := l.lru.Get(key)
+	if !ok {
+		return nil, ErrKeyNotExist
+	}
+	entry := val.(localEntry)
+	if time.Now().After(entry.expireAt) {
+		l.lru.Remove(key)
+		return nil, ErrKeyNotExist
+	}
+	if entry.val == nil {
+		return nil, dao.ErrRecordNotFound
+	}
+	return entry.val, nil
+}
+
+func (l *localUserCache) set(key string, val any) {
+	l.lru.Add(key, localEntry{val: val, expireAt: time.Now().Add(l.expiration)})
+}
+
+func (l *localUserCache) Get(ctx context.Context, uid int64) (dao.User, error) {
+	val, err := l.get(l.key(ctx, uid))
+	if err != nil {
+		return dao.User{}, err
+	}
+	return val.(dao.User), nil
+}
+
+func (l *localUserCache) Set(ctx context.Context, user dao.User) error {
+	l.set(l.key(ctx, user.Id), user)
+	return nil
+}
+
+func (l *localUserCache) SetMissing(ctx context.Context, uid int64) error {
+	l.set(l.key(ctx, uid), nil)
+	return nil
+}
+
+func (l *localUserCache) Del(ctx context.Context, uid int64) error {
+	l.lru.Remove(l.key(ctx, uid))
+	return nil
+}
+
+func (l *localUserCache) GetId(ctx context.Context, index string) (int64, error) {
+	val, err := l.get(l.emailKey(ctx, index))
+	if err != nil {
+		return 0, err
+	}
+	return val.(int64), nil
+}
+
+func (l *localUserCache) SetId(ctx context.Context, index string, uid int64) error {
+	l.set(l.emailKey(ctx, index), uid)
+	return nil
+}
+
+func (l *localUserCache) SetEmailMissing(ctx context.Context, index string) error {
+	l.set(l.emailKey(ctx, index), nil)
+	return nil
+}
+
+func (l *localUserCache) DelEmail(ctx context.Context, index string) error {
+	l.lru.Remove(l.emailKey(ctx, index))
+	return nil
+}
+
+func (l *localUserCache) purge() {
+	l.lru.Purge()
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+)
+
+var ErrKeyNotExist = redis.Nil
+
+type PreferenceCache interface {
+	Get(ctx context.Context, uid int64) ([]domain.Preference, error)
+	Set(ctx context.Context, uid int64, prefs []domain.Preference) error
+	Del(ctx context.Context, uid int64) error
+}
+
+var _ PreferenceCache = &preferenceCache{}
+
+type preferenceCache struct {
+	client     redis.Cmdable
+	expiration time.Duration
+}
+
+func NewPreferenceCache(client redis.Cmdable) PreferenceCache {
+	return &preferenceCache{
+		client:     client,
+		expiration: time.Hour * 24,
+	}
+}
+
+func (p *preferenceCache) key(ctx context.Context, uid int64) string {
+	return tenantKey(ctx, fmt.Sprintf("user:preference:%d", uid))
+}
+
+// Get 缓存中保存的是用户已设置过的偏好, 不包含默认值
+func (p *preferenceCache) Get(ctx context.Context, uid int64) ([]domain.Preference, error) {
+	val, err := p.client.Get(ctx, p.key(ctx, uid)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var prefs []domain.Preference
+	err = json.Unmarshal(val, &prefs)
+	return prefs, err
+}
+
+func (p *preferenceCache) Set(ctx context.Context, uid int64, prefs []domain.Preference) error {
+	if prefs == nil {
+		prefs = []domain.Preference{}
+	}
+	val, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	return p.client.Set(ctx, p.key(ctx, uid), val, p.expiration).Err()
+}
+
+func (p *preferenceCache) Del(ctx context.Context, uid int64) error {
+	err := p.client.Del(ctx, p.key(ctx, uid)).Err()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
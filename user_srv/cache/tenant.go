@@ -0,0 +1,16 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// tenantKey 给非默认租户的缓存键加上租户前缀, 默认租户沿用原来的键, 开启多租户前写入的缓存仍然有效
+func tenantKey(ctx context.Context, key string) string {
+	id := tenant.FromContext(ctx)
+	if id == tenant.Default {
+		return key
+	}
+	return "tenant:" + id + ":" + key
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// 非默认租户的缓存键带租户前缀, 一个租户写入的缓存其他租户读不到
+func TestTenantKeys(t *testing.T) {
+	rdb := newMemRedis()
+	cipher := newTestCipher()
+	c := NewUserCache(rdb, config.UserCacheConfig{}, cipher)
+	pc := NewPreferenceCache(rdb)
+	acme := tenant.WithTenant(context.Background(), "acme")
+	other := tenant.WithTenant(context.Background(), "other")
+	index := cipher.BlindIndex(alice.Email)
+
+	ue := alice
+	ue.TenantId = "acme"
+	if err := c.Set(acme, ue); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetId(acme, index, ue.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.Set(acme, ue.Id, []domain.Preference{{Key: "lang", Value: "zh"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{
+		fmt.Sprintf("tenant:acme:user:info:v2:id:%d", ue.Id),
+		"tenant:acme:user:info:v2:email:" + index,
+		fmt.Sprintf("tenant:acme:user:preference:%d", ue.Id),
+	} {
+		if _, ok := rdb.data[key]; !ok {
+			t.Fatalf("缺少带租户前缀的键%s, 实际: %v", key, rdb.data)
+		}
+	}
+
+	for _, ctx := range []context.Context{other, context.Background()} {
+		if _, err := c.Get(ctx, ue.Id); !errors.Is(err, ErrKeyNotExist) {
+			t.Fatalf("租户%s读到了其他租户的缓存: %v", tenant.FromContext(ctx), err)
+		}
+		if _, err := c.GetId(ctx, index); !errors.Is(err, ErrKeyNotExist) {
+			t.Fatalf("租户%s读到了其他租户的邮箱缓存: %v", tenant.FromContext(ctx), err)
+		}
+		if _, err := pc.Get(ctx, ue.Id); !errors.Is(err, ErrKeyNotExist) {
+			t.Fatalf("租户%s读到了其他租户的偏好缓存: %v", tenant.FromContext(ctx), err)
+		}
+		// 其他租户删除缓存不影响本租户
+		if err := c.Del(ctx, ue.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := c.Get(acme, ue.Id); err != nil || got.Id != ue.Id {
+		t.Fatalf("读不到本租户的缓存: %+v, %v", got, err)
+	}
+
+	// 默认租户沿用没有前缀的键
+	if err := c.Set(context.Background(), alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rdb.data[fmt.Sprintf("user:info:v2:id:%d", alice.Id)]; !ok {
+		t.Fatalf("默认租户的键不应带前缀, 实际: %v", rdb.data)
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// userInvalidateChannel 用户缓存失效的广播频道, 所有副本收到后删除本地缓存
+const userInvalidateChannel = "user:cache:invalidate"
+
+type invalidation struct {
+	Source string `json:"source"`
+	Tenant string `json:"tenant,omitempty"`
+	Id     int64  `json:"id,omitempty"`
+	// Index 邮箱的盲索引
+	Index string `json:"email_index,omitempty"`
+}
+
+var _ UserCache = &twoLevelUserCache{}
+
+// twoLevelUserCache 本地LRU在前, redis在后; 删除时通过redis pub/sub通知其他副本,
+// 本地缓存的过期时间很短, 用来兜底丢失的失效消息
+type twoLevelUserCache struct {
+	local  *localUserCache
+	remote UserCache
+	client redis.UniversalClient
+	source string
+	logger *logger.Logger
+}
+
+// NewTwoLevelUserCache 创建本地LRU并开始订阅失效广播
+func NewTwoLevelUserCache(remote UserCache, client redis.UniversalClient, size int, expiration time.Duration,
+	logger *logger.Logger) (UserCache, error) {
+	local, err := newLocalUserCache(size, expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &twoLevelUserCache{
+		local:  local,
+		remote: remote,
+		client: client,
+		source: uuid.New().String(),
+		logger: logger,
+	}
+	go t.subscribe(context.Background())
+	return t, nil
+}
+
+func (t *twoLevelUserCache) Get(ctx context.Context, uid int64) (dao.User, error) {
+	user, err := t.local.Get(ctx, uid)
+	if !errors.Is(err, ErrKeyNotExist) {
+		return user, err
+	}
+
+	user, err = t.remote.Get(ctx, uid)
+	switch {
+	case err == nil:
+		t.local.Set(ctx, user)
+	case errors.Is(err, dao.ErrRecordNotFound):
+		t.local.SetMissing(ctx, uid)
+	}
+	return user, err
+}
+
+func (t *twoLevelUserCache) Set(ctx context.Context, user dao.User) error {
+	t.local.Set(ctx, user)
+	return t.remote.Set(ctx, user)
+}
+
+func (t *twoLevelUserCache) SetMissing(ctx context.Context, uid int64) error {
+	t.local.SetMissing(ctx, uid)
+	return t.remote.SetMissing(ctx, uid)
+}
+
+func (t *twoLevelUserCache) Del(ctx context.Context, uid int64) error {
+	t.local.Del(ctx, uid)
+	err := t.remote.Del(ctx, uid)
+	t.publish(ctx, invalidation{Id: uid})
+	return err
+}
+
+func (t *twoLevelUserCache) GetId(ctx context.Context, index string) (int64, error) {
+	uid, err := t.local.GetId(ctx, index)
+	if !errors.Is(err, ErrKeyNotExist) {
+		return uid, err
+	}
+
+	uid, err = t.remote.GetId(ctx, index)
+	switch {
+	case err == nil:
+		t.local.SetId(ctx, index, uid)
+	case errors.Is(err, dao.ErrRecordNotFound):
+		t.local.SetEmailMissing(ctx, index)
+	}
+	return uid, err
+}
+
+func (t *twoLevelUserCache) SetId(ctx context.Context, index string, uid int64) error {
+	t.local.SetId(ctx, index, uid)
+	return t.remote.SetId(ctx, index, uid)
+}
+
+func (t *twoLevelUserCache) SetEmailMissing(ctx context.Context, index string) error {
+	t.local.SetEmailMissing(ctx, index)
+	return t.remote.SetEmailMissing(ctx, index)
+}
+
+func (t *twoLevelUserCache) DelEmail(ctx context.Context, index string) error {
+	t.local.DelEmail(ctx, index)
+	err := t.remote.DelEmail(ctx, index)
+	t.publish(ctx, invalidation{Index: index})
+	return err
+}
+
+func (t *twoLevelUserCache) publish(ctx context.Context, msg invalidation) {
+	msg.Source = t.source
+	msg.Tenant = tenant.FromContext(ctx)
+	val, _ := json.Marshal(msg)
+	if err := t.client.Publish(ctx, userInvalidateChannel, val).Err(); err != nil {
+		t.logger.Sugar().Warnf("广播用户缓存失效失败, 错误原因: %s", err)
+	}
+}
+
+// subscribe 接收其他副本的失效广播, 直到ctx结束
+func (t *twoLevelUserCache) subscribe(ctx context.Context) {
+	pubsub := t.client.Subscribe(ctx, userInvalidateChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			t.logger.Sugar().Warnf("接收用户缓存失效广播失败, 错误原因: %s", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			// 断线重连期间可能丢失了失效消息, 重新订阅成功后清空本地缓存
+			t.local.purge()
+		case *redis.Message:
+			var inv invalidation
+			if err = json.Unmarshal([]byte(msg.Payload), &inv); err != nil || inv.Source == t.source {
+				continue
+			}
+			// 没有租户的消息来自开启多租户之前的副本, 属于默认租户
+			tctx := tenant.WithTenant(ctx, inv.Tenant)
+			if inv.Id != 0 {
+				t.local.Del(tctx, inv.Id)
+			}
+			if inv.Index != "" {
+				t.local.DelEmail(tctx, inv.Index)
+			}
+		}
+	}
+}
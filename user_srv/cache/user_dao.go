@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	prome "github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+)
+
+var _ dao.UserI = &cachedUserDao{}
+
+// cachedUserDao 在dao.UserI外面加一层cache-aside缓存, 写操作先写库再删除缓存.
+// 缓存的用户不带密码哈希, 需要时通过FindPassword查库
+type cachedUserDao struct {
+	dao.UserI
+	cache   UserCache
+	pii     pii.Cipher
+	group   singleflight.Group
+	counter *prome.CounterVec
+	logger  *logger.Logger
+}
+
+func NewCachedUserDao(d dao.UserI, cache UserCache, c pii.Cipher, logger *logger.Logger) dao.UserI {
+	counter := prome.NewCounterVec(prome.CounterOpts{
+		Namespace: "tk_users",
+		Subsystem: "user_srv",
+		Name:      "user_cache_total",
+		Help:      "统计用户缓存的命中和未命中次数",
+	}, []string{"key", "result"})
+	if err := prome.Register(counter); err != nil {
+		var are prome.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			counter = are.ExistingCollector.(*prome.CounterVec)
+		}
+	}
+
+	return &cachedUserDao{
+		UserI:   d,
+		cache:   cache,
+		pii:     c,
+		counter: counter,
+		logger:  logger,
+	}
+}
+
+func (c *cachedUserDao) FindUserById(ctx context.Context, uid int64) (dao.User, error) {
+	user, err := c.cache.Get(ctx, uid)
+	switch {
+	case err == nil:
+		c.counter.WithLabelValues("id", "hit").Inc()
+		return user, nil
+	case errors.Is(err, dao.ErrRecordNotFound):
+		c.counter.WithLabelValues("id", "negative_hit").Inc()
+		return dao.User{}, err
+	case !errors.Is(err, ErrKeyNotExist):
+		// redis出错时直接查库, 不回写缓存
+		c.logger.Sugar().Warnf("读取用户缓存失败, 用户: %d, 错误原因: %s", uid, err)
+		return c.UserI.FindUserById(ctx, uid)
+	}
+
+	c.counter.WithLabelValues("id", "miss").Inc()
+	val, err, _ := c.group.Do(tenantKey(ctx, "id:"+strconv.FormatInt(uid, 10)), func() (any, error) {
+		user, err := c.UserI.FindUserById(ctx, uid)
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			c.log(c.cache.SetMissing(ctx, uid))
+		}
+		if err != nil {
+			return dao.User{}, err
+		}
+		// 命中和未命中时返回相同的字段
+		user.Password = ""
+		c.log(c.cache.Set(ctx, user))
+		return user, nil
+	})
+	return val.(dao.User), err
+}
+
+func (c *cachedUserDao) FindUserByEmail(ctx context.Context, email string) (dao.User, error) {
+	index := c.pii.BlindIndex(email)
+	uid, err := c.cache.GetId(ctx, index)
+	switch {
+	case err == nil:
+		user, err := c.FindUserById(ctx, uid)
+		// 邮箱被修改后旧的映射会指向其他邮箱的用户
+		if err == nil && user.Email == email {
+			c.counter.WithLabelValues("email", "hit").Inc()
+			return user, nil
+		}
+		if err != nil && !errors.Is(err, dao.ErrRecordNotFound) {
+			return dao.User{}, err
+		}
+	case errors.Is(err, dao.ErrRecordNotFound):
+		c.counter.WithLabelValues("email", "negative_hit").Inc()
+		return dao.User{}, err
+	case !errors.Is(err, ErrKeyNotExist):
+		c.logger.Sugar().Warnf("按邮箱读取用户缓存失败, 错误原因: %s", err)
+		return c.UserI.FindUserByEmail(ctx, email)
+	}
+
+	c.counter.WithLabelValues("email", "miss").Inc()
+	val, err, _ := c.group.Do(tenantKey(ctx, "email:"+index), func() (any, error) {
+		user, err := c.UserI.FindUserByEmail(ctx, email)
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			c.log(c.cache.SetEmailMissing(ctx, index))
+		}
+		if err != nil {
+			return dao.User{}, err
+		}
+		user.Password = ""
+		c.log(c.cache.Set(ctx, user))
+		c.log(c.cache.SetId(ctx, index, user.Id))
+		return user, nil
+	})
+	return val.(dao.User), err
+}
+
+func (c *cachedUserDao) CreateUser(ctx context.Context, user dao.User) (int64, error) {
+	uid, err := c.UserI.CreateUser(ctx, user)
+	if err != nil {
+		return uid, err
+	}
+	// 清除注册前缓存的空值
+	c.log(c.cache.DelEmail(ctx, c.pii.BlindIndex(user.Email)))
+	c.log(c.cache.Del(ctx, uid))
+	return uid, nil
+}
+
+func (c *cachedUserDao) CreateUsers(ctx context.Context, users []dao.User) ([]int64, error) {
+	ids, err := c.UserI.CreateUsers(ctx, users)
+	if err != nil {
+		return ids, err
+	}
+	for i, user := range users {
+		c.log(c.cache.DelEmail(ctx, c.pii.BlindIndex(user.Email)))
+		c.log(c.cache.Del(ctx, ids[i]))
+	}
+	return ids, nil
+}
+
+func (c *cachedUserDao) UpdateUserInfoByUid(ctx context.Context, user dao.User, fields ...string) (dao.User, error) {
+	ue, err := c.UserI.UpdateUserInfoByUid(ctx, user, fields...)
+	c.log(c.cache.Del(ctx, user.Id))
+	if user.Email != "" {
+		c.log(c.cache.DelEmail(ctx, c.pii.BlindIndex(user.Email)))
+	}
+	return ue, err
+}
+
+func (c *cachedUserDao) DeleteUser(ctx context.Context, uid int64) error {
+	err := c.UserI.DeleteUser(ctx, uid)
+	c.log(c.cache.Del(ctx, uid))
+	return err
+}
+
+func (c *cachedUserDao) UpdatePassword(ctx context.Context, uid int64, hash string) error {
+	err := c.UserI.UpdatePassword(ctx, uid, hash)
+	c.log(c.cache.Del(ctx, uid))
+	return err
+}
+
+func (c *cachedUserDao) log(err error) {
+	if err != nil {
+		c.logger.Sugar().Warnf("更新用户缓存失败, 错误原因: %s", err)
+	}
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+)
+
+const (
+	defaultUserExpire     = 30 * time.Minute
+	defaultNegativeExpire = time.Minute
+	// 过期时间随机增加的比例上限, 避免同一时间写入的缓存同时失效
+	expireJitter = 0.1
+)
+
+// missing 空值缓存的占位, 表示数据库中不存在该用户
+const missing = "-"
+
+// UserCache 按id缓存用户, 邮箱只缓存到id的映射, 失效时只需要删除id对应的缓存.
+// 邮箱使用盲索引, 缓存键和失效广播中不出现邮箱明文
+type UserCache interface {
+	// Get 返回ErrKeyNotExist表示未缓存, dao.ErrRecordNotFound表示命中空值缓存
+	Get(ctx context.Context, uid int64) (dao.User, error)
+	Set(ctx context.Context, user dao.User) error
+	SetMissing(ctx context.Context, uid int64) error
+	Del(ctx context.Context, uid int64) error
+
+	// GetId 返回邮箱盲索引对应的用户id, 语义与Get相同
+	GetId(ctx context.Context, index string) (int64, error)
+	SetId(ctx context.Context, index string, uid int64) error
+	SetEmailMissing(ctx context.Context, index string) error
+	DelEmail(ctx context.Context, index string) error
+}
+
+var _ UserCache = &userCache{}
+
+type userCache struct {
+	client         redis.Cmdable
+	pii            pii.Cipher
+	expiration     time.Duration
+	negativeExpire time.Duration
+}
+
+func NewUserCache(client redis.Cmdable, cfg config.UserCacheConfig, c pii.Cipher) UserCache {
+	uc := &userCache{
+		client:         client,
+		pii:            c,
+		expiration:     time.Duration(cfg.Expire) * time.Second,
+		negativeExpire: time.Duration(cfg.NegativeExpire) * time.Second,
+	}
+	if uc.expiration <= 0 {
+		uc.expiration = defaultUserExpire
+	}
+	if uc.negativeExpire <= 0 {
+		uc.negativeExpire = defaultNegativeExpire
+	}
+	return uc
+}
+
+// cachedUser 写入redis的用户, 不带密码哈希, 邮箱、地址、生日与分表中一样加密保存
+type cachedUser struct {
+	Id          int64  `json:"id"`
+	TenantId    string `json:"tenant_id,omitempty"`
+	Email       string `json:"email"`
+	NickName    string `json:"nick_name"`
+	Description string `json:"description"`
+	Avatar      string `json:"avatar"`
+	Address     string `json:"address"`
+	BirthDay    string `json:"birth_day,omitempty"`
+	CreateAt    int64  `json:"create_at"`
+	UpdateAt    int64  `json:"update_at"`
+	DeleteAt    int64  `json:"delete_at"`
+	Version     int64  `json:"version"`
+}
+
+// 之前的缓存键下保存的是带密码哈希的明文, 换用新的键, 旧的缓存等待过期
+func (u *userCache) key(ctx context.Context, uid int64) string {
+	return tenantKey(ctx, fmt.Sprintf("user:info:v2:id:%d", uid))
+}
+
+func (u *userCache) emailKey(ctx context.Context, index string) string {
+	return tenantKey(ctx, fmt.Sprintf("user:info:v2:email:%s", index))
+}
+
+func (u *userCache) Get(ctx context.Context, uid int64) (dao.User, error) {
+	val, err := u.client.Get(ctx, u.key(ctx, uid)).Bytes()
+	if err != nil {
+		return dao.User{}, err
+	}
+	if string(val) == missing {
+		return dao.User{}, dao.ErrRecordNotFound
+	}
+
+	var cu cachedUser
+	if err = json.Unmarshal(val, &cu); err != nil {
+		return dao.User{}, err
+	}
+	return u.open(ctx, cu)
+}
+
+func (u *userCache) Set(ctx context.Context, user dao.User) error {
+	cu, err := u.seal(ctx, user)
+	if err != nil {
+		return err
+	}
+	val, err := json.Marshal(cu)
+	if err != nil {
+		return err
+	}
+	return u.client.Set(ctx, u.key(ctx, user.Id), val, jitter(u.expiration)).Err()
+}
+
+func (u *userCache) SetMissing(ctx context.Context, uid int64) error {
+	return u.client.Set(ctx, u.key(ctx, uid), missing, jitter(u.negativeExpire)).Err()
+}
+
+func (u *userCache) Del(ctx context.Context, uid int64) error {
+	return u.client.Del(ctx, u.key(ctx, uid)).Err()
+}
+
+func (u *userCache) GetId(ctx context.Context, index string) (int64, error) {
+	val, err := u.client.Get(ctx, u.emailKey(ctx, index)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if val == missing {
+		return 0, dao.ErrRecordNotFound
+	}
+
+	return strconv.ParseInt(val, 10, 64)
+}
+
+func (u *userCache) SetId(ctx context.Context, index string, uid int64) error {
+	return u.client.Set(ctx, u.emailKey(ctx, index), uid, jitter(u.expiration)).Err()
+}
+
+func (u *userCache) SetEmailMissing(ctx context.Context, index string) error {
+	return u.client.Set(ctx, u.emailKey(ctx, index), missing, jitter(u.negativeExpire)).Err()
+}
+
+func (u *userCache) DelEmail(ctx context.Context, index string) error {
+	return u.client.Del(ctx, u.emailKey(ctx, index)).Err()
+}
+
+func (u *userCache) seal(ctx context.Context, user dao.User) (cachedUser, error) {
+	cu := cachedUser{
+		Id:          user.Id,
+		TenantId:    user.TenantId,
+		NickName:    user.NickName,
+		Description: user.Description,
+		Avatar:      user.Avatar,
+		CreateAt:    user.CreateAt,
+		UpdateAt:    user.UpdateAt,
+		DeleteAt:    user.DeleteAt,
+		Version:     user.Version,
+	}
+	var err error
+	if cu.Email, err = u.pii.Encrypt(ctx, user.Email, pii.Field(user.Id, "email")); err != nil {
+		return cachedUser{}, err
+	}
+	if cu.Address, err = u.pii.Encrypt(ctx, user.Address, pii.Field(user.Id, "address")); err != nil {
+		return cachedUser{}, err
+	}
+	if user.BirthDay != 0 {
+		birthDay := strconv.FormatInt(user.BirthDay, 10)
+		if cu.BirthDay, err = u.pii.Encrypt(ctx, birthDay, pii.Field(user.Id, "birth_day")); err != nil {
+			return cachedUser{}, err
+		}
+	}
+	return cu, nil
+}
+
+func (u *userCache) open(ctx context.Context, cu cachedUser) (dao.User, error) {
+	user := dao.User{
+		Id:          cu.Id,
+		TenantId:    cu.TenantId,
+		NickName:    cu.NickName,
+		Description: cu.Description,
+		Avatar:      cu.Avatar,
+		CreateAt:    cu.CreateAt,
+		UpdateAt:    cu.UpdateAt,
+		DeleteAt:    cu.DeleteAt,
+		Version:     cu.Version,
+	}
+	var err error
+	if user.Email, err = u.pii.Decrypt(ctx, cu.Email, pii.Field(cu.Id, "email")); err != nil {
+		return dao.User{}, err
+	}
+	if user.Address, err = u.pii.Decrypt(ctx, cu.Address, pii.Field(cu.Id, "address")); err != nil {
+		return dao.User{}, err
+	}
+	if cu.BirthDay != "" {
+		birthDay, err := u.pii.Decrypt(ctx, cu.BirthDay, pii.Field(cu.Id, "birth_day"))
+		if err != nil {
+			return dao.User{}, err
+		}
+		if user.BirthDay, err = strconv.ParseInt(birthDay, 10, 64); err != nil {
+			return dao.User{}, err
+		}
+	}
+	return user, nil
+}
+
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration(rand.Int63n(int64(float64(d)*expireJitter)+1))
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/dao"
+)
+
+var alice = dao.User{
+	Id:       370579190170259480,
+	TenantId: "default",
+	Email:    "alice@ex.com",
+	Password: "$argon2id$v=19$m=65536,t=3,p=2$secret-hash",
+	NickName: "alice",
+	Address:  "secret street",
+	BirthDay: 946684800000,
+	Version:  3,
+}
+
+// redis中的用户不带密码哈希, 邮箱、地址和生日加密保存
+func TestUserCacheSealsPii(t *testing.T) {
+	rdb := newMemRedis()
+	c := NewUserCache(rdb, config.UserCacheConfig{}, newTestCipher())
+	ctx := context.Background()
+
+	if err := c.Set(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{alice.Email, alice.Address, "946684800000", "secret-hash"} {
+		if rdb.contains(secret) {
+			t.Fatalf("redis中包含明文%q", secret)
+		}
+	}
+
+	got, err := c.Get(ctx, alice.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := alice
+	want.Password = ""
+	if got != want {
+		t.Fatalf("缓存读出%+v, 期望%+v", got, want)
+	}
+}
+
+// 按邮箱查找时缓存键使用盲索引, 返回的用户不带密码哈希, 密码通过FindPassword查库
+func TestCachedUserDaoEmailIndex(t *testing.T) {
+	rdb := newMemRedis()
+	cipher := newTestCipher()
+	d := NewCachedUserDao(&memUserDao{users: map[int64]dao.User{alice.Id: alice}},
+		NewUserCache(rdb, config.UserCacheConfig{}, cipher), cipher, newTestLogger())
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		ue, err := d.FindUserByEmail(ctx, alice.Email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ue.Id != alice.Id || ue.Password != "" {
+			t.Fatalf("第%d次查找返回%+v", i+1, ue)
+		}
+	}
+	if _, err := d.FindUserByEmail(ctx, "nobody@ex.com"); err != dao.ErrRecordNotFound {
+		t.Fatalf("不存在的邮箱应返回ErrRecordNotFound, 实际: %v", err)
+	}
+	if rdb.contains("alice@") || rdb.contains("nobody@") {
+		t.Fatal("redis中包含邮箱明文")
+	}
+	if len(rdb.data) != 3 {
+		t.Fatalf("redis中有%d个键, 期望3", len(rdb.data))
+	}
+
+	hash, err := d.FindPassword(ctx, alice.Id)
+	if err != nil || hash != alice.Password {
+		t.Fatalf("FindPassword返回%q, %v", hash, err)
+	}
+}
@@ -2,28 +2,43 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/consul/api"
+	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"gorm.io/gorm"
 
+	"github.com/Numsina/tk_users/user_srv/cache"
 	"github.com/Numsina/tk_users/user_srv/config"
 	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/gateway"
 	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+	usersv2 "github.com/Numsina/tk_users/user_srv/gen/users/v2"
 	"github.com/Numsina/tk_users/user_srv/handler"
 	"github.com/Numsina/tk_users/user_srv/initiallize"
 	"github.com/Numsina/tk_users/user_srv/initiallize/tracing"
 	logger "github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/broker"
+	"github.com/Numsina/tk_users/user_srv/pkg/eventbus"
+	"github.com/Numsina/tk_users/user_srv/pkg/idgen"
+	"github.com/Numsina/tk_users/user_srv/pkg/interceptor"
+	"github.com/Numsina/tk_users/user_srv/pkg/mailer"
+	"github.com/Numsina/tk_users/user_srv/pkg/password"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
 	"github.com/Numsina/tk_users/user_srv/service"
 	"github.com/Numsina/tk_users/user_srv/tools"
 )
@@ -35,13 +50,33 @@ var (
 
 type App struct {
 	db         *gorm.DB
+	rdb        redis.UniversalClient
 	logger     *logger.Logger
 	conf       *config.Config
 	instanceId string
 	client     *api.Client
+	bus        *eventbus.Bus
+	lease      *idgen.Lease
 }
 
 func Execte() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reshard" {
+		runReshard(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		runExport(os.Args[2:])
+		return
+	}
+
 	app := new(App)
 	app.Init()
 	app.register()
@@ -49,9 +84,20 @@ func Execte() {
 }
 
 func (a *App) register() {
-	web := a.ioc()
-	server := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
-	users.RegisterUserServiceServer(server, web)
+	chain := interceptor.NewBuilder(a.conf.Interceptor, a.logger).Validators(handler.Validators)
+	if len(a.conf.Tenants) > 0 {
+		ids := make([]string, 0, len(a.conf.Tenants))
+		for _, t := range a.conf.Tenants {
+			ids = append(ids, t.Id)
+		}
+		chain.Tenants(ids...)
+	}
+	server := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(chain.Unary()),
+		grpc.ChainStreamInterceptor(chain.Stream()),
+	)
+	a.ioc(server)
 
 	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", IP, Port))
 	if err != nil {
@@ -80,17 +126,67 @@ func (a *App) register() {
 		}
 	}()
 
+	gw := a.startGateway(ctx)
 	a.startConsul()
 
 	// 优雅退出
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	defer close(quit)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP)
 	<-quit
 	a.stopConsul()
+	if gw != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		gw.Shutdown(shutdownCtx)
+		cancel()
+	}
+	a.bus.Close()
+	if a.lease != nil {
+		a.lease.Release(context.Background())
+	}
 	a.logger.Info("服务注销成功")
 }
 
+// startGateway 开启时在gateway.host:gateway.port上提供HTTP/JSON接口, 请求转发到本实例的grpc端口
+func (a *App) startGateway(ctx context.Context) *http.Server {
+	if !a.conf.Gateway.Enabled {
+		return nil
+	}
+	h, err := gateway.New(ctx, grpcEndpoint(IP, Port))
+	if err != nil {
+		panic(err)
+	}
+	srv := &http.Server{
+		Addr:    gatewayAddr(a.conf.Gateway),
+		Handler: h,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(err)
+		}
+	}()
+	a.logger.Sugar().Infof("HTTP网关启动成功, 地址: %s", srv.Addr)
+	return srv
+}
+
+// gatewayAddr 网关没有鉴权, 未配置host时只监听本机回环地址
+func gatewayAddr(cfg config.GatewayConfig) string {
+	host := cfg.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+}
+
+// grpcEndpoint 网关连接grpc服务的地址, grpc监听所有地址时连接本机回环地址
+func grpcEndpoint(ip string, port int) string {
+	switch ip {
+	case "", "0.0.0.0", "::":
+		ip = "127.0.0.1"
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
 func (a *App) Init() {
 	flag.StringVar(&IP, "IP", "0.0.0.0", "IP地址")
 	flag.IntVar(&Port, "Port", 0, "应用启动端口")
@@ -105,16 +201,179 @@ func (a *App) Init() {
 	a.logger = initiallize.InitLogger()
 	a.conf = initiallize.InitConfig()
 	a.db = initiallize.InitDB()
+	a.rdb = initiallize.InitRedis()
+	initiallize.InitPrometheus()
 }
 
-func (a *App) ioc() *handler.UserHandler {
-	err := dao.InitAutoMigrateTable(a.db)
+// migrate 启动时执行未应用的迁移, 多个副本同时启动时由迁移锁保证只执行一次
+func (a *App) migrate() {
+	mdb, err := initiallize.InitMigrateDB()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if sqlDB, err := mdb.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	migrator, err := dao.NewMigrator(mdb, a.logger)
 	if err != nil {
 		panic(err)
 	}
-	d := dao.NewUserDao(a.db, a.logger)
-	srv := service.NewUserSvc(d, a.logger)
-	return handler.NewUserHandler(srv)
+	if err = migrator.Up(context.Background(), 0); err != nil {
+		a.logger.Sugar().Panicf("数据库迁移失败, 失败原因: %v", err)
+	}
+}
+
+func (a *App) ioc(server *grpc.Server) {
+	a.migrate()
+	breach, err := password.NewBreachChecker(a.conf.PasswordBreach)
+	if err != nil {
+		a.logger.Sugar().Panicf("加载泄露密码库失败, 失败原因: %v", err)
+	}
+	pc := cache.NewPreferenceCache(a.rdb)
+
+	// 用户事件的内置订阅者
+	a.bus = eventbus.New(a.logger)
+	service.SubscribeWelcomeMail(a.bus, mailer.NewMailer(a.conf.Mail, a.logger))
+	service.SubscribeAudit(a.bus, dao.NewAuditDao(a.db, a.logger))
+	service.SubscribePreferenceInvalidation(a.bus, pc)
+
+	sharding := a.sharding()
+	cipher, err := pii.New(a.conf.Pii)
+	if err != nil {
+		a.logger.Sugar().Panicf("初始化敏感字段加密失败, 失败原因: %v", err)
+	}
+	ud := dao.NewUserDao(sharding, a.idGenerator(), cipher, a.logger)
+	d := cache.NewCachedUserDao(ud, a.userCache(cipher), cipher, a.logger)
+	srv := service.NewUserSvc(d, password.NewPolicies(a.conf.PasswordPolicy, a.conf.Tenants),
+		password.NewHasher(a.conf.PasswordHash), breach, a.bus, a.logger)
+	search := a.userSearch(ud, sharding)
+	users.RegisterUserServiceServer(server, handler.NewUserHandler(srv, search))
+	usersv2.RegisterUserServiceServer(server, handler.NewUserV2Handler(srv, search))
+
+	pd := dao.NewPreferenceDao(a.db, a.logger)
+	psrv := service.NewPreferenceSvc(pd, pc, a.logger)
+	users.RegisterPreferenceServiceServer(server, handler.NewPreferenceHandler(psrv))
+
+	ptsrv := service.NewPointsSvc(dao.NewPointsDao(a.db, d, a.logger), a.logger)
+	users.RegisterPointsServiceServer(server, handler.NewPointsHandler(ptsrv))
+	go a.expirePoints(ptsrv)
+	a.relayEvents(sharding)
+	if a.conf.Pii.KeyProvider != "" {
+		go a.rotatePii(dao.NewPiiRotator(sharding, cipher, a.conf.Pii.RotateBatch, a.logger))
+	}
+}
+
+// userSearch 开启用户搜索时在后台构建索引, 构建完成之前搜索返回Unavailable
+func (a *App) userSearch(d dao.UserI, s *dao.Sharding) service.UserSearch {
+	if !a.conf.Search.Enabled {
+		return nil
+	}
+
+	var outboxes []dao.OutboxI
+	for _, db := range s.DBs() {
+		outboxes = append(outboxes, dao.NewOutboxDao(db, a.logger))
+	}
+	us := service.NewUserSearch(d, outboxes, a.conf.Search, a.logger)
+	go us.Run(context.Background())
+	return us
+}
+
+// rotatePii 启动时和之后每隔rotate_interval分钟重新加密明文和旧密钥加密的数据
+func (a *App) rotatePii(r *dao.PiiRotator) {
+	interval := time.Duration(a.conf.Pii.RotateInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	for {
+		n, err := r.Rotate(context.Background())
+		if err != nil {
+			a.logger.Sugar().Warnf("重新加密用户信息失败, 失败原因: %v", err)
+		}
+		if n > 0 {
+			a.logger.Sugar().Infof("重新加密用户信息, 行数: %d", n)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// relayEvents 配置了消息队列时投递各个库outbox中的用户事件
+func (a *App) relayEvents(s *dao.Sharding) {
+	if a.conf.Broker.Type == "" {
+		return
+	}
+
+	b, err := broker.NewBroker(a.conf.Broker)
+	if err != nil {
+		a.logger.Sugar().Panicf("初始化消息队列失败, 失败原因: %v", err)
+	}
+	var outboxes []dao.OutboxI
+	for _, db := range s.DBs() {
+		outboxes = append(outboxes, dao.NewOutboxDao(db, a.logger))
+	}
+	go service.NewOutboxRelay(outboxes, b, a.conf.Outbox, a.logger).Run(context.Background())
+}
+
+// sharding 按配置构建用户分表, 并创建缺少的分表
+func (a *App) sharding() *dao.Sharding {
+	cfg := a.conf.Sharding
+	s := dao.NewSharding(initiallize.InitShardDBs(), cfg.Tables, cfg.NextTables)
+	if err := s.EnsureTables(context.Background()); err != nil {
+		a.logger.Sugar().Panicf("创建用户分表失败, 失败原因: %v", err)
+	}
+	return s
+}
+
+// idGenerator 配置了worker_id时直接使用, 否则从redis中租用一个
+func (a *App) idGenerator() idgen.Generator {
+	cfg := a.conf.IdGenerator
+	if cfg.WorkerId > 0 {
+		g, err := idgen.NewSnowflake(int64(cfg.WorkerId))
+		if err != nil {
+			a.logger.Sugar().Panicf("初始化用户id生成器失败, 失败原因: %v", err)
+		}
+		return g
+	}
+
+	ttl := time.Duration(cfg.LeaseTTL) * time.Second
+	if ttl <= 0 {
+		ttl = time.Second * 30
+	}
+	lease, err := idgen.AcquireWorker(context.Background(), a.rdb, "user:idgen:worker", ttl, a.logger)
+	if err != nil {
+		a.logger.Sugar().Panicf("租用worker id失败, 失败原因: %v", err)
+	}
+	a.lease = lease
+	a.logger.Sugar().Infof("租用worker id成功, worker: %d", lease.Id)
+	return idgen.NewLeasedSnowflake(lease)
+}
+
+// userCache 配置了本地缓存大小时使用本地LRU+redis两级缓存
+func (a *App) userCache(c pii.Cipher) cache.UserCache {
+	uc := cache.NewUserCache(a.rdb, a.conf.UserCache, c)
+	if a.conf.UserCache.LocalSize <= 0 {
+		return uc
+	}
+
+	uc, err := cache.NewTwoLevelUserCache(uc, a.rdb, a.conf.UserCache.LocalSize,
+		time.Duration(a.conf.UserCache.LocalExpire)*time.Second, a.logger)
+	if err != nil {
+		a.logger.Sugar().Panicf("初始化本地用户缓存失败, 失败原因: %v", err)
+	}
+	return uc
+}
+
+// expirePoints 定期清理过期的积分批次, 查询和扣减时也会按用户顺带清理
+func (a *App) expirePoints(srv service.PointsService) {
+	ticker := time.NewTicker(time.Minute * 10)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := srv.ExpireDue(context.Background()); err != nil {
+			a.logger.Sugar().Warnf("清理过期积分失败, 失败原因: %v", err)
+		}
+	}
 }
 
 func (a *App) startConsul() {
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+func TestGrpcEndpoint(t *testing.T) {
+	cases := []struct {
+		ip   string
+		want string
+	}{
+		{"", "127.0.0.1:8080"},
+		{"0.0.0.0", "127.0.0.1:8080"},
+		{"::", "127.0.0.1:8080"},
+		{"10.0.0.5", "10.0.0.5:8080"},
+		{"127.0.0.1", "127.0.0.1:8080"},
+		{"fd00::5", "[fd00::5]:8080"},
+	}
+	for _, c := range cases {
+		if got := grpcEndpoint(c.ip, 8080); got != c.want {
+			t.Errorf("grpcEndpoint(%q) = %q, 期望%q", c.ip, got, c.want)
+		}
+	}
+}
+
+func TestGatewayAddr(t *testing.T) {
+	cases := []struct {
+		host string
+		want string
+	}{
+		{"", "127.0.0.1:8090"},
+		{"0.0.0.0", "0.0.0.0:8090"},
+		{"fd00::5", "[fd00::5]:8090"},
+	}
+	for _, c := range cases {
+		if got := gatewayAddr(config.GatewayConfig{Host: c.host, Port: 8090}); got != c.want {
+			t.Errorf("gatewayAddr(%q) = %q, 期望%q", c.host, got, c.want)
+		}
+	}
+}
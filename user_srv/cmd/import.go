@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Numsina/tk_users/user_srv/cache"
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	"github.com/Numsina/tk_users/user_srv/initiallize"
+	"github.com/Numsina/tk_users/user_srv/pkg/idgen"
+	"github.com/Numsina/tk_users/user_srv/pkg/password"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+	"github.com/Numsina/tk_users/user_srv/service"
+)
+
+const importUsage = `用法:
+  user_srv import [选项] 文件    从csv或jsonl文件批量导入用户
+  user_srv export [选项] 文件    把所有用户导出到csv或jsonl文件, 文件为-时输出到标准输出
+
+文件的列: email, password, password_hash, nick_name, description, avatar, address, birth_day.
+password和password_hash二选一, 明文密码按注册的规则校验后哈希, 已有的bcrypt或argon2id哈希原样保存.
+导入失败的行写到错误报告中, 修复后可以直接重新导入; 中途退出时用-from从提示的行继续`
+
+// importArgs import子命令的参数
+type importArgs struct {
+	path       string
+	format     string
+	batch      int
+	reportPath string
+	from       int
+	tenantId   string
+	opts       service.ImportOptions
+}
+
+// runImport 批量导入用户子命令
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), importUsage)
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "", "文件格式csv或jsonl, 默认按扩展名判断")
+	batch := flags.Int("batch", 500, "每批导入的行数")
+	onDuplicate := flags.String("on-duplicate", service.DuplicateSkip, "邮箱已存在时的处理方式: skip, update(不修改邮箱和密码), fail")
+	dryRun := flags.Bool("dry-run", false, "只校验和检查重复, 不写入")
+	reportPath := flags.String("report", "", "错误报告文件, 默认为<文件名>.errors.<扩展名>")
+	from := flags.Int("from", 0, "从第几行开始导入, 用于中断后继续")
+	tenantId := flags.String("tenant", tenant.Default, "导入到哪个租户")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *onDuplicate != service.DuplicateSkip && *onDuplicate != service.DuplicateUpdate && *onDuplicate != service.DuplicateFail {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *batch <= 0 {
+		*batch = 500
+	}
+
+	l := initiallize.InitLogger()
+	// importUsers返回之前已经释放worker id的租约和关闭文件, 这里可以直接退出
+	failed, err := importUsers(importArgs{
+		path:       flags.Arg(0),
+		format:     *format,
+		batch:      *batch,
+		reportPath: *reportPath,
+		from:       *from,
+		tenantId:   *tenantId,
+		opts:       service.ImportOptions{OnDuplicate: *onDuplicate, DryRun: *dryRun},
+	})
+	if err != nil {
+		l.Sugar().Fatal(err)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// importUsers 导入文件中的用户, 返回失败的行数
+func importUsers(args importArgs) (int, error) {
+	f, err := recordFormat(args.format, args.path)
+	if err != nil {
+		return 0, fmt.Errorf("导入用户失败, 失败原因: %w", err)
+	}
+	in, err := os.Open(args.path)
+	if err != nil {
+		return 0, fmt.Errorf("打开导入文件失败, 失败原因: %w", err)
+	}
+	defer in.Close()
+	reader, err := newRecordReader(f, in)
+	if err != nil {
+		return 0, fmt.Errorf("读取导入文件失败, 失败原因: %w", err)
+	}
+
+	reportPath := args.reportPath
+	if reportPath == "" {
+		ext := filepath.Ext(args.path)
+		reportPath = strings.TrimSuffix(args.path, ext) + ".errors" + ext
+	}
+	out, err := os.Create(reportPath)
+	if err != nil {
+		return 0, fmt.Errorf("创建错误报告失败, 失败原因: %w", err)
+	}
+	defer out.Close()
+	report, err := newRecordWriter(f, out, true)
+	if err != nil {
+		return 0, fmt.Errorf("写入错误报告失败, 失败原因: %w", err)
+	}
+
+	a := newToolApp()
+	breach, err := password.NewBreachChecker(a.conf.PasswordBreach)
+	if err != nil {
+		return 0, fmt.Errorf("加载泄露密码库失败, 失败原因: %w", err)
+	}
+	ctx := a.tenantContext(args.tenantId)
+	var ids idgen.Generator
+	if !args.opts.DryRun {
+		ids = a.idGenerator()
+		if a.lease != nil {
+			defer a.lease.Release(context.Background())
+		}
+	}
+	importer := service.NewUserImporter(a.userDao(ids), password.NewPolicies(a.conf.PasswordPolicy, a.conf.Tenants),
+		password.NewHasher(a.conf.PasswordHash), breach, a.logger)
+
+	counts := make(map[string]int)
+	var records []domain.UserRecord
+	var lines []int
+
+	// flush 导入一批并把失败的行写到错误报告, 返回中止的行号
+	flush := func() (int, error) {
+		if len(records) == 0 {
+			return 0, nil
+		}
+		results, err := importer.Import(ctx, records, args.opts)
+		if err != nil && !errors.Is(err, service.ErrImportDuplicate) {
+			return 0, fmt.Errorf("导入用户失败, 失败原因: %w, 修复后使用 -from %d 继续", err, lines[0])
+		}
+
+		abortAt := 0
+		for n, res := range results {
+			if res.Status == "" {
+				continue
+			}
+			counts[res.Status]++
+			if res.Status != service.ImportFailed {
+				continue
+			}
+			if errors.Is(res.Err, service.ErrImportDuplicate) && err != nil {
+				abortAt = lines[n]
+			}
+			if werr := report.Write(records[n], lines[n], res.Err.Error()); werr != nil {
+				return 0, fmt.Errorf("写入错误报告失败, 失败原因: %w", werr)
+			}
+		}
+		if abortAt == 0 {
+			fmt.Printf("已处理到第%d行, 新建: %d, 更新: %d, 跳过: %d, 失败: %d\n", lines[len(lines)-1],
+				counts[service.ImportCreated], counts[service.ImportUpdated], counts[service.ImportSkipped], counts[service.ImportFailed])
+		}
+		records, lines = records[:0], lines[:0]
+		return abortAt, nil
+	}
+	// abort 中止导入, 已经写入的失败行保留在错误报告中
+	abort := func(err error) (int, error) {
+		report.Flush()
+		return counts[service.ImportFailed], err
+	}
+
+	for {
+		r, line, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if line < args.from {
+			continue
+		}
+		if err != nil && line == 0 {
+			return abort(fmt.Errorf("读取导入文件失败, 失败原因: %w", err))
+		}
+		if err != nil {
+			counts[service.ImportFailed]++
+			if werr := report.Write(r, line, err.Error()); werr != nil {
+				return abort(fmt.Errorf("写入错误报告失败, 失败原因: %w", werr))
+			}
+			continue
+		}
+
+		records = append(records, r)
+		lines = append(lines, line)
+		if len(records) < args.batch {
+			continue
+		}
+		at, err := flush()
+		if err != nil {
+			return abort(err)
+		}
+		if at > 0 {
+			return abort(fmt.Errorf("第%d行的邮箱已存在, 导入中止, 修复后使用 -from %d 继续, 错误报告: %s", at, at, reportPath))
+		}
+	}
+	at, err := flush()
+	if err != nil {
+		return abort(err)
+	}
+	if at > 0 {
+		return abort(fmt.Errorf("第%d行的邮箱已存在, 导入中止, 修复后使用 -from %d 继续, 错误报告: %s", at, at, reportPath))
+	}
+	if err = report.Flush(); err != nil {
+		return counts[service.ImportFailed], fmt.Errorf("写入错误报告失败, 失败原因: %w", err)
+	}
+
+	prefix := "导入完成"
+	if args.opts.DryRun {
+		prefix = "校验完成(dry-run, 未写入)"
+	}
+	fmt.Printf("%s, 新建: %d, 更新: %d, 跳过: %d, 失败: %d, 错误报告: %s\n", prefix,
+		counts[service.ImportCreated], counts[service.ImportUpdated], counts[service.ImportSkipped],
+		counts[service.ImportFailed], reportPath)
+	return counts[service.ImportFailed], nil
+}
+
+// runExport 导出用户子命令, 默认不导出密码哈希
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), importUsage)
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "", "文件格式csv或jsonl, 默认按扩展名判断")
+	batch := flags.Int("batch", 500, "每批读取的行数")
+	hashes := flags.Bool("hashes", false, "导出密码哈希, 用于迁移到其他环境")
+	tenantId := flags.String("tenant", tenant.Default, "导出哪个租户的用户")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	path := flags.Arg(0)
+	l := initiallize.InitLogger()
+	f, err := recordFormat(*format, path)
+	if err != nil {
+		l.Sugar().Fatalf("导出用户失败, 失败原因: %v", err)
+	}
+	out := os.Stdout
+	if path != "-" {
+		if out, err = os.Create(path); err != nil {
+			l.Sugar().Fatalf("创建导出文件失败, 失败原因: %v", err)
+		}
+		defer out.Close()
+	}
+	w, err := newRecordWriter(f, out, false)
+	if err != nil {
+		l.Sugar().Fatalf("写入导出文件失败, 失败原因: %v", err)
+	}
+
+	a := newToolApp()
+	importer := service.NewUserImporter(a.userDao(nil), nil, nil, nil, a.logger)
+	var total int
+	err = importer.Export(a.tenantContext(*tenantId), *batch, *hashes, func(records []domain.UserRecord) error {
+		for _, r := range records {
+			if err := w.Write(r, 0, ""); err != nil {
+				return err
+			}
+		}
+		total += len(records)
+		return nil
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		l.Sugar().Fatalf("导出用户失败, 已导出: %d, 失败原因: %v", total, err)
+	}
+	fmt.Fprintf(os.Stderr, "导出完成, 共导出%d个用户\n", total)
+}
+
+// newToolApp 子命令只需要配置、redis和用户分表
+func newToolApp() *App {
+	return &App{
+		logger: initiallize.InitLogger(),
+		conf:   initiallize.InitConfig(),
+		rdb:    initiallize.InitRedis(),
+	}
+}
+
+// tenantContext 子命令操作的租户, 只接受配置中的租户和默认租户
+func (a *App) tenantContext(id string) context.Context {
+	id = tenant.Normalize(id)
+	if id != tenant.Default && !slices.ContainsFunc(a.conf.Tenants, func(t config.TenantConfig) bool {
+		return tenant.Normalize(t.Id) == id
+	}) {
+		a.logger.Sugar().Fatalf("未知的租户: %s", id)
+	}
+	return tenant.WithTenant(context.Background(), id)
+}
+
+// userDao 与服务使用相同的加密和缓存, 写入后清理缓存中的旧数据.
+// 调用时可能已经租用了worker id, 出错时panic, 让调用方延迟的释放租约仍然执行
+func (a *App) userDao(ids idgen.Generator) dao.UserI {
+	cipher, err := pii.New(a.conf.Pii)
+	if err != nil {
+		a.logger.Sugar().Panicf("初始化敏感字段加密失败, 失败原因: %v", err)
+	}
+	return cache.NewCachedUserDao(dao.NewUserDao(a.sharding(), ids, cipher, a.logger), a.userCache(cipher), cipher, a.logger)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/initiallize"
+	"github.com/Numsina/tk_users/user_srv/pkg/migrate"
+)
+
+const migrateUsage = `用法:
+  user_srv migrate up [-n 步数]            执行未执行的迁移, 默认全部
+  user_srv migrate down [-n 步数]          回滚最近的迁移, 默认一个版本
+  user_srv migrate status                  查看迁移状态
+  user_srv migrate create [-dir 目录] 名称  为每种数据库创建新的迁移文件`
+
+// runMigrate 数据库迁移子命令
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	steps := flags.Int("n", 0, "迁移的版本数")
+	dir := flags.String("dir", "dao/migrations", "迁移文件目录")
+	flags.Parse(args[1:])
+
+	if args[0] == "create" {
+		if flags.NArg() != 1 {
+			fmt.Println(migrateUsage)
+			os.Exit(2)
+		}
+		files, err := migrate.Create(*dir, dao.MigrationDialects, flags.Arg(0))
+		if err != nil {
+			fmt.Printf("创建迁移文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		for _, file := range files {
+			fmt.Println(file)
+		}
+		return
+	}
+
+	l := initiallize.InitLogger()
+	initiallize.InitConfig()
+	mdb, err := initiallize.InitMigrateDB()
+	if err != nil {
+		l.Sugar().Fatalf("连接数据库失败, 失败原因: %v", err)
+	}
+	migrator, err := dao.NewMigrator(mdb, l)
+	if err != nil {
+		l.Sugar().Fatalf("加载迁移文件失败, 失败原因: %v", err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx, *steps)
+	case "down":
+		err = migrator.Down(ctx, *steps)
+	case "status":
+		err = printStatus(ctx, migrator)
+	default:
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		l.Sugar().Fatalf("数据库迁移失败, 失败原因: %v", err)
+	}
+}
+
+func printStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	res, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range res {
+		state, at := "未执行", ""
+		switch {
+		case s.Dirty:
+			state = "执行失败"
+		case s.Applied:
+			state = "已执行"
+		}
+		if s.AppliedAt > 0 {
+			at = time.UnixMilli(s.AppliedAt).Format(time.DateTime)
+		}
+		fmt.Printf("%06d  %-32s  %-6s  %s\n", s.Version, s.Name, state, at)
+	}
+	return nil
+}
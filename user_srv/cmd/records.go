@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+)
+
+// 导入导出文件的列, 错误报告在前面加上行号和错误原因, 修复后可以直接重新导入
+var recordColumns = []string{"email", "password", "password_hash", "nick_name", "description", "avatar", "address", "birth_day"}
+
+// recordFormat 未指定格式时按文件扩展名判断, 默认csv
+func recordFormat(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jsonl", ".ndjson", ".json":
+			format = "jsonl"
+		default:
+			format = "csv"
+		}
+	}
+	if format != "csv" && format != "jsonl" {
+		return "", fmt.Errorf("不支持的文件格式: %s", format)
+	}
+	return format, nil
+}
+
+type recordReader interface {
+	// Read 返回下一条记录和它在文件中的行号, 读完时返回io.EOF
+	Read() (domain.UserRecord, int, error)
+}
+
+func newRecordReader(format string, r io.Reader) (recordReader, error) {
+	if format == "jsonl" {
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 64*1024), 1024*1024)
+		return &jsonlReader{s: s}, nil
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取表头失败: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for n, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = n
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("表头中缺少email列")
+	}
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func (c *csvReader) Read() (domain.UserRecord, int, error) {
+	row, err := c.r.Read()
+	var pe *csv.ParseError
+	if errors.As(err, &pe) {
+		return domain.UserRecord{}, pe.StartLine, err
+	}
+	if err != nil {
+		return domain.UserRecord{}, 0, err
+	}
+	line, _ := c.r.FieldPos(0)
+
+	get := func(name string) string {
+		n, ok := c.columns[name]
+		if !ok || n >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[n])
+	}
+	r := domain.UserRecord{
+		Email:        get("email"),
+		Password:     get("password"),
+		PasswordHash: get("password_hash"),
+		NickName:     get("nick_name"),
+		Description:  get("description"),
+		Avatar:       get("avatar"),
+		Address:      get("address"),
+	}
+	if v := get("birth_day"); v != "" {
+		if r.BirthDay, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return r, line, fmt.Errorf("birth_day格式不正确: %s", v)
+		}
+	}
+	return r, line, nil
+}
+
+type jsonlReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func (j *jsonlReader) Read() (domain.UserRecord, int, error) {
+	for j.s.Scan() {
+		j.line++
+		text := strings.TrimSpace(j.s.Text())
+		if text == "" {
+			continue
+		}
+		var r domain.UserRecord
+		if err := json.Unmarshal([]byte(text), &r); err != nil {
+			return r, j.line, fmt.Errorf("json格式不正确: %w", err)
+		}
+		return r, j.line, nil
+	}
+	if err := j.s.Err(); err != nil {
+		return domain.UserRecord{}, j.line, err
+	}
+	return domain.UserRecord{}, j.line, io.EOF
+}
+
+// recordWriter report为true时写出错误报告, 每行带上原来的行号和错误原因
+type recordWriter struct {
+	format string
+	report bool
+	csv    *csv.Writer
+	json   *json.Encoder
+}
+
+func newRecordWriter(format string, w io.Writer, report bool) (*recordWriter, error) {
+	rw := &recordWriter{format: format, report: report}
+	if format == "jsonl" {
+		rw.json = json.NewEncoder(w)
+		rw.json.SetEscapeHTML(false)
+		return rw, nil
+	}
+
+	rw.csv = csv.NewWriter(w)
+	header := recordColumns
+	if report {
+		header = append([]string{"line", "error"}, recordColumns...)
+	}
+	if err := rw.csv.Write(header); err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+func (w *recordWriter) Write(r domain.UserRecord, line int, reason string) error {
+	if w.json != nil {
+		if !w.report {
+			return w.json.Encode(r)
+		}
+		return w.json.Encode(struct {
+			Line  int    `json:"line"`
+			Error string `json:"error"`
+			domain.UserRecord
+		}{line, reason, r})
+	}
+
+	row := []string{r.Email, r.Password, r.PasswordHash, r.NickName, r.Description, r.Avatar, r.Address, strconv.FormatInt(r.BirthDay, 10)}
+	if w.report {
+		row = append([]string{strconv.Itoa(line), reason}, row...)
+	}
+	return w.csv.Write(row)
+}
+
+func (w *recordWriter) Flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/initiallize"
+)
+
+const reshardUsage = `用法:
+  user_srv reshard copy [-batch 行数]    把存量用户复制到next_tables对应的新分表
+  user_srv reshard verify [-batch 行数]  校验并修复新旧分表之间不一致的行
+
+重新分表的步骤:
+  1. 在配置中设置sharding.next_tables, 等待所有实例生效后开始双写
+  2. 执行reshard copy, 再执行reshard verify直到修复行数为0
+  3. 把sharding.tables改为新的分表数并去掉next_tables, 旧分表确认无误后手动删除`
+
+// runReshard 在线重新分表子命令
+func runReshard(args []string) {
+	if len(args) == 0 {
+		fmt.Println(reshardUsage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("reshard "+args[0], flag.ExitOnError)
+	batch := flags.Int("batch", 500, "每批处理的行数")
+	flags.Parse(args[1:])
+
+	l := initiallize.InitLogger()
+	conf := initiallize.InitConfig()
+	s := dao.NewSharding(initiallize.InitShardDBs(), conf.Sharding.Tables, conf.Sharding.NextTables)
+	resharder, err := dao.NewResharder(s, *batch, l)
+	if err != nil {
+		l.Sugar().Fatalf("重新分表失败, 失败原因: %v", err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "copy":
+		if err = s.EnsureTables(ctx); err != nil {
+			l.Sugar().Fatalf("创建用户分表失败, 失败原因: %v", err)
+		}
+		n, err := resharder.Copy(ctx)
+		if err != nil {
+			l.Sugar().Fatalf("复制用户失败, 已复制: %d, 失败原因: %v", n, err)
+		}
+		fmt.Printf("复制完成, 共复制%d行\n", n)
+	case "verify":
+		n, err := resharder.Verify(ctx)
+		if err != nil {
+			l.Sugar().Fatalf("校验用户失败, 已修复: %d, 失败原因: %v", n, err)
+		}
+		fmt.Printf("校验完成, 共修复%d行\n", n)
+	default:
+		fmt.Println(reshardUsage)
+		os.Exit(2)
+	}
+}
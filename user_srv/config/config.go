@@ -1,11 +1,115 @@
 package config
 
+// ReplicaConfig 从库地址, 账号和库名与主库相同
+type ReplicaConfig struct {
+	Host string `mapstructure:"host" json:"host"`
+	Port int    `mapstructure:"port" json:"port"`
+}
+
+// MysqlConfig 数据库连接信息, 使用postgres时同样读取这里的配置.
+// 配置了从库时读请求按policy(random、round_robin、least_loaded)分配到从库,
+// 同一用户写入后sticky_window毫秒内的读请求仍走主库
 type MysqlConfig struct {
 	Host     string `mapstructure:"host" json:"host"`
 	Port     int    `mapstructure:"port" json:"port"`
 	UserName string `mapstructure:"username" json:"username"`
 	PassWord string `mapstructure:"password" json:"password"`
 	DBName   string `mapstructure:"dbname" json:"dbname"`
+
+	Replicas     []ReplicaConfig `mapstructure:"replicas" json:"replicas"`
+	Policy       string          `mapstructure:"policy" json:"policy"`
+	StickyWindow int             `mapstructure:"sticky_window" json:"sticky_window"`
+
+	MaxOpenConns    int `mapstructure:"max_open_conns" json:"max_open_conns"`
+	MaxIdleConns    int `mapstructure:"max_idle_conns" json:"max_idle_conns"`
+	ConnMaxLifetime int `mapstructure:"conn_max_lifetime" json:"conn_max_lifetime"`   // 单位秒
+	ConnMaxIdleTime int `mapstructure:"conn_max_idle_time" json:"conn_max_idle_time"` // 单位秒
+}
+
+// DatabaseConfig driver可选mysql、postgres、sqlite, 默认mysql; path为sqlite的数据库文件
+type DatabaseConfig struct {
+	Driver  string `mapstructure:"driver" json:"driver"`
+	SSLMode string `mapstructure:"ssl_mode" json:"ssl_mode"`
+	Path    string `mapstructure:"path" json:"path"`
+}
+
+// ShardingConfig 用户表按id分为tables张表, 分表按序号轮流放在主库和databases中.
+// 重新分表时先设置next_tables让所有实例双写, 再执行reshard命令搬迁存量数据,
+// 完成后把tables改为新的分表数并去掉next_tables
+type ShardingConfig struct {
+	Tables     int                   `mapstructure:"tables" json:"tables"`
+	NextTables int                   `mapstructure:"next_tables" json:"next_tables"`
+	Databases  []ShardDatabaseConfig `mapstructure:"databases" json:"databases"`
+}
+
+// ShardDatabaseConfig 存放分表的其他库, 账号和库名与主库相同
+type ShardDatabaseConfig struct {
+	Host string `mapstructure:"host" json:"host"`
+	Port int    `mapstructure:"port" json:"port"`
+}
+
+// BrokerConfig type可选kafka、memory, 为空时不投递领域事件, 事件保留在outbox中
+type BrokerConfig struct {
+	Type    string   `mapstructure:"type" json:"type"`
+	Brokers []string `mapstructure:"brokers" json:"brokers"`
+}
+
+// OutboxConfig 领域事件的投递, topic默认tk_users.user_events
+type OutboxConfig struct {
+	Topic     string `mapstructure:"topic" json:"topic"`
+	Interval  int    `mapstructure:"interval" json:"interval"`   // 轮询间隔, 单位毫秒
+	Batch     int    `mapstructure:"batch" json:"batch"`         // 每批投递的事件数
+	Retention int    `mapstructure:"retention" json:"retention"` // 已投递事件的保留时间, 单位小时
+}
+
+// IdGeneratorConfig 用户id的snowflake生成器, worker_id为0时从redis中租用一个空闲的worker id,
+// 大于0时使用固定的worker id, 需要保证各个实例不重复
+type IdGeneratorConfig struct {
+	WorkerId int `mapstructure:"worker_id" json:"worker_id"`
+	LeaseTTL int `mapstructure:"lease_ttl" json:"lease_ttl"` // 租约时间, 单位秒, 默认30
+}
+
+// PiiConfig 用户敏感字段的加密, key_provider可选file, 为空时不加密.
+// 后台每隔rotate_interval分钟把明文和旧密钥加密的数据用当前密钥重新加密
+type PiiConfig struct {
+	KeyProvider    string `mapstructure:"key_provider" json:"key_provider"`
+	KeyFile        string `mapstructure:"key_file" json:"key_file"`
+	RotateInterval int    `mapstructure:"rotate_interval" json:"rotate_interval"`
+	RotateBatch    int    `mapstructure:"rotate_batch" json:"rotate_batch"`
+}
+
+// SearchConfig 用户搜索, 每个实例在内存中建索引, 启动时从分表全量构建,
+// 之后跟随各库outbox中的用户事件更新, 每隔rebuild_interval小时全量重建一次, 为0时不重建
+type SearchConfig struct {
+	Enabled         bool `mapstructure:"enabled" json:"enabled"`
+	Interval        int  `mapstructure:"interval" json:"interval"` // 跟随outbox的轮询间隔, 单位毫秒
+	Batch           int  `mapstructure:"batch" json:"batch"`
+	RebuildInterval int  `mapstructure:"rebuild_interval" json:"rebuild_interval"`
+}
+
+// TenantConfig 一个租户, 请求通过grpc metadata中的x-tenant-id指定租户,
+// 没有配置的租户会被拒绝. password_policy为空时使用全局的密码策略
+type TenantConfig struct {
+	Id             string                `mapstructure:"id" json:"id"`
+	PasswordPolicy *PasswordPolicyConfig `mapstructure:"password_policy" json:"password_policy"`
+}
+
+// GatewayConfig user_srv内置的HTTP/JSON网关, 按proto中的http注解把请求转为对本机grpc端口的调用,
+// 和grpc请求经过相同的拦截器. /openapi.json返回生成的OpenAPI文档.
+// 网关本身不做鉴权, host为空时只监听127.0.0.1, 对外提供时需要在前面加上鉴权的代理
+type GatewayConfig struct {
+	Enabled bool   `mapstructure:"enabled" json:"enabled"`
+	Host    string `mapstructure:"host" json:"host"`
+	Port    int    `mapstructure:"port" json:"port"`
+}
+
+// MailConfig 发送通知邮件的smtp服务, host为空时只记录日志
+type MailConfig struct {
+	Host     string `mapstructure:"host" json:"host"`
+	Port     int    `mapstructure:"port" json:"port"`
+	Username string `mapstructure:"username" json:"username"`
+	Password string `mapstructure:"password" json:"password"`
+	From     string `mapstructure:"from" json:"from"`
 }
 
 type RedisConfig struct {
@@ -48,11 +152,79 @@ type JaegerConfig struct {
 	LogSpans bool    `mapstructure:"log_spans" json:"log_spans"`
 }
 
+// PasswordPolicyConfig 密码策略, 未配置的长度限制使用默认值
+type PasswordPolicyConfig struct {
+	MinLength     int      `mapstructure:"min_length" json:"min_length"`
+	MaxLength     int      `mapstructure:"max_length" json:"max_length"`
+	RequireUpper  bool     `mapstructure:"require_upper" json:"require_upper"`
+	RequireLower  bool     `mapstructure:"require_lower" json:"require_lower"`
+	RequireDigit  bool     `mapstructure:"require_digit" json:"require_digit"`
+	RequireSymbol bool     `mapstructure:"require_symbol" json:"require_symbol"`
+	MinClasses    int      `mapstructure:"min_classes" json:"min_classes"`
+	BanUserInputs bool     `mapstructure:"ban_user_inputs" json:"ban_user_inputs"`
+	BannedWords   []string `mapstructure:"banned_words" json:"banned_words"`
+	MinScore      int      `mapstructure:"min_score" json:"min_score"`
+}
+
+// PasswordHashConfig 密码哈希算法及参数, 各环境可配置不同的计算成本
+type PasswordHashConfig struct {
+	Algorithm     string `mapstructure:"algorithm" json:"algorithm"`
+	BcryptCost    int    `mapstructure:"bcrypt_cost" json:"bcrypt_cost"`
+	Argon2Memory  uint32 `mapstructure:"argon2_memory" json:"argon2_memory"` // 单位KiB
+	Argon2Time    uint32 `mapstructure:"argon2_time" json:"argon2_time"`
+	Argon2Threads uint8  `mapstructure:"argon2_threads" json:"argon2_threads"`
+}
+
+// PasswordBreachConfig 本地泄露密码库, type为hashfile或bloom, path为空时不检查
+type PasswordBreachConfig struct {
+	Type string `mapstructure:"type" json:"type"`
+	Path string `mapstructure:"path" json:"path"`
+}
+
+// MethodInterceptorConfig 拦截器配置, enabled为开启的拦截器名称,
+// 可选recovery、logging、deadline、concurrency、validate
+type MethodInterceptorConfig struct {
+	Enabled        []string `mapstructure:"enabled" json:"enabled"`
+	Timeout        int      `mapstructure:"timeout" json:"timeout"` // 单位毫秒
+	MaxConcurrency int      `mapstructure:"max_concurrency" json:"max_concurrency"`
+}
+
+// InterceptorConfig methods的key为方法全名, 例如/user.UserService/Register, 未配置的项使用default
+type InterceptorConfig struct {
+	Default MethodInterceptorConfig            `mapstructure:"default" json:"default"`
+	Methods map[string]MethodInterceptorConfig `mapstructure:"methods" json:"methods"`
+}
+
+// UserCacheConfig 用户缓存的过期时间, 单位秒; local_size大于0时在redis前增加本地LRU缓存
+type UserCacheConfig struct {
+	Expire         int `mapstructure:"expire" json:"expire"`
+	NegativeExpire int `mapstructure:"negative_expire" json:"negative_expire"`
+	LocalSize      int `mapstructure:"local_size" json:"local_size"`
+	LocalExpire    int `mapstructure:"local_expire" json:"local_expire"`
+}
+
 type Config struct {
-	MysqlInfo   MysqlConfig  `mapstructure:"mysql" json:"mysql"`
-	RedisInfo   RedisConfig  `mapstructure:"redis" json:"redis"`
-	JwtInfo     JWTConfig    `mapstructure:"jwt" json:"jwt"`
-	ConsuleInfo ConsulConfig `mapstructure:"consul" json:"consul"`
-	NacosInfo   NacosConfig  `mapstructure:"nacos" json:"nacos"`
-	JaegerInfo  JaegerConfig `mapstructure:"jaeger" json:"jaeger"`
+	MysqlInfo   MysqlConfig    `mapstructure:"mysql" json:"mysql"`
+	Database    DatabaseConfig `mapstructure:"database" json:"database"`
+	Sharding    ShardingConfig `mapstructure:"sharding" json:"sharding"`
+	RedisInfo   RedisConfig    `mapstructure:"redis" json:"redis"`
+	JwtInfo     JWTConfig      `mapstructure:"jwt" json:"jwt"`
+	ConsuleInfo ConsulConfig   `mapstructure:"consul" json:"consul"`
+	NacosInfo   NacosConfig    `mapstructure:"nacos" json:"nacos"`
+	JaegerInfo  JaegerConfig   `mapstructure:"jaeger" json:"jaeger"`
+
+	PasswordPolicy PasswordPolicyConfig `mapstructure:"password_policy" json:"password_policy"`
+	PasswordHash   PasswordHashConfig   `mapstructure:"password_hash" json:"password_hash"`
+	PasswordBreach PasswordBreachConfig `mapstructure:"password_breach" json:"password_breach"`
+	Interceptor    InterceptorConfig    `mapstructure:"interceptor" json:"interceptor"`
+	UserCache      UserCacheConfig      `mapstructure:"user_cache" json:"user_cache"`
+	MetricsPort    int                  `mapstructure:"metrics_port" json:"metrics_port"`
+	Broker         BrokerConfig         `mapstructure:"broker" json:"broker"`
+	Outbox         OutboxConfig         `mapstructure:"outbox" json:"outbox"`
+	Mail           MailConfig           `mapstructure:"mail" json:"mail"`
+	IdGenerator    IdGeneratorConfig    `mapstructure:"id_generator" json:"id_generator"`
+	Pii            PiiConfig            `mapstructure:"pii" json:"pii"`
+	Search         SearchConfig         `mapstructure:"search" json:"search"`
+	Tenants        []TenantConfig       `mapstructure:"tenants" json:"tenants"`
+	Gateway        GatewayConfig        `mapstructure:"gateway" json:"gateway"`
 }
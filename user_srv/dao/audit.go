@@ -0,0 +1,37 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+type AuditI interface {
+	AddAuditLog(ctx context.Context, log AuditLog) error
+}
+
+var _ AuditI = &audit{}
+
+type audit struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+func NewAuditDao(db *gorm.DB, logger *logger.Logger) AuditI {
+	return &audit{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (a *audit) AddAuditLog(ctx context.Context, log AuditLog) error {
+	log.TenantId = tenant.FromContext(ctx)
+	err := a.db.WithContext(ctx).Create(&log).Error
+	if err != nil {
+		a.logger.Sugar().Warnf("写入审计记录失败, 用户: %d, 错误原因: %s", log.UserId, err)
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/idgen"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+)
+
+// 测试使用临时目录中的sqlite, 连接参数与initiallize中的sqlite一致,
+// 另外用immediate事务避免并发写入时升级锁失败
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tk_user_srv.db")
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on&_txlock=immediate", path)), &gorm.Config{
+		Logger:                 gormlogger.Default.LogMode(gormlogger.Silent),
+		SkipDefaultTransaction: true,
+		TranslateError:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMigrator(db, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestLogger() *logger.Logger {
+	return logger.NewLogger(logger.WithWriteFile(false))
+}
+
+// newTestUserDao 在db上按tables张分表创建用户dao
+func newTestUserDao(t *testing.T, db *gorm.DB, tables int) (*user, *Sharding) {
+	t.Helper()
+	s := NewSharding([]*gorm.DB{db}, tables, 0)
+	if err := s.EnsureTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := idgen.NewSnowflake(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := pii.New(config.PiiConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUserDao(s, ids, c, newTestLogger()).(*user), s
+}
+
+func mustCreateUser(t *testing.T, ctx context.Context, d UserI, email string) int64 {
+	t.Helper()
+	uid, err := d.CreateUser(ctx, User{Email: email, Password: "hash", NickName: "nick"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uid
+}
@@ -0,0 +1,38 @@
+package dao
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	mysqlUniqueConflict    uint16 = 1062
+	postgresUniqueConflict        = "23505"
+)
+
+// isUniqueConflict 判断是否为唯一键冲突, 兼容mysql、postgres和sqlite.
+// 开启TranslateError后各驱动的错误会转换为gorm.ErrDuplicatedKey,
+// 未经gorm转换的驱动错误按错误码判断
+func isUniqueConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlUniqueConflict
+	}
+
+	// pgconn.PgError
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == postgresUniqueConflict
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package dao
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+
+	"gorm.io/gorm"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/migrate"
+)
+
+// MigrationDialects 每个方言在migrations下有一个同名目录
+var MigrationDialects = []string{"mysql", "postgres", "sqlite"}
+
+//go:embed migrations
+var migrations embed.FS
+
+// NewMigrator 使用当前数据库方言对应的迁移文件
+func NewMigrator(db *gorm.DB, logger *logger.Logger) (*migrate.Migrator, error) {
+	sub, err := fs.Sub(migrations, path.Join("migrations", db.Dialector.Name()))
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, sub, logger)
+}
@@ -0,0 +1,124 @@
+package dao
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/pkg/migrate"
+)
+
+// 保存用户id的列, 000006需要把它们都改为64位
+var userIdColumns = []string{
+	"audit_logs.user_id",
+	"outbox_events.aggregate_id",
+	"points_accounts.user_id",
+	"points_lots.user_id",
+	"points_transactions.user_id",
+	"preferences.user_id",
+	"user_emails.id",
+	"users.id",
+}
+
+var alterColumn = regexp.MustCompile("ALTER TABLE `?(\\w+)`? (?:MODIFY|ALTER COLUMN) `?(\\w+)`? (?:TYPE )?(\\w+)")
+
+func loadMigration(t *testing.T, dialect string, version int64) migrate.Migration {
+	t.Helper()
+	sub, err := fs.Sub(migrations, path.Join("migrations", dialect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	migs, err := migrate.Load(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mig := range migs {
+		if mig.Version == version {
+			return mig
+		}
+	}
+	t.Fatalf("%s缺少迁移%d", dialect, version)
+	return migrate.Migration{}
+}
+
+// alteredColumns 返回脚本中修改的列以及修改后的类型
+func alteredColumns(script string) map[string]string {
+	cols := make(map[string]string)
+	for _, stmt := range migrate.Split(script) {
+		if m := alterColumn.FindStringSubmatch(stmt); m != nil {
+			cols[m[1]+"."+m[2]] = m[3]
+		}
+	}
+	return cols
+}
+
+func TestBigintUserIdsScripts(t *testing.T) {
+	for _, dialect := range []string{"mysql", "postgres"} {
+		mig := loadMigration(t, dialect, 6)
+		up, down := alteredColumns(mig.Up), alteredColumns(mig.Down)
+
+		for _, col := range userIdColumns {
+			if up[col] != "bigint" {
+				t.Fatalf("%s的000006没有把%s改为bigint: %q", dialect, col, up[col])
+			}
+			if typ := down[col]; typ != "int" && typ != "integer" {
+				t.Fatalf("%s的000006回滚时没有恢复%s: %q", dialect, col, typ)
+			}
+		}
+		if len(up) != len(userIdColumns) || len(down) != len(userIdColumns) {
+			t.Fatalf("%s的000006修改了未预期的列: %v, %v", dialect, up, down)
+		}
+	}
+
+	// sqlite只有注释
+	if mig := loadMigration(t, "sqlite", 6); len(migrate.Split(mig.Up)) != 0 || len(migrate.Split(mig.Down)) != 0 {
+		t.Fatal("sqlite的000006不应包含语句")
+	}
+}
+
+// 迁移之后每个保存用户id的列都能存取snowflake生成的id
+func TestBigintUserIds(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	const uid int64 = 370579190170259480
+
+	m, err := NewMigrator(db, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 回滚到000006之前再重新执行
+	if err = m.Down(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, col := range userIdColumns {
+		table, column, _ := strings.Cut(col, ".")
+		row := map[string]any{column: uid}
+		switch table {
+		case "outbox_events":
+			row["event_id"], row["event_type"], row["payload"], row["create_at"] = "e1", "test", []byte("{}"), 1
+		case "audit_logs":
+			row["action"], row["create_at"] = "test", 1
+		case "user_emails":
+			row["email"] = "alice@ex.com"
+		}
+		if err = db.Table(table).Create(row).Error; err != nil {
+			t.Fatalf("写入%s失败: %v", col, err)
+		}
+
+		var got []int64
+		if err = db.Table(table).Pluck(column, &got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, []int64{uid}) {
+			t.Fatalf("%s读出%v, 期望%d", col, got, uid)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS points_lots;
+DROP TABLE IF EXISTS points_entries;
+DROP TABLE IF EXISTS points_transactions;
+DROP TABLE IF EXISTS points_accounts;
+DROP TABLE IF EXISTS preferences;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,74 @@
+-- 初始表结构, 与之前AutoMigrate创建的表一致, 已存在的表不会重复创建
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `email` varchar(191) DEFAULT NULL,
+  `password` longtext,
+  `nick_name` longtext,
+  `description` longtext,
+  `avatar` longtext,
+  `address` longtext,
+  `birth_day` bigint DEFAULT NULL,
+  `create_at` bigint DEFAULT NULL,
+  `update_at` bigint DEFAULT NULL,
+  `delete_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uni_users_email` (`email`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `preferences` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` int DEFAULT NULL,
+  `key` varchar(64) DEFAULT NULL,
+  `value` varchar(1024) DEFAULT NULL,
+  `version` bigint DEFAULT NULL,
+  `create_at` bigint DEFAULT NULL,
+  `update_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_user_key` (`user_id`, `key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `points_accounts` (
+  `user_id` int NOT NULL,
+  `balance` bigint DEFAULT NULL,
+  `update_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `points_transactions` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` int DEFAULT NULL,
+  `kind` varchar(16) DEFAULT NULL,
+  `biz_type` varchar(32) DEFAULT NULL,
+  `biz_ref` varchar(128) DEFAULT NULL,
+  `amount` bigint DEFAULT NULL,
+  `balance` bigint DEFAULT NULL,
+  `remark` longtext,
+  `expire_at` bigint DEFAULT NULL,
+  `create_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_kind_ref` (`kind`, `biz_ref`),
+  KEY `idx_points_transactions_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `points_entries` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `transaction_id` bigint DEFAULT NULL,
+  `account` varchar(64) DEFAULT NULL,
+  `amount` bigint DEFAULT NULL,
+  `create_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_points_entries_transaction_id` (`transaction_id`),
+  KEY `idx_points_entries_account` (`account`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `points_lots` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` int DEFAULT NULL,
+  `transaction_id` bigint DEFAULT NULL,
+  `amount` bigint DEFAULT NULL,
+  `remaining` bigint DEFAULT NULL,
+  `expire_at` bigint DEFAULT NULL,
+  `create_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_user_expire` (`user_id`, `expire_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+-- 全局邮箱索引, 分表后按邮箱查找用户id, 同时负责分配用户id并保证邮箱全局唯一
+CREATE TABLE IF NOT EXISTS `user_emails` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `email` varchar(191) NOT NULL,
+  `create_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uni_user_emails_email` (`email`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO `user_emails` (`id`, `email`, `create_at`)
+SELECT `id`, `email`, `create_at` FROM `users` WHERE `email` IS NOT NULL;
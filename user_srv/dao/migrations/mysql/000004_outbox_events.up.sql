@@ -0,0 +1,13 @@
+-- 领域事件outbox, 与用户修改在同一事务中写入, 由relay投递到消息队列
+CREATE TABLE IF NOT EXISTS `outbox_events` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `event_id` varchar(64) NOT NULL,
+  `event_type` varchar(64) NOT NULL,
+  `aggregate_id` int NOT NULL,
+  `payload` longblob NOT NULL,
+  `create_at` bigint NOT NULL,
+  `published_at` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uni_outbox_events_event_id` (`event_id`),
+  KEY `idx_outbox_events_published_at` (`published_at`, `id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
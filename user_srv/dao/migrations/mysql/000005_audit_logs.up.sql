@@ -0,0 +1,10 @@
+-- 用户操作的审计记录, 由事件总线的订阅者写入
+CREATE TABLE IF NOT EXISTS `audit_logs` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `action` varchar(64) NOT NULL,
+  `detail` varchar(1024) NOT NULL DEFAULT '',
+  `create_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_audit_logs_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
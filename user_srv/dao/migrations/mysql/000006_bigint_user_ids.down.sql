@@ -0,0 +1,9 @@
+-- 已经存在64位id时无法回滚
+ALTER TABLE `audit_logs` MODIFY `user_id` int NOT NULL;
+ALTER TABLE `outbox_events` MODIFY `aggregate_id` int NOT NULL;
+ALTER TABLE `points_lots` MODIFY `user_id` int DEFAULT NULL;
+ALTER TABLE `points_transactions` MODIFY `user_id` int DEFAULT NULL;
+ALTER TABLE `points_accounts` MODIFY `user_id` int NOT NULL;
+ALTER TABLE `preferences` MODIFY `user_id` int DEFAULT NULL;
+ALTER TABLE `user_emails` MODIFY `id` int NOT NULL AUTO_INCREMENT;
+ALTER TABLE `users` MODIFY `id` int NOT NULL AUTO_INCREMENT;
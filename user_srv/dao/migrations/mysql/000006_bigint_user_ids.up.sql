@@ -0,0 +1,9 @@
+-- 用户id改为64位, 新用户的id由snowflake生成, 已有的32位id保持不变
+ALTER TABLE `users` MODIFY `id` bigint NOT NULL AUTO_INCREMENT;
+ALTER TABLE `user_emails` MODIFY `id` bigint NOT NULL AUTO_INCREMENT;
+ALTER TABLE `preferences` MODIFY `user_id` bigint DEFAULT NULL;
+ALTER TABLE `points_accounts` MODIFY `user_id` bigint NOT NULL;
+ALTER TABLE `points_transactions` MODIFY `user_id` bigint DEFAULT NULL;
+ALTER TABLE `points_lots` MODIFY `user_id` bigint DEFAULT NULL;
+ALTER TABLE `outbox_events` MODIFY `aggregate_id` bigint NOT NULL;
+ALTER TABLE `audit_logs` MODIFY `user_id` bigint NOT NULL;
@@ -0,0 +1,4 @@
+-- 只能回滚还没有加密的数据
+ALTER TABLE `users` DROP COLUMN `birth_day_cipher`;
+ALTER TABLE `users` MODIFY `email` varchar(191) DEFAULT NULL;
+ALTER TABLE `users` ADD UNIQUE KEY `uni_users_email` (`email`);
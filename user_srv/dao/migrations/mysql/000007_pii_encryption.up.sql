@@ -0,0 +1,4 @@
+-- 邮箱、地址、生日加密存储, 密文超出原来的长度, 邮箱唯一由user_emails中的盲索引保证
+ALTER TABLE `users` DROP INDEX `uni_users_email`;
+ALTER TABLE `users` MODIFY `email` varchar(1024) DEFAULT NULL;
+ALTER TABLE `users` ADD COLUMN `birth_day_cipher` varchar(512) DEFAULT NULL;
@@ -0,0 +1,11 @@
+-- 只能在各租户的邮箱和业务流水号没有重复时回滚
+ALTER TABLE `audit_logs` DROP COLUMN `tenant_id`;
+ALTER TABLE `outbox_events` DROP COLUMN `tenant_id`;
+ALTER TABLE `points_lots` DROP COLUMN `tenant_id`;
+ALTER TABLE `points_transactions` DROP INDEX `idx_kind_ref`, ADD UNIQUE KEY `idx_kind_ref` (`kind`, `biz_ref`);
+ALTER TABLE `points_transactions` DROP COLUMN `tenant_id`;
+ALTER TABLE `points_accounts` DROP COLUMN `tenant_id`;
+ALTER TABLE `preferences` DROP COLUMN `tenant_id`;
+ALTER TABLE `user_emails` DROP INDEX `uni_user_emails_tenant_email`, ADD UNIQUE KEY `uni_user_emails_email` (`email`);
+ALTER TABLE `user_emails` DROP COLUMN `tenant_id`;
+ALTER TABLE `users` DROP COLUMN `tenant_id`;
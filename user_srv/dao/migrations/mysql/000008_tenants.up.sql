@@ -0,0 +1,11 @@
+-- 多租户, 已有的数据属于默认租户, 邮箱和业务流水号改为在租户内唯一
+ALTER TABLE `users` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `user_emails` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `user_emails` DROP INDEX `uni_user_emails_email`, ADD UNIQUE KEY `uni_user_emails_tenant_email` (`tenant_id`, `email`);
+ALTER TABLE `preferences` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `points_accounts` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `points_transactions` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `points_transactions` DROP INDEX `idx_kind_ref`, ADD UNIQUE KEY `idx_kind_ref` (`tenant_id`, `kind`, `biz_ref`);
+ALTER TABLE `points_lots` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `outbox_events` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `audit_logs` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
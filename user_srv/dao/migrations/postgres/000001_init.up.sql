@@ -0,0 +1,67 @@
+-- 初始表结构, 与之前AutoMigrate创建的表一致, 已存在的表不会重复创建
+CREATE TABLE IF NOT EXISTS users (
+  id serial PRIMARY KEY,
+  email text CONSTRAINT uni_users_email UNIQUE,
+  password text,
+  nick_name text,
+  description text,
+  avatar text,
+  address text,
+  birth_day bigint,
+  create_at bigint,
+  update_at bigint,
+  delete_at bigint
+);
+
+CREATE TABLE IF NOT EXISTS preferences (
+  id bigserial PRIMARY KEY,
+  user_id integer,
+  key varchar(64),
+  value varchar(1024),
+  version bigint,
+  create_at bigint,
+  update_at bigint
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_key ON preferences (user_id, key);
+
+CREATE TABLE IF NOT EXISTS points_accounts (
+  user_id integer PRIMARY KEY,
+  balance bigint,
+  update_at bigint
+);
+
+CREATE TABLE IF NOT EXISTS points_transactions (
+  id bigserial PRIMARY KEY,
+  user_id integer,
+  kind varchar(16),
+  biz_type varchar(32),
+  biz_ref varchar(128),
+  amount bigint,
+  balance bigint,
+  remark text,
+  expire_at bigint,
+  create_at bigint
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_kind_ref ON points_transactions (kind, biz_ref);
+CREATE INDEX IF NOT EXISTS idx_points_transactions_user_id ON points_transactions (user_id);
+
+CREATE TABLE IF NOT EXISTS points_entries (
+  id bigserial PRIMARY KEY,
+  transaction_id bigint,
+  account varchar(64),
+  amount bigint,
+  create_at bigint
+);
+CREATE INDEX IF NOT EXISTS idx_points_entries_transaction_id ON points_entries (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_points_entries_account ON points_entries (account);
+
+CREATE TABLE IF NOT EXISTS points_lots (
+  id bigserial PRIMARY KEY,
+  user_id integer,
+  transaction_id bigint,
+  amount bigint,
+  remaining bigint,
+  expire_at bigint,
+  create_at bigint
+);
+CREATE INDEX IF NOT EXISTS idx_user_expire ON points_lots (user_id, expire_at);
@@ -0,0 +1,12 @@
+-- 全局邮箱索引, 分表后按邮箱查找用户id, 同时负责分配用户id并保证邮箱全局唯一
+CREATE TABLE IF NOT EXISTS user_emails (
+  id serial PRIMARY KEY,
+  email text NOT NULL CONSTRAINT uni_user_emails_email UNIQUE,
+  create_at bigint
+);
+
+INSERT INTO user_emails (id, email, create_at)
+SELECT id, email, create_at FROM users WHERE email IS NOT NULL;
+
+-- 显式写入id不会推进序列, 需要手动对齐
+SELECT setval(pg_get_serial_sequence('user_emails', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM user_emails;
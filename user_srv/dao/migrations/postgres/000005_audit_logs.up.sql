@@ -0,0 +1,9 @@
+-- 用户操作的审计记录, 由事件总线的订阅者写入
+CREATE TABLE IF NOT EXISTS audit_logs (
+  id bigserial PRIMARY KEY,
+  user_id integer NOT NULL,
+  action varchar(64) NOT NULL,
+  detail varchar(1024) NOT NULL DEFAULT '',
+  create_at bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs (user_id);
@@ -0,0 +1,9 @@
+-- 已经存在64位id时无法回滚
+ALTER TABLE audit_logs ALTER COLUMN user_id TYPE integer;
+ALTER TABLE outbox_events ALTER COLUMN aggregate_id TYPE integer;
+ALTER TABLE points_lots ALTER COLUMN user_id TYPE integer;
+ALTER TABLE points_transactions ALTER COLUMN user_id TYPE integer;
+ALTER TABLE points_accounts ALTER COLUMN user_id TYPE integer;
+ALTER TABLE preferences ALTER COLUMN user_id TYPE integer;
+ALTER TABLE user_emails ALTER COLUMN id TYPE integer;
+ALTER TABLE users ALTER COLUMN id TYPE integer;
@@ -0,0 +1,9 @@
+-- 用户id改为64位, 新用户的id由snowflake生成, 已有的32位id保持不变
+ALTER TABLE users ALTER COLUMN id TYPE bigint;
+ALTER TABLE user_emails ALTER COLUMN id TYPE bigint;
+ALTER TABLE preferences ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE points_accounts ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE points_transactions ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE points_lots ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE outbox_events ALTER COLUMN aggregate_id TYPE bigint;
+ALTER TABLE audit_logs ALTER COLUMN user_id TYPE bigint;
@@ -0,0 +1,3 @@
+-- 只能回滚还没有加密的数据
+ALTER TABLE users DROP COLUMN IF EXISTS birth_day_cipher;
+ALTER TABLE users ADD CONSTRAINT uni_users_email UNIQUE (email);
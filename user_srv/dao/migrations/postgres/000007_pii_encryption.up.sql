@@ -0,0 +1,3 @@
+-- 邮箱、地址、生日加密存储, 邮箱唯一由user_emails中的盲索引保证
+ALTER TABLE users DROP CONSTRAINT IF EXISTS uni_users_email;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS birth_day_cipher text;
@@ -0,0 +1,13 @@
+-- 只能在各租户的邮箱和业务流水号没有重复时回滚
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE points_lots DROP COLUMN IF EXISTS tenant_id;
+DROP INDEX IF EXISTS idx_kind_ref;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_kind_ref ON points_transactions (kind, biz_ref);
+ALTER TABLE points_transactions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE points_accounts DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE preferences DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE user_emails DROP CONSTRAINT IF EXISTS uni_user_emails_tenant_email;
+ALTER TABLE user_emails ADD CONSTRAINT uni_user_emails_email UNIQUE (email);
+ALTER TABLE user_emails DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
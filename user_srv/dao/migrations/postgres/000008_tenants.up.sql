@@ -0,0 +1,13 @@
+-- 多租户, 已有的数据属于默认租户, 邮箱和业务流水号改为在租户内唯一
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE user_emails ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE user_emails DROP CONSTRAINT IF EXISTS uni_user_emails_email;
+ALTER TABLE user_emails ADD CONSTRAINT uni_user_emails_tenant_email UNIQUE (tenant_id, email);
+ALTER TABLE preferences ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE points_accounts ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE points_transactions ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
+DROP INDEX IF EXISTS idx_kind_ref;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_kind_ref ON points_transactions (tenant_id, kind, biz_ref);
+ALTER TABLE points_lots ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
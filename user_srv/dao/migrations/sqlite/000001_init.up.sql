@@ -0,0 +1,18 @@
+-- 初始表结构, 与之前AutoMigrate创建的表一致, 已存在的表不会重复创建
+CREATE TABLE IF NOT EXISTS `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`email` text,`password` text,`nick_name` text,`description` text,`avatar` text,`address` text,`birth_day` integer,`create_at` integer,`update_at` integer,`delete_at` integer,CONSTRAINT `uni_users_email` UNIQUE (`email`));
+
+CREATE TABLE IF NOT EXISTS `preferences` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer,`key` varchar(64),`value` varchar(1024),`version` integer,`create_at` integer,`update_at` integer);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_user_key` ON `preferences`(`user_id`,`key`);
+
+CREATE TABLE IF NOT EXISTS `points_accounts` (`user_id` integer,`balance` integer,`update_at` integer,PRIMARY KEY (`user_id`));
+
+CREATE TABLE IF NOT EXISTS `points_transactions` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer,`kind` varchar(16),`biz_type` varchar(32),`biz_ref` varchar(128),`amount` integer,`balance` integer,`remark` text,`expire_at` integer,`create_at` integer);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_kind_ref` ON `points_transactions`(`kind`,`biz_ref`);
+CREATE INDEX IF NOT EXISTS `idx_points_transactions_user_id` ON `points_transactions`(`user_id`);
+
+CREATE TABLE IF NOT EXISTS `points_entries` (`id` integer PRIMARY KEY AUTOINCREMENT,`transaction_id` integer,`account` varchar(64),`amount` integer,`create_at` integer);
+CREATE INDEX IF NOT EXISTS `idx_points_entries_account` ON `points_entries`(`account`);
+CREATE INDEX IF NOT EXISTS `idx_points_entries_transaction_id` ON `points_entries`(`transaction_id`);
+
+CREATE TABLE IF NOT EXISTS `points_lots` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer,`transaction_id` integer,`amount` integer,`remaining` integer,`expire_at` integer,`create_at` integer);
+CREATE INDEX IF NOT EXISTS `idx_user_expire` ON `points_lots`(`user_id`,`expire_at`);
@@ -0,0 +1,5 @@
+-- 全局邮箱索引, 分表后按邮箱查找用户id, 同时负责分配用户id并保证邮箱全局唯一
+CREATE TABLE IF NOT EXISTS `user_emails` (`id` integer PRIMARY KEY AUTOINCREMENT,`email` text NOT NULL,`create_at` integer,CONSTRAINT `uni_user_emails_email` UNIQUE (`email`));
+
+INSERT INTO `user_emails` (`id`, `email`, `create_at`)
+SELECT `id`, `email`, `create_at` FROM `users` WHERE `email` IS NOT NULL;
@@ -0,0 +1,2 @@
+-- 用户信息乐观锁版本号, 从1开始, 0保留给调用方表示不检查版本
+ALTER TABLE `users` ADD COLUMN `version` integer NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- 领域事件outbox, 与用户修改在同一事务中写入, 由relay投递到消息队列
+CREATE TABLE IF NOT EXISTS `outbox_events` (`id` integer PRIMARY KEY AUTOINCREMENT,`event_id` varchar(64) NOT NULL,`event_type` varchar(64) NOT NULL,`aggregate_id` integer NOT NULL,`payload` blob NOT NULL,`create_at` integer NOT NULL,`published_at` integer NOT NULL DEFAULT 0,CONSTRAINT `uni_outbox_events_event_id` UNIQUE (`event_id`));
+CREATE INDEX IF NOT EXISTS `idx_outbox_events_published_at` ON `outbox_events`(`published_at`,`id`);
@@ -0,0 +1 @@
+-- sqlite的integer本身就是64位, 不需要修改
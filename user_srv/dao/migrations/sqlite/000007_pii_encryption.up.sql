@@ -0,0 +1,2 @@
+-- 邮箱、地址、生日加密存储, 邮箱唯一由user_emails中的盲索引保证
+ALTER TABLE `users` ADD COLUMN `birth_day_cipher` text;
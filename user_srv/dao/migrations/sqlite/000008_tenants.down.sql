@@ -0,0 +1,17 @@
+-- 只能在各租户的邮箱和业务流水号没有重复时回滚
+ALTER TABLE `audit_logs` DROP COLUMN `tenant_id`;
+ALTER TABLE `outbox_events` DROP COLUMN `tenant_id`;
+ALTER TABLE `points_lots` DROP COLUMN `tenant_id`;
+DROP INDEX IF EXISTS `idx_kind_ref`;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_kind_ref` ON `points_transactions`(`kind`,`biz_ref`);
+ALTER TABLE `points_transactions` DROP COLUMN `tenant_id`;
+ALTER TABLE `points_accounts` DROP COLUMN `tenant_id`;
+ALTER TABLE `preferences` DROP COLUMN `tenant_id`;
+
+CREATE TABLE `user_emails_global` (`id` integer PRIMARY KEY AUTOINCREMENT,`email` text NOT NULL,`create_at` integer,CONSTRAINT `uni_user_emails_email` UNIQUE (`email`));
+INSERT INTO `user_emails_global` (`id`, `email`, `create_at`) SELECT `id`, `email`, `create_at` FROM `user_emails`;
+DROP TABLE `user_emails`;
+ALTER TABLE `user_emails_global` RENAME TO `user_emails`;
+
+-- users的邮箱唯一约束在000007之后已经由user_emails保证, 不再恢复
+ALTER TABLE `users` DROP COLUMN `tenant_id`;
@@ -0,0 +1,21 @@
+-- 多租户, 已有的数据属于默认租户, 邮箱和业务流水号改为在租户内唯一
+-- sqlite不能删除表内定义的唯一约束, 重建users和user_emails. 不同租户的用户可以使用相同的邮箱
+CREATE TABLE `users_tenant` (`id` integer PRIMARY KEY AUTOINCREMENT,`tenant_id` varchar(64) NOT NULL DEFAULT 'default',`email` text,`password` text,`nick_name` text,`description` text,`avatar` text,`address` text,`birth_day` integer,`birth_day_cipher` text,`create_at` integer,`update_at` integer,`delete_at` integer,`version` integer NOT NULL DEFAULT 1);
+INSERT INTO `users_tenant` (`id`, `email`, `password`, `nick_name`, `description`, `avatar`, `address`, `birth_day`, `birth_day_cipher`, `create_at`, `update_at`, `delete_at`, `version`)
+SELECT `id`, `email`, `password`, `nick_name`, `description`, `avatar`, `address`, `birth_day`, `birth_day_cipher`, `create_at`, `update_at`, `delete_at`, `version` FROM `users`;
+DROP TABLE `users`;
+ALTER TABLE `users_tenant` RENAME TO `users`;
+
+CREATE TABLE `user_emails_tenant` (`id` integer PRIMARY KEY AUTOINCREMENT,`tenant_id` varchar(64) NOT NULL DEFAULT 'default',`email` text NOT NULL,`create_at` integer,CONSTRAINT `uni_user_emails_tenant_email` UNIQUE (`tenant_id`,`email`));
+INSERT INTO `user_emails_tenant` (`id`, `email`, `create_at`) SELECT `id`, `email`, `create_at` FROM `user_emails`;
+DROP TABLE `user_emails`;
+ALTER TABLE `user_emails_tenant` RENAME TO `user_emails`;
+
+ALTER TABLE `preferences` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `points_accounts` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `points_transactions` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+DROP INDEX IF EXISTS `idx_kind_ref`;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_kind_ref` ON `points_transactions`(`tenant_id`,`kind`,`biz_ref`);
+ALTER TABLE `points_lots` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `outbox_events` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
+ALTER TABLE `audit_logs` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
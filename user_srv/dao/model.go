@@ -1,30 +1,109 @@
 package dao
 
-import (
-	"log"
+// User 邮箱、地址、生日在分表中加密存储, dao对外返回的是解密后的值.
+// 生日加密后存到BirthDayCipher, BirthDay只保留加密之前写入的明文
+type User struct {
+	Id             int64  `gorm:"primaryKey, autoIncrement"`
+	TenantId       string `gorm:"type:varchar(64)"`
+	Email          string
+	Password       string
+	NickName       string
+	Description    string
+	Avatar         string
+	Address        string
+	BirthDay       int64
+	BirthDayCipher string
+	CreateAt       int64
+	UpdateAt       int64
+	DeleteAt       int64
+	// Version 每次修改加1, 修改时检查以避免并发修改相互覆盖
+	Version int64
+}
 
-	"gorm.io/gorm"
-)
+// UserEmail 全局邮箱索引, id即为用户id, 分表后用于按邮箱查找用户所在的分表.
+// 新用户的id由snowflake生成, 之前由自增分配的32位id保持不变.
+// Email保存的是邮箱的盲索引, 加密之前写入的行保存的是明文, 由后台重新加密时替换.
+// 邮箱在租户内唯一
+type UserEmail struct {
+	Id       int64  `gorm:"primaryKey, autoIncrement"`
+	TenantId string `gorm:"type:varchar(64);uniqueIndex:uni_user_emails_tenant_email"`
+	Email    string `gorm:"uniqueIndex:uni_user_emails_tenant_email"`
+	CreateAt int64
+}
 
-type User struct {
-	Id          int32  `gorm:"primaryKey, autoIncrement"`
-	Email       string `gorm:"unique"`
-	Password    string
-	NickName    string
-	Description string
-	Avatar      string
-	Address     string
-	BirthDay    int64
+type Preference struct {
+	Id       int64  `gorm:"primaryKey, autoIncrement"`
+	TenantId string `gorm:"type:varchar(64)"`
+	UserId   int64  `gorm:"uniqueIndex:idx_user_key"`
+	Key      string `gorm:"type:varchar(64);uniqueIndex:idx_user_key"`
+	Value    string `gorm:"type:varchar(1024)"`
+	Version  int64
+	CreateAt int64
+	UpdateAt int64
+}
+
+// PointsAccount 用户积分账户, 余额为所有未过期积分批次剩余量之和
+type PointsAccount struct {
+	UserId   int64  `gorm:"primaryKey;autoIncrement:false"`
+	TenantId string `gorm:"type:varchar(64)"`
+	Balance  int64
+	UpdateAt int64
+}
+
+// PointsTransaction 一次积分变动, 同一租户同一类型下的业务流水号唯一, 保证幂等
+type PointsTransaction struct {
+	Id       int64  `gorm:"primaryKey, autoIncrement"`
+	TenantId string `gorm:"type:varchar(64);uniqueIndex:idx_kind_ref"`
+	UserId   int64  `gorm:"index"`
+	Kind     string `gorm:"type:varchar(16);uniqueIndex:idx_kind_ref"`
+	BizType  string `gorm:"type:varchar(32)"`
+	BizRef   string `gorm:"type:varchar(128);uniqueIndex:idx_kind_ref"`
+	Amount   int64
+	Balance  int64
+	Remark   string
+	ExpireAt int64
+	CreateAt int64
+}
+
+// PointsEntry 复式记账分录, 每笔交易的分录金额之和为0
+type PointsEntry struct {
+	Id            int64  `gorm:"primaryKey, autoIncrement"`
+	TransactionId int64  `gorm:"index"`
+	Account       string `gorm:"type:varchar(64);index"`
+	Amount        int64
+	CreateAt      int64
+}
+
+// PointsLot 每次发放的积分批次, 扣减时按过期时间先后消耗
+type PointsLot struct {
+	Id            int64  `gorm:"primaryKey, autoIncrement"`
+	TenantId      string `gorm:"type:varchar(64)"`
+	UserId        int64  `gorm:"index:idx_user_expire"`
+	TransactionId int64
+	Amount        int64
+	Remaining     int64
+	ExpireAt      int64 `gorm:"index:idx_user_expire"`
+	CreateAt      int64
+}
+
+// OutboxEvent 与用户修改在同一事务中写入的领域事件, PublishedAt为0表示尚未投递
+type OutboxEvent struct {
+	Id          int64  `gorm:"primaryKey, autoIncrement"`
+	EventId     string `gorm:"type:varchar(64);unique"`
+	EventType   string `gorm:"type:varchar(64)"`
+	TenantId    string `gorm:"type:varchar(64)"`
+	AggregateId int64
+	Payload     []byte
 	CreateAt    int64
-	UpdateAt    int64
-	DeleteAt    int64
+	PublishedAt int64 `gorm:"index:idx_outbox_events_published_at"`
 }
 
-func InitAutoMigrateTable(db *gorm.DB) error {
-	err := db.AutoMigrate(&User{})
-	if err != nil {
-		log.Printf("迁移表失败, 失败原因：%v", err)
-		return err
-	}
-	return nil
+// AuditLog 用户操作的审计记录
+type AuditLog struct {
+	Id       int64  `gorm:"primaryKey, autoIncrement"`
+	TenantId string `gorm:"type:varchar(64)"`
+	UserId   int64  `gorm:"index:idx_audit_logs_user_id"`
+	Action   string `gorm:"type:varchar(64)"`
+	Detail   string `gorm:"type:varchar(1024)"`
+	CreateAt int64
 }
@@ -0,0 +1,99 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/Numsina/tk_users/user_srv/events"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+type OutboxI interface {
+	// Relay 锁定一批未投递的事件交给publish, publish成功后标记为已投递.
+	// 多个实例同时执行时后来者等待锁释放, 保证同一用户的事件按写入顺序投递
+	Relay(ctx context.Context, limit int, publish func(evts []OutboxEvent) error) (int, error)
+	// Purge 删除before之前已投递的事件
+	Purge(ctx context.Context, before int64) (int64, error)
+	// After 按写入顺序读取id之后的事件, 不论是否已投递, 用于在本地跟随用户的变化
+	After(ctx context.Context, id int64, limit int) ([]OutboxEvent, error)
+	// LastId 当前最后一个事件的id, 没有事件时为0
+	LastId(ctx context.Context) (int64, error)
+}
+
+var _ OutboxI = &outbox{}
+
+type outbox struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+func NewOutboxDao(db *gorm.DB, logger *logger.Logger) OutboxI {
+	return &outbox{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (o *outbox) Relay(ctx context.Context, limit int, publish func(evts []OutboxEvent) error) (int, error) {
+	var n int
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var evts []OutboxEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("published_at = 0").
+			Order("id").Limit(limit).Find(&evts).Error
+		if err != nil || len(evts) == 0 {
+			return err
+		}
+
+		if err = publish(evts); err != nil {
+			return err
+		}
+
+		ids := make([]int64, 0, len(evts))
+		for _, e := range evts {
+			ids = append(ids, e.Id)
+		}
+		n = len(evts)
+		return tx.Model(&OutboxEvent{}).Where("id IN ?", ids).
+			Update("published_at", time.Now().UnixMilli()).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (o *outbox) Purge(ctx context.Context, before int64) (int64, error) {
+	res := o.db.WithContext(ctx).Where("published_at > 0 AND published_at < ?", before).Delete(&OutboxEvent{})
+	return res.RowsAffected, res.Error
+}
+
+func (o *outbox) After(ctx context.Context, id int64, limit int) ([]OutboxEvent, error) {
+	var evts []OutboxEvent
+	err := o.db.WithContext(ctx).Clauses(dbresolver.Write).Where("id > ?", id).
+		Order("id").Limit(limit).Find(&evts).Error
+	return evts, err
+}
+
+func (o *outbox) LastId(ctx context.Context) (int64, error) {
+	var id int64
+	err := o.db.WithContext(ctx).Clauses(dbresolver.Write).Model(&OutboxEvent{}).
+		Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+// addEvent 在tx所在的事务中写入领域事件, 事件属于事务所在的租户
+func addEvent(tx *gorm.DB, e events.Event) error {
+	return tx.Create(&OutboxEvent{
+		TenantId:    tenant.FromContext(tx.Statement.Context),
+		EventId:     e.Id,
+		EventType:   e.Type,
+		AggregateId: e.UserId,
+		Payload:     e.Payload,
+		CreateAt:    e.OccurredAt,
+	}).Error
+}
@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+)
+
+const defaultRotateBatch = 200
+
+// PiiRotator 把分表中的明文和旧密钥加密的敏感字段用当前密钥重新加密,
+// 同时把邮箱索引中的明文替换为盲索引. 重新加密不修改版本, 按版本检查避免覆盖并发的修改
+type PiiRotator struct {
+	u     *user
+	batch int
+}
+
+func NewPiiRotator(s *Sharding, c pii.Cipher, batch int, logger *logger.Logger) *PiiRotator {
+	if batch <= 0 {
+		batch = defaultRotateBatch
+	}
+	return &PiiRotator{
+		u:     &user{s: s, pii: c, logger: logger},
+		batch: batch,
+	}
+}
+
+// Rotate 扫描所有分表, 返回重新加密的行数. 被并发修改而跳过的行在下一次扫描时处理
+func (r *PiiRotator) Rotate(ctx context.Context) (int64, error) {
+	var total int64
+	shards := r.u.s.Current.Shards()
+	if r.u.s.Next != nil {
+		shards = append(append([]Shard(nil), shards...), r.u.s.Next.Shards()...)
+	}
+
+	for i, shard := range shards {
+		n, err := r.rotateShard(ctx, shard, i < r.u.s.Current.Size())
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r *PiiRotator) rotateShard(ctx context.Context, shard Shard, current bool) (int64, error) {
+	var total int64
+	var last int64
+	for {
+		var rows []User
+		err := shard.Query(ctx).Clauses(dbresolver.Write).Where("id > ?", last).
+			Order("id").Limit(r.batch).Find(&rows).Error
+		if err != nil || len(rows) == 0 {
+			return total, err
+		}
+
+		for _, row := range rows {
+			if !r.stale(row) {
+				continue
+			}
+			ok, err := r.rotateRow(ctx, shard, row, current)
+			if err != nil {
+				return total, err
+			}
+			if ok {
+				total++
+			}
+		}
+		last = rows[len(rows)-1].Id
+	}
+}
+
+func (r *PiiRotator) stale(row User) bool {
+	c := r.u.pii
+	return row.BirthDay != 0 || c.Stale(row.Email) || c.Stale(row.Address) || c.Stale(row.BirthDayCipher)
+}
+
+func (r *PiiRotator) rotateRow(ctx context.Context, shard Shard, row User, current bool) (bool, error) {
+	plain := row
+	if err := r.u.open(ctx, &plain); err != nil {
+		r.u.logger.Sugar().Warnf("解密用户信息失败, 跳过重新加密, 用户: %d, 错误原因: %s", row.Id, err)
+		return false, nil
+	}
+	sealed := plain
+	if err := r.u.seal(ctx, &sealed); err != nil {
+		return false, err
+	}
+
+	res := shard.Query(ctx).Where("id = ? AND version = ?", row.Id, row.Version).
+		Updates(map[string]any{
+			"email":            sealed.Email,
+			"address":          sealed.Address,
+			"birth_day":        0,
+			"birth_day_cipher": sealed.BirthDayCipher,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 || !current || plain.Email == "" {
+		return res.RowsAffected > 0, nil
+	}
+
+	// 只替换仍然是明文的索引, 邮箱已经被修改时索引由修改负责
+	err := r.u.s.Index.WithContext(ctx).Model(&UserEmail{}).
+		Where("id = ? AND email = ?", row.Id, plain.Email).
+		Update("email", r.u.pii.BlindIndex(plain.Email)).Error
+	if err != nil {
+		r.u.logger.Sugar().Warnf("替换邮箱盲索引失败, 用户: %d, 错误原因: %s", row.Id, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,350 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+var (
+	ErrInsufficientPoints = errors.New("积分余额不足")
+	ErrBizRefConflict     = errors.New("业务流水号已被其他请求使用")
+)
+
+const (
+	PointsKindCredit = "credit"
+	PointsKindDebit  = "debit"
+	PointsKindExpire = "expire"
+)
+
+// 系统侧账户, 与用户账户构成复式记账的两端
+const (
+	pointsAccountIssued   = "system:issued"
+	pointsAccountRedeemed = "system:redeemed"
+	pointsAccountExpired  = "system:expired"
+)
+
+type PointsI interface {
+	// Credit 发放积分, 同一BizRef重复调用返回第一次的结果
+	Credit(ctx context.Context, t PointsTransaction) (PointsTransaction, error)
+	// Debit 扣减积分, 按过期时间先后消耗积分批次
+	Debit(ctx context.Context, t PointsTransaction) (PointsTransaction, error)
+	// Balance 返回余额以及在expireBefore之前将要过期的积分
+	Balance(ctx context.Context, uid int64, expireBefore int64) (int64, int64, error)
+	// ListTransactions 按id倒序分页, cursor为上一页最后一条记录的id
+	ListTransactions(ctx context.Context, uid int64, cursor int64, limit int) ([]PointsTransaction, error)
+	// ExpireDue 清理已过期的积分批次, 返回本次处理的用户数
+	ExpireDue(ctx context.Context, limit int) (int, error)
+}
+
+var _ PointsI = &points{}
+
+type points struct {
+	db *gorm.DB
+	// users 创建积分账户前确认用户存在于当前租户
+	users  UserI
+	logger *logger.Logger
+}
+
+func NewPointsDao(db *gorm.DB, users UserI, logger *logger.Logger) PointsI {
+	return &points{
+		db:     db,
+		users:  users,
+		logger: logger,
+	}
+}
+
+func (p *points) Credit(ctx context.Context, t PointsTransaction) (PointsTransaction, error) {
+	t.Kind = PointsKindCredit
+	return p.apply(ctx, t, func(tx *gorm.DB, acct *PointsAccount, t *PointsTransaction) error {
+		acct.Balance += t.Amount
+		t.Balance = acct.Balance
+		if err := p.record(tx, t, pointsAccountIssued); err != nil {
+			return err
+		}
+		return tx.Create(&PointsLot{
+			UserId:        t.UserId,
+			TenantId:      t.TenantId,
+			TransactionId: t.Id,
+			Amount:        t.Amount,
+			Remaining:     t.Amount,
+			ExpireAt:      t.ExpireAt,
+			CreateAt:      t.CreateAt,
+		}).Error
+	})
+}
+
+func (p *points) Debit(ctx context.Context, t PointsTransaction) (PointsTransaction, error) {
+	t.Kind = PointsKindDebit
+	t.ExpireAt = 0
+	amount := t.Amount
+	t.Amount = -amount
+	return p.apply(ctx, t, func(tx *gorm.DB, acct *PointsAccount, t *PointsTransaction) error {
+		if acct.Balance < amount {
+			return ErrInsufficientPoints
+		}
+
+		// 永不过期的批次最后消耗
+		var lots []PointsLot
+		err := tx.Scopes(byTenant(ctx)).Where("user_id = ? AND remaining > 0", t.UserId).
+			Order("expire_at = 0, expire_at, id").Find(&lots).Error
+		if err != nil {
+			return err
+		}
+
+		left := amount
+		for _, lot := range lots {
+			if left == 0 {
+				break
+			}
+			used := min(lot.Remaining, left)
+			err = tx.Model(&PointsLot{}).Where("id = ?", lot.Id).
+				Update("remaining", lot.Remaining-used).Error
+			if err != nil {
+				return err
+			}
+			left -= used
+		}
+
+		if left > 0 {
+			// 账户余额与批次不一致
+			p.logger.Sugar().Errorf("积分批次与余额不一致, 用户: %d, 差额: %d", t.UserId, left)
+			return ErrInsufficientPoints
+		}
+
+		acct.Balance -= amount
+		t.Balance = acct.Balance
+		return p.record(tx, t, pointsAccountRedeemed)
+	})
+}
+
+// Balance 只读, 不锁账户也不写入. 已过期但还未被ExpireDue清理的批次从余额中扣除,
+// 账户与批次在同一条语句中读取, 保证两者一致
+func (p *points) Balance(ctx context.Context, uid int64, expireBefore int64) (int64, int64, error) {
+	ctx = stickyUser(ctx, uid, "")
+	now := time.Now().UnixMilli()
+	lots := func(query string, args ...any) *gorm.DB {
+		return p.db.WithContext(ctx).Model(&PointsLot{}).Select("COALESCE(SUM(remaining), 0)").Scopes(byTenant(ctx)).
+			Where("user_id = ? AND remaining > 0 AND expire_at > 0", uid).Where(query, args...)
+	}
+
+	var row struct {
+		Balance  int64
+		Expired  int64
+		Expiring int64
+	}
+	res := p.db.WithContext(ctx).Model(&PointsAccount{}).
+		Select("balance, (?) AS expired, (?) AS expiring",
+			lots("expire_at <= ?", now), lots("expire_at > ? AND expire_at <= ?", now, expireBefore)).
+		Scopes(byTenant(ctx)).Where("user_id = ?", uid).Scan(&row)
+	if res.Error != nil {
+		p.logger.Sugar().Warnf("查询积分余额失败, 用户: %d, 错误原因: %s", uid, res.Error)
+		return 0, 0, res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		// 还没有积分账户, 用户存在时余额为0
+		if _, err := p.users.FindUserById(ctx, uid); err != nil {
+			return 0, 0, err
+		}
+		return 0, 0, nil
+	}
+	return row.Balance - row.Expired, row.Expiring, nil
+}
+
+func (p *points) ListTransactions(ctx context.Context, uid int64, cursor int64, limit int) ([]PointsTransaction, error) {
+	var txs []PointsTransaction
+	query := p.db.WithContext(stickyUser(ctx, uid, "")).Scopes(byTenant(ctx)).Where("user_id = ?", uid)
+	if cursor > 0 {
+		query = query.Where("id < ?", cursor)
+	}
+	err := query.Order("id desc").Limit(limit).Find(&txs).Error
+	if err != nil {
+		p.logger.Sugar().Warnf("查询积分流水失败, 用户: %d, 错误原因: %s", uid, err)
+		return nil, err
+	}
+	return txs, nil
+}
+
+// ExpireDue 处理所有租户的过期批次, 每个用户在自己所属的租户内清理
+func (p *points) ExpireDue(ctx context.Context, limit int) (int, error) {
+	var due []PointsLot
+	err := p.db.WithContext(ctx).Model(&PointsLot{}).Distinct("user_id", "tenant_id").
+		Where("remaining > 0 AND expire_at > 0 AND expire_at <= ?", time.Now().UnixMilli()).
+		Limit(limit).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, lot := range due {
+		// lockAccount会顺带清理过期批次
+		err = p.db.WithContext(tenant.WithTenant(ctx, lot.TenantId)).Transaction(func(tx *gorm.DB) error {
+			_, err := p.lockAccount(tx, lot.UserId)
+			return err
+		})
+		if err != nil {
+			p.logger.Sugar().Warnf("清理过期积分失败, 用户: %d, 错误原因: %s", lot.UserId, err)
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// apply 在一个事务中锁定账户, 清理过期批次后执行fn, 并保证同一BizRef只生效一次
+func (p *points) apply(ctx context.Context, t PointsTransaction,
+	fn func(tx *gorm.DB, acct *PointsAccount, t *PointsTransaction) error) (PointsTransaction, error) {
+	ctx = stickyUser(ctx, t.UserId, "")
+	existing, err := p.findByRef(ctx, t.Kind, t.BizRef)
+	if err == nil {
+		return replay(existing, t)
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return PointsTransaction{}, err
+	}
+
+	t.CreateAt = time.Now().UnixMilli()
+	t.TenantId = tenant.FromContext(ctx)
+	err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		acct, err := p.lockAccount(tx, t.UserId)
+		if err != nil {
+			return err
+		}
+
+		if err = fn(tx, &acct, &t); err != nil {
+			return err
+		}
+		return p.saveAccount(tx, acct)
+	})
+
+	if isUniqueConflict(err) {
+		// 并发的重复请求已先行提交
+		existing, err = p.findByRef(ctx, t.Kind, t.BizRef)
+		if err != nil {
+			return PointsTransaction{}, err
+		}
+		return replay(existing, t)
+	}
+
+	if err != nil && !errors.Is(err, ErrInsufficientPoints) {
+		p.logger.Sugar().Warnf("积分变动失败, 用户: %d, 业务流水: %s, 错误原因: %s", t.UserId, t.BizRef, err)
+	}
+
+	if err != nil {
+		return PointsTransaction{}, err
+	}
+	return t, nil
+}
+
+func (p *points) findByRef(ctx context.Context, kind, bizRef string) (PointsTransaction, error) {
+	var t PointsTransaction
+	err := p.db.WithContext(ctx).Scopes(byTenant(ctx)).Where("kind = ? AND biz_ref = ?", kind, bizRef).First(&t).Error
+	return t, err
+}
+
+// replay 重复请求必须与第一次请求的用户和金额一致
+func replay(existing, t PointsTransaction) (PointsTransaction, error) {
+	if existing.UserId != t.UserId || existing.Amount != t.Amount || existing.BizType != t.BizType {
+		return PointsTransaction{}, ErrBizRefConflict
+	}
+	return existing, nil
+}
+
+// lockAccount 锁定用户积分账户, 不存在时确认用户存在后在事务所属的租户中创建, 并清理已过期的积分批次.
+// 用户不存在或账户属于其他租户时返回ErrRecordNotFound
+func (p *points) lockAccount(tx *gorm.DB, uid int64) (PointsAccount, error) {
+	now := time.Now().UnixMilli()
+	ctx := tx.Statement.Context
+	acct, err := p.findAccount(tx, uid)
+	if errors.Is(err, ErrRecordNotFound) {
+		if _, err = p.users.FindUserById(ctx, uid); err != nil {
+			return PointsAccount{}, err
+		}
+		err = tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&PointsAccount{UserId: uid, TenantId: tenant.FromContext(ctx), UpdateAt: now}).Error
+		if err != nil {
+			return PointsAccount{}, err
+		}
+		acct, err = p.findAccount(tx, uid)
+	}
+	if err != nil {
+		return PointsAccount{}, err
+	}
+
+	var lots []PointsLot
+	err = tx.Scopes(byTenant(ctx)).Where("user_id = ? AND remaining > 0 AND expire_at > 0 AND expire_at <= ?", uid, now).
+		Find(&lots).Error
+	if err != nil || len(lots) == 0 {
+		return acct, err
+	}
+
+	for _, lot := range lots {
+		acct.Balance -= lot.Remaining
+		t := PointsTransaction{
+			UserId:   uid,
+			TenantId: acct.TenantId,
+			Kind:     PointsKindExpire,
+			BizType:  PointsKindExpire,
+			BizRef:   fmt.Sprintf("lot:%d", lot.Id),
+			Amount:   -lot.Remaining,
+			Balance:  acct.Balance,
+			CreateAt: now,
+		}
+		if err = p.record(tx, &t, pointsAccountExpired); err != nil {
+			return PointsAccount{}, err
+		}
+
+		err = tx.Model(&PointsLot{}).Where("id = ?", lot.Id).Update("remaining", 0).Error
+		if err != nil {
+			return PointsAccount{}, err
+		}
+	}
+	return acct, p.saveAccount(tx, acct)
+}
+
+func (p *points) findAccount(tx *gorm.DB, uid int64) (PointsAccount, error) {
+	var acct PointsAccount
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(byTenant(tx.Statement.Context)).
+		Where("user_id = ?", uid).First(&acct).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return PointsAccount{}, ErrRecordNotFound
+	}
+	return acct, err
+}
+
+func (p *points) saveAccount(tx *gorm.DB, acct PointsAccount) error {
+	return tx.Model(&PointsAccount{}).Where("user_id = ?", acct.UserId).
+		Updates(map[string]any{
+			"balance":   acct.Balance,
+			"update_at": time.Now().UnixMilli(),
+		}).Error
+}
+
+// record 写入交易以及一对金额相反的分录
+func (p *points) record(tx *gorm.DB, t *PointsTransaction, counterparty string) error {
+	if err := tx.Create(t).Error; err != nil {
+		return err
+	}
+
+	return tx.Create([]PointsEntry{
+		{
+			TransactionId: t.Id,
+			Account:       fmt.Sprintf("user:%d", t.UserId),
+			Amount:        t.Amount,
+			CreateAt:      t.CreateAt,
+		},
+		{
+			TransactionId: t.Id,
+			Account:       counterparty,
+			Amount:        -t.Amount,
+			CreateAt:      t.CreateAt,
+		},
+	}).Error
+}
@@ -0,0 +1,285 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func newTestPoints(t *testing.T) (*points, *gorm.DB, int64) {
+	t.Helper()
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 1)
+	uid := mustCreateUser(t, context.Background(), u, "points@ex.com")
+	return NewPointsDao(db, u, newTestLogger()).(*points), db, uid
+}
+
+func credit(uid int64, ref string, amount, expireAt int64) PointsTransaction {
+	return PointsTransaction{UserId: uid, BizType: "order", BizRef: ref, Amount: amount, ExpireAt: expireAt}
+}
+
+func mustCredit(t *testing.T, p *points, c PointsTransaction) PointsTransaction {
+	t.Helper()
+	res, err := p.Credit(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// checkLedger 余额等于用户分录之和, 每笔交易的分录之和为0
+func checkLedger(t *testing.T, db *gorm.DB, uid int64, balance int64) {
+	t.Helper()
+	var acct PointsAccount
+	if err := db.Where("user_id = ?", uid).First(&acct).Error; err != nil {
+		t.Fatal(err)
+	}
+	if acct.Balance != balance {
+		t.Fatalf("余额为%d, 期望%d", acct.Balance, balance)
+	}
+
+	var sum, unbalanced int64
+	db.Model(&PointsEntry{}).Select("COALESCE(SUM(amount), 0)").Where("account = ?", fmt.Sprintf("user:%d", uid)).Scan(&sum)
+	if sum != balance {
+		t.Fatalf("用户分录之和为%d, 余额为%d", sum, balance)
+	}
+	db.Raw("SELECT COUNT(*) FROM (SELECT transaction_id FROM points_entries GROUP BY transaction_id HAVING SUM(amount) <> 0) t").
+		Scan(&unbalanced)
+	if unbalanced != 0 {
+		t.Fatalf("%d笔交易的分录不平", unbalanced)
+	}
+}
+
+func TestPointsCreditReplay(t *testing.T) {
+	p, db, uid := newTestPoints(t)
+	ctx := context.Background()
+
+	first, err := p.Credit(ctx, credit(uid, "order-1", 100, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		again, err := p.Credit(ctx, credit(uid, "order-1", 100, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Id != first.Id || again.Balance != 100 {
+			t.Fatalf("重复请求返回了新的交易: %+v", again)
+		}
+	}
+	checkLedger(t, db, uid, 100)
+}
+
+func TestPointsCreditConflict(t *testing.T) {
+	p, db, uid := newTestPoints(t)
+	ctx := context.Background()
+
+	if _, err := p.Credit(ctx, credit(uid, "order-1", 100, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Credit(ctx, credit(uid, "order-1", 200, 0)); !errors.Is(err, ErrBizRefConflict) {
+		t.Fatalf("金额不同的重复请求应返回ErrBizRefConflict, 实际: %v", err)
+	}
+	other := credit(uid, "order-1", 100, 0)
+	other.BizType = "refund"
+	if _, err := p.Credit(ctx, other); !errors.Is(err, ErrBizRefConflict) {
+		t.Fatalf("业务类型不同的重复请求应返回ErrBizRefConflict, 实际: %v", err)
+	}
+	checkLedger(t, db, uid, 100)
+}
+
+// 两个请求都在查询流水号之后才进入事务, 后提交的一方触发唯一键冲突并返回先提交的结果
+func TestPointsConcurrentDuplicate(t *testing.T) {
+	p, db, uid := newTestPoints(t)
+	ctx := context.Background()
+
+	const n = 2
+	var misses atomic.Int32
+	var barrier sync.WaitGroup
+	barrier.Add(n)
+	err := db.Callback().Query().After("gorm:query").Register("test:barrier", func(tx *gorm.DB) {
+		if tx.Statement.Table == "points_transactions" && tx.RowsAffected == 0 && misses.Add(1) <= n {
+			barrier.Done()
+			barrier.Wait()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	res := make([]PointsTransaction, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res[i], errs[i] = p.Credit(ctx, credit(uid, "order-1", 100, 0))
+		}(i)
+	}
+	wg.Wait()
+
+	if misses.Load() < n {
+		t.Fatal("请求没有同时越过流水号查询, 未覆盖唯一键冲突的分支")
+	}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if res[i].Id != res[0].Id {
+			t.Fatalf("并发的重复请求生成了不同的交易: %d, %d", res[0].Id, res[i].Id)
+		}
+	}
+	var count int64
+	db.Model(&PointsTransaction{}).Where("biz_ref = ?", "order-1").Count(&count)
+	if count != 1 {
+		t.Fatalf("交易数为%d", count)
+	}
+	checkLedger(t, db, uid, 100)
+}
+
+func TestPointsDebitFIFO(t *testing.T) {
+	p, db, uid := newTestPoints(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	later := mustCredit(t, p, credit(uid, "later", 100, now.Add(2*time.Hour).UnixMilli()))
+	sooner := mustCredit(t, p, credit(uid, "sooner", 100, now.Add(time.Hour).UnixMilli()))
+	never := mustCredit(t, p, credit(uid, "never", 100, 0))
+
+	debit := func(ref string, amount int64) (PointsTransaction, error) {
+		return p.Debit(ctx, PointsTransaction{UserId: uid, BizType: "redeem", BizRef: ref, Amount: amount})
+	}
+	remaining := func(txId int64) int64 {
+		var lot PointsLot
+		if err := db.Where("transaction_id = ?", txId).First(&lot).Error; err != nil {
+			t.Fatal(err)
+		}
+		return lot.Remaining
+	}
+
+	res, err := debit("redeem-1", 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Amount != -150 || res.Balance != 150 {
+		t.Fatalf("扣减结果不正确: %+v", res)
+	}
+	if remaining(sooner.Id) != 0 || remaining(later.Id) != 50 || remaining(never.Id) != 100 {
+		t.Fatalf("没有按过期时间先后扣减: %d, %d, %d", remaining(sooner.Id), remaining(later.Id), remaining(never.Id))
+	}
+
+	if _, err = debit("redeem-2", 151); !errors.Is(err, ErrInsufficientPoints) {
+		t.Fatalf("余额不足时应返回ErrInsufficientPoints, 实际: %v", err)
+	}
+	if _, err = debit("redeem-3", 120); err != nil {
+		t.Fatal(err)
+	}
+	if remaining(later.Id) != 0 || remaining(never.Id) != 30 {
+		t.Fatalf("永不过期的批次应最后扣减: %d, %d", remaining(later.Id), remaining(never.Id))
+	}
+	checkLedger(t, db, uid, 30)
+}
+
+func TestPointsExpireDue(t *testing.T) {
+	p, db, uid := newTestPoints(t)
+	ctx := context.Background()
+
+	expiring, err := p.Credit(ctx, credit(uid, "expiring", 80, time.Now().Add(time.Hour).UnixMilli()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Credit(ctx, credit(uid, "never", 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&PointsLot{}).Where("transaction_id = ?", expiring.Id).
+		Update("expire_at", time.Now().Add(-time.Minute).UnixMilli()).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := p.ExpireDue(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("处理的用户数为%d", n)
+	}
+	var expired PointsTransaction
+	if err = db.Where("kind = ?", PointsKindExpire).First(&expired).Error; err != nil {
+		t.Fatal(err)
+	}
+	if expired.Amount != -80 || expired.Balance != 20 {
+		t.Fatalf("过期交易不正确: %+v", expired)
+	}
+	checkLedger(t, db, uid, 20)
+
+	if n, err = p.ExpireDue(ctx, 100); err != nil || n != 0 {
+		t.Fatalf("再次清理应没有过期批次: %d, %v", n, err)
+	}
+}
+
+func TestPointsBalanceReadOnly(t *testing.T) {
+	p, db, uid := newTestPoints(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	expired := mustCredit(t, p, credit(uid, "expired", 80, now.Add(time.Hour).UnixMilli()))
+	mustCredit(t, p, credit(uid, "soon", 50, now.Add(3*24*time.Hour).UnixMilli()))
+	mustCredit(t, p, credit(uid, "never", 20, 0))
+	err := db.Model(&PointsLot{}).Where("transaction_id = ?", expired.Id).
+		Update("expire_at", now.Add(-time.Minute).UnixMilli()).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 已过期的批次不计入余额, 也不计入即将过期
+	balance, expiring, err := p.Balance(ctx, uid, now.Add(4*24*time.Hour).UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 70 || expiring != 50 {
+		t.Fatalf("余额为%d, 即将过期%d, 期望70和50", balance, expiring)
+	}
+
+	// 查询余额不写入过期交易, 清理留给ExpireDue
+	var count int64
+	db.Model(&PointsTransaction{}).Where("kind = ?", PointsKindExpire).Count(&count)
+	if count != 0 {
+		t.Fatalf("查询余额写入了%d笔过期交易", count)
+	}
+	checkLedger(t, db, uid, 150)
+
+	// 没有积分账户的用户余额为0, 也不创建账户
+	other := mustCreateUser(t, ctx, p.users, "other@ex.com")
+	if balance, expiring, err = p.Balance(ctx, other, now.UnixMilli()); err != nil || balance != 0 || expiring != 0 {
+		t.Fatalf("没有积分账户时应返回0, 实际: %d, %d, %v", balance, expiring, err)
+	}
+	db.Model(&PointsAccount{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("查询余额创建了积分账户, 账户数: %d", count)
+	}
+}
+
+func TestPointsUnknownUser(t *testing.T) {
+	p, db, uid := newTestPoints(t)
+	ctx := context.Background()
+
+	if _, err := p.Credit(ctx, credit(uid+1, "order-1", 100, 0)); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("不存在的用户应返回ErrRecordNotFound, 实际: %v", err)
+	}
+	if _, _, err := p.Balance(ctx, uid+1, 0); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("不存在的用户应返回ErrRecordNotFound, 实际: %v", err)
+	}
+	var count int64
+	db.Model(&PointsAccount{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("为不存在的用户创建了%d个积分账户", count)
+	}
+}
@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+var ErrVersionConflict = errors.New("版本冲突")
+
+type PreferenceI interface {
+	FindPreferences(ctx context.Context, uid int64) ([]Preference, error)
+	// SavePreference 按乐观锁写入偏好, version为调用方读到的版本, 0表示首次写入
+	SavePreference(ctx context.Context, pref Preference, version int64) (Preference, error)
+}
+
+var _ PreferenceI = &preference{}
+
+type preference struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+func NewPreferenceDao(db *gorm.DB, logger *logger.Logger) PreferenceI {
+	return &preference{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (p *preference) FindPreferences(ctx context.Context, uid int64) ([]Preference, error) {
+	var prefs []Preference
+	err := p.db.WithContext(stickyUser(ctx, uid, "")).Scopes(byTenant(ctx)).Where("user_id = ?", uid).Find(&prefs).Error
+	if err != nil {
+		p.logger.Sugar().Warnf("查询用户偏好失败, 错误原因: %s", err)
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func (p *preference) SavePreference(ctx context.Context, pref Preference, version int64) (Preference, error) {
+	now := time.Now().UnixMilli()
+	pref.UpdateAt = now
+	pref.Version = version + 1
+	ctx = stickyUser(ctx, pref.UserId, "")
+
+	if version == 0 {
+		pref.CreateAt = now
+		pref.TenantId = tenant.FromContext(ctx)
+		err := p.db.WithContext(ctx).Create(&pref).Error
+		if isUniqueConflict(err) {
+			// 已被其他请求先行创建
+			return Preference{}, ErrVersionConflict
+		}
+
+		if err != nil {
+			p.logger.Sugar().Warnf("数据库错误, 错误原因: %s", err)
+			return Preference{}, err
+		}
+		return pref, nil
+	}
+
+	res := p.db.WithContext(ctx).Model(&Preference{}).Scopes(byTenant(ctx)).
+		Where(map[string]any{"user_id": pref.UserId, "key": pref.Key, "version": version}).
+		Updates(map[string]any{
+			"value":     pref.Value,
+			"version":   pref.Version,
+			"update_at": now,
+		})
+	if res.Error != nil {
+		p.logger.Sugar().Warnf("数据库错误, 错误原因: %s", res.Error)
+		return Preference{}, res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return Preference{}, ErrVersionConflict
+	}
+	return pref, nil
+}
@@ -0,0 +1,220 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+var ErrNotResharding = errors.New("未配置重新分表的目标分表数")
+
+const defaultReshardBatch = 500
+
+// Resharder 在线搬迁用户到新的分表. 搬迁前所有实例需要已经按next_tables开启双写,
+// 这样目标分表中已有的行总是比存量数据新
+type Resharder struct {
+	s      *Sharding
+	batch  int
+	logger *logger.Logger
+}
+
+func NewResharder(s *Sharding, batch int, logger *logger.Logger) (*Resharder, error) {
+	if s.Next == nil {
+		return nil, ErrNotResharding
+	}
+	if batch <= 0 {
+		batch = defaultReshardBatch
+	}
+	return &Resharder{
+		s:      s,
+		batch:  batch,
+		logger: logger,
+	}, nil
+}
+
+// Copy 按id顺序分批复制存量数据, 目标分表中已经存在的行不覆盖, 返回复制的行数
+func (r *Resharder) Copy(ctx context.Context) (int64, error) {
+	var total int64
+	for _, src := range r.s.Current.Shards() {
+		n, err := r.scan(ctx, src, func(users []User) (int64, error) {
+			return r.copyBatch(ctx, src, users)
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+		r.logger.Sugar().Infof("分表%s复制完成, 复制行数: %d", src.Table, n)
+	}
+	return total, nil
+}
+
+// Verify 逐行比较新旧分表并修复不一致的行, 包括目标分表中多出来的行, 返回修复的行数
+func (r *Resharder) Verify(ctx context.Context) (int64, error) {
+	var total int64
+	for _, src := range r.s.Current.Shards() {
+		n, err := r.scan(ctx, src, func(users []User) (int64, error) {
+			return r.repairBatch(ctx, src, users)
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	for _, dst := range r.s.Next.Shards() {
+		n, err := r.scan(ctx, dst, func(users []User) (int64, error) {
+			return r.removeOrphans(ctx, users)
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// scan 按id顺序分批读取分表, 始终读主库避免复制延迟
+func (r *Resharder) scan(ctx context.Context, s Shard, fn func(users []User) (int64, error)) (int64, error) {
+	var total int64
+	var last int64
+	for {
+		var users []User
+		err := s.Query(ctx).Clauses(dbresolver.Write).Where("id > ?", last).
+			Order("id").Limit(r.batch).Find(&users).Error
+		if err != nil {
+			return total, err
+		}
+		if len(users) == 0 {
+			return total, nil
+		}
+
+		n, err := fn(users)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		last = users[len(users)-1].Id
+	}
+}
+
+func (r *Resharder) copyBatch(ctx context.Context, src Shard, users []User) (int64, error) {
+	var total int64
+	for dst, group := range r.group(users) {
+		res := dst.Query(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&group)
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+	}
+
+	// 读取之后被删除的用户可能已经复制到目标分表, 复制后再确认一次
+	ids := make([]int64, 0, len(users))
+	for _, ue := range users {
+		ids = append(ids, ue.Id)
+	}
+	var alive []int64
+	err := src.Query(ctx).Clauses(dbresolver.Write).Where("id IN ?", ids).Pluck("id", &alive).Error
+	if err != nil {
+		return total, err
+	}
+
+	exists := make(map[int64]struct{}, len(alive))
+	for _, id := range alive {
+		exists[id] = struct{}{}
+	}
+	for _, id := range ids {
+		if _, ok := exists[id]; ok {
+			continue
+		}
+		if err = r.s.Next.Route(id).Query(ctx).Delete(&User{Id: id}).Error; err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r *Resharder) repairBatch(ctx context.Context, src Shard, users []User) (int64, error) {
+	var total int64
+	for dst, group := range r.group(users) {
+		ids := make([]int64, 0, len(group))
+		for _, ue := range group {
+			ids = append(ids, ue.Id)
+		}
+
+		var copied []User
+		if err := dst.Query(ctx).Where("id IN ?", ids).Find(&copied).Error; err != nil {
+			return total, err
+		}
+		byId := make(map[int64]User, len(copied))
+		for _, ue := range copied {
+			byId[ue.Id] = ue
+		}
+
+		for _, ue := range group {
+			got, ok := byId[ue.Id]
+			if ok && got == ue {
+				continue
+			}
+
+			// 比较期间可能有新的写入, 重新读取旧分表, 只用不比目标分表旧的数据覆盖
+			var fresh User
+			err := src.Query(ctx).Clauses(dbresolver.Write).Where("id = ?", ue.Id).First(&fresh).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return total, err
+			}
+			if ok && fresh.UpdateAt < got.UpdateAt {
+				continue
+			}
+
+			err = dst.Query(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&fresh).Error
+			if err != nil {
+				return total, err
+			}
+			r.logger.Sugar().Infof("修复新分表中的用户, 用户: %d, 分表: %s", ue.Id, dst.Table)
+			total++
+		}
+	}
+	return total, nil
+}
+
+// removeOrphans 删除目标分表中在旧分表已经不存在的行
+func (r *Resharder) removeOrphans(ctx context.Context, users []User) (int64, error) {
+	var total int64
+	for _, ue := range users {
+		src := r.s.Current.Route(ue.Id)
+		var n int64
+		err := src.Query(ctx).Clauses(dbresolver.Write).Where("id = ?", ue.Id).Count(&n).Error
+		if err != nil {
+			return total, err
+		}
+		if n > 0 {
+			continue
+		}
+
+		dst := r.s.Next.Route(ue.Id)
+		if err = dst.Query(ctx).Delete(&User{Id: ue.Id}).Error; err != nil {
+			return total, err
+		}
+		r.logger.Sugar().Infof("删除新分表中多余的用户, 用户: %d, 分表: %s", ue.Id, dst.Table)
+		total++
+	}
+	return total, nil
+}
+
+// group 按目标分表分组
+func (r *Resharder) group(users []User) map[Shard][]User {
+	groups := make(map[Shard][]User)
+	for _, ue := range users {
+		dst := r.s.Next.Route(ue.Id)
+		groups[dst] = append(groups[dst], ue)
+	}
+	return groups
+}
@@ -0,0 +1,157 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// newTestResharder 先按2张分表写入用户, 再按4张分表开启双写
+func newTestResharder(t *testing.T, n int) (*gorm.DB, *Sharding, []int64) {
+	t.Helper()
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 2)
+	ctx := context.Background()
+
+	ids := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		ids = append(ids, mustCreateUser(t, ctx, u, fmt.Sprintf("user%d@ex.com", i)))
+	}
+
+	s := NewSharding([]*gorm.DB{db}, 2, 4)
+	if err := s.EnsureTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return db, s, ids
+}
+
+// checkResharded 每个用户都在新分表中对应的表里, 并且与旧分表一致
+func checkResharded(t *testing.T, s *Sharding, ids []int64) {
+	t.Helper()
+	ctx := context.Background()
+	var total int64
+	for _, dst := range s.Next.Shards() {
+		var n int64
+		if err := dst.Query(ctx).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		total += n
+	}
+	if total != int64(len(ids)) {
+		t.Fatalf("新分表中有%d行, 期望%d", total, len(ids))
+	}
+
+	for _, id := range ids {
+		var old, copied User
+		if err := s.Current.Route(id).Query(ctx).Where("id = ?", id).First(&old).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Next.Route(id).Query(ctx).Where("id = ?", id).First(&copied).Error; err != nil {
+			t.Fatalf("用户%d不在新分表%s中: %v", id, s.Next.Route(id).Table, err)
+		}
+		if old != copied {
+			t.Fatalf("用户%d新旧分表不一致", id)
+		}
+	}
+}
+
+func TestResharderCopy(t *testing.T) {
+	_, s, ids := newTestResharder(t, 7)
+	r, err := NewResharder(s, 3, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	n, err := r.Copy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(ids)) {
+		t.Fatalf("复制了%d行, 期望%d", n, len(ids))
+	}
+	checkResharded(t, s, ids)
+
+	// 重复执行不覆盖已有的行
+	if n, err = r.Copy(ctx); err != nil || n != 0 {
+		t.Fatalf("再次复制应为0行: %d, %v", n, err)
+	}
+}
+
+func TestResharderVerify(t *testing.T) {
+	_, s, ids := newTestResharder(t, 5)
+	r, err := NewResharder(s, 2, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err = r.Copy(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟双写失败: 旧分表中的修改没有同步, 删除也没有同步
+	changed, deleted := ids[0], ids[1]
+	err = s.Current.Route(changed).Query(ctx).Where("id = ?", changed).
+		Updates(map[string]any{"nick_name": "changed", "update_at": gorm.Expr("update_at + 1")}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Current.Route(deleted).Query(ctx).Delete(&User{Id: deleted}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 新分表中缺少的行
+	missing := ids[2]
+	if err = s.Next.Route(missing).Query(ctx).Delete(&User{Id: missing}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := r.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("修复了%d行, 期望3", n)
+	}
+	checkResharded(t, s, append([]int64{ids[0]}, ids[2:]...))
+
+	if n, err = r.Verify(ctx); err != nil || n != 0 {
+		t.Fatalf("再次校验应为0行: %d, %v", n, err)
+	}
+}
+
+func TestResharderDualWrite(t *testing.T) {
+	db, s, ids := newTestResharder(t, 1)
+	u, _ := newTestUserDao(t, db, 2)
+	u.s = s
+	ctx := context.Background()
+
+	uid := mustCreateUser(t, ctx, u, "dual@ex.com")
+	if _, err := u.UpdateUserInfoByUid(ctx, User{Id: ids[0], NickName: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	var created, updated User
+	if err := s.Next.Route(uid).Query(ctx).Where("id = ?", uid).First(&created).Error; err != nil {
+		t.Fatalf("新注册的用户没有写入新分表: %v", err)
+	}
+	if err := s.Next.Route(ids[0]).Query(ctx).Where("id = ?", ids[0]).First(&updated).Error; err != nil || updated.NickName != "updated" {
+		t.Fatalf("修改没有同步到新分表: %+v, %v", updated, err)
+	}
+
+	if err := u.DeleteUser(ctx, uid); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Next.Route(uid).Query(ctx).Where("id = ?", uid).First(&User{}).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("删除没有同步到新分表: %v", err)
+	}
+}
+
+func TestNewResharderWithoutNext(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := NewResharder(NewSharding([]*gorm.DB{db}, 2, 0), 0, newTestLogger()); !errors.Is(err, ErrNotResharding) {
+		t.Fatalf("没有配置目标分表数时应返回ErrNotResharding, 实际: %v", err)
+	}
+}
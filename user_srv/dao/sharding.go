@@ -0,0 +1,234 @@
+package dao
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/Numsina/tk_users/user_srv/pkg/migrate"
+)
+
+// 每种方言一个建表模板, %[1]s为分表名
+//
+//go:embed shards
+var shardTemplates embed.FS
+
+// Shard 一张用户分表以及它所在的库
+type Shard struct {
+	DB    *gorm.DB
+	Table string
+}
+
+func (s Shard) Query(ctx context.Context) *gorm.DB {
+	return s.DB.WithContext(ctx).Table(s.Table)
+}
+
+// Layout 一种分表方式, 用户按 id % 分表数 路由, 分表按序号轮流放在各个库中
+type Layout struct {
+	shards []Shard
+}
+
+// NewLayout dbs的第一个为主库, 只有一张表时使用迁移创建的users表
+func NewLayout(dbs []*gorm.DB, tables int) Layout {
+	if tables <= 1 {
+		return Layout{shards: []Shard{{DB: dbs[0], Table: ShardTable(1, 0)}}}
+	}
+
+	shards := make([]Shard, 0, tables)
+	for i := 0; i < tables; i++ {
+		shards = append(shards, Shard{DB: dbs[i%len(dbs)], Table: ShardTable(tables, i)})
+	}
+	return Layout{shards: shards}
+}
+
+// ShardTable 分表名包含分表数, 重新分表时新旧两种分表可以共存
+func ShardTable(tables, i int) string {
+	if tables <= 1 {
+		return "users"
+	}
+	return fmt.Sprintf("users_%d_%d", tables, i)
+}
+
+// Route 外部传入的id可能为负数, 负数的余数换算到[0, 分表数)内, 查询时按用户不存在处理
+func (l Layout) Route(uid int64) Shard {
+	i := uid % int64(len(l.shards))
+	if i < 0 {
+		i += int64(len(l.shards))
+	}
+	return l.shards[i]
+}
+
+func (l Layout) Shards() []Shard {
+	return l.shards
+}
+
+func (l Layout) Size() int {
+	return len(l.shards)
+}
+
+// EnsureTables 创建缺少的分表
+func (l Layout) EnsureTables(ctx context.Context) error {
+	if len(l.shards) == 1 {
+		// users表由迁移创建
+		return nil
+	}
+
+	for _, s := range l.shards {
+		tmpl, err := shardTemplates.ReadFile(fmt.Sprintf("shards/%s.sql", s.DB.Dialector.Name()))
+		if err != nil {
+			return err
+		}
+		for _, stmt := range migrate.Split(fmt.Sprintf(string(tmpl), s.Table)) {
+			if err = s.DB.WithContext(ctx).Exec(stmt).Error; err != nil {
+				return fmt.Errorf("创建分表%s失败: %w", s.Table, err)
+			}
+		}
+		if err = upgradeShard(ctx, s); err != nil {
+			return fmt.Errorf("升级分表%s失败: %w", s.Table, err)
+		}
+	}
+	return nil
+}
+
+// shardUpgrades 旧版本创建的分表需要的修改, need返回true时执行shards/<name>_<方言>.sql
+var shardUpgrades = []struct {
+	name string
+	need func(s Shard) (bool, error)
+}{
+	{name: "widen", need: narrowId},
+	{name: "pii", need: func(s Shard) (bool, error) {
+		return !s.DB.Migrator().HasColumn(s.Table, "birth_day_cipher"), nil
+	}},
+	{name: "tenant", need: func(s Shard) (bool, error) {
+		return !s.DB.Migrator().HasColumn(s.Table, "tenant_id"), nil
+	}},
+}
+
+func upgradeShard(ctx context.Context, s Shard) error {
+	for _, up := range shardUpgrades {
+		need, err := up.need(s)
+		if err != nil {
+			return err
+		}
+		if !need {
+			continue
+		}
+
+		tmpl, err := shardTemplates.ReadFile(fmt.Sprintf("shards/%s_%s.sql", up.name, s.DB.Dialector.Name()))
+		if err != nil {
+			return err
+		}
+		for _, stmt := range migrate.Split(fmt.Sprintf(string(tmpl), s.Table)) {
+			if err = s.DB.WithContext(ctx).Exec(stmt).Error; err != nil {
+				return fmt.Errorf("%s: %w", up.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// narrowId 旧版本创建的分表id为32位, sqlite的integer本身就是64位
+func narrowId(s Shard) (bool, error) {
+	if s.DB.Dialector.Name() == "sqlite" {
+		return false, nil
+	}
+	return hasNarrowId(s)
+}
+
+// hasNarrowId 按声明的列类型判断id是否为32位
+func hasNarrowId(s Shard) (bool, error) {
+	cols, err := s.DB.Migrator().ColumnTypes(s.Table)
+	if err != nil {
+		return false, err
+	}
+	for _, col := range cols {
+		if col.Name() == "id" {
+			switch strings.ToLower(col.DatabaseTypeName()) {
+			case "int", "int4", "integer":
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Sharding 用户表的分表方式. 重新分表期间Next不为空, 所有写入同时落到新旧两种分表,
+// 读取仍然使用Current, 存量数据由reshard命令搬迁
+type Sharding struct {
+	// Index 全局邮箱索引所在的库
+	Index   *gorm.DB
+	Current Layout
+	Next    *Layout
+}
+
+func NewSharding(dbs []*gorm.DB, tables, next int) *Sharding {
+	s := &Sharding{
+		Index:   dbs[0],
+		Current: NewLayout(dbs, tables),
+	}
+	if next > 0 && next != tables {
+		layout := NewLayout(dbs, next)
+		s.Next = &layout
+	}
+	return s
+}
+
+// EnsureTables 创建当前以及重新分表目标的分表, 以及其他库中的outbox表
+func (s *Sharding) EnsureTables(ctx context.Context) error {
+	if err := s.Current.EnsureTables(ctx); err != nil {
+		return err
+	}
+	if s.Next != nil {
+		if err := s.Next.EnsureTables(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, db := range s.DBs()[1:] {
+		tmpl, err := shardTemplates.ReadFile(fmt.Sprintf("shards/outbox_%s.sql", db.Dialector.Name()))
+		if err != nil {
+			return err
+		}
+		for _, stmt := range migrate.Split(string(tmpl)) {
+			if err = db.WithContext(ctx).Exec(stmt).Error; err != nil {
+				return fmt.Errorf("创建outbox表失败: %w", err)
+			}
+		}
+
+		if db.Migrator().HasColumn("outbox_events", "tenant_id") {
+			continue
+		}
+		tmpl, err = shardTemplates.ReadFile(fmt.Sprintf("shards/outbox_tenant_%s.sql", db.Dialector.Name()))
+		if err != nil {
+			return err
+		}
+		for _, stmt := range migrate.Split(string(tmpl)) {
+			if err = db.WithContext(ctx).Exec(stmt).Error; err != nil {
+				return fmt.Errorf("升级outbox表失败: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// DBs 返回分表用到的所有库, 第一个为Index所在的库. 用户事件写入分表所在库的outbox
+func (s *Sharding) DBs() []*gorm.DB {
+	dbs := []*gorm.DB{s.Index}
+	seen := map[*gorm.DB]struct{}{s.Index: {}}
+	layouts := []Layout{s.Current}
+	if s.Next != nil {
+		layouts = append(layouts, *s.Next)
+	}
+	for _, l := range layouts {
+		for _, shard := range l.shards {
+			if _, ok := seen[shard.DB]; !ok {
+				seen[shard.DB] = struct{}{}
+				dbs = append(dbs, shard.DB)
+			}
+		}
+	}
+	return dbs
+}
@@ -0,0 +1,66 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestLayoutRoute(t *testing.T) {
+	db := newTestDB(t)
+	l := NewLayout([]*gorm.DB{db}, 4)
+
+	for _, uid := range []int64{1, 4, 7, math.MaxInt64} {
+		if got, want := l.Route(uid).Table, ShardTable(4, int(uid%4)); got != want {
+			t.Fatalf("用户%d路由到%s, 期望%s", uid, got, want)
+		}
+	}
+	// 负数和0不能越界
+	for _, uid := range []int64{0, -1, -4, -7, math.MinInt64} {
+		l.Route(uid)
+	}
+}
+
+func TestFindUserByNegativeId(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 4)
+	ctx := context.Background()
+	mustCreateUser(t, ctx, u, "alice@ex.com")
+
+	for _, uid := range []int64{0, -1, math.MinInt64} {
+		if _, err := u.FindUserById(ctx, uid); !errors.Is(err, ErrRecordNotFound) {
+			t.Fatalf("用户%d应不存在, 实际: %v", uid, err)
+		}
+	}
+}
+
+func TestNarrowId(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	for table, typ := range map[string]string{"narrow_int": "INT", "narrow_integer": "INTEGER", "wide": "BIGINT"} {
+		if err := db.Exec("CREATE TABLE " + table + " (id " + typ + " PRIMARY KEY, nick_name TEXT)").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for table, want := range map[string]bool{"narrow_int": true, "narrow_integer": true, "wide": false} {
+		got, err := hasNarrowId(Shard{DB: db, Table: table})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("%s的id是否为32位: %v, 期望%v", table, got, want)
+		}
+	}
+
+	// sqlite的integer本身就是64位, 不执行widen
+	if need, err := narrowId(Shard{DB: db, Table: "narrow_int"}); err != nil || need {
+		t.Fatalf("sqlite不需要修改id的类型: %v, %v", need, err)
+	}
+	if err := NewLayout([]*gorm.DB{db}, 2).EnsureTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,18 @@
+-- 用户分表, %[1]s为分表名, 结构与users一致, id由snowflake生成, 邮箱唯一由user_emails保证
+CREATE TABLE IF NOT EXISTS `%[1]s` (
+  `id` bigint NOT NULL,
+  `tenant_id` varchar(64) NOT NULL DEFAULT 'default',
+  `email` varchar(1024) DEFAULT NULL,
+  `password` longtext,
+  `nick_name` longtext,
+  `description` longtext,
+  `avatar` longtext,
+  `address` longtext,
+  `birth_day` bigint DEFAULT NULL,
+  `birth_day_cipher` varchar(512) DEFAULT NULL,
+  `create_at` bigint DEFAULT NULL,
+  `update_at` bigint DEFAULT NULL,
+  `delete_at` bigint DEFAULT NULL,
+  `version` bigint NOT NULL DEFAULT 1,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+-- 存放分表的其他库中的outbox, 与迁移000004_outbox_events、000008_tenants一致
+CREATE TABLE IF NOT EXISTS `outbox_events` (`id` integer PRIMARY KEY AUTOINCREMENT,`event_id` varchar(64) NOT NULL,`event_type` varchar(64) NOT NULL,`tenant_id` varchar(64) NOT NULL DEFAULT 'default',`aggregate_id` integer NOT NULL,`payload` blob NOT NULL,`create_at` integer NOT NULL,`published_at` integer NOT NULL DEFAULT 0,CONSTRAINT `uni_outbox_events_event_id` UNIQUE (`event_id`));
+CREATE INDEX IF NOT EXISTS `idx_outbox_events_published_at` ON `outbox_events`(`published_at`,`id`);
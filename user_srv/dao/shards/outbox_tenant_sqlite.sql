@@ -0,0 +1,2 @@
+-- 旧版本创建的outbox没有租户, 已有的事件属于默认租户
+ALTER TABLE `outbox_events` ADD COLUMN `tenant_id` varchar(64) NOT NULL DEFAULT 'default';
@@ -0,0 +1,4 @@
+-- 旧版本创建的分表没有加密字段
+ALTER TABLE `%[1]s` DROP INDEX `uni_%[1]s_email`;
+ALTER TABLE `%[1]s` MODIFY `email` varchar(1024) DEFAULT NULL;
+ALTER TABLE `%[1]s` ADD COLUMN `birth_day_cipher` varchar(512) DEFAULT NULL;
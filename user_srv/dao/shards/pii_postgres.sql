@@ -0,0 +1,3 @@
+-- 旧版本创建的分表没有加密字段
+ALTER TABLE %[1]s DROP CONSTRAINT IF EXISTS uni_%[1]s_email;
+ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS birth_day_cipher text;
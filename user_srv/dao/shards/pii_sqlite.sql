@@ -0,0 +1,2 @@
+-- 旧版本创建的分表没有加密字段
+ALTER TABLE `%[1]s` ADD COLUMN `birth_day_cipher` text;
@@ -0,0 +1,2 @@
+-- 用户分表, %[1]s为分表名, 结构与users一致, id由snowflake生成, 邮箱唯一由user_emails保证
+CREATE TABLE IF NOT EXISTS `%[1]s` (`id` integer PRIMARY KEY,`tenant_id` varchar(64) NOT NULL DEFAULT 'default',`email` text,`password` text,`nick_name` text,`description` text,`avatar` text,`address` text,`birth_day` integer,`birth_day_cipher` text,`create_at` integer,`update_at` integer,`delete_at` integer,`version` integer NOT NULL DEFAULT 1);
@@ -0,0 +1,2 @@
+-- 旧版本创建的分表没有租户, 已有的用户属于默认租户
+ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS tenant_id varchar(64) NOT NULL DEFAULT 'default';
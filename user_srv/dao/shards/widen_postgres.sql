@@ -0,0 +1,2 @@
+-- 旧版本创建的分表id为32位, 改为64位
+ALTER TABLE %[1]s ALTER COLUMN id TYPE bigint;
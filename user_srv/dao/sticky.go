@@ -0,0 +1,29 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Numsina/tk_users/user_srv/pkg/gormx"
+)
+
+// stickyUser 标记本次操作涉及的用户, 配置从库时该用户写入后的读取会固定到主库.
+// emailIndex为邮箱的盲索引, 标记保存在redis中, 不能使用明文邮箱
+func stickyUser(ctx context.Context, uid int64, emailIndex string) context.Context {
+	var keys []string
+	if uid > 0 {
+		keys = append(keys, fmt.Sprintf("uid:%d", uid))
+	}
+	if emailIndex != "" {
+		keys = append(keys, "email:"+emailIndex)
+	}
+	return gormx.WithSticky(ctx, keys...)
+}
+
+// sticky 按邮箱的盲索引标记用户
+func (u *user) sticky(ctx context.Context, uid int64, email string) context.Context {
+	if email != "" {
+		email = u.pii.BlindIndex(email)
+	}
+	return stickyUser(ctx, uid, email)
+}
@@ -0,0 +1,18 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// byTenant 把查询限制在ctx所属的租户内, 按用户读写的查询都需要带上.
+// 重新分表、重新加密等按id处理所有租户的后台任务不需要
+func byTenant(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	id := tenant.FromContext(ctx)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("tenant_id = ?", id)
+	}
+}
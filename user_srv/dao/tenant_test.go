@@ -0,0 +1,129 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// 租户A不能读取、修改、注销租户B的用户
+func TestTenantIsolation(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 4)
+	acme := tenant.WithTenant(context.Background(), "acme")
+	other := tenant.WithTenant(context.Background(), "other")
+	uid := mustCreateUser(t, other, u, "bob@ex.com")
+
+	if _, err := u.FindUserById(acme, uid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("按id读到了其他租户的用户: %v", err)
+	}
+	if _, err := u.FindUserByEmail(acme, "bob@ex.com"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("按邮箱读到了其他租户的用户: %v", err)
+	}
+	if _, err := u.FindPassword(acme, uid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("读到了其他租户用户的密码: %v", err)
+	}
+	if res, err := u.FindUsersByIds(acme, []int64{uid}); err != nil || len(res) != 0 {
+		t.Fatalf("批量读到了其他租户的用户: %v, %v", res, err)
+	}
+
+	if _, err := u.UpdateUserInfoByUid(acme, User{Id: uid, NickName: "mallory"}); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("修改了其他租户的用户: %v", err)
+	}
+	if _, err := u.UpdateUserInfoByUid(acme, User{Id: uid, Email: "mallory@ex.com"}); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("修改了其他租户用户的邮箱: %v", err)
+	}
+	if err := u.UpdatePassword(acme, uid, "mallory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.DeleteUser(acme, uid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("注销其他租户的用户应返回ErrRecordNotFound, 实际: %v", err)
+	}
+
+	ue, err := u.FindUserById(other, uid)
+	if err != nil {
+		t.Fatalf("其他租户的操作影响了用户: %v", err)
+	}
+	if ue.NickName != "nick" || ue.Email != "bob@ex.com" || ue.Password != "hash" || ue.Version != 1 {
+		t.Fatalf("其他租户的操作修改了用户: %+v", ue)
+	}
+	if _, err = u.FindUserByEmail(other, "bob@ex.com"); err != nil {
+		t.Fatalf("其他租户的操作修改了邮箱索引: %v", err)
+	}
+}
+
+// 邮箱只在租户内唯一
+func TestTenantEmailUnique(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 4)
+	acme := tenant.WithTenant(context.Background(), "acme")
+	other := tenant.WithTenant(context.Background(), "other")
+
+	a := mustCreateUser(t, acme, u, "alice@ex.com")
+	b := mustCreateUser(t, other, u, "alice@ex.com")
+	if _, err := u.CreateUser(acme, User{Email: "alice@ex.com", Password: "hash"}); !errors.Is(err, ErrUniqueConflict) {
+		t.Fatalf("同一租户内重复的邮箱应返回ErrUniqueConflict, 实际: %v", err)
+	}
+	if _, err := u.CreateUsers(other, []User{{Email: "alice@ex.com", Password: "hash"}}); !errors.Is(err, ErrUniqueConflict) {
+		t.Fatalf("批量创建重复的邮箱应返回ErrUniqueConflict, 实际: %v", err)
+	}
+
+	// 改成本租户已有的邮箱冲突, 改成其他租户已有的邮箱不冲突
+	c := mustCreateUser(t, acme, u, "carol@ex.com")
+	if _, err := u.UpdateUserInfoByUid(acme, User{Id: c, Email: "alice@ex.com"}); !errors.Is(err, ErrUniqueConflict) {
+		t.Fatalf("改成同一租户内已有的邮箱应返回ErrUniqueConflict, 实际: %v", err)
+	}
+	d := mustCreateUser(t, other, u, "dave@ex.com")
+	if _, err := u.UpdateUserInfoByUid(acme, User{Id: c, Email: "dave@ex.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for ctx, want := range map[context.Context]map[string]int64{
+		acme:  {"alice@ex.com": a, "dave@ex.com": c},
+		other: {"alice@ex.com": b, "dave@ex.com": d},
+	} {
+		for email, uid := range want {
+			ue, err := u.FindUserByEmail(ctx, email)
+			if err != nil || ue.Id != uid {
+				t.Fatalf("租户%s按邮箱%s查到%d, 期望%d, %v", tenant.FromContext(ctx), email, ue.Id, uid, err)
+			}
+		}
+	}
+}
+
+// 租户A不能给租户B的用户发放积分, 业务流水号只在租户内唯一
+func TestTenantPoints(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 1)
+	p := NewPointsDao(db, u, newTestLogger()).(*points)
+	acme := tenant.WithTenant(context.Background(), "acme")
+	other := tenant.WithTenant(context.Background(), "other")
+	a := mustCreateUser(t, acme, u, "alice@ex.com")
+	b := mustCreateUser(t, other, u, "bob@ex.com")
+
+	if _, err := p.Credit(acme, credit(b, "order-1", 100, 0)); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("给其他租户的用户发放积分应返回ErrRecordNotFound, 实际: %v", err)
+	}
+	if _, _, err := p.Balance(acme, b, 0); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("读到了其他租户用户的积分: %v", err)
+	}
+
+	ta, err := p.Credit(acme, credit(a, "order-1", 100, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb, err := p.Credit(other, credit(b, "order-1", 50, 0))
+	if err != nil {
+		t.Fatalf("其他租户使用了相同的业务流水号: %v", err)
+	}
+	if ta.Id == tb.Id || tb.UserId != b || tb.Balance != 50 {
+		t.Fatalf("不同租户的相同业务流水号返回了同一笔交易: %+v, %+v", ta, tb)
+	}
+	if _, err = p.Credit(acme, credit(a, "order-1", 50, 0)); !errors.Is(err, ErrBizRefConflict) {
+		t.Fatalf("同一租户内金额不同的重复请求应返回ErrBizRefConflict, 实际: %v", err)
+	}
+	checkLedger(t, db, a, 100)
+	checkLedger(t, db, b, 50)
+}
@@ -3,60 +3,140 @@ package dao
 import (
 	"context"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
 
+	"github.com/Numsina/tk_users/user_srv/events"
 	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/idgen"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
 )
 
 var ErrRecordNotFound = errors.New("记录不存在")
 var ErrUniqueConflict = errors.New("唯一主键冲突")
 
 type UserI interface {
-	CreateUser(ctx context.Context, user User) (int32, error)
-	UpdateUserInfoByUid(ctx context.Context, user User) (User, error)
+	CreateUser(ctx context.Context, user User) (int64, error)
+	// UpdateUserInfoByUid 只修改user中非零的字段; 指定fields时只修改这些列, 零值也会写入
+	UpdateUserInfoByUid(ctx context.Context, user User, fields ...string) (User, error)
 	FindUserByEmail(ctx context.Context, email string) (User, error)
-	DeleteUser(ctx context.Context, uid int32) error
+	FindUserById(ctx context.Context, uid int64) (User, error)
+	DeleteUser(ctx context.Context, uid int64) error
+	UpdatePassword(ctx context.Context, uid int64, hash string) error
+	// FindPassword 返回用户的密码哈希, 其他方法返回的User中可能不带密码
+	FindPassword(ctx context.Context, uid int64) (string, error)
+	FindIdsByEmails(ctx context.Context, emails []string) (map[string]int64, error)
+	// FindUsersByIds 批量按id查找ctx所属租户的用户, 不存在的id不在结果中
+	FindUsersByIds(ctx context.Context, uids []int64) (map[int64]User, error)
+	CreateUsers(ctx context.Context, users []User) ([]int64, error)
+	ScanUsers(ctx context.Context, batch int, fn func(users []User) error) error
+	// ScanTenantUsers 与ScanUsers相同, 只读取ctx所属租户的用户
+	ScanTenantUsers(ctx context.Context, batch int, fn func(users []User) error) error
 }
 
 var _ UserI = &user{}
 
+// user 用户按id分表存储, 邮箱到id的映射保存在全局的user_emails中
 type user struct {
-	db     *gorm.DB
+	s      *Sharding
+	ids    idgen.Generator
+	pii    pii.Cipher
 	logger *logger.Logger
 }
 
-func NewUserDao(db *gorm.DB, logger *logger.Logger) UserI {
+func NewUserDao(s *Sharding, ids idgen.Generator, c pii.Cipher, logger *logger.Logger) UserI {
 	return &user{
-		db:     db,
+		s:      s,
+		ids:    ids,
+		pii:    c,
 		logger: logger,
 	}
 }
 
-func (u *user) CreateUser(ctx context.Context, user User) (int32, error) {
+func (u *user) CreateUser(ctx context.Context, user User) (int64, error) {
+	ctx = u.sticky(ctx, 0, user.Email)
 	now := time.Now().UnixMilli()
 	user.CreateAt = now
 	user.UpdateAt = now
-	err := u.db.WithContext(ctx).Create(&user).Error
-	var mysqlErr *mysql.MySQLError
-	if errors.As(err, &mysqlErr) {
-		const uniqueConflictErr uint16 = 1062
-		if mysqlErr.Number == uniqueConflictErr {
-			u.logger.Sugar().Infof("唯一主键冲突, 冲突主键: %s", user.Email)
-			return 0, ErrUniqueConflict
-		}
+	user.Version = 1
+	user.TenantId = tenant.FromContext(ctx)
+
+	id, err := u.ids.Next()
+	if err != nil {
+		u.logger.Sugar().Warnf("生成用户id失败, 错误原因: %s", err)
+		return 0, err
+	}
+
+	if err = u.checkLegacyEmail(ctx, user.Email, 0); err != nil {
+		return 0, err
+	}
+
+	// 先写入邮箱索引, 保证邮箱在租户的所有分表中唯一
+	idx := UserEmail{Id: id, TenantId: user.TenantId, Email: u.pii.BlindIndex(user.Email), CreateAt: now}
+	err = u.s.Index.WithContext(ctx).Create(&idx).Error
+	if isUniqueConflict(err) {
+		u.logger.Sugar().Infof("邮箱已被占用, 注册失败")
+		return 0, ErrUniqueConflict
 	}
 
 	if err != nil {
 		u.logger.Sugar().Warnf("数据库错误, 错误原因: %s", err)
+		return 0, err
 	}
+
+	user.Id = idx.Id
+	ctx = u.sticky(ctx, user.Id, user.Email)
+	row := user
+	if err = u.seal(ctx, &row); err != nil {
+		u.s.Index.WithContext(ctx).Delete(&UserEmail{Id: user.Id})
+		u.logger.Sugar().Warnf("加密用户信息失败, 用户: %d, 错误原因: %s", user.Id, err)
+		return 0, err
+	}
+	shard := u.s.Current.Route(user.Id)
+	err = shard.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(shard.Table).Create(&row).Error; err != nil {
+			return err
+		}
+		e, err := events.UserRegistered(user.Id, user.Version, user.CreateAt)
+		if err != nil {
+			return err
+		}
+		return addEvent(tx, e)
+	})
+	if err != nil {
+		// 回收索引, 允许使用同一邮箱重新注册
+		u.s.Index.WithContext(ctx).Delete(&UserEmail{Id: user.Id})
+		u.logger.Sugar().Warnf("写入用户分表失败, 用户: %d, 错误原因: %s", user.Id, err)
+		return 0, err
+	}
+	u.syncNext(ctx, user.Id)
 	return user.Id, nil
 }
 
-func (u *user) DeleteUser(ctx context.Context, uid int32) error {
-	err := u.db.WithContext(ctx).Delete(&User{Id: uid}).Error
+func (u *user) DeleteUser(ctx context.Context, uid int64) error {
+	ctx = stickyUser(ctx, uid, "")
+	shard := u.s.Current.Route(uid)
+	err := shard.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(shard.Table).Scopes(byTenant(ctx)).Delete(&User{Id: uid})
+		if res.Error != nil {
+			return res.Error
+		}
+		// 用户不存在或者已被并发的请求删除
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		e, err := events.UserDeleted(uid)
+		if err != nil {
+			return err
+		}
+		return addEvent(tx, e)
+	})
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return ErrRecordNotFound
@@ -66,30 +146,164 @@ func (u *user) DeleteUser(ctx context.Context, uid int32) error {
 		u.logger.Sugar().Info("删除用户失败, 造成数据库错误, 错误原因: %v", err)
 		return err
 	}
+	u.syncNext(ctx, uid)
+
+	// 分表中已经删除, 索引删除失败只会留下一条查不到用户的索引
+	if err = u.s.Index.WithContext(ctx).Scopes(byTenant(ctx)).Delete(&UserEmail{Id: uid}).Error; err != nil {
+		u.logger.Sugar().Warnf("删除邮箱索引失败, 用户: %d, 错误原因: %s", uid, err)
+	}
 	return nil
 }
 
-func (u *user) UpdateUserInfoByUid(ctx context.Context, user User) (User, error) {
-	now := time.Now().UnixMilli()
-	user.CreateAt = now
-	user.UpdateAt = now
-	err := u.db.WithContext(ctx).Where("id = ?", user.Id).Updates(&user).Error
+func (u *user) UpdateUserInfoByUid(ctx context.Context, user User, fields ...string) (User, error) {
+	ctx = u.sticky(ctx, user.Id, user.Email)
+	// 注册时间不随修改变化, 调用方传入的值也不写入
+	user.CreateAt = 0
+	user.UpdateAt = time.Now().UnixMilli()
 
-	if err == gorm.ErrRecordNotFound {
-		return User{}, ErrRecordNotFound
+	if user.Email != "" {
+		if err := u.checkLegacyEmail(ctx, user.Email, user.Id); err != nil {
+			return User{}, err
+		}
+
+		// 先修改索引, 新邮箱已被其他用户占用时不修改用户信息
+		err := u.s.Index.WithContext(ctx).Model(&UserEmail{}).Scopes(byTenant(ctx)).Where("id = ?", user.Id).
+			Update("email", u.pii.BlindIndex(user.Email)).Error
+		if isUniqueConflict(err) {
+			u.logger.Sugar().Infof("邮箱已被占用, 用户: %d", user.Id)
+			return User{}, ErrUniqueConflict
+		}
+
+		if err != nil {
+			u.logger.Sugar().Warnf("数据库错误, 错误原因: %s", err)
+			return User{}, err
+		}
+	}
+
+	shard := u.s.Current.Route(user.Id)
+	expected := user.Version
+	if expected == 0 {
+		// 调用方没有指定版本时以当前版本为准, 仍然保证修改期间没有其他写入
+		var cur User
+		err := shard.Query(ctx).Clauses(dbresolver.Write).Scopes(byTenant(ctx)).Select("version").
+			Where("id = ?", user.Id).First(&cur).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return User{}, ErrRecordNotFound
+		}
+		if err != nil {
+			u.logger.Sugar().Warnf("数据库错误, 错误原因: %s", err)
+			return User{}, err
+		}
+		expected = cur.Version
+	}
+
+	user.Version = expected + 1
+	user.TenantId = ""
+	row := user
+	if err := u.seal(ctx, &row); err != nil {
+		u.restoreEmail(ctx, user)
+		u.logger.Sugar().Warnf("加密用户信息失败, 用户: %d, 错误原因: %s", user.Id, err)
+		return User{}, err
 	}
+	var updated bool
+	err := shard.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Table(shard.Table).Scopes(byTenant(ctx)).Where("id = ? AND version = ?", user.Id, expected)
+		if len(fields) > 0 {
+			q = q.Select(updateColumns(fields))
+		}
+		res := q.Updates(&row)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		updated = true
 
+		e, err := events.ProfileUpdated(user.Id, user.Version, user.UpdateAt)
+		if err != nil {
+			return err
+		}
+		return addEvent(tx, e)
+	})
 	if err != nil {
+		u.restoreEmail(ctx, user)
+		if isUniqueConflict(err) {
+			u.logger.Sugar().Infof("唯一主键冲突, 用户: %d", user.Id)
+			return User{}, ErrUniqueConflict
+		}
 		// 可能是数据库错误， 记录日志，
 		u.logger.Sugar().Warnf("数据库错误, 错误原因: %s", err)
+		return User{}, err
 	}
 
+	if !updated {
+		if _, err := u.FindUserById(ctx, user.Id); err != nil {
+			return User{}, err
+		}
+		u.restoreEmail(ctx, user)
+		return User{}, ErrVersionConflict
+	}
+	u.syncNext(ctx, user.Id)
+
 	return user, nil
 }
 
+// updateColumns 指定修改的列时加上版本和修改时间, 生日同时修改明文和密文两列
+func updateColumns(fields []string) []string {
+	cols := []string{"version", "update_at"}
+	for _, f := range fields {
+		cols = append(cols, f)
+		if f == "birth_day" {
+			cols = append(cols, "birth_day_cipher")
+		}
+	}
+	return cols
+}
+
+// restoreEmail 修改没有生效时把已经修改的邮箱索引恢复为分表中的邮箱
+func (u *user) restoreEmail(ctx context.Context, user User) {
+	if user.Email == "" {
+		return
+	}
+
+	cur, err := u.FindUserById(ctx, user.Id)
+	if err == nil && cur.Email != user.Email {
+		err = u.s.Index.WithContext(ctx).Model(&UserEmail{}).Scopes(byTenant(ctx)).Where("id = ?", user.Id).
+			Update("email", u.pii.BlindIndex(cur.Email)).Error
+	}
+	if err != nil {
+		u.logger.Sugar().Warnf("恢复邮箱索引失败, 用户: %d, 错误原因: %s", user.Id, err)
+	}
+}
+
 func (u *user) FindUserByEmail(ctx context.Context, email string) (User, error) {
+	// 同时按明文查找加密之前写入的索引
+	var idx UserEmail
+	err := u.s.Index.WithContext(u.sticky(ctx, 0, email)).Scopes(byTenant(ctx)).
+		Where("email IN ?", []string{u.pii.BlindIndex(email), email}).First(&idx).Error
+	if err == gorm.ErrRecordNotFound {
+		return User{}, ErrRecordNotFound
+	}
+
+	if err != nil {
+		u.logger.Sugar().Warnf("数据库内部错误, 错误原因：%s", err)
+		return User{}, err
+	}
+
+	ue, err := u.FindUserById(ctx, idx.Id)
+	if err != nil {
+		return User{}, err
+	}
+
+	// 修改邮箱时索引先于分表更新, 两者不一致说明修改没有完成
+	if !strings.EqualFold(ue.Email, email) {
+		return User{}, ErrRecordNotFound
+	}
+	return ue, nil
+}
+
+func (u *user) FindUserById(ctx context.Context, uid int64) (User, error) {
 	var ue User
-	err := u.db.WithContext(ctx).Where("email = ?", email).First(&ue).Error
+	err := u.s.Current.Route(uid).Query(stickyUser(ctx, uid, "")).Scopes(byTenant(ctx)).
+		Where("id = ?", uid).First(&ue).Error
 	if err == gorm.ErrRecordNotFound {
 		return User{}, ErrRecordNotFound
 	}
@@ -99,5 +313,118 @@ func (u *user) FindUserByEmail(ctx context.Context, email string) (User, error)
 		return ue, err
 	}
 
+	if err = u.open(ctx, &ue); err != nil {
+		u.logger.Sugar().Warnf("解密用户信息失败, 用户: %d, 错误原因：%s", uid, err)
+		return User{}, err
+	}
 	return ue, nil
 }
+
+func (u *user) UpdatePassword(ctx context.Context, uid int64, hash string) error {
+	ctx = stickyUser(ctx, uid, "")
+	err := u.s.Current.Route(uid).Query(ctx).Scopes(byTenant(ctx)).Where("id = ?", uid).
+		Updates(map[string]any{
+			"password":  hash,
+			"update_at": time.Now().UnixMilli(),
+			"version":   gorm.Expr("version + 1"),
+		}).Error
+	if err != nil {
+		u.logger.Sugar().Warnf("更新密码失败, 用户: %d, 错误原因: %s", uid, err)
+		return err
+	}
+	u.syncNext(ctx, uid)
+	return nil
+}
+
+func (u *user) FindPassword(ctx context.Context, uid int64) (string, error) {
+	var ue User
+	err := u.s.Current.Route(uid).Query(stickyUser(ctx, uid, "")).Scopes(byTenant(ctx)).Select("password").
+		Where("id = ?", uid).First(&ue).Error
+	if err == gorm.ErrRecordNotFound {
+		return "", ErrRecordNotFound
+	}
+
+	if err != nil {
+		u.logger.Sugar().Warnf("数据库内部错误, 错误原因：%s", err)
+		return "", err
+	}
+	return ue.Password, nil
+}
+
+// checkLegacyEmail 加密之前写入的索引保存的是明文邮箱, 后台重新加密完成之前盲索引的唯一约束覆盖不到
+func (u *user) checkLegacyEmail(ctx context.Context, email string, uid int64) error {
+	var n int64
+	err := u.s.Index.WithContext(ctx).Model(&UserEmail{}).Scopes(byTenant(ctx)).
+		Where("email = ? AND id <> ?", email, uid).Count(&n).Error
+	if err != nil {
+		u.logger.Sugar().Warnf("数据库错误, 错误原因: %s", err)
+		return err
+	}
+	if n > 0 {
+		return ErrUniqueConflict
+	}
+	return nil
+}
+
+// seal 加密写入分表的敏感字段, 空值不加密, 只修改部分字段时不会覆盖其他字段.
+// 密文绑定用户id和列名, ue.Id必须已经设置
+func (u *user) seal(ctx context.Context, ue *User) error {
+	var err error
+	if ue.Email, err = u.pii.Encrypt(ctx, ue.Email, pii.Field(ue.Id, "email")); err != nil {
+		return err
+	}
+	if ue.Address, err = u.pii.Encrypt(ctx, ue.Address, pii.Field(ue.Id, "address")); err != nil {
+		return err
+	}
+	if ue.BirthDay != 0 {
+		birthDay := strconv.FormatInt(ue.BirthDay, 10)
+		if ue.BirthDayCipher, err = u.pii.Encrypt(ctx, birthDay, pii.Field(ue.Id, "birth_day_cipher")); err != nil {
+			return err
+		}
+		ue.BirthDay = 0
+	}
+	return nil
+}
+
+// open 解密从分表中读出的敏感字段, 没有加密的明文原样返回
+func (u *user) open(ctx context.Context, ue *User) error {
+	var err error
+	if ue.Email, err = u.pii.Decrypt(ctx, ue.Email, pii.Field(ue.Id, "email")); err != nil {
+		return err
+	}
+	if ue.Address, err = u.pii.Decrypt(ctx, ue.Address, pii.Field(ue.Id, "address")); err != nil {
+		return err
+	}
+	if ue.BirthDayCipher != "" {
+		birthDay, err := u.pii.Decrypt(ctx, ue.BirthDayCipher, pii.Field(ue.Id, "birth_day_cipher"))
+		if err != nil {
+			return err
+		}
+		if ue.BirthDay, err = strconv.ParseInt(birthDay, 10, 64); err != nil {
+			return err
+		}
+		ue.BirthDayCipher = ""
+	}
+	return nil
+}
+
+// syncNext 重新分表期间把当前分表中的整行同步到新分表, 同步失败的行由reshard verify修复
+func (u *user) syncNext(ctx context.Context, uid int64) {
+	if u.s.Next == nil {
+		return
+	}
+
+	next := u.s.Next.Route(uid)
+	var ue User
+	err := u.s.Current.Route(uid).Query(ctx).Clauses(dbresolver.Write).Where("id = ?", uid).First(&ue).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = next.Query(ctx).Delete(&User{Id: uid}).Error
+	case err == nil:
+		err = next.Query(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&ue).Error
+	}
+
+	if err != nil {
+		u.logger.Sugar().Warnf("同步用户到新分表失败, 用户: %d, 错误原因: %s", uid, err)
+	}
+}
@@ -0,0 +1,213 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/Numsina/tk_users/user_srv/events"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// FindIdsByEmails 批量按邮箱查找用户id, 结果以pii.Normalize后的邮箱为key,
+// 大小写不同的邮箱对应同一个用户, 不存在的邮箱不在结果中
+func (u *user) FindIdsByEmails(ctx context.Context, emails []string) (map[string]int64, error) {
+	// 同时按明文查找加密之前写入的索引
+	keys := make(map[string]string, len(emails)*2)
+	for _, email := range emails {
+		keys[u.pii.BlindIndex(email)] = pii.Normalize(email)
+		keys[email] = pii.Normalize(email)
+	}
+	values := make([]string, 0, len(keys))
+	for key := range keys {
+		values = append(values, key)
+	}
+
+	var idxs []UserEmail
+	err := u.s.Index.WithContext(ctx).Clauses(dbresolver.Write).Scopes(byTenant(ctx)).
+		Where("email IN ?", values).Find(&idxs).Error
+	if err != nil {
+		u.logger.Sugar().Warnf("数据库内部错误, 错误原因：%s", err)
+		return nil, err
+	}
+
+	res := make(map[string]int64, len(idxs))
+	for _, idx := range idxs {
+		res[keys[idx.Email]] = idx.Id
+	}
+	return res, nil
+}
+
+// FindUsersByIds 按分表分组, 每张分表查询一次
+func (u *user) FindUsersByIds(ctx context.Context, uids []int64) (map[int64]User, error) {
+	groups := make(map[Shard][]int64)
+	for _, uid := range uids {
+		shard := u.s.Current.Route(uid)
+		groups[shard] = append(groups[shard], uid)
+	}
+
+	res := make(map[int64]User, len(uids))
+	for shard, ids := range groups {
+		var rows []User
+		err := shard.Query(ctx).Scopes(byTenant(ctx)).Where("id IN ?", ids).Find(&rows).Error
+		if err != nil {
+			u.logger.Sugar().Warnf("数据库内部错误, 错误原因：%s", err)
+			return nil, err
+		}
+		for _, ue := range rows {
+			if err = u.open(ctx, &ue); err != nil {
+				u.logger.Sugar().Warnf("解密用户信息失败, 用户: %d, 错误原因：%s", ue.Id, err)
+				return nil, err
+			}
+			res[ue.Id] = ue
+		}
+	}
+	return res, nil
+}
+
+// CreateUsers 批量创建邮箱不存在的用户, 返回与users顺序一致的id.
+// 邮箱冲突时整批不写入; 写入分表失败时只回收失败分表的索引, 已经写入的分表不回滚
+func (u *user) CreateUsers(ctx context.Context, users []User) ([]int64, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now().UnixMilli()
+	tenantId := tenant.FromContext(ctx)
+	emails := make([]string, 0, len(users))
+	for _, ue := range users {
+		emails = append(emails, ue.Email)
+	}
+	var legacy int64
+	err := u.s.Index.WithContext(ctx).Model(&UserEmail{}).Scopes(byTenant(ctx)).
+		Where("email IN ?", emails).Count(&legacy).Error
+	if err != nil {
+		return nil, err
+	}
+	if legacy > 0 {
+		return nil, ErrUniqueConflict
+	}
+
+	ids := make([]int64, 0, len(users))
+	idxs := make([]UserEmail, 0, len(users))
+	for _, ue := range users {
+		id, err := u.ids.Next()
+		if err != nil {
+			u.logger.Sugar().Warnf("生成用户id失败, 错误原因: %s", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+		idxs = append(idxs, UserEmail{Id: id, TenantId: tenantId, Email: u.pii.BlindIndex(ue.Email), CreateAt: now})
+	}
+	err = u.s.Index.WithContext(ctx).Create(&idxs).Error
+	if isUniqueConflict(err) {
+		return nil, ErrUniqueConflict
+	}
+	if err != nil {
+		u.logger.Sugar().Warnf("数据库错误, 错误原因: %s", err)
+		return nil, err
+	}
+
+	groups := make(map[Shard][]User)
+	var order []Shard
+	for i, ue := range users {
+		ue.Id = ids[i]
+		ue.CreateAt = now
+		ue.UpdateAt = now
+		ue.Version = 1
+		ue.TenantId = tenantId
+
+		shard := u.s.Current.Route(ue.Id)
+		if _, ok := groups[shard]; !ok {
+			order = append(order, shard)
+		}
+		groups[shard] = append(groups[shard], ue)
+	}
+
+	for i, shard := range order {
+		if err = u.createInShard(ctx, shard, groups[shard]); err != nil {
+			// 回收还没有写入的分表的索引
+			var failed []int64
+			for _, s := range order[i:] {
+				for _, ue := range groups[s] {
+					failed = append(failed, ue.Id)
+				}
+			}
+			u.s.Index.WithContext(ctx).Where("id IN ?", failed).Delete(&UserEmail{})
+			u.logger.Sugar().Warnf("批量写入用户分表失败, 分表: %s, 错误原因: %s", shard.Table, err)
+			return nil, err
+		}
+	}
+
+	for _, id := range ids {
+		u.syncNext(ctx, id)
+	}
+	return ids, nil
+}
+
+func (u *user) createInShard(ctx context.Context, shard Shard, users []User) error {
+	rows := make([]User, 0, len(users))
+	for _, ue := range users {
+		row := ue
+		if err := u.seal(ctx, &row); err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	return shard.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(shard.Table).Create(&rows).Error; err != nil {
+			return err
+		}
+		for _, ue := range users {
+			e, err := events.UserRegistered(ue.Id, ue.Version, ue.CreateAt)
+			if err != nil {
+				return err
+			}
+			if err = addEvent(tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ScanUsers 按分表和id顺序分批读取所有租户的用户, 返回的是解密后的值
+func (u *user) ScanUsers(ctx context.Context, batch int, fn func(users []User) error) error {
+	return u.scan(ctx, batch, func(db *gorm.DB) *gorm.DB { return db }, fn)
+}
+
+func (u *user) ScanTenantUsers(ctx context.Context, batch int, fn func(users []User) error) error {
+	return u.scan(ctx, batch, byTenant(ctx), fn)
+}
+
+func (u *user) scan(ctx context.Context, batch int, scope func(db *gorm.DB) *gorm.DB, fn func(users []User) error) error {
+	for _, shard := range u.s.Current.Shards() {
+		var last int64
+		for {
+			var rows []User
+			err := shard.Query(ctx).Clauses(dbresolver.Write).Scopes(scope).Where("id > ?", last).
+				Order("id").Limit(batch).Find(&rows).Error
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			last = rows[len(rows)-1].Id
+			for i := range rows {
+				if err = u.open(ctx, &rows[i]); err != nil {
+					return err
+				}
+			}
+			if err = fn(rows); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Numsina/tk_users/user_srv/events"
+	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// 邮箱索引在所有分表之间保证唯一, 并且能按邮箱找到任意分表中的用户
+func TestEmailIndexAcrossShards(t *testing.T) {
+	db := newTestDB(t)
+	u, s := newTestUserDao(t, db, 4)
+	ctx := context.Background()
+
+	ids := make(map[string]int64)
+	shards := make(map[string]struct{})
+	for i := 0; i < 8; i++ {
+		email := fmt.Sprintf("user%d@ex.com", i)
+		ids[email] = mustCreateUser(t, ctx, u, email)
+		shards[s.Current.Route(ids[email]).Table] = struct{}{}
+	}
+	if len(shards) < 2 {
+		t.Fatal("用户都在同一张分表中, 没有覆盖跨分表的情况")
+	}
+
+	for email, id := range ids {
+		ue, err := u.FindUserByEmail(ctx, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ue.Id != id {
+			t.Fatalf("邮箱%s查到用户%d, 期望%d", email, ue.Id, id)
+		}
+		if _, err = u.CreateUser(ctx, User{Email: email, Password: "hash"}); !errors.Is(err, ErrUniqueConflict) {
+			t.Fatalf("重复的邮箱应返回ErrUniqueConflict, 实际: %v", err)
+		}
+	}
+
+	var n int64
+	db.Model(&UserEmail{}).Count(&n)
+	if n != int64(len(ids)) {
+		t.Fatalf("邮箱索引有%d行, 期望%d", n, len(ids))
+	}
+}
+
+func TestEmailIndexUpdate(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 4)
+	ctx := context.Background()
+	alice := mustCreateUser(t, ctx, u, "alice@ex.com")
+	mustCreateUser(t, ctx, u, "bob@ex.com")
+
+	if _, err := u.UpdateUserInfoByUid(ctx, User{Id: alice, Email: "bob@ex.com"}); !errors.Is(err, ErrUniqueConflict) {
+		t.Fatalf("改为已占用的邮箱应返回ErrUniqueConflict, 实际: %v", err)
+	}
+	if ue, err := u.FindUserByEmail(ctx, "alice@ex.com"); err != nil || ue.Id != alice {
+		t.Fatalf("修改失败后原邮箱应仍然可用: %v", err)
+	}
+
+	// 版本冲突时恢复已经修改的索引
+	if _, err := u.UpdateUserInfoByUid(ctx, User{Id: alice, Email: "carol@ex.com", Version: 100}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("版本不一致应返回ErrVersionConflict, 实际: %v", err)
+	}
+	if _, err := u.FindUserByEmail(ctx, "carol@ex.com"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("修改没有生效时不能按新邮箱查到用户: %v", err)
+	}
+	mustCreateUser(t, ctx, u, "carol@ex.com")
+
+	if _, err := u.UpdateUserInfoByUid(ctx, User{Id: alice, Email: "alice2@ex.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.FindUserByEmail(ctx, "alice@ex.com"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("旧邮箱应查不到用户: %v", err)
+	}
+	if ue, err := u.FindUserByEmail(ctx, "alice2@ex.com"); err != nil || ue.Id != alice {
+		t.Fatalf("按新邮箱应查到用户: %v", err)
+	}
+}
+
+// 修改用户信息不改变注册时间
+func TestUpdateKeepsCreateAt(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 1)
+	ctx := context.Background()
+	uid := mustCreateUser(t, ctx, u, "alice@ex.com")
+	before, err := u.FindUserById(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if _, err = u.UpdateUserInfoByUid(ctx, User{Id: uid, NickName: "alice", CreateAt: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = u.UpdateUserInfoByUid(ctx, User{Id: uid, NickName: "alice2"}, "nick_name"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := u.FindUserById(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.CreateAt != before.CreateAt || after.UpdateAt <= before.UpdateAt {
+		t.Fatalf("注册时间%d变为%d, 修改时间%d变为%d", before.CreateAt, after.CreateAt, before.UpdateAt, after.UpdateAt)
+	}
+}
+
+// 删除用户后释放邮箱, 可以重新注册
+func TestEmailIndexDelete(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 4)
+	ctx := context.Background()
+	uid := mustCreateUser(t, ctx, u, "alice@ex.com")
+
+	if err := u.DeleteUser(ctx, uid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.FindUserByEmail(ctx, "alice@ex.com"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("删除后应查不到用户: %v", err)
+	}
+	again := mustCreateUser(t, ctx, u, "alice@ex.com")
+	if again == uid {
+		t.Fatal("重新注册使用了已删除用户的id")
+	}
+}
+
+// 并发注销同一用户时只有一个请求成功, 其他请求返回ErrRecordNotFound, 只写入一个注销事件
+func TestDeleteUserOnce(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 2)
+	ctx := context.Background()
+	uid := mustCreateUser(t, ctx, u, "alice@ex.com")
+
+	const n = 4
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = u.DeleteUser(ctx, uid)
+		}(i)
+	}
+	wg.Wait()
+
+	var ok int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, ErrRecordNotFound):
+			t.Fatal(err)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("%d个注销请求成功", ok)
+	}
+	var count int64
+	db.Model(&OutboxEvent{}).Where("event_type = ?", events.TypeUserDeleted).Count(&count)
+	if count != 1 {
+		t.Fatalf("写入了%d个注销事件", count)
+	}
+	if err := u.DeleteUser(ctx, uid+1); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("注销不存在的用户应返回ErrRecordNotFound, 实际: %v", err)
+	}
+}
+
+// outbox中的事件只带用户id和版本, 不带邮箱、地址、生日等用户信息
+func TestUserEventsWithoutPii(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 2)
+	ctx := context.Background()
+
+	uid, err := u.CreateUser(ctx, User{Email: "alice@ex.com", Password: "hash", Address: "secret street", BirthDay: 946684800000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = u.UpdateUserInfoByUid(ctx, User{Id: uid, Email: "alice2@ex.com", Address: "other street"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = u.CreateUsers(ctx, []User{{Email: "bob@ex.com", Password: "hash", Address: "bob street"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var evts []OutboxEvent
+	if err = db.Order("id").Find(&evts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(evts) != 3 {
+		t.Fatalf("outbox中有%d个事件, 期望3", len(evts))
+	}
+	for _, e := range evts {
+		for _, secret := range []string{"alice", "bob", "street", "946684800000"} {
+			if bytes.Contains(e.Payload, []byte(secret)) {
+				t.Fatalf("%s事件中包含用户信息%q", e.EventType, secret)
+			}
+		}
+	}
+
+	var ue users.UserEvent
+	if err = proto.Unmarshal(evts[1].Payload, &ue); err != nil {
+		t.Fatal(err)
+	}
+	if ue.GetUserId() != uid || ue.GetSchemaVersion() != events.SchemaVersion || ue.GetProfileUpdated().GetVersion() != 2 {
+		t.Fatalf("修改资料的事件不正确: %v", &ue)
+	}
+}
+
+func TestScanTenantUsers(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 4)
+	acme := tenant.WithTenant(context.Background(), "acme")
+	other := tenant.WithTenant(context.Background(), "other")
+
+	want := make(map[int64]bool)
+	for i := 0; i < 5; i++ {
+		want[mustCreateUser(t, acme, u, fmt.Sprintf("user%d@ex.com", i))] = true
+		mustCreateUser(t, other, u, fmt.Sprintf("user%d@ex.com", i))
+	}
+
+	got := make(map[int64]bool)
+	err := u.ScanTenantUsers(acme, 2, func(users []User) error {
+		for _, ue := range users {
+			if ue.TenantId != "acme" {
+				t.Fatalf("读到了租户%s的用户%d", ue.TenantId, ue.Id)
+			}
+			got[ue.Id] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("读到%d个用户, 期望%d", len(got), len(want))
+	}
+
+	var all int
+	if err = u.ScanUsers(acme, 3, func(users []User) error { all += len(users); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if all != 10 {
+		t.Fatalf("ScanUsers读到%d个用户, 期望10", all)
+	}
+}
+
+func TestFindUsersByIds(t *testing.T) {
+	db := newTestDB(t)
+	u, _ := newTestUserDao(t, db, 4)
+	acme := tenant.WithTenant(context.Background(), "acme")
+	other := tenant.WithTenant(context.Background(), "other")
+
+	var uids []int64
+	for i := 0; i < 6; i++ {
+		uids = append(uids, mustCreateUser(t, acme, u, fmt.Sprintf("user%d@ex.com", i)))
+	}
+	deleted := uids[0]
+	if err := u.DeleteUser(acme, deleted); err != nil {
+		t.Fatal(err)
+	}
+	foreign := mustCreateUser(t, other, u, "user0@ex.com")
+
+	res, err := u.FindUsersByIds(acme, append(uids, foreign))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(uids)-1 {
+		t.Fatalf("查到%d个用户, 期望%d", len(res), len(uids)-1)
+	}
+	if _, ok := res[deleted]; ok {
+		t.Fatal("查到了已注销的用户")
+	}
+	if _, ok := res[foreign]; ok {
+		t.Fatal("查到了其他租户的用户")
+	}
+	for _, uid := range uids[1:] {
+		if ue := res[uid]; ue.Id != uid || ue.Email == "" || ue.Email[:4] != "user" {
+			t.Fatalf("用户%d不正确: %+v", uid, ue)
+		}
+	}
+}
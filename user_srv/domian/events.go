@@ -0,0 +1,25 @@
+package domain
+
+// 用户服务发布到进程内事件总线的事件, At为事件发生时间, 单位毫秒
+
+type UserRegistered struct {
+	Id       int64
+	Email    string
+	NickName string
+	At       int64
+}
+
+type UserProfileUpdated struct {
+	User User
+	At   int64
+}
+
+type UserPasswordChanged struct {
+	Id int64
+	At int64
+}
+
+type UserDeleted struct {
+	Id int64
+	At int64
+}
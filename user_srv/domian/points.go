@@ -0,0 +1,19 @@
+package domain
+
+type PointsTx struct {
+	Id       int64  `json:"id"`
+	UserId   int64  `json:"user_id"`
+	Kind     string `json:"kind"`
+	BizType  string `json:"biz_type"`
+	BizRef   string `json:"biz_ref"`
+	Amount   int64  `json:"amount"`
+	Balance  int64  `json:"balance"`
+	Remark   string `json:"remark"`
+	ExpireAt int64  `json:"expire_at"`
+	CreateAt int64  `json:"create_at"`
+}
+
+type PointsBalance struct {
+	Balance  int64 `json:"balance"`
+	Expiring int64 `json:"expiring"`
+}
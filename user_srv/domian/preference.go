@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+var (
+	ErrPreferenceKeyUnknown   = errors.New("未声明的偏好设置")
+	ErrPreferenceValueInvalid = errors.New("偏好设置的值无效")
+)
+
+const (
+	PreferenceTypeString = "string"
+	PreferenceTypeBool   = "bool"
+	PreferenceTypeEnum   = "enum"
+)
+
+type Preference struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Type     string `json:"type"`
+	Version  int64  `json:"version"`
+	UpdateAt int64  `json:"update_at"`
+}
+
+// PreferenceSchema 声明一个偏好设置的类型、默认值以及取值范围
+type PreferenceSchema struct {
+	Key     string
+	Type    string
+	Default string
+	Options []string // 仅enum类型使用
+	MaxLen  int      // 仅string类型使用
+}
+
+func (s PreferenceSchema) Validate(value string) error {
+	switch s.Type {
+	case PreferenceTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return ErrPreferenceValueInvalid
+		}
+	case PreferenceTypeEnum:
+		if !slices.Contains(s.Options, value) {
+			return ErrPreferenceValueInvalid
+		}
+	case PreferenceTypeString:
+		if s.MaxLen > 0 && utf8.RuneCountInString(value) > s.MaxLen {
+			return ErrPreferenceValueInvalid
+		}
+	default:
+		return ErrPreferenceValueInvalid
+	}
+	return nil
+}
+
+// DefaultPreference 用户还未设置过时返回的偏好, 版本号为0
+func (s PreferenceSchema) DefaultPreference() Preference {
+	return Preference{
+		Key:   s.Key,
+		Value: s.Default,
+		Type:  s.Type,
+	}
+}
+
+var PreferenceSchemas = []PreferenceSchema{
+	{Key: "language", Type: PreferenceTypeEnum, Default: "zh-CN", Options: []string{"zh-CN", "zh-TW", "en-US", "ja-JP"}},
+	{Key: "currency", Type: PreferenceTypeEnum, Default: "CNY", Options: []string{"CNY", "USD", "EUR", "JPY", "HKD"}},
+	{Key: "theme", Type: PreferenceTypeEnum, Default: "system", Options: []string{"system", "light", "dark"}},
+	{Key: "notification.email", Type: PreferenceTypeBool, Default: "true"},
+	{Key: "notification.sms", Type: PreferenceTypeBool, Default: "false"},
+	{Key: "notification.push", Type: PreferenceTypeBool, Default: "true"},
+	{Key: "timezone", Type: PreferenceTypeString, Default: "Asia/Shanghai", MaxLen: 64},
+}
+
+func FindPreferenceSchema(key string) (PreferenceSchema, bool) {
+	for _, s := range PreferenceSchemas {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return PreferenceSchema{}, false
+}
@@ -0,0 +1,14 @@
+package domain
+
+// UserRecord 导入导出文件中的一行用户, CSV的表头与json的键一致.
+// 导入时password和password_hash二选一, password_hash为已有的bcrypt或argon2id哈希
+type UserRecord struct {
+	Email        string `json:"email"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	NickName     string `json:"nick_name"`
+	Description  string `json:"description"`
+	Avatar       string `json:"avatar"`
+	Address      string `json:"address"`
+	BirthDay     int64  `json:"birth_day"`
+}
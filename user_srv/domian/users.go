@@ -1,7 +1,7 @@
 package domain
 
 type User struct {
-	Id              int32  `json:"id"`
+	Id              int64  `json:"id"`
 	Email           string `json:"email"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirm_password"`
@@ -10,10 +10,12 @@ type User struct {
 	Avatar          string `json:"avatar"`
 	BirthDay        int64  `json:"birth_day"`
 	Address         string `json:"address"`
+	Version         int64  `json:"version"`
+	UpdateAt        int64  `json:"update_at"`
 }
 
 type UserResp struct {
-	Id          int32  `json:"id"`
+	Id          int64  `json:"id"`
 	Email       string `json:"email"`
 	NickName    string `json:"nick_name"`
 	Description string `json:"description"`
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+)
+
+// SchemaVersion 事件结构的版本, 与api/events.proto中的UserEvent对应.
+// 2起事件中不再带有用户信息
+const SchemaVersion = 2
+
+const (
+	TypeUserRegistered = "user.registered"
+	TypeProfileUpdated = "user.profile_updated"
+	TypeUserDeleted    = "user.deleted"
+)
+
+// ContentType 事件以protobuf编码
+const ContentType = "application/x-protobuf"
+
+// Event 一条待写入outbox的领域事件
+type Event struct {
+	Id         string
+	Type       string
+	UserId     int64
+	Payload    []byte
+	OccurredAt int64
+}
+
+func UserRegistered(uid int64, version, createAt int64) (Event, error) {
+	return build(uid, TypeUserRegistered, func(e *users.UserEvent) {
+		e.Payload = &users.UserEvent_Registered{Registered: &users.UserRegistered{
+			CreateAt: createAt,
+			Version:  version,
+		}}
+	})
+}
+
+func ProfileUpdated(uid int64, version, updateAt int64) (Event, error) {
+	return build(uid, TypeProfileUpdated, func(e *users.UserEvent) {
+		e.Payload = &users.UserEvent_ProfileUpdated{ProfileUpdated: &users.UserProfileUpdated{
+			Version:  version,
+			UpdateAt: updateAt,
+		}}
+	})
+}
+
+func UserDeleted(uid int64) (Event, error) {
+	return build(uid, TypeUserDeleted, func(e *users.UserEvent) {
+		e.Payload = &users.UserEvent_Deleted{Deleted: &users.UserDeleted{}}
+	})
+}
+
+func build(uid int64, typ string, set func(e *users.UserEvent)) (Event, error) {
+	e := &users.UserEvent{
+		EventId:       uuid.NewString(),
+		Type:          typ,
+		SchemaVersion: SchemaVersion,
+		UserId:        uid,
+		OccurredAt:    time.Now().UnixMilli(),
+	}
+	set(e)
+
+	payload, err := proto.Marshal(e)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Id:         e.EventId,
+		Type:       typ,
+		UserId:     uid,
+		Payload:    payload,
+		OccurredAt: e.OccurredAt,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"context"
+	_ "embed"
+	"net/http"
+	"net/textproto"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+	usersv2 "github.com/Numsina/tk_users/user_srv/gen/users/v2"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// TenantHeader 通过HTTP调用时指定租户的请求头, 转为grpc metadata中的x-tenant-id
+const TenantHeader = "X-Tenant-Id"
+
+//go:embed openapi/user.swagger.json
+var openapi []byte
+
+//go:embed openapi/v2/user.swagger.json
+var openapiV2 []byte
+
+// New 返回按proto中的http注解转发到endpoint上grpc服务的handler, 另外在/openapi.json和/v2/openapi.json返回v1和v2的OpenAPI文档.
+// 请求经过grpc端口而不是直接调用handler, 这样校验、租户、日志等拦截器对HTTP请求同样生效
+func New(ctx context.Context, endpoint string) (http.Handler, error) {
+	gw := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+		// 字段名与proto保持一致, 并输出零值字段, 与OpenAPI文档中的定义一致
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{
+				UseProtoNames:   true,
+				EmitUnpopulated: true,
+			},
+			UnmarshalOptions: protojson.UnmarshalOptions{
+				DiscardUnknown: true,
+			},
+		}),
+	)
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	if err := users.RegisterUserServiceHandlerFromEndpoint(ctx, gw, endpoint, opts); err != nil {
+		return nil, err
+	}
+	if err := usersv2.RegisterUserServiceHandlerFromEndpoint(ctx, gw, endpoint, opts); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", gw)
+	mux.Handle("/v2/", gw)
+	mux.HandleFunc("/openapi.json", serveDoc(openapi))
+	mux.HandleFunc("/v2/openapi.json", serveDoc(openapiV2))
+	return mux, nil
+}
+
+func serveDoc(doc []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+}
+
+func headerMatcher(key string) (string, bool) {
+	if textproto.CanonicalMIMEHeaderKey(key) == TenantHeader {
+		return tenant.MetadataKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/interceptor"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// fakeUsers 把请求所属的租户放在昵称中返回
+type fakeUsers struct {
+	users.UnimplementedUserServiceServer
+}
+
+func (fakeUsers) GetUserById(ctx context.Context, req *users.GetUserByIdReq) (*users.GetUserByIdResp, error) {
+	if req.GetUserId() != 42 {
+		return nil, status.Error(codes.NotFound, "用户不存在")
+	}
+	return &users.GetUserByIdResp{Profile: &users.Profile{
+		UserId:   req.GetUserId(),
+		NickName: tenant.FromContext(ctx),
+	}}, nil
+}
+
+// newTestGateway 在127.0.0.1的随机端口上启动带租户拦截器的grpc服务, 返回转发到该端口的网关
+func newTestGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := interceptor.NewBuilder(config.InterceptorConfig{}, logger.NewLogger(logger.WithWriteFile(false))).Tenants("acme")
+	server := grpc.NewServer(grpc.UnaryInterceptor(b.Unary()))
+	users.RegisterUserServiceServer(server, fakeUsers{})
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	h, err := New(ctx, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, url, tenantId string) (int, map[string]any) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenantId != "" {
+		req.Header.Set(TenantHeader, tenantId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body map[string]any
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestGatewayRoute(t *testing.T) {
+	srv := newTestGateway(t)
+
+	code, body := get(t, srv.URL+"/v1/users/42", "ACME")
+	if code != http.StatusOK {
+		t.Fatalf("返回%d: %v", code, body)
+	}
+	profile, _ := body["profile"].(map[string]any)
+	// int64按protojson输出为字符串, 零值字段也输出
+	if profile["user_id"] != "42" || profile["nick_name"] != "acme" || profile["version"] != "0" {
+		t.Fatalf("返回的用户不正确: %v", body)
+	}
+
+	if code, body = get(t, srv.URL+"/v1/users/42", ""); code != http.StatusOK || body["profile"].(map[string]any)["nick_name"] != tenant.Default {
+		t.Fatalf("没有指定租户时返回%d: %v", code, body)
+	}
+	if code, _ = get(t, srv.URL+"/v1/users/7", "acme"); code != http.StatusNotFound {
+		t.Fatalf("用户不存在时返回%d", code)
+	}
+	if code, _ = get(t, srv.URL+"/v1/users/42", "other"); code != http.StatusForbidden {
+		t.Fatalf("未知的租户返回%d", code)
+	}
+	if code, _ = get(t, srv.URL+"/v1/users/abc", "acme"); code != http.StatusBadRequest {
+		t.Fatalf("路径参数不合法时返回%d", code)
+	}
+	if code, body = get(t, srv.URL+"/openapi.json", ""); code != http.StatusOK || body["swagger"] == nil {
+		t.Fatalf("OpenAPI文档返回%d", code)
+	}
+}
@@ -0,0 +1,213 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: points.proto
+
+package users
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// PointsServiceClient is the client API for PointsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PointsServiceClient interface {
+	Credit(ctx context.Context, in *CreditReq, opts ...grpc.CallOption) (*PointsTxResp, error)
+	Debit(ctx context.Context, in *DebitReq, opts ...grpc.CallOption) (*PointsTxResp, error)
+	GetBalance(ctx context.Context, in *GetBalanceReq, opts ...grpc.CallOption) (*GetBalanceResp, error)
+	ListHistory(ctx context.Context, in *ListHistoryReq, opts ...grpc.CallOption) (*ListHistoryResp, error)
+}
+
+type pointsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPointsServiceClient(cc grpc.ClientConnInterface) PointsServiceClient {
+	return &pointsServiceClient{cc}
+}
+
+func (c *pointsServiceClient) Credit(ctx context.Context, in *CreditReq, opts ...grpc.CallOption) (*PointsTxResp, error) {
+	out := new(PointsTxResp)
+	err := c.cc.Invoke(ctx, "/user.PointsService/Credit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pointsServiceClient) Debit(ctx context.Context, in *DebitReq, opts ...grpc.CallOption) (*PointsTxResp, error) {
+	out := new(PointsTxResp)
+	err := c.cc.Invoke(ctx, "/user.PointsService/Debit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pointsServiceClient) GetBalance(ctx context.Context, in *GetBalanceReq, opts ...grpc.CallOption) (*GetBalanceResp, error) {
+	out := new(GetBalanceResp)
+	err := c.cc.Invoke(ctx, "/user.PointsService/GetBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pointsServiceClient) ListHistory(ctx context.Context, in *ListHistoryReq, opts ...grpc.CallOption) (*ListHistoryResp, error) {
+	out := new(ListHistoryResp)
+	err := c.cc.Invoke(ctx, "/user.PointsService/ListHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PointsServiceServer is the server API for PointsService service.
+// All implementations must embed UnimplementedPointsServiceServer
+// for forward compatibility
+type PointsServiceServer interface {
+	Credit(context.Context, *CreditReq) (*PointsTxResp, error)
+	Debit(context.Context, *DebitReq) (*PointsTxResp, error)
+	GetBalance(context.Context, *GetBalanceReq) (*GetBalanceResp, error)
+	ListHistory(context.Context, *ListHistoryReq) (*ListHistoryResp, error)
+	mustEmbedUnimplementedPointsServiceServer()
+}
+
+// UnimplementedPointsServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedPointsServiceServer struct {
+}
+
+func (UnimplementedPointsServiceServer) Credit(context.Context, *CreditReq) (*PointsTxResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Credit not implemented")
+}
+func (UnimplementedPointsServiceServer) Debit(context.Context, *DebitReq) (*PointsTxResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Debit not implemented")
+}
+func (UnimplementedPointsServiceServer) GetBalance(context.Context, *GetBalanceReq) (*GetBalanceResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedPointsServiceServer) ListHistory(context.Context, *ListHistoryReq) (*ListHistoryResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListHistory not implemented")
+}
+func (UnimplementedPointsServiceServer) mustEmbedUnimplementedPointsServiceServer() {}
+
+// UnsafePointsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PointsServiceServer will
+// result in compilation errors.
+type UnsafePointsServiceServer interface {
+	mustEmbedUnimplementedPointsServiceServer()
+}
+
+func RegisterPointsServiceServer(s grpc.ServiceRegistrar, srv PointsServiceServer) {
+	s.RegisterService(&PointsService_ServiceDesc, srv)
+}
+
+func _PointsService_Credit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreditReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PointsServiceServer).Credit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.PointsService/Credit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PointsServiceServer).Credit(ctx, req.(*CreditReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PointsService_Debit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DebitReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PointsServiceServer).Debit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.PointsService/Debit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PointsServiceServer).Debit(ctx, req.(*DebitReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PointsService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PointsServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.PointsService/GetBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PointsServiceServer).GetBalance(ctx, req.(*GetBalanceReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PointsService_ListHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListHistoryReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PointsServiceServer).ListHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.PointsService/ListHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PointsServiceServer).ListHistory(ctx, req.(*ListHistoryReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PointsService_ServiceDesc is the grpc.ServiceDesc for PointsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PointsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "user.PointsService",
+	HandlerType: (*PointsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Credit",
+			Handler:    _PointsService_Credit_Handler,
+		},
+		{
+			MethodName: "Debit",
+			Handler:    _PointsService_Debit_Handler,
+		},
+		{
+			MethodName: "GetBalance",
+			Handler:    _PointsService_GetBalance_Handler,
+		},
+		{
+			MethodName: "ListHistory",
+			Handler:    _PointsService_ListHistory_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "points.proto",
+}
@@ -0,0 +1,177 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: preference.proto
+
+package users
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// PreferenceServiceClient is the client API for PreferenceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PreferenceServiceClient interface {
+	GetPreference(ctx context.Context, in *GetPreferenceReq, opts ...grpc.CallOption) (*GetPreferenceResp, error)
+	BatchGetPreferences(ctx context.Context, in *BatchGetPreferencesReq, opts ...grpc.CallOption) (*BatchGetPreferencesResp, error)
+	SetPreference(ctx context.Context, in *SetPreferenceReq, opts ...grpc.CallOption) (*SetPreferenceResp, error)
+}
+
+type preferenceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPreferenceServiceClient(cc grpc.ClientConnInterface) PreferenceServiceClient {
+	return &preferenceServiceClient{cc}
+}
+
+func (c *preferenceServiceClient) GetPreference(ctx context.Context, in *GetPreferenceReq, opts ...grpc.CallOption) (*GetPreferenceResp, error) {
+	out := new(GetPreferenceResp)
+	err := c.cc.Invoke(ctx, "/user.PreferenceService/GetPreference", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *preferenceServiceClient) BatchGetPreferences(ctx context.Context, in *BatchGetPreferencesReq, opts ...grpc.CallOption) (*BatchGetPreferencesResp, error) {
+	out := new(BatchGetPreferencesResp)
+	err := c.cc.Invoke(ctx, "/user.PreferenceService/BatchGetPreferences", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *preferenceServiceClient) SetPreference(ctx context.Context, in *SetPreferenceReq, opts ...grpc.CallOption) (*SetPreferenceResp, error) {
+	out := new(SetPreferenceResp)
+	err := c.cc.Invoke(ctx, "/user.PreferenceService/SetPreference", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PreferenceServiceServer is the server API for PreferenceService service.
+// All implementations must embed UnimplementedPreferenceServiceServer
+// for forward compatibility
+type PreferenceServiceServer interface {
+	GetPreference(context.Context, *GetPreferenceReq) (*GetPreferenceResp, error)
+	BatchGetPreferences(context.Context, *BatchGetPreferencesReq) (*BatchGetPreferencesResp, error)
+	SetPreference(context.Context, *SetPreferenceReq) (*SetPreferenceResp, error)
+	mustEmbedUnimplementedPreferenceServiceServer()
+}
+
+// UnimplementedPreferenceServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedPreferenceServiceServer struct {
+}
+
+func (UnimplementedPreferenceServiceServer) GetPreference(context.Context, *GetPreferenceReq) (*GetPreferenceResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPreference not implemented")
+}
+func (UnimplementedPreferenceServiceServer) BatchGetPreferences(context.Context, *BatchGetPreferencesReq) (*BatchGetPreferencesResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetPreferences not implemented")
+}
+func (UnimplementedPreferenceServiceServer) SetPreference(context.Context, *SetPreferenceReq) (*SetPreferenceResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetPreference not implemented")
+}
+func (UnimplementedPreferenceServiceServer) mustEmbedUnimplementedPreferenceServiceServer() {}
+
+// UnsafePreferenceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PreferenceServiceServer will
+// result in compilation errors.
+type UnsafePreferenceServiceServer interface {
+	mustEmbedUnimplementedPreferenceServiceServer()
+}
+
+func RegisterPreferenceServiceServer(s grpc.ServiceRegistrar, srv PreferenceServiceServer) {
+	s.RegisterService(&PreferenceService_ServiceDesc, srv)
+}
+
+func _PreferenceService_GetPreference_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPreferenceReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PreferenceServiceServer).GetPreference(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.PreferenceService/GetPreference",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PreferenceServiceServer).GetPreference(ctx, req.(*GetPreferenceReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PreferenceService_BatchGetPreferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetPreferencesReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PreferenceServiceServer).BatchGetPreferences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.PreferenceService/BatchGetPreferences",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PreferenceServiceServer).BatchGetPreferences(ctx, req.(*BatchGetPreferencesReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PreferenceService_SetPreference_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPreferenceReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PreferenceServiceServer).SetPreference(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.PreferenceService/SetPreference",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PreferenceServiceServer).SetPreference(ctx, req.(*SetPreferenceReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PreferenceService_ServiceDesc is the grpc.ServiceDesc for PreferenceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PreferenceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "user.PreferenceService",
+	HandlerType: (*PreferenceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPreference",
+			Handler:    _PreferenceService_GetPreference_Handler,
+		},
+		{
+			MethodName: "BatchGetPreferences",
+			Handler:    _PreferenceService_BatchGetPreferences_Handler,
+		},
+		{
+			MethodName: "SetPreference",
+			Handler:    _PreferenceService_SetPreference_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "preference.proto",
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+	"github.com/Numsina/tk_users/user_srv/service"
+)
+
+var _ users.PointsServiceServer = &PointsHandler{}
+
+type PointsHandler struct {
+	users.UnimplementedPointsServiceServer
+	srv service.PointsService
+}
+
+func NewPointsHandler(srv service.PointsService) *PointsHandler {
+	return &PointsHandler{
+		srv: srv,
+	}
+}
+
+func (p *PointsHandler) Credit(ctx context.Context, req *users.CreditReq) (*users.PointsTxResp, error) {
+	t, err := p.srv.Credit(ctx, domain.PointsTx{
+		UserId:   req.GetUserId(),
+		Amount:   req.GetAmount(),
+		BizType:  req.GetBizType(),
+		BizRef:   req.GetBizRef(),
+		ExpireAt: req.GetExpireAt(),
+		Remark:   req.GetRemark(),
+	})
+	if err != nil {
+		return &users.PointsTxResp{}, pointsError(err)
+	}
+
+	return &users.PointsTxResp{
+		Tx: toPointsTxPb(t),
+	}, nil
+}
+
+func (p *PointsHandler) Debit(ctx context.Context, req *users.DebitReq) (*users.PointsTxResp, error) {
+	t, err := p.srv.Debit(ctx, domain.PointsTx{
+		UserId:  req.GetUserId(),
+		Amount:  req.GetAmount(),
+		BizType: req.GetBizType(),
+		BizRef:  req.GetBizRef(),
+		Remark:  req.GetRemark(),
+	})
+	if err != nil {
+		return &users.PointsTxResp{}, pointsError(err)
+	}
+
+	return &users.PointsTxResp{
+		Tx: toPointsTxPb(t),
+	}, nil
+}
+
+func (p *PointsHandler) GetBalance(ctx context.Context, req *users.GetBalanceReq) (*users.GetBalanceResp, error) {
+	if req.GetUserId() <= 0 {
+		return &users.GetBalanceResp{}, status.Error(codes.InvalidArgument, "参数无效")
+	}
+
+	b, err := p.srv.Balance(ctx, req.GetUserId())
+	if err != nil {
+		return &users.GetBalanceResp{}, pointsError(err)
+	}
+
+	return &users.GetBalanceResp{
+		Balance:  b.Balance,
+		Expiring: b.Expiring,
+	}, nil
+}
+
+func (p *PointsHandler) ListHistory(ctx context.Context, req *users.ListHistoryReq) (*users.ListHistoryResp, error) {
+	if req.GetUserId() <= 0 || req.GetCursor() < 0 {
+		return &users.ListHistoryResp{}, status.Error(codes.InvalidArgument, "参数无效")
+	}
+
+	txs, next, err := p.srv.History(ctx, req.GetUserId(), req.GetCursor(), int(req.GetPageSize()))
+	if err != nil {
+		return &users.ListHistoryResp{}, pointsError(err)
+	}
+
+	resp := &users.ListHistoryResp{
+		Txs:        make([]*users.PointsTx, 0, len(txs)),
+		NextCursor: next,
+	}
+	for _, t := range txs {
+		resp.Txs = append(resp.Txs, toPointsTxPb(t))
+	}
+	return resp, nil
+}
+
+func pointsError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrPointsInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrInsufficientPoints):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrBizRefConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrRecordNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func toPointsTxPb(t domain.PointsTx) *users.PointsTx {
+	return &users.PointsTx{
+		Id:       t.Id,
+		UserId:   t.UserId,
+		Kind:     t.Kind,
+		BizType:  t.BizType,
+		BizRef:   t.BizRef,
+		Amount:   t.Amount,
+		Balance:  t.Balance,
+		Remark:   t.Remark,
+		ExpireAt: t.ExpireAt,
+		CreateAt: t.CreateAt,
+	}
+}
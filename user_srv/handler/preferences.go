@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+	"github.com/Numsina/tk_users/user_srv/service"
+)
+
+var _ users.PreferenceServiceServer = &PreferenceHandler{}
+
+type PreferenceHandler struct {
+	users.UnimplementedPreferenceServiceServer
+	srv service.PreferenceService
+}
+
+func NewPreferenceHandler(srv service.PreferenceService) *PreferenceHandler {
+	return &PreferenceHandler{
+		srv: srv,
+	}
+}
+
+func (p *PreferenceHandler) GetPreference(ctx context.Context, req *users.GetPreferenceReq) (*users.GetPreferenceResp, error) {
+	if req.GetUserId() <= 0 || req.GetKey() == "" {
+		return &users.GetPreferenceResp{}, status.Error(codes.InvalidArgument, "参数无效")
+	}
+
+	pref, err := p.srv.Get(ctx, req.GetUserId(), req.GetKey())
+	if err != nil {
+		return &users.GetPreferenceResp{}, preferenceError(err)
+	}
+
+	return &users.GetPreferenceResp{
+		Preference: toPreferencePb(pref),
+	}, nil
+}
+
+func (p *PreferenceHandler) BatchGetPreferences(ctx context.Context, req *users.BatchGetPreferencesReq) (*users.BatchGetPreferencesResp, error) {
+	if req.GetUserId() <= 0 {
+		return &users.BatchGetPreferencesResp{}, status.Error(codes.InvalidArgument, "参数无效")
+	}
+
+	prefs, err := p.srv.BatchGet(ctx, req.GetUserId(), req.GetKeys())
+	if err != nil {
+		return &users.BatchGetPreferencesResp{}, preferenceError(err)
+	}
+
+	resp := &users.BatchGetPreferencesResp{
+		Preferences: make([]*users.Preference, 0, len(prefs)),
+	}
+	for _, pref := range prefs {
+		resp.Preferences = append(resp.Preferences, toPreferencePb(pref))
+	}
+	return resp, nil
+}
+
+func (p *PreferenceHandler) SetPreference(ctx context.Context, req *users.SetPreferenceReq) (*users.SetPreferenceResp, error) {
+	if req.GetUserId() <= 0 || req.GetKey() == "" || req.GetVersion() < 0 {
+		return &users.SetPreferenceResp{}, status.Error(codes.InvalidArgument, "参数无效")
+	}
+
+	pref, err := p.srv.Set(ctx, req.GetUserId(), domain.Preference{
+		Key:     req.GetKey(),
+		Value:   req.GetValue(),
+		Version: req.GetVersion(),
+	})
+	if err != nil {
+		return &users.SetPreferenceResp{}, preferenceError(err)
+	}
+
+	return &users.SetPreferenceResp{
+		Preference: toPreferencePb(pref),
+	}, nil
+}
+
+func preferenceError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrPreferenceKeyUnknown):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrPreferenceValueInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrVersionConflict):
+		return status.Error(codes.Aborted, "偏好设置已被修改, 请刷新后重试")
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func toPreferencePb(pref domain.Preference) *users.Preference {
+	return &users.Preference{
+		Key:      pref.Key,
+		Value:    pref.Value,
+		Type:     pref.Type,
+		Version:  pref.Version,
+		UpdateAt: pref.UpdateAt,
+	}
+}
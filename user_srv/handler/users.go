@@ -7,6 +7,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -14,6 +15,7 @@ import (
 	"github.com/Numsina/tk_users/user_srv/dao"
 	domain "github.com/Numsina/tk_users/user_srv/domian"
 	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+	"github.com/Numsina/tk_users/user_srv/pkg/password"
 	"github.com/Numsina/tk_users/user_srv/service"
 )
 
@@ -26,12 +28,15 @@ var _ users.UserServiceServer = &UserHandler{}
 
 type UserHandler struct {
 	users.UnimplementedUserServiceServer
-	srv service.UserService
+	srv    service.UserService
+	search service.UserSearch
 }
 
-func NewUserHandler(srv service.UserService) *UserHandler {
+// NewUserHandler search为nil时表示没有开启用户搜索
+func NewUserHandler(srv service.UserService, search service.UserSearch) *UserHandler {
 	return &UserHandler{
-		srv: srv,
+		srv:    srv,
+		search: search,
 	}
 }
 
@@ -55,6 +60,17 @@ func (u *UserHandler) Register(ctx context.Context, req *users.RegisterReq) (*us
 		return &users.RegisterResp{}, status.Error(codes.AlreadyExists, "用户已存在")
 	}
 
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		return &users.RegisterResp{}, policyStatus(policyErr)
+	}
+
+	if errors.Is(err, service.ErrBreached) {
+		return &users.RegisterResp{}, policyStatus(&password.PolicyError{
+			Reasons: []string{password.ReasonBreached},
+		})
+	}
+
 	if err != nil {
 		return &users.RegisterResp{}, status.Error(codes.Internal, err.Error())
 	}
@@ -86,6 +102,10 @@ func (u *UserHandler) Login(ctx context.Context, req *users.LoginReq) (*users.Lo
 		return &users.LoginResp{}, status.Error(codes.NotFound, "用户不存在")
 	}
 
+	if errors.Is(err, service.ErrPasswordWrong) {
+		return &users.LoginResp{}, status.Error(codes.Unauthenticated, "邮箱或密码不正确")
+	}
+
 	if err != nil {
 		return &users.LoginResp{}, status.Error(codes.Internal, err.Error())
 	}
@@ -117,5 +137,134 @@ func (u *UserHandler) GetUserByEmail(ctx context.Context, req *users.GetUserByEm
 		Address:     user.Address,
 		Description: user.Description,
 		Avatar:      user.Avatar,
+		Version:     user.Version,
+	}, nil
+}
+
+func (u *UserHandler) GetUserById(ctx context.Context, req *users.GetUserByIdReq) (*users.GetUserByIdResp, error) {
+	user, err := u.srv.GetUserInfoById(ctx, req.GetUserId())
+	if errors.Is(err, ErrRecordNotFound) {
+		return &users.GetUserByIdResp{}, status.Error(codes.NotFound, "用户不存在")
+	}
+
+	if err != nil {
+		return &users.GetUserByIdResp{}, status.Error(codes.Internal, err.Error())
+	}
+
+	return &users.GetUserByIdResp{
+		Profile: toProfilePb(user),
+	}, nil
+}
+
+func (u *UserHandler) UpdateProfile(ctx context.Context, req *users.UpdateProfileReq) (*users.UpdateProfileResp, error) {
+	user, err := u.srv.ModifyUserInfoById(ctx, domain.User{
+		Id:          req.GetUserId(),
+		NickName:    req.GetNickName(),
+		Description: req.GetDescription(),
+		Avatar:      req.GetAvatar(),
+		BirthDay:    req.GetBirthDay(),
+		Address:     req.GetAddress(),
+		Version:     req.GetVersion(),
+	})
+	if errors.Is(err, ErrRecordNotFound) {
+		return &users.UpdateProfileResp{}, status.Error(codes.NotFound, "用户不存在")
+	}
+
+	if errors.Is(err, service.ErrVersionConflict) {
+		return &users.UpdateProfileResp{}, status.Error(codes.Aborted, "用户信息已被修改, 请刷新后重试")
+	}
+
+	if err != nil {
+		return &users.UpdateProfileResp{}, status.Error(codes.Internal, err.Error())
+	}
+
+	return &users.UpdateProfileResp{
+		Profile: toProfilePb(user),
 	}, nil
 }
+
+func (u *UserHandler) ChangePassword(ctx context.Context, req *users.ChangePasswordReq) (*users.ChangePasswordResp, error) {
+	if req.GetNewPassword() != req.GetConfirmPassword() {
+		return &users.ChangePasswordResp{}, status.Error(codes.InvalidArgument, "两次输入的密码不同")
+	}
+
+	err := u.srv.ChangePassword(ctx, req.GetUserId(), req.GetOldPassword(), req.GetNewPassword())
+	if errors.Is(err, ErrRecordNotFound) {
+		return &users.ChangePasswordResp{}, status.Error(codes.NotFound, "用户不存在")
+	}
+
+	if errors.Is(err, service.ErrPasswordWrong) {
+		return &users.ChangePasswordResp{}, status.Error(codes.Unauthenticated, "原密码不正确")
+	}
+
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		return &users.ChangePasswordResp{}, policyStatus(policyErr)
+	}
+
+	if errors.Is(err, service.ErrBreached) {
+		return &users.ChangePasswordResp{}, policyStatus(&password.PolicyError{
+			Reasons: []string{password.ReasonBreached},
+		})
+	}
+
+	if err != nil {
+		return &users.ChangePasswordResp{}, status.Error(codes.Internal, err.Error())
+	}
+	return &users.ChangePasswordResp{}, nil
+}
+
+func (u *UserHandler) SearchUsers(ctx context.Context, req *users.SearchUsersReq) (*users.SearchUsersResp, error) {
+	if u.search == nil {
+		return &users.SearchUsersResp{}, status.Error(codes.Unimplemented, "未开启用户搜索")
+	}
+
+	res, total, err := u.search.Search(ctx, req.GetQuery(), int(req.GetOffset()), int(req.GetPageSize()))
+	if errors.Is(err, service.ErrSearchUnavailable) {
+		return &users.SearchUsersResp{}, status.Error(codes.Unavailable, err.Error())
+	}
+
+	if err != nil {
+		return &users.SearchUsersResp{}, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &users.SearchUsersResp{
+		Profiles: make([]*users.Profile, 0, len(res)),
+		Total:    int64(total),
+	}
+	for _, user := range res {
+		resp.Profiles = append(resp.Profiles, toProfilePb(user))
+	}
+	return resp, nil
+}
+
+func toProfilePb(user domain.User) *users.Profile {
+	return &users.Profile{
+		UserId:      user.Id,
+		Email:       user.Email,
+		NickName:    user.NickName,
+		Description: user.Description,
+		Avatar:      user.Avatar,
+		BirthDay:    user.BirthDay,
+		Address:     user.Address,
+		Version:     user.Version,
+		UpdateAt:    user.UpdateAt,
+	}
+}
+
+// policyStatus 将密码策略的失败原因放入BadRequest详情, 便于调用方逐条识别
+func policyStatus(policyErr *password.PolicyError) error {
+	br := &errdetails.BadRequest{}
+	for _, reason := range policyErr.Reasons {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "password",
+			Description: reason,
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, "密码不符合安全策略").WithDetails(br)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, policyErr.Error())
+	}
+	return st.Err()
+}
@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/genproto/googleapis/type/date"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	usersv2 "github.com/Numsina/tk_users/user_srv/gen/users/v2"
+	"github.com/Numsina/tk_users/user_srv/service"
+)
+
+// errorDomain v2错误详情中ErrorInfo的domain
+const errorDomain = "users.tk_users"
+
+const (
+	reasonUserNotFound       = "USER_NOT_FOUND"
+	reasonVersionConflict    = "VERSION_CONFLICT"
+	reasonSearchUnavailable  = "SEARCH_UNAVAILABLE"
+	reasonSearchNotSupported = "SEARCH_NOT_SUPPORTED"
+)
+
+// updatableFields v2可以通过update_mask修改的字段, 与v1的UpdateProfile一致
+var updatableFields = []string{"nick_name", "description", "avatar", "birth_day", "address"}
+
+var errPageTokenInvalid = errors.New("page_token无效")
+
+var _ usersv2.UserServiceServer = &UserV2Handler{}
+
+// UserV2Handler users.v2的UserService, 与UserHandler共用同一套服务层
+type UserV2Handler struct {
+	usersv2.UnimplementedUserServiceServer
+	srv    service.UserService
+	search service.UserSearch
+}
+
+// NewUserV2Handler search为nil时表示没有开启用户搜索
+func NewUserV2Handler(srv service.UserService, search service.UserSearch) *UserV2Handler {
+	return &UserV2Handler{
+		srv:    srv,
+		search: search,
+	}
+}
+
+func (u *UserV2Handler) GetUser(ctx context.Context, req *usersv2.GetUserRequest) (*usersv2.User, error) {
+	user, err := u.srv.GetUserInfoById(ctx, req.GetUserId())
+	if err != nil {
+		return &usersv2.User{}, userV2Error(err, req.GetUserId())
+	}
+
+	res := toUserV2Pb(user)
+	applyReadMask(res, req.GetReadMask())
+	return res, nil
+}
+
+func (u *UserV2Handler) UpdateUser(ctx context.Context, req *usersv2.UpdateUserRequest) (*usersv2.User, error) {
+	// 指定的字段会直接写入分表, 即使没有开启校验拦截器也不能修改其他字段
+	if err := checkUpdateMask(req.GetUpdateMask()); err != nil {
+		return &usersv2.User{}, err
+	}
+	// fromDatePb会把无效的日期顺延为其他日期, 需要先拒绝
+	if err := checkDate(req.GetUser().GetBirthDay()); err != nil {
+		return &usersv2.User{}, err
+	}
+
+	pb := req.GetUser()
+	user, err := u.srv.ModifyUserInfoById(ctx, domain.User{
+		Id:          pb.GetUserId(),
+		NickName:    pb.GetNickName(),
+		Description: pb.GetDescription(),
+		Avatar:      pb.GetAvatar(),
+		BirthDay:    fromDatePb(pb.GetBirthDay()),
+		Address:     pb.GetAddress(),
+		Version:     pb.GetVersion(),
+	}, updateFields(req.GetUpdateMask())...)
+	if err != nil {
+		return &usersv2.User{}, userV2Error(err, pb.GetUserId())
+	}
+	return toUserV2Pb(user), nil
+}
+
+func (u *UserV2Handler) DeleteUser(ctx context.Context, req *usersv2.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := u.srv.Delele(ctx, req.GetUserId()); err != nil {
+		return &emptypb.Empty{}, userV2Error(err, req.GetUserId())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (u *UserV2Handler) SearchUsers(ctx context.Context, req *usersv2.SearchUsersRequest) (*usersv2.SearchUsersResponse, error) {
+	if u.search == nil {
+		return &usersv2.SearchUsersResponse{}, errorStatus(codes.Unimplemented, "未开启用户搜索", reasonSearchNotSupported, nil)
+	}
+
+	// 没有开启校验拦截器时同样拒绝无效的page_token
+	offset, err := decodePageToken(req.GetPageToken(), req.GetQuery())
+	if err != nil {
+		return &usersv2.SearchUsersResponse{}, badRequest("page_token", err.Error())
+	}
+	limit := int(req.GetPageSize())
+	if limit <= 0 || limit > service.SearchMaxPageSize {
+		limit = service.SearchMaxPageSize
+	}
+
+	res, total, err := u.search.Search(ctx, req.GetQuery(), offset, limit)
+	if errors.Is(err, service.ErrSearchUnavailable) {
+		return &usersv2.SearchUsersResponse{}, errorStatus(codes.Unavailable, err.Error(), reasonSearchUnavailable, nil)
+	}
+
+	if err != nil {
+		return &usersv2.SearchUsersResponse{}, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &usersv2.SearchUsersResponse{
+		Users:     make([]*usersv2.User, 0, len(res)),
+		TotalSize: int64(total),
+	}
+	for _, user := range res {
+		pb := toUserV2Pb(user)
+		applyReadMask(pb, req.GetReadMask())
+		resp.Users = append(resp.Users, pb)
+	}
+	if next := offset + limit; next < total && next <= service.SearchMaxOffset {
+		resp.NextPageToken = encodePageToken(req.GetQuery(), next)
+	}
+	return resp, nil
+}
+
+// userV2Error 把服务层的错误转换为带详情的status
+func userV2Error(err error, uid int64) error {
+	switch {
+	case errors.Is(err, ErrRecordNotFound):
+		st, detailErr := status.New(codes.NotFound, "用户不存在").WithDetails(
+			errorInfo(reasonUserNotFound, map[string]string{"user_id": strconv.FormatInt(uid, 10)}),
+			&errdetails.ResourceInfo{
+				ResourceType: "user.v2.User",
+				ResourceName: fmt.Sprintf("users/%d", uid),
+				Description:  "用户不存在",
+			},
+		)
+		if detailErr != nil {
+			return status.Error(codes.NotFound, "用户不存在")
+		}
+		return st.Err()
+	case errors.Is(err, service.ErrVersionConflict):
+		return errorStatus(codes.Aborted, "用户信息已被修改, 请刷新后重试", reasonVersionConflict,
+			map[string]string{"user_id": strconv.FormatInt(uid, 10)})
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// errorStatus 返回带ErrorInfo详情的status, 调用方按reason识别错误而不是按msg
+func errorStatus(code codes.Code, msg, reason string, metadata map[string]string) error {
+	st, err := status.New(code, msg).WithDetails(errorInfo(reason, metadata))
+	if err != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
+func errorInfo(reason string, metadata map[string]string) *errdetails.ErrorInfo {
+	return &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   errorDomain,
+		Metadata: metadata,
+	}
+}
+
+// badRequest 返回带BadRequest详情的InvalidArgument, 由校验拦截器原样返回
+func badRequest(field, description string) error {
+	st, err := status.New(codes.InvalidArgument, errParamInvalid.Error()).WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+			Field:       field,
+			Description: description,
+		}},
+	})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, description)
+	}
+	return st.Err()
+}
+
+// updateFields mask为空时返回nil, 服务层只修改非空的字段
+func updateFields(mask *fieldmaskpb.FieldMask) []string {
+	paths := mask.GetPaths()
+	if len(paths) == 1 && paths[0] == "*" {
+		return updatableFields
+	}
+	var fields []string
+	for _, p := range paths {
+		// 网关按body生成的mask中生日是birth_day.year这样的子字段, 生日总是整体修改;
+		// user_id和version用于定位用户和乐观锁, 不是修改的字段
+		f, _, _ := strings.Cut(p, ".")
+		if f == "user_id" || f == "version" || slices.Contains(fields, f) {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// checkUpdateMask update_mask只能是*或者可以修改的字段
+func checkUpdateMask(mask *fieldmaskpb.FieldMask) error {
+	paths := mask.GetPaths()
+	if len(paths) == 1 && paths[0] == "*" {
+		return nil
+	}
+	for _, f := range updateFields(mask) {
+		if !slices.Contains(updatableFields, f) {
+			return badRequest("update_mask", fmt.Sprintf("不能修改字段%s", f))
+		}
+	}
+	return nil
+}
+
+// checkReadMask read_mask只支持User的顶层字段
+func checkReadMask(mask *fieldmaskpb.FieldMask) error {
+	fields := (&usersv2.User{}).ProtoReflect().Descriptor().Fields()
+	for _, p := range mask.GetPaths() {
+		if fields.ByName(protoreflect.Name(p)) == nil {
+			return badRequest("read_mask", fmt.Sprintf("未知的字段%s", p))
+		}
+	}
+	return nil
+}
+
+// applyReadMask 清除不在mask中的字段, mask为空时保留全部字段
+func applyReadMask(user *usersv2.User, mask *fieldmaskpb.FieldMask) {
+	paths := mask.GetPaths()
+	if len(paths) == 0 {
+		return
+	}
+	m := user.ProtoReflect()
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if !slices.Contains(paths, string(fd.Name())) {
+			m.Clear(fd)
+		}
+		return true
+	})
+}
+
+// checkDate 生日需要是完整的日期
+func checkDate(d *date.Date) error {
+	if d == nil {
+		return nil
+	}
+	t := time.Date(int(d.GetYear()), time.Month(d.GetMonth()), int(d.GetDay()), 0, 0, 0, 0, time.UTC)
+	if d.GetYear() <= 0 || t.Year() != int(d.GetYear()) || int32(t.Month()) != d.GetMonth() || int32(t.Day()) != d.GetDay() {
+		return badRequest("user.birth_day", "生日不是有效的日期")
+	}
+	return nil
+}
+
+// page_token为base64编码的"偏移量:查询的哈希", 换了查询之后不能继续使用.
+// page_token没有签名, 偏移量限制在service.SearchMaxOffset以内, 伪造的page_token不能让搜索扫描更多的结果
+func encodePageToken(query string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", offset, queryHash(query))))
+}
+
+func decodePageToken(token, query string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errPageTokenInvalid
+	}
+	o, h, ok := strings.Cut(string(b), ":")
+	if !ok || h != strconv.FormatUint(uint64(queryHash(query)), 10) {
+		return 0, errPageTokenInvalid
+	}
+	offset, err := strconv.Atoi(o)
+	if err != nil || offset < 0 || offset > service.SearchMaxOffset {
+		return 0, errPageTokenInvalid
+	}
+	return offset, nil
+}
+
+func queryHash(query string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(query))
+	return h.Sum32()
+}
+
+// 生日和修改时间在服务层是毫秒时间戳, 生日按UTC转换为日期, 同一天内的任意时刻都是这一天
+func toUserV2Pb(user domain.User) *usersv2.User {
+	res := &usersv2.User{
+		UserId:      user.Id,
+		Email:       user.Email,
+		NickName:    user.NickName,
+		Description: user.Description,
+		Avatar:      user.Avatar,
+		Address:     user.Address,
+		Version:     user.Version,
+	}
+	if user.BirthDay != 0 {
+		t := time.UnixMilli(user.BirthDay).UTC()
+		res.BirthDay = &date.Date{Year: int32(t.Year()), Month: int32(t.Month()), Day: int32(t.Day())}
+	}
+	if user.UpdateAt != 0 {
+		res.UpdateTime = timestamppb.New(time.UnixMilli(user.UpdateAt))
+	}
+	return res
+}
+
+// fromDatePb 生日为0表示没有设置, 1970-01-01的零点恰好是0, 保存为当天的第1毫秒
+func fromDatePb(d *date.Date) int64 {
+	if d == nil {
+		return 0
+	}
+	ms := time.Date(int(d.GetYear()), time.Month(d.GetMonth()), int(d.GetDay()), 0, 0, 0, 0, time.UTC).UnixMilli()
+	if ms == 0 {
+		ms = 1
+	}
+	return ms
+}
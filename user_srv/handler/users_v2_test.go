@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/genproto/googleapis/type/date"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	usersv2 "github.com/Numsina/tk_users/user_srv/gen/users/v2"
+	"github.com/Numsina/tk_users/user_srv/service"
+)
+
+// fakeUserSvc 只实现v2用到的方法, 其他方法被调用时panic
+type fakeUserSvc struct {
+	service.UserService
+	users    map[int64]domain.User
+	modified []domain.User
+}
+
+func (f *fakeUserSvc) Delele(ctx context.Context, uid int64) error {
+	if _, ok := f.users[uid]; !ok {
+		return service.ErrRecordNotFound
+	}
+	delete(f.users, uid)
+	return nil
+}
+
+func (f *fakeUserSvc) ModifyUserInfoById(ctx context.Context, user domain.User, fields ...string) (domain.User, error) {
+	f.modified = append(f.modified, user)
+	return user, nil
+}
+
+type fakeSearch struct {
+	service.UserSearch
+	total   int
+	offsets []int
+}
+
+func (f *fakeSearch) Search(ctx context.Context, query string, offset, limit int) ([]domain.User, int, error) {
+	f.offsets = append(f.offsets, offset)
+	return []domain.User{{Id: 1}}, f.total, nil
+}
+
+// checkBadRequest err是field字段的InvalidArgument
+func checkBadRequest(t *testing.T, err error, field string) {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("应返回InvalidArgument, 实际: %v", err)
+	}
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok && br.GetFieldViolations()[0].GetField() == field {
+			return
+		}
+	}
+	t.Fatalf("错误详情中没有字段%s: %v", field, st.Details())
+}
+
+// 注销不依赖先查询, 不存在或已被并发注销的用户返回NotFound
+func TestV2DeleteUser(t *testing.T) {
+	svc := &fakeUserSvc{users: map[int64]domain.User{1: {Id: 1}}}
+	h := NewUserV2Handler(svc, nil)
+	ctx := context.Background()
+
+	if _, err := h.DeleteUser(ctx, &usersv2.DeleteUserRequest{UserId: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.DeleteUser(ctx, &usersv2.DeleteUserRequest{UserId: 1}); status.Code(err) != codes.NotFound {
+		t.Fatalf("再次注销应返回NotFound, 实际: %v", err)
+	}
+}
+
+// 没有经过校验拦截器时handler同样拒绝无效的page_token
+func TestV2SearchPageToken(t *testing.T) {
+	s := &fakeSearch{total: 3}
+	h := NewUserV2Handler(&fakeUserSvc{}, s)
+	ctx := context.Background()
+
+	for _, token := range []string{"!!!", encodePageToken("bob", 1), "LTE6MA", encodePageToken("alice", service.SearchMaxOffset+1)} {
+		_, err := h.SearchUsers(ctx, &usersv2.SearchUsersRequest{Query: "alice", PageSize: 1, PageToken: token})
+		checkBadRequest(t, err, "page_token")
+	}
+	if len(s.offsets) != 0 {
+		t.Fatalf("无效的page_token执行了搜索: %v", s.offsets)
+	}
+
+	resp, err := h.SearchUsers(ctx, &usersv2.SearchUsersRequest{Query: "alice", PageSize: 1, PageToken: encodePageToken("alice", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.offsets[0] != 1 || resp.GetNextPageToken() != encodePageToken("alice", 2) {
+		t.Fatalf("偏移量为%v, next_page_token为%s", s.offsets, resp.GetNextPageToken())
+	}
+}
+
+// 翻页不能超过SearchMaxOffset, 到达上限后不再返回next_page_token
+func TestV2SearchMaxOffset(t *testing.T) {
+	s := &fakeSearch{total: 2 * service.SearchMaxOffset}
+	h := NewUserV2Handler(&fakeUserSvc{}, s)
+	ctx := context.Background()
+
+	search := func(offset int) string {
+		t.Helper()
+		resp, err := h.SearchUsers(ctx, &usersv2.SearchUsersRequest{
+			Query:     "alice",
+			PageSize:  1,
+			PageToken: encodePageToken("alice", offset),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.GetNextPageToken()
+	}
+	if next := search(service.SearchMaxOffset - 1); next != encodePageToken("alice", service.SearchMaxOffset) {
+		t.Fatalf("上限之前应返回next_page_token, 实际: %q", next)
+	}
+	if next := search(service.SearchMaxOffset); next != "" {
+		t.Fatalf("到达上限后不应返回next_page_token, 实际: %q", next)
+	}
+}
+
+// 无效的生日直接拒绝, 不会被顺延为其他日期写入
+func TestV2UpdateUserBirthDay(t *testing.T) {
+	svc := &fakeUserSvc{}
+	h := NewUserV2Handler(svc, nil)
+	ctx := context.Background()
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"birth_day"}}
+
+	for _, d := range []*date.Date{{Year: 2023, Month: 2, Day: 29}, {Year: 2024, Month: 13, Day: 1}, {Year: 0, Month: 1, Day: 1}} {
+		_, err := h.UpdateUser(ctx, &usersv2.UpdateUserRequest{
+			User:       &usersv2.User{UserId: 1, BirthDay: d},
+			UpdateMask: mask,
+		})
+		checkBadRequest(t, err, "user.birth_day")
+	}
+	if len(svc.modified) != 0 {
+		t.Fatalf("无效的生日被写入: %+v", svc.modified)
+	}
+
+	_, err := h.UpdateUser(ctx, &usersv2.UpdateUserRequest{
+		User:       &usersv2.User{UserId: 1, BirthDay: &date.Date{Year: 2024, Month: 2, Day: 29}},
+		UpdateMask: mask,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.modified[0].BirthDay != 1709164800000 {
+		t.Fatalf("生日为%d", svc.modified[0].BirthDay)
+	}
+}
+
+// 1970-01-01不能与表示没有设置的0混淆
+func TestV2BirthDayEpoch(t *testing.T) {
+	svc := &fakeUserSvc{}
+	h := NewUserV2Handler(svc, nil)
+	epoch := &date.Date{Year: 1970, Month: 1, Day: 1}
+
+	res, err := h.UpdateUser(context.Background(), &usersv2.UpdateUserRequest{
+		User:       &usersv2.User{UserId: 1, BirthDay: epoch},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"birth_day"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.modified[0].BirthDay == 0 {
+		t.Fatal("1970-01-01被当作没有设置生日")
+	}
+	if !proto.Equal(res.GetBirthDay(), epoch) {
+		t.Fatalf("返回的生日为%v", res.GetBirthDay())
+	}
+	if res = toUserV2Pb(domain.User{Id: 1}); res.BirthDay != nil {
+		t.Fatalf("没有设置生日时返回了%v", res.GetBirthDay())
+	}
+}
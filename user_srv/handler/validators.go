@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Numsina/tk_users/user_srv/constant"
+	"github.com/Numsina/tk_users/user_srv/gen/users/v1"
+	usersv2 "github.com/Numsina/tk_users/user_srv/gen/users/v2"
+	"github.com/Numsina/tk_users/user_srv/pkg/interceptor"
+)
+
+var (
+	errEmailInvalid = errors.New("邮箱格式不正确")
+	errParamInvalid = errors.New("参数无效")
+
+	emailRegexp = regexp.MustCompile("^" + constant.UserEmail + "$")
+)
+
+// Validators 各方法的请求校验, 由拦截器在进入handler前执行
+var Validators = map[string]interceptor.Validator{
+	"/user.UserService/Register": func(req any) error {
+		r := req.(*users.RegisterReq)
+		if r.GetPassword() == "" || r.GetConfirmPassword() == "" {
+			return errParamInvalid
+		}
+		return checkEmail(r.GetEmail())
+	},
+	"/user.UserService/Login": func(req any) error {
+		r := req.(*users.LoginReq)
+		if r.GetPassword() == "" {
+			return errParamInvalid
+		}
+		return checkEmail(r.GetEmail())
+	},
+	"/user.UserService/GetUserByEmail": func(req any) error {
+		return checkEmail(req.(*users.GetUserByEmailReq).GetEmail())
+	},
+	"/user.UserService/GetUserById": func(req any) error {
+		return check(req.(*users.GetUserByIdReq).GetUserId() > 0)
+	},
+	"/user.UserService/UpdateProfile": func(req any) error {
+		r := req.(*users.UpdateProfileReq)
+		return check(r.GetUserId() > 0 && r.GetVersion() >= 0)
+	},
+	"/user.UserService/ChangePassword": func(req any) error {
+		r := req.(*users.ChangePasswordReq)
+		return check(r.GetUserId() > 0 && r.GetOldPassword() != "" && r.GetNewPassword() != "" && r.GetConfirmPassword() != "")
+	},
+	"/user.UserService/SearchUsers": func(req any) error {
+		r := req.(*users.SearchUsersReq)
+		return check(strings.TrimSpace(r.GetQuery()) != "" && r.GetOffset() >= 0 && r.GetPageSize() >= 0)
+	},
+	"/user.v2.UserService/GetUser": func(req any) error {
+		r := req.(*usersv2.GetUserRequest)
+		if r.GetUserId() <= 0 {
+			return badRequest("user_id", "用户id无效")
+		}
+		return checkReadMask(r.GetReadMask())
+	},
+	"/user.v2.UserService/UpdateUser": func(req any) error {
+		r := req.(*usersv2.UpdateUserRequest)
+		if r.GetUser().GetUserId() <= 0 {
+			return badRequest("user.user_id", "用户id无效")
+		}
+		if r.GetUser().GetVersion() < 0 {
+			return badRequest("user.version", "版本无效")
+		}
+		if err := checkUpdateMask(r.GetUpdateMask()); err != nil {
+			return err
+		}
+		return checkDate(r.GetUser().GetBirthDay())
+	},
+	"/user.v2.UserService/DeleteUser": func(req any) error {
+		if req.(*usersv2.DeleteUserRequest).GetUserId() <= 0 {
+			return badRequest("user_id", "用户id无效")
+		}
+		return nil
+	},
+	"/user.v2.UserService/SearchUsers": func(req any) error {
+		r := req.(*usersv2.SearchUsersRequest)
+		if strings.TrimSpace(r.GetQuery()) == "" {
+			return badRequest("query", "搜索关键词不能为空")
+		}
+		if r.GetPageSize() < 0 {
+			return badRequest("page_size", "每页数量无效")
+		}
+		if _, err := decodePageToken(r.GetPageToken(), r.GetQuery()); err != nil {
+			return badRequest("page_token", err.Error())
+		}
+		return checkReadMask(r.GetReadMask())
+	},
+	"/user.PreferenceService/GetPreference": func(req any) error {
+		r := req.(*users.GetPreferenceReq)
+		return check(r.GetUserId() > 0 && r.GetKey() != "")
+	},
+	"/user.PreferenceService/BatchGetPreferences": func(req any) error {
+		return check(req.(*users.BatchGetPreferencesReq).GetUserId() > 0)
+	},
+	"/user.PreferenceService/SetPreference": func(req any) error {
+		r := req.(*users.SetPreferenceReq)
+		return check(r.GetUserId() > 0 && r.GetKey() != "" && r.GetVersion() >= 0)
+	},
+	"/user.PointsService/Credit": func(req any) error {
+		r := req.(*users.CreditReq)
+		return check(r.GetUserId() > 0 && r.GetAmount() > 0 && r.GetBizType() != "" && r.GetBizRef() != "")
+	},
+	"/user.PointsService/Debit": func(req any) error {
+		r := req.(*users.DebitReq)
+		return check(r.GetUserId() > 0 && r.GetAmount() > 0 && r.GetBizType() != "" && r.GetBizRef() != "")
+	},
+	"/user.PointsService/GetBalance": func(req any) error {
+		return check(req.(*users.GetBalanceReq).GetUserId() > 0)
+	},
+	"/user.PointsService/ListHistory": func(req any) error {
+		r := req.(*users.ListHistoryReq)
+		return check(r.GetUserId() > 0 && r.GetCursor() >= 0)
+	},
+}
+
+func checkEmail(email string) error {
+	if !emailRegexp.MatchString(email) {
+		return errEmailInvalid
+	}
+	return nil
+}
+
+func check(ok bool) error {
+	if !ok {
+		return errParamInvalid
+	}
+	return nil
+}
@@ -1,64 +1,205 @@
 package initiallize
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
+	prom "github.com/prometheus/client_golang/prometheus"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 	"gorm.io/plugin/prometheus"
 
 	"github.com/Numsina/tk_users/user_srv/pkg/gormx"
 )
 
+const (
+	DriverMysql    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+)
+
 var db *gorm.DB
 
 func InitDB() *gorm.DB {
 	if db == nil {
-		dsn := fmt.Sprintf("%s:%s@(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-			Conf.MysqlInfo.UserName, Conf.MysqlInfo.PassWord, Conf.MysqlInfo.Host, Conf.MysqlInfo.Port,
-			Conf.MysqlInfo.DBName)
+		var err error
+		db, err = open(dialector())
+		if err != nil {
+			panic(err)
+		}
+		//gormx.InitJaeger()
+		resolve(db)
+		use(db)
+	}
+	return db
+}
 
-		newLogger := logger.New(
-			log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-			logger.Config{
-				SlowThreshold: time.Second, // Slow SQL threshold
-				LogLevel:      logger.Info, // Log level
-			},
-		)
+// InitMigrateDB 打开一个只连主库且不注册插件的连接用于数据库迁移,
+// 迁移锁要求所有语句在同一个连接上执行, 不能经过读写分离, 用完后需要关闭
+func InitMigrateDB() (*gorm.DB, error) {
+	return open(dialector())
+}
 
-		var err error
-		db, err = gorm.Open(mysql.New(mysql.Config{
+var shardDBs []*gorm.DB
+
+// InitShardDBs 存放用户分表的库, 第一个为主库
+func InitShardDBs() []*gorm.DB {
+	if shardDBs == nil {
+		shardDBs = []*gorm.DB{InitDB()}
+		// sqlite只有一个库文件
+		if Conf.Database.Driver == DriverSqlite {
+			return shardDBs
+		}
+
+		for _, d := range Conf.Sharding.Databases {
+			sdb, err := open(dialectorOf(d.Host, d.Port))
+			if err != nil {
+				panic(err)
+			}
+			sqlDB, err := sdb.DB()
+			if err != nil {
+				panic(err)
+			}
+			configurePool(sqlDB)
+			shardDBs = append(shardDBs, sdb)
+		}
+	}
+	return shardDBs
+}
+
+func open(dialector gorm.Dialector) (*gorm.DB, error) {
+	newLogger := logger.New(
+		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
+		logger.Config{
+			SlowThreshold: time.Second, // Slow SQL threshold
+			LogLevel:      logger.Info, // Log level
+		},
+	)
+
+	return gorm.Open(dialector, &gorm.Config{
+		Logger:                 newLogger,
+		SkipDefaultTransaction: true,
+		// 各驱动的唯一键冲突统一转换为gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
+}
+
+// dialector 根据配置的驱动构建主库连接
+func dialector() gorm.Dialector {
+	return dialectorOf(Conf.MysqlInfo.Host, Conf.MysqlInfo.Port)
+}
+
+func dialectorOf(host string, port int) gorm.Dialector {
+	info := Conf.MysqlInfo
+	switch Conf.Database.Driver {
+	case DriverPostgres:
+		sslMode := Conf.Database.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s TimeZone=Asia/Shanghai",
+			host, port, info.UserName, info.PassWord, info.DBName, sslMode)
+		return postgres.Open(dsn)
+	case DriverSqlite:
+		path := Conf.Database.Path
+		if path == "" {
+			path = "tk_user_srv.db"
+		}
+		return sqlite.Open(fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on", path))
+	case DriverMysql, "":
+		dsn := fmt.Sprintf("%s:%s@(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			info.UserName, info.PassWord, host, port, info.DBName)
+		return mysql.New(mysql.Config{
 			DSN:                       dsn,
 			SkipInitializeWithVersion: true,
-		}), &gorm.Config{
-			Logger:                 newLogger,
-			SkipDefaultTransaction: true,
 		})
+	default:
+		panic(fmt.Sprintf("不支持的数据库驱动: %s", Conf.Database.Driver))
+	}
+}
 
-		if err != nil {
+// resolve 配置读写分离以及主从库的连接池参数
+func resolve(db *gorm.DB) {
+	info := Conf.MysqlInfo
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic(err)
+	}
+	pools := map[string]*sql.DB{"primary": sqlDB}
+	configurePool(sqlDB)
+
+	if len(info.Replicas) > 0 && Conf.Database.Driver != DriverSqlite {
+		replicas := make([]gorm.Dialector, 0, len(info.Replicas))
+		for _, r := range info.Replicas {
+			replicas = append(replicas, dialectorOf(r.Host, r.Port))
+		}
+		resolver := dbresolver.Register(dbresolver.Config{
+			Replicas: replicas,
+			Policy:   gormx.NewPolicy(info.Policy),
+		})
+		if err = db.Use(resolver); err != nil {
+			panic(err)
+		}
+
+		i := 0
+		resolver.Call(func(pool gorm.ConnPool) error {
+			// 未单独配置主库时dbresolver复用默认连接作为主库
+			if replica, ok := pool.(*sql.DB); ok && replica != sqlDB {
+				configurePool(replica)
+				pools[fmt.Sprintf("replica-%d", i)] = replica
+				i++
+			}
+			return nil
+		})
+
+		window := time.Duration(info.StickyWindow) * time.Millisecond
+		if window <= 0 {
+			window = 2 * time.Second
+		}
+		if err = db.Use(gormx.NewSticky(InitRedis(), window)); err != nil {
 			panic(err)
 		}
-		//gormx.InitJaeger()
-		use(db)
 	}
-	return db
+
+	prom.Register(gormx.NewPoolCollector(info.DBName, pools))
+}
+
+func configurePool(sqlDB *sql.DB) {
+	info := Conf.MysqlInfo
+	if info.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(info.MaxOpenConns)
+	}
+	if info.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(info.MaxIdleConns)
+	}
+	if info.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(time.Duration(info.ConnMaxLifetime) * time.Second)
+	}
+	if info.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(time.Duration(info.ConnMaxIdleTime) * time.Second)
+	}
 }
 
 func use(db *gorm.DB) {
-	// 监控mysql线程的运行数量
+	// 监控mysql线程的运行数量, 其他数据库只采集连接池指标
+	var collectors []prometheus.MetricsCollector
+	if db.Dialector.Name() == DriverMysql {
+		collectors = append(collectors, &prometheus.MySQL{
+			VariableNames: []string{"thread_running"},
+		})
+	}
 	db.Use(prometheus.New(prometheus.Config{
-		DBName:          "tk_user_srv",
-		RefreshInterval: 15,
-		StartServer:     false,
-		MetricsCollector: []prometheus.MetricsCollector{
-			&prometheus.MySQL{
-				VariableNames: []string{"thread_running"},
-			},
-		},
+		DBName:           "tk_user_srv",
+		RefreshInterval:  15,
+		StartServer:      false,
+		MetricsCollector: collectors,
 	}))
 
 	// 利用prometheus监控sql执行时长
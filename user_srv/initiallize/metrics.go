@@ -0,0 +1,25 @@
+package initiallize
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// InitPrometheus 暴露缓存命中率等服务指标, 未配置端口时使用9989
+func InitPrometheus() {
+	port := Conf.MetricsPort
+	if port == 0 {
+		port = 9989
+	}
+
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+		if err != nil {
+			log.Println("prometheus server error:", err)
+		}
+	}()
+}
@@ -0,0 +1,19 @@
+package initiallize
+
+import (
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var rdb *redis.Client
+
+func InitRedis() *redis.Client {
+	if rdb == nil {
+		rdb = redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", Conf.RedisInfo.Host, Conf.RedisInfo.Port),
+			Password: Conf.RedisInfo.PassWord,
+		})
+	}
+	return rdb
+}
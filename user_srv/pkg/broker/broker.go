@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+const (
+	TypeKafka  = "kafka"
+	TypeMemory = "memory"
+)
+
+// Message 投递到消息队列的一条消息, 相同Key的消息进入同一分区
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// Broker 消息队列, Publish返回nil表示所有消息都已被确认
+type Broker interface {
+	Publish(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+func NewBroker(cfg config.BrokerConfig) (Broker, error) {
+	switch cfg.Type {
+	case TypeKafka:
+		if len(cfg.Brokers) == 0 {
+			return nil, fmt.Errorf("未配置kafka地址")
+		}
+		return NewKafka(cfg.Brokers), nil
+	case TypeMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("不支持的消息队列类型: %s", cfg.Type)
+	}
+}
@@ -0,0 +1,76 @@
+package broker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka 每个topic一个writer, 按key哈希分区并等待所有副本确认
+type Kafka struct {
+	brokers []string
+
+	mu      sync.Mutex
+	writers map[string]*kafka.Writer
+}
+
+func NewKafka(brokers []string) *Kafka {
+	return &Kafka{
+		brokers: brokers,
+		writers: make(map[string]*kafka.Writer),
+	}
+}
+
+func (k *Kafka) Publish(ctx context.Context, msgs ...Message) error {
+	byTopic := make(map[string][]kafka.Message)
+	var topics []string
+	for _, msg := range msgs {
+		if _, ok := byTopic[msg.Topic]; !ok {
+			topics = append(topics, msg.Topic)
+		}
+		km := kafka.Message{Key: msg.Key, Value: msg.Value}
+		for key, val := range msg.Headers {
+			km.Headers = append(km.Headers, kafka.Header{Key: key, Value: []byte(val)})
+		}
+		byTopic[msg.Topic] = append(byTopic[msg.Topic], km)
+	}
+
+	for _, topic := range topics {
+		if err := k.writer(topic).WriteMessages(ctx, byTopic[topic]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *Kafka) writer(topic string) *kafka.Writer {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	w, ok := k.writers[topic]
+	if !ok {
+		w = kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      k.brokers,
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: -1,
+		})
+		k.writers[topic] = w
+	}
+	return w
+}
+
+func (k *Kafka) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var err error
+	for topic, w := range k.writers {
+		if cerr := w.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(k.writers, topic)
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory 进程内的消息队列, 用于本地开发和测试, 不做持久化
+type Memory struct {
+	mu       sync.Mutex
+	messages map[string][]Message
+	subs     map[string][]chan Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		messages: make(map[string][]Message),
+		subs:     make(map[string][]chan Message),
+	}
+}
+
+func (m *Memory) Publish(ctx context.Context, msgs ...Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range msgs {
+		m.messages[msg.Topic] = append(m.messages[msg.Topic], msg)
+		for _, ch := range m.subs[msg.Topic] {
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// Subscribe 订阅之后发布到topic的消息, 消费过慢会阻塞发布
+func (m *Memory) Subscribe(topic string, buffer int) <-chan Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ch := make(chan Message, buffer)
+	m.subs[topic] = append(m.subs[topic], ch)
+	return ch
+}
+
+// Messages 返回topic中已发布的全部消息
+func (m *Memory) Messages(topic string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages[topic]...)
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for topic, subs := range m.subs {
+		for _, ch := range subs {
+			close(ch)
+		}
+		delete(m.subs, topic)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+const defaultBuffer = 1024
+
+// Bus 进程内的事件总线, 按事件的类型分发给订阅者.
+// 每个订阅者单独重试, 一个订阅者失败或panic不影响其他订阅者和发布方
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[reflect.Type][]*subscriber
+	closed bool
+	wg     sync.WaitGroup
+	logger *logger.Logger
+}
+
+func New(logger *logger.Logger) *Bus {
+	return &Bus{
+		subs:   make(map[reflect.Type][]*subscriber),
+		logger: logger,
+	}
+}
+
+type subscriber struct {
+	name    string
+	handle  func(ctx context.Context, e any) error
+	retries int
+	backoff time.Duration
+	// queue 不为空时为异步订阅者
+	queue chan job
+}
+
+type job struct {
+	ctx context.Context
+	e   any
+}
+
+type Option func(s *subscriber)
+
+// Async 在单独的goroutine中按发布顺序处理事件, 队列满时丢弃事件并记录日志
+func Async(buffer int) Option {
+	return func(s *subscriber) {
+		if buffer <= 0 {
+			buffer = defaultBuffer
+		}
+		s.queue = make(chan job, buffer)
+	}
+}
+
+// Retry 失败后最多重试times次, 第n次重试前等待n*backoff.
+// 同步订阅者在Publish中重试, 等待时间计入发布方的耗时, 只适合很短的backoff; 发布方的ctx取消时停止重试
+func Retry(times int, backoff time.Duration) Option {
+	return func(s *subscriber) {
+		s.retries = times
+		s.backoff = backoff
+	}
+}
+
+// Subscribe 订阅类型为T的事件, 需要在发布之前完成订阅
+func Subscribe[T any](b *Bus, name string, fn func(ctx context.Context, e T) error, opts ...Option) {
+	s := &subscriber{
+		name: name,
+		handle: func(ctx context.Context, e any) error {
+			return fn(ctx, e.(T))
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	b.subs[typ] = append(b.subs[typ], s)
+	if s.queue != nil {
+		b.wg.Add(1)
+		go b.consume(s)
+	}
+}
+
+// Publish 同步订阅者处理完成后返回, 异步订阅者只入队.
+// 订阅者的错误只记录日志, 不返回给发布方
+func (b *Bus) Publish(ctx context.Context, e any) {
+	b.mu.RLock()
+	subs := b.subs[reflect.TypeOf(e)]
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		if s.queue == nil {
+			b.dispatch(ctx, s, e)
+			continue
+		}
+		b.enqueue(ctx, s, e)
+	}
+}
+
+func (b *Bus) enqueue(ctx context.Context, s *subscriber, e any) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		b.logger.Sugar().Warnf("事件总线已关闭, 订阅者%s丢弃事件: %T", s.name, e)
+		return
+	}
+
+	// 请求结束后异步订阅者仍然需要处理事件
+	select {
+	case s.queue <- job{ctx: context.WithoutCancel(ctx), e: e}:
+	default:
+		b.logger.Sugar().Warnf("订阅者%s的队列已满, 丢弃事件: %T", s.name, e)
+	}
+}
+
+// Close 停止接收事件, 等待异步订阅者处理完队列中的事件
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	for _, subs := range b.subs {
+		for _, s := range subs {
+			if s.queue != nil {
+				close(s.queue)
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+func (b *Bus) consume(s *subscriber) {
+	defer b.wg.Done()
+	for j := range s.queue {
+		b.dispatch(j.ctx, s, j.e)
+	}
+}
+
+func (b *Bus) dispatch(ctx context.Context, s *subscriber, e any) {
+	var err error
+	for i := 0; i <= s.retries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(time.Duration(i) * s.backoff):
+			case <-ctx.Done():
+				b.logger.Sugar().Warnf("订阅者%s处理事件%T被取消, 失败原因: %v", s.name, e, err)
+				return
+			}
+		}
+		if err = b.call(ctx, s, e); err == nil {
+			return
+		}
+	}
+	b.logger.Sugar().Warnf("订阅者%s处理事件%T失败, 重试次数: %d, 失败原因: %v", s.name, e, s.retries, err)
+}
+
+func (b *Bus) call(ctx context.Context, s *subscriber, e any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.handle(ctx, e)
+}
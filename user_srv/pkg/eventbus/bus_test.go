@@ -0,0 +1,167 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+type created struct{ Id int }
+
+type deleted struct{ Id int }
+
+func newTestBus(t *testing.T) *Bus {
+	t.Helper()
+	b := New(logger.NewLogger(logger.WithWriteFile(false)))
+	t.Cleanup(b.Close)
+	return b
+}
+
+func TestPublishByType(t *testing.T) {
+	b := newTestBus(t)
+	var got []any
+	Subscribe(b, "created", func(ctx context.Context, e created) error {
+		got = append(got, e)
+		return nil
+	})
+	Subscribe(b, "deleted", func(ctx context.Context, e deleted) error {
+		got = append(got, e)
+		return nil
+	})
+
+	b.Publish(context.Background(), created{Id: 1})
+	b.Publish(context.Background(), deleted{Id: 2})
+	b.Publish(context.Background(), &created{Id: 3})
+	if !slices.Equal(got, []any{created{Id: 1}, deleted{Id: 2}}) {
+		t.Fatalf("收到的事件为%v", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	b := newTestBus(t)
+	var flaky, broken int
+	Subscribe(b, "flaky", func(ctx context.Context, e created) error {
+		if flaky++; flaky < 3 {
+			return errors.New("暂时失败")
+		}
+		return nil
+	}, Retry(5, time.Millisecond))
+	Subscribe(b, "broken", func(ctx context.Context, e created) error {
+		broken++
+		return errors.New("一直失败")
+	}, Retry(2, time.Millisecond))
+
+	b.Publish(context.Background(), created{Id: 1})
+	if flaky != 3 {
+		t.Fatalf("成功后应停止重试, 调用次数: %d", flaky)
+	}
+	if broken != 3 {
+		t.Fatalf("应重试2次, 调用次数: %d", broken)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	b := newTestBus(t)
+	var calls int
+	Subscribe(b, "broken", func(ctx context.Context, e created) error {
+		calls++
+		return errors.New("一直失败")
+	}, Retry(3, time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	b.Publish(ctx, created{Id: 1})
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Fatalf("发布方取消后应停止重试, 调用次数: %d, 耗时: %s", calls, time.Since(start))
+	}
+}
+
+// 一个订阅者失败或panic不影响其他订阅者和发布方
+func TestIsolation(t *testing.T) {
+	b := newTestBus(t)
+	var panics, delivered int
+	Subscribe(b, "panic", func(ctx context.Context, e created) error {
+		panics++
+		panic("订阅者panic")
+	}, Retry(1, time.Millisecond))
+	Subscribe(b, "error", func(ctx context.Context, e created) error {
+		return errors.New("失败")
+	})
+	Subscribe(b, "ok", func(ctx context.Context, e created) error {
+		delivered++
+		return nil
+	})
+
+	b.Publish(context.Background(), created{Id: 1})
+	if panics != 2 {
+		t.Fatalf("panic也应按失败重试, 调用次数: %d", panics)
+	}
+	if delivered != 1 {
+		t.Fatalf("其他订阅者没有收到事件, 调用次数: %d", delivered)
+	}
+}
+
+func TestAsyncDropWhenFull(t *testing.T) {
+	b := newTestBus(t)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var got []int
+	Subscribe(b, "slow", func(ctx context.Context, e created) error {
+		started <- struct{}{}
+		<-release
+		mu.Lock()
+		got = append(got, e.Id)
+		mu.Unlock()
+		return nil
+	}, Async(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Publish(ctx, created{Id: 1})
+	<-started
+	// 第一个事件处理中, 第二个占满队列, 第三个被丢弃
+	b.Publish(ctx, created{Id: 2})
+	b.Publish(ctx, created{Id: 3})
+	// 请求结束后队列中的事件仍然处理
+	cancel()
+	close(release)
+	b.Close()
+
+	if !slices.Equal(got, []int{1, 2}) {
+		t.Fatalf("处理的事件为%v, 期望[1 2]", got)
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	b := New(logger.NewLogger(logger.WithWriteFile(false)))
+	var mu sync.Mutex
+	var got []int
+	Subscribe(b, "async", func(ctx context.Context, e created) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		got = append(got, e.Id)
+		mu.Unlock()
+		return nil
+	}, Async(16))
+
+	for i := 1; i <= 10; i++ {
+		b.Publish(context.Background(), created{Id: i})
+	}
+	b.Close()
+	if len(got) != 10 || !slices.IsSorted(got) {
+		t.Fatalf("关闭前没有按顺序处理完队列: %v", got)
+	}
+
+	// 关闭后发布的事件被丢弃, 重复关闭不会panic
+	b.Publish(context.Background(), created{Id: 11})
+	b.Close()
+	if len(got) != 10 {
+		t.Fatalf("关闭后仍然处理了事件: %v", got)
+	}
+}
@@ -0,0 +1,179 @@
+package gormx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	prome "github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	PolicyRandom      = "random"
+	PolicyRoundRobin  = "round_robin"
+	PolicyLeastLoaded = "least_loaded"
+)
+
+// NewPolicy 从库的选择策略, 默认随机
+func NewPolicy(name string) dbresolver.Policy {
+	switch name {
+	case PolicyRoundRobin:
+		return dbresolver.StrictRoundRobinPolicy()
+	case PolicyLeastLoaded:
+		return LeastLoadedPolicy{}
+	default:
+		return dbresolver.RandomPolicy{}
+	}
+}
+
+// LeastLoadedPolicy 选择正在使用的连接数最少的从库
+type LeastLoadedPolicy struct{}
+
+func (LeastLoadedPolicy) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	best, bestInUse := pools[0], -1
+	for _, pool := range pools {
+		sqlDB, ok := pool.(*sql.DB)
+		if !ok {
+			continue
+		}
+		if inUse := sqlDB.Stats().InUse; bestInUse < 0 || inUse < bestInUse {
+			best, bestInUse = pool, inUse
+		}
+	}
+	return best
+}
+
+type stickyKey struct{}
+
+// WithSticky 标记本次操作涉及的用户, 写入后一段时间内这些用户的读请求走主库
+func WithSticky(ctx context.Context, keys ...string) context.Context {
+	return context.WithValue(ctx, stickyKey{}, keys)
+}
+
+// Sticky 写入后在复制延迟窗口内把同一用户的读请求固定到主库,
+// 写入记录保存在redis中, 对所有副本生效
+type Sticky struct {
+	client redis.Cmdable
+	window time.Duration
+}
+
+func NewSticky(client redis.Cmdable, window time.Duration) *Sticky {
+	return &Sticky{
+		client: client,
+		window: window,
+	}
+}
+
+func (s *Sticky) Name() string {
+	return "gorm:sticky"
+}
+
+func (s *Sticky) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("sticky:mark_create", s.mark); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("sticky:mark_update", s.mark); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("sticky:mark_delete", s.mark); err != nil {
+		return err
+	}
+	// 需要在dbresolver选择连接之前执行
+	if err := cb.Query().Before("gorm:db_resolver").Register("sticky:pin_query", s.pin); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:db_resolver").Register("sticky:pin_row", s.pin); err != nil {
+		return err
+	}
+	return cb.Raw().Before("gorm:db_resolver").Register("sticky:pin_raw", s.pin)
+}
+
+func (s *Sticky) key(k string) string {
+	return fmt.Sprintf("db:sticky:%s", k)
+}
+
+func (s *Sticky) mark(db *gorm.DB) {
+	keys, _ := db.Statement.Context.Value(stickyKey{}).([]string)
+	if db.Error != nil || len(keys) == 0 {
+		return
+	}
+
+	pipe := s.client.Pipeline()
+	for _, k := range keys {
+		pipe.Set(db.Statement.Context, s.key(k), 1, s.window)
+	}
+	if _, err := pipe.Exec(db.Statement.Context); err != nil {
+		db.Logger.Warn(db.Statement.Context, "记录主库读取窗口失败: %v", err)
+	}
+}
+
+func (s *Sticky) pin(db *gorm.DB) {
+	keys, _ := db.Statement.Context.Value(stickyKey{}).([]string)
+	if len(keys) == 0 {
+		return
+	}
+
+	redisKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		redisKeys = append(redisKeys, s.key(k))
+	}
+	n, err := s.client.Exists(db.Statement.Context, redisKeys...).Result()
+	// redis不可用时保守地读主库
+	if err != nil || n > 0 {
+		dbresolver.Write.ModifyStatement(db.Statement)
+	}
+}
+
+// PoolCollector 上报主库和从库连接池的状态
+type PoolCollector struct {
+	pools map[string]*sql.DB
+
+	maxOpen      *prome.Desc
+	open         *prome.Desc
+	inUse        *prome.Desc
+	idle         *prome.Desc
+	waitCount    *prome.Desc
+	waitDuration *prome.Desc
+}
+
+func NewPoolCollector(dbName string, pools map[string]*sql.DB) *PoolCollector {
+	desc := func(name, help string) *prome.Desc {
+		return prome.NewDesc(prome.BuildFQName("tk_users", "db_pool", name), help,
+			[]string{"pool"}, prome.Labels{"db": dbName})
+	}
+	return &PoolCollector{
+		pools:        pools,
+		maxOpen:      desc("max_open_connections", "连接池最大连接数"),
+		open:         desc("open_connections", "当前打开的连接数"),
+		inUse:        desc("in_use", "正在使用的连接数"),
+		idle:         desc("idle", "空闲连接数"),
+		waitCount:    desc("wait_count", "等待连接的总次数"),
+		waitDuration: desc("wait_duration_seconds", "等待连接的总时长"),
+	}
+}
+
+func (p *PoolCollector) Describe(ch chan<- *prome.Desc) {
+	ch <- p.maxOpen
+	ch <- p.open
+	ch <- p.inUse
+	ch <- p.idle
+	ch <- p.waitCount
+	ch <- p.waitDuration
+}
+
+func (p *PoolCollector) Collect(ch chan<- prome.Metric) {
+	for name, pool := range p.pools {
+		stats := pool.Stats()
+		ch <- prome.MustNewConstMetric(p.maxOpen, prome.GaugeValue, float64(stats.MaxOpenConnections), name)
+		ch <- prome.MustNewConstMetric(p.open, prome.GaugeValue, float64(stats.OpenConnections), name)
+		ch <- prome.MustNewConstMetric(p.inUse, prome.GaugeValue, float64(stats.InUse), name)
+		ch <- prome.MustNewConstMetric(p.idle, prome.GaugeValue, float64(stats.Idle), name)
+		ch <- prome.MustNewConstMetric(p.waitCount, prome.CounterValue, float64(stats.WaitCount), name)
+		ch <- prome.MustNewConstMetric(p.waitDuration, prome.CounterValue, stats.WaitDuration.Seconds(), name)
+	}
+}
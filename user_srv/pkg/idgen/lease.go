@@ -0,0 +1,111 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+var ErrNoWorker = errors.New("没有空闲的worker id")
+
+// 只续期和释放自己持有的租约
+var (
+	renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Lease 在redis中占用的worker id, 每隔ttl/3续期一次.
+// 续期失败超过ttl后认为租约已经失效, 其他实例可能已经拿到了同一个worker id
+type Lease struct {
+	Id int64
+
+	client redis.Cmdable
+	key    string
+	token  string
+	ttl    time.Duration
+	// renewed 最近一次续期成功的时间, 单位纳秒
+	renewed atomic.Int64
+	stop    chan struct{}
+	logger  *logger.Logger
+}
+
+// AcquireWorker 按顺序尝试占用prefix:0到prefix:MaxWorker中的一个
+func AcquireWorker(ctx context.Context, client redis.Cmdable, prefix string, ttl time.Duration,
+	logger *logger.Logger) (*Lease, error) {
+	token := uuid.NewString()
+	for id := int64(0); id <= MaxWorker; id++ {
+		key := fmt.Sprintf("%s:%d", prefix, id)
+		ok, err := client.SetNX(ctx, key, token, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		l := &Lease{
+			Id:     id,
+			client: client,
+			key:    key,
+			token:  token,
+			ttl:    ttl,
+			stop:   make(chan struct{}),
+			logger: logger,
+		}
+		l.renewed.Store(time.Now().UnixNano())
+		go l.keepAlive()
+		return l, nil
+	}
+	return nil, ErrNoWorker
+}
+
+func (l *Lease) keepAlive() {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := renewScript.Run(context.Background(), l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+		if err == nil && ok == 1 {
+			l.renewed.Store(time.Now().UnixNano())
+			continue
+		}
+		if err == nil {
+			// 租约已经被其他实例占用, 不能再使用这个worker id
+			l.renewed.Store(0)
+			l.logger.Sugar().Errorf("worker id的租约已被占用, worker: %d", l.Id)
+			return
+		}
+		l.logger.Sugar().Warnf("worker id续期失败, worker: %d, 失败原因: %v", l.Id, err)
+	}
+}
+
+// Lost 租约是否已经失效
+func (l *Lease) Lost() bool {
+	return time.Since(time.Unix(0, l.renewed.Load())) >= l.ttl
+}
+
+// Release 停止续期并释放worker id
+func (l *Lease) Release(ctx context.Context) error {
+	close(l.stop)
+	return releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+}
@@ -0,0 +1,45 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+// redis不可用时续期一直失败, 超过ttl后租约失效, 不再生成id
+func TestLeaseLostAfterFailedRenewal(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+
+	const ttl = 90 * time.Millisecond
+	l := &Lease{
+		Id:     3,
+		client: client,
+		key:    "test:worker:3",
+		token:  "token",
+		ttl:    ttl,
+		stop:   make(chan struct{}),
+		logger: logger.NewLogger(logger.WithWriteFile(false)),
+	}
+	l.renewed.Store(time.Now().UnixNano())
+	go l.keepAlive()
+	defer l.Release(context.Background())
+
+	s := NewLeasedSnowflake(l)
+	if _, err := s.Next(); err != nil {
+		t.Fatalf("租约有效时应能生成id: %v", err)
+	}
+
+	time.Sleep(ttl + ttl/3)
+	if !l.Lost() {
+		t.Fatal("续期失败超过ttl后租约应失效")
+	}
+	if _, err := s.Next(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("租约失效后应返回ErrLeaseLost, 实际: %v", err)
+	}
+}
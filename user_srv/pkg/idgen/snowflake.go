@@ -0,0 +1,100 @@
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// id布局: 1位符号 | 41位毫秒时间戳 | 10位worker | 12位序号.
+// 时间戳从Epoch开始计算, 生成的id都大于32位整数的范围, 不会和之前自增分配的id冲突
+const (
+	workerBits   = 10
+	sequenceBits = 12
+
+	MaxWorker   = 1<<workerBits - 1
+	maxSequence = 1<<sequenceBits - 1
+
+	// seqJitter 每毫秒的起始序号在[0, seqJitter)中随机, 使低位分布均匀,
+	// 按 id % 分表数 路由时不会集中到同一张分表
+	seqJitter = 1 << 10
+
+	// maxBackward 时钟回拨在这个范围内时等待追上, 超过时返回错误
+	maxBackward = 10 * time.Millisecond
+)
+
+// Epoch 2024-01-01 00:00:00 UTC
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	ErrClockBackwards = errors.New("系统时钟回拨")
+	ErrLeaseLost      = errors.New("worker id的租约已失效")
+)
+
+type Generator interface {
+	Next() (int64, error)
+}
+
+var _ Generator = &Snowflake{}
+
+type Snowflake struct {
+	mu     sync.Mutex
+	worker int64
+	last   int64
+	seq    int64
+	// lease 不为空时worker id来自租约, 租约失效后不再生成id
+	lease *Lease
+}
+
+func NewSnowflake(worker int64) (*Snowflake, error) {
+	if worker < 0 || worker > MaxWorker {
+		return nil, fmt.Errorf("worker id超出范围[0, %d]: %d", MaxWorker, worker)
+	}
+	return &Snowflake{worker: worker}, nil
+}
+
+// NewLeasedSnowflake 使用租约中的worker id
+func NewLeasedSnowflake(lease *Lease) *Snowflake {
+	return &Snowflake{worker: lease.Id, lease: lease}
+}
+
+func (s *Snowflake) Next() (int64, error) {
+	if s.lease != nil && s.lease.Lost() {
+		return 0, ErrLeaseLost
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Since(Epoch).Milliseconds()
+	if now < s.last {
+		if time.Duration(s.last-now)*time.Millisecond > maxBackward {
+			return 0, ErrClockBackwards
+		}
+		now = s.wait(s.last)
+	}
+
+	if now == s.last {
+		s.seq++
+		if s.seq > maxSequence {
+			now = s.wait(s.last + 1)
+			s.seq = rand.Int64N(seqJitter)
+		}
+	} else {
+		s.seq = rand.Int64N(seqJitter)
+	}
+	s.last = now
+	return now<<(workerBits+sequenceBits) | s.worker<<sequenceBits | s.seq, nil
+}
+
+// wait 等待到ms毫秒
+func (s *Snowflake) wait(ms int64) int64 {
+	now := time.Since(Epoch).Milliseconds()
+	for now < ms {
+		time.Sleep(time.Duration(ms-now) * time.Millisecond)
+		now = time.Since(Epoch).Milliseconds()
+	}
+	return now
+}
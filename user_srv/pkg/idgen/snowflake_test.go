@@ -0,0 +1,124 @@
+package idgen
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSnowflake(t *testing.T) *Snowflake {
+	t.Helper()
+	s, err := NewSnowflake(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func timestamp(id int64) int64 {
+	return id >> (workerBits + sequenceBits)
+}
+
+func TestSnowflakeMonotonic(t *testing.T) {
+	s := newTestSnowflake(t)
+	var last int64
+	for i := 0; i < 20000; i++ {
+		id, err := s.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= last {
+			t.Fatalf("id没有递增: %d <= %d", id, last)
+		}
+		if worker := id >> sequenceBits & MaxWorker; worker != 7 {
+			t.Fatalf("worker为%d", worker)
+		}
+		last = id
+	}
+	if last <= 1<<31 {
+		t.Fatalf("id在32位整数范围内: %d", last)
+	}
+}
+
+func TestNewSnowflakeWorker(t *testing.T) {
+	for _, worker := range []int64{-1, MaxWorker + 1} {
+		if _, err := NewSnowflake(worker); err == nil {
+			t.Fatalf("worker %d应超出范围", worker)
+		}
+	}
+}
+
+// 同一毫秒内序号用完后等到下一毫秒
+func TestSnowflakeSequenceOverflow(t *testing.T) {
+	s := newTestSnowflake(t)
+	last := time.Since(Epoch).Milliseconds() + 5
+	s.last, s.seq = last, maxSequence
+
+	id, err := s.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestamp(id) <= last {
+		t.Fatalf("序号用完后时间戳为%d, 应大于%d", timestamp(id), last)
+	}
+	if seq := id & maxSequence; seq >= seqJitter {
+		t.Fatalf("新的一毫秒的起始序号为%d", seq)
+	}
+}
+
+func TestSnowflakeClockBackwards(t *testing.T) {
+	s := newTestSnowflake(t)
+	now := time.Since(Epoch).Milliseconds()
+
+	// 小幅回拨时等待时钟追上
+	s.last = now + 5
+	id, err := s.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestamp(id) < now+5 {
+		t.Fatalf("回拨后生成了更早的时间戳: %d", timestamp(id))
+	}
+
+	s.last = time.Since(Epoch).Milliseconds() + maxBackward.Milliseconds() + 1000
+	if _, err = s.Next(); !errors.Is(err, ErrClockBackwards) {
+		t.Fatalf("回拨超过%s时应返回ErrClockBackwards, 实际: %v", maxBackward, err)
+	}
+}
+
+func TestSnowflakeConcurrent(t *testing.T) {
+	s := newTestSnowflake(t)
+	const workers, n = 8, 5000
+
+	var wg sync.WaitGroup
+	ids := make([][]int64, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				id, err := s.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ids[i] = append(ids[i], id)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int64]struct{}, workers*n)
+	for _, part := range ids {
+		for _, id := range part {
+			if _, ok := seen[id]; ok {
+				t.Fatalf("生成了重复的id: %d", id)
+			}
+			seen[id] = struct{}{}
+		}
+	}
+	if len(seen) != workers*n {
+		t.Fatalf("生成了%d个id, 期望%d", len(seen), workers*n)
+	}
+}
@@ -0,0 +1,169 @@
+package interceptor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+// 可按方法开启的拦截器, 执行顺序与下面的声明顺序一致
+const (
+	NameRecovery    = "recovery"
+	NameLogging     = "logging"
+	NameDeadline    = "deadline"
+	NameConcurrency = "concurrency"
+	NameValidate    = "validate"
+)
+
+var ordered = []string{NameRecovery, NameLogging, NameDeadline, NameConcurrency, NameValidate}
+
+// nameTenant 租户解析不受enabled配置影响, 开启租户时在recovery和logging之后、其余拦截器之前执行,
+// 解析时的panic会被recovery捕获, 被拒绝的请求也会记录日志
+const nameTenant = "tenant"
+
+// Validator 校验请求参数, 返回的错误会转换为codes.InvalidArgument
+type Validator func(req any) error
+
+// options 单个方法合并默认配置后生效的拦截器配置
+type options struct {
+	// chain 按执行顺序排列的拦截器
+	chain          []string
+	timeout        time.Duration
+	maxConcurrency int
+}
+
+// Builder 根据配置为每个方法组装拦截器链
+type Builder struct {
+	cfg        config.InterceptorConfig
+	logger     *logger.Logger
+	validators map[string]Validator
+	// tenants 为nil时不解析租户, 所有请求属于默认租户
+	tenants map[string]struct{}
+
+	mu      sync.Mutex
+	options map[string]*options
+	limits  map[string]chan struct{}
+}
+
+func NewBuilder(cfg config.InterceptorConfig, logger *logger.Logger) *Builder {
+	return &Builder{
+		cfg:        cfg,
+		logger:     logger,
+		validators: make(map[string]Validator),
+		options:    make(map[string]*options),
+		limits:     make(map[string]chan struct{}),
+	}
+}
+
+// Validators 注册请求校验函数, key为方法全名, 例如/user.UserService/Register
+func (b *Builder) Validators(validators map[string]Validator) *Builder {
+	for method, v := range validators {
+		b.validators[method] = v
+	}
+	return b
+}
+
+func (b *Builder) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		opts := b.optionsOf(info.FullMethod)
+		next := handler
+		for i := len(opts.chain) - 1; i >= 0; i-- {
+			next = b.unary(opts.chain[i], info.FullMethod, opts, next)
+		}
+		return next(ctx, req)
+	}
+}
+
+func (b *Builder) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		opts := b.optionsOf(info.FullMethod)
+		next := handler
+		for i := len(opts.chain) - 1; i >= 0; i-- {
+			next = b.stream(opts.chain[i], info.FullMethod, opts, next)
+		}
+		return next(srv, ss)
+	}
+}
+
+func (b *Builder) unary(name, method string, opts *options, next grpc.UnaryHandler) grpc.UnaryHandler {
+	switch name {
+	case NameRecovery:
+		return b.unaryRecovery(method, next)
+	case NameLogging:
+		return b.unaryLogging(method, next)
+	case NameDeadline:
+		return unaryDeadline(opts.timeout, next)
+	case NameConcurrency:
+		return b.unaryConcurrency(method, opts.maxConcurrency, next)
+	case NameValidate:
+		return b.unaryValidate(method, next)
+	case nameTenant:
+		return b.unaryTenant(next)
+	}
+	return next
+}
+
+func (b *Builder) stream(name, method string, opts *options, next grpc.StreamHandler) grpc.StreamHandler {
+	switch name {
+	case NameRecovery:
+		return b.streamRecovery(method, next)
+	case NameLogging:
+		return b.streamLogging(method, next)
+	case NameDeadline:
+		return streamDeadline(opts.timeout, next)
+	case NameConcurrency:
+		return b.streamConcurrency(method, opts.maxConcurrency, next)
+	case NameValidate:
+		return b.streamValidate(method, next)
+	case nameTenant:
+		return b.streamTenant(next)
+	}
+	return next
+}
+
+// optionsOf 方法单独的配置覆盖默认配置中对应的非零项
+func (b *Builder) optionsOf(method string) *options {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if opts, ok := b.options[method]; ok {
+		return opts
+	}
+
+	cfg := b.cfg.Default
+	if m, ok := b.cfg.Methods[method]; ok {
+		if m.Enabled != nil {
+			cfg.Enabled = m.Enabled
+		}
+		if m.Timeout > 0 {
+			cfg.Timeout = m.Timeout
+		}
+		if m.MaxConcurrency > 0 {
+			cfg.MaxConcurrency = m.MaxConcurrency
+		}
+	}
+
+	enabled := make(map[string]bool, len(cfg.Enabled))
+	for _, name := range cfg.Enabled {
+		enabled[name] = true
+	}
+
+	opts := &options{
+		timeout:        time.Duration(cfg.Timeout) * time.Millisecond,
+		maxConcurrency: cfg.MaxConcurrency,
+	}
+	for _, name := range ordered {
+		if enabled[name] {
+			opts.chain = append(opts.chain, name)
+		}
+		if name == NameLogging && b.tenants != nil {
+			opts.chain = append(opts.chain, nameTenant)
+		}
+	}
+	b.options[method] = opts
+	return opts
+}
@@ -0,0 +1,70 @@
+package interceptor
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+const testMethod = "/user.UserService/Register"
+
+func newTestBuilder(cfg config.InterceptorConfig) *Builder {
+	return NewBuilder(cfg, logger.NewLogger(logger.WithWriteFile(false)))
+}
+
+// callUnary 经过拦截器链调用handler
+func callUnary(b *Builder, ctx context.Context, req any, handler grpc.UnaryHandler) (any, error) {
+	return b.Unary()(ctx, req, &grpc.UnaryServerInfo{FullMethod: testMethod}, handler)
+}
+
+func TestOptionsOf(t *testing.T) {
+	cfg := config.InterceptorConfig{
+		Default: config.MethodInterceptorConfig{
+			Enabled: []string{NameValidate, NameRecovery, NameLogging, "unknown"},
+			Timeout: 3000,
+		},
+		Methods: map[string]config.MethodInterceptorConfig{
+			testMethod: {MaxConcurrency: 8},
+			"/user.UserService/Login": {
+				Enabled: []string{NameConcurrency, NameRecovery},
+				Timeout: 500,
+			},
+		},
+	}
+	b := newTestBuilder(cfg)
+
+	cases := []struct {
+		method      string
+		chain       []string
+		timeout     time.Duration
+		concurrency int
+	}{
+		// 按固定顺序执行, 与配置中的顺序无关, 未知的名称被忽略
+		{testMethod, []string{NameRecovery, NameLogging, NameValidate}, 3 * time.Second, 8},
+		{"/user.UserService/Login", []string{NameRecovery, NameConcurrency}, 500 * time.Millisecond, 0},
+		{"/user.UserService/GetUserById", []string{NameRecovery, NameLogging, NameValidate}, 3 * time.Second, 0},
+	}
+	for _, c := range cases {
+		opts := b.optionsOf(c.method)
+		if !slices.Equal(opts.chain, c.chain) || opts.timeout != c.timeout || opts.maxConcurrency != c.concurrency {
+			t.Errorf("%s: 拦截器为%v, 超时%v, 并发%d", c.method, opts.chain, opts.timeout, opts.maxConcurrency)
+		}
+	}
+
+	// 开启租户后租户解析在recovery和logging之后, 已缓存的配置重新组装
+	b.Tenants("acme")
+	want := []string{NameRecovery, NameLogging, nameTenant, NameValidate}
+	if chain := b.optionsOf(testMethod).chain; !slices.Equal(chain, want) {
+		t.Errorf("开启租户后拦截器为%v, 期望%v", chain, want)
+	}
+	want = []string{NameRecovery, nameTenant, NameConcurrency}
+	if chain := b.optionsOf("/user.UserService/Login").chain; !slices.Equal(chain, want) {
+		t.Errorf("开启租户后拦截器为%v, 期望%v", chain, want)
+	}
+}
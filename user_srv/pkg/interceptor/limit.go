@@ -0,0 +1,90 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// unaryDeadline 调用方未设置截止时间或超过配置的上限时, 使用配置的超时时间
+func unaryDeadline(timeout time.Duration, next grpc.UnaryHandler) grpc.UnaryHandler {
+	return func(ctx context.Context, req any) (any, error) {
+		ctx, cancel, err := withDeadline(ctx, timeout)
+		if err != nil {
+			return nil, err
+		}
+		defer cancel()
+		return next(ctx, req)
+	}
+}
+
+func streamDeadline(timeout time.Duration, next grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv any, ss grpc.ServerStream) error {
+		ctx, cancel, err := withDeadline(ss.Context(), timeout)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		return next(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func withDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= 0 {
+		return nil, nil, status.Error(codes.DeadlineExceeded, "请求已超时")
+	}
+	if timeout <= 0 {
+		return ctx, func() {}, nil
+	}
+
+	// 调用方的截止时间更早时保持不变
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+func (b *Builder) unaryConcurrency(method string, limit int, next grpc.UnaryHandler) grpc.UnaryHandler {
+	return func(ctx context.Context, req any) (any, error) {
+		release, err := b.acquire(method, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return next(ctx, req)
+	}
+}
+
+func (b *Builder) streamConcurrency(method string, limit int, next grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv any, ss grpc.ServerStream) error {
+		release, err := b.acquire(method, limit)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return next(srv, ss)
+	}
+}
+
+// acquire 占用方法的并发名额, 名额用完时直接拒绝而不是排队等待
+func (b *Builder) acquire(method string, limit int) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	b.mu.Lock()
+	sem, ok := b.limits[method]
+	if !ok {
+		sem = make(chan struct{}, limit)
+		b.limits[method] = sem
+	}
+	b.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	default:
+		return nil, status.Error(codes.ResourceExhausted, "服务繁忙, 请稍后再试")
+	}
+}
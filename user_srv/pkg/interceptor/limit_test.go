@@ -0,0 +1,118 @@
+package interceptor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+func TestUnaryDeadline(t *testing.T) {
+	b := newTestBuilder(config.InterceptorConfig{
+		Default: config.MethodInterceptorConfig{Enabled: []string{NameDeadline}, Timeout: 1000},
+	})
+	remaining := func(ctx context.Context) time.Duration {
+		res, err := callUnary(b, ctx, nil, func(ctx context.Context, req any) (any, error) {
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				return time.Duration(-1), nil
+			}
+			return time.Until(deadline), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.(time.Duration)
+	}
+
+	// 调用方没有截止时间或截止时间更晚时使用配置的超时
+	if d := remaining(context.Background()); d <= 0 || d > time.Second {
+		t.Fatalf("没有截止时间时剩余%v", d)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if d := remaining(ctx); d <= 0 || d > time.Second {
+		t.Fatalf("调用方截止时间更晚时剩余%v", d)
+	}
+
+	// 调用方的截止时间更早时保持不变
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if d := remaining(ctx); d <= 0 || d > 100*time.Millisecond {
+		t.Fatalf("调用方截止时间更早时剩余%v", d)
+	}
+
+	// 已超时的请求不再进入handler
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err := callUnary(b, ctx, nil, func(ctx context.Context, req any) (any, error) {
+		t.Fatal("已超时的请求进入了handler")
+		return nil, nil
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("已超时的请求应返回DeadlineExceeded, 实际: %v", err)
+	}
+
+	// 没有配置超时时不设置截止时间
+	b = newTestBuilder(config.InterceptorConfig{
+		Default: config.MethodInterceptorConfig{Enabled: []string{NameDeadline}},
+	})
+	if d := remaining(context.Background()); d != -1 {
+		t.Fatalf("没有配置超时时不应设置截止时间, 剩余%v", d)
+	}
+}
+
+func TestUnaryConcurrency(t *testing.T) {
+	const limit = 2
+	b := newTestBuilder(config.InterceptorConfig{
+		Default: config.MethodInterceptorConfig{Enabled: []string{NameConcurrency}, MaxConcurrency: limit},
+	})
+	unary := b.Unary()
+	call := func(method string, handler grpc.UnaryHandler) error {
+		_, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	block := func(ctx context.Context, req any) (any, error) {
+		started <- struct{}{}
+		<-release
+		return nil, nil
+	}
+	noop := func(ctx context.Context, req any) (any, error) {
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := call(testMethod, block); err != nil {
+				t.Error(err)
+			}
+		}()
+		<-started
+	}
+
+	// 名额用完时直接拒绝, 其他方法的名额不受影响
+	if err := call(testMethod, noop); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("超过并发上限应返回ResourceExhausted, 实际: %v", err)
+	}
+	if err := call("/user.UserService/Login", noop); err != nil {
+		t.Fatalf("其他方法不应受影响: %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	if err := call(testMethod, noop); err != nil {
+		t.Fatalf("请求结束后应释放名额: %v", err)
+	}
+}
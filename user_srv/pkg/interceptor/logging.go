@@ -0,0 +1,89 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func (b *Builder) unaryLogging(method string, next grpc.UnaryHandler) grpc.UnaryHandler {
+	return func(ctx context.Context, req any) (any, error) {
+		ctx, log := b.logger.AddCtx(ctx, requestFields(ctx, method)...)
+		start := time.Now()
+		resp, err := next(ctx, req)
+		logResult(log, start, err)
+		return resp, err
+	}
+}
+
+func (b *Builder) streamLogging(method string, next grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv any, ss grpc.ServerStream) error {
+		ctx, log := b.logger.AddCtx(ss.Context(), requestFields(ss.Context(), method)...)
+		start := time.Now()
+		err := next(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+		logResult(log, start, err)
+		return err
+	}
+}
+
+// requestFields 请求日志携带调用方标识以及链路id, 通过ctx传递给后续的日志
+func requestFields(ctx context.Context, method string) []zap.Field {
+	md, _ := metadata.FromIncomingContext(ctx)
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.String("client_id", first(md, "client-id", "client_id")),
+	}
+
+	// otel的stats handler已经从metadata中解析出链路信息
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", sc.TraceID().String()),
+			zap.String("span_id", sc.SpanID().String()),
+		)
+	} else if tp := first(md, "traceparent"); tp != "" {
+		fields = append(fields, zap.String("traceparent", tp))
+	}
+	return fields
+}
+
+func logResult(log *zap.Logger, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []zap.Field{
+		zap.String("code", code.String()),
+		zap.Duration("cost", time.Since(start)),
+	}
+
+	switch code {
+	case codes.OK:
+		log.Info("grpc请求完成", fields...)
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		log.Error("grpc请求失败", append(fields, zap.Error(err))...)
+	default:
+		log.Warn("grpc请求失败", append(fields, zap.Error(err))...)
+	}
+}
+
+func first(md metadata.MD, keys ...string) string {
+	for _, key := range keys {
+		if vals := md.Get(key); len(vals) > 0 {
+			return vals[0]
+		}
+	}
+	return ""
+}
+
+// wrappedStream 替换流的ctx
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
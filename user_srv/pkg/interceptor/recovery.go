@@ -0,0 +1,43 @@
+package interceptor
+
+import (
+	"context"
+	"runtime/debug"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (b *Builder) unaryRecovery(method string, next grpc.UnaryHandler) grpc.UnaryHandler {
+	return func(ctx context.Context, req any) (resp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = b.recovered(ctx, method, r)
+			}
+		}()
+		return next(ctx, req)
+	}
+}
+
+func (b *Builder) streamRecovery(method string, next grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv any, ss grpc.ServerStream) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = b.recovered(ss.Context(), method, r)
+			}
+		}()
+		return next(srv, ss)
+	}
+}
+
+// recovered 记录panic及调用栈, 调用方只会收到codes.Internal
+func (b *Builder) recovered(ctx context.Context, method string, r any) error {
+	b.logger.GetLoggerFromCtx(ctx).Error("处理请求时发生panic",
+		zap.String("method", method),
+		zap.Any("panic", r),
+		zap.ByteString("stack", debug.Stack()),
+	)
+	return status.Error(codes.Internal, "服务内部错误")
+}
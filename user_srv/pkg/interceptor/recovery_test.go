@@ -0,0 +1,55 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+func TestUnaryRecovery(t *testing.T) {
+	b := newTestBuilder(config.InterceptorConfig{
+		Default: config.MethodInterceptorConfig{Enabled: []string{NameRecovery, NameLogging}},
+	})
+
+	_, err := callUnary(b, context.Background(), nil, func(ctx context.Context, req any) (any, error) {
+		panic("boom")
+	})
+	if s, _ := status.FromError(err); s.Code() != codes.Internal || s.Message() != "服务内部错误" {
+		t.Fatalf("panic应转换为Internal且不暴露细节, 实际: %v", err)
+	}
+
+	// 正常返回和普通错误不受影响
+	res, err := callUnary(b, context.Background(), nil, func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	})
+	if err != nil || res != "ok" {
+		t.Fatalf("正常请求的结果为%v, %v", res, err)
+	}
+	_, err = callUnary(b, context.Background(), nil, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "用户不存在")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("handler的错误应原样返回, 实际: %v", err)
+	}
+}
+
+func TestUnaryRecoveryTenant(t *testing.T) {
+	// 租户解析在recovery之内, 已解析的租户传给handler, handler的panic也被捕获
+	b := newTestBuilder(config.InterceptorConfig{
+		Default: config.MethodInterceptorConfig{Enabled: []string{NameRecovery}},
+	}).Tenants("acme")
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, "acme"))
+
+	_, err := callUnary(b, ctx, nil, func(ctx context.Context, req any) (any, error) {
+		panic("tenant: " + tenant.FromContext(ctx))
+	})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("panic应转换为Internal, 实际: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// Tenants 开启租户解析, 所有方法都从metadata中读取租户放入ctx, 不受enabled配置影响.
+// 只接受配置中的租户和默认租户
+func (b *Builder) Tenants(ids ...string) *Builder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tenants = map[string]struct{}{tenant.Default: {}}
+	for _, id := range ids {
+		b.tenants[tenant.Normalize(id)] = struct{}{}
+	}
+	// 已经组装好的拦截器链中没有租户解析, 重新组装
+	clear(b.options)
+	return b
+}
+
+func (b *Builder) unaryTenant(next grpc.UnaryHandler) grpc.UnaryHandler {
+	return func(ctx context.Context, req any) (any, error) {
+		ctx, err := b.tenantContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (b *Builder) streamTenant(next grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv any, ss grpc.ServerStream) error {
+		ctx, err := b.tenantContext(ss.Context())
+		if err != nil {
+			return err
+		}
+		return next(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (b *Builder) tenantContext(ctx context.Context) (context.Context, error) {
+	id := tenant.Default
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(tenant.MetadataKey); len(vals) > 0 {
+			id = tenant.Normalize(vals[0])
+		}
+	}
+	if _, ok := b.tenants[id]; !ok {
+		return ctx, status.Errorf(codes.PermissionDenied, "未知的租户: %s", id)
+	}
+	return tenant.WithTenant(ctx, id), nil
+}
@@ -0,0 +1,54 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+func TestUnaryTenant(t *testing.T) {
+	b := NewBuilder(config.InterceptorConfig{}, logger.NewLogger(logger.WithWriteFile(false))).Tenants("Acme")
+	unary := b.Unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.UserService/GetUserInfo"}
+
+	call := func(ctx context.Context) (string, error) {
+		res, err := unary(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+			return tenant.FromContext(ctx), nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return res.(string), nil
+	}
+	withTenant := func(id string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, id))
+	}
+
+	cases := []struct {
+		ctx  context.Context
+		want string
+	}{
+		{context.Background(), tenant.Default},
+		{withTenant(""), tenant.Default},
+		{withTenant(" ACME "), "acme"},
+	}
+	for _, c := range cases {
+		got, err := call(c.ctx)
+		if err != nil || got != c.want {
+			t.Fatalf("解析的租户为%q, 期望%q, %v", got, c.want, err)
+		}
+	}
+
+	// 未知租户在进入方法之前被拒绝
+	if _, err := call(withTenant("other")); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("未知的租户应返回PermissionDenied, 实际: %v", err)
+	}
+}
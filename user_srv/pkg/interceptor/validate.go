@@ -0,0 +1,61 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validatable 兼容protoc-gen-validate生成的Validate方法
+type validatable interface {
+	Validate() error
+}
+
+func (b *Builder) unaryValidate(method string, next grpc.UnaryHandler) grpc.UnaryHandler {
+	return func(ctx context.Context, req any) (any, error) {
+		if err := b.validate(method, req); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (b *Builder) streamValidate(method string, next grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv any, ss grpc.ServerStream) error {
+		return next(srv, &validatedStream{ServerStream: ss, b: b, method: method})
+	}
+}
+
+func (b *Builder) validate(method string, req any) error {
+	if v, ok := req.(validatable); ok {
+		if err := v.Validate(); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if fn, ok := b.validators[method]; ok {
+		if err := fn(req); err != nil {
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return nil
+}
+
+// validatedStream 校验流中收到的每条消息
+type validatedStream struct {
+	grpc.ServerStream
+	b      *Builder
+	method string
+}
+
+func (v *validatedStream) RecvMsg(m any) error {
+	if err := v.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return v.b.validate(v.method, m)
+}
@@ -0,0 +1,110 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+type testReq struct {
+	email string
+	err   error
+}
+
+// Validate 模拟protoc-gen-validate生成的方法
+func (r *testReq) Validate() error {
+	return r.err
+}
+
+func newValidateBuilder(enabled ...string) *Builder {
+	return newTestBuilder(config.InterceptorConfig{
+		Default: config.MethodInterceptorConfig{Enabled: enabled},
+	}).Validators(map[string]Validator{
+		testMethod: func(req any) error {
+			switch req.(*testReq).email {
+			case "":
+				return errors.New("邮箱不能为空")
+			case "locked@ex.com":
+				return status.Error(codes.FailedPrecondition, "账号已锁定")
+			}
+			return nil
+		},
+	})
+}
+
+func TestUnaryValidate(t *testing.T) {
+	b := newValidateBuilder(NameValidate)
+	ok := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+
+	cases := []struct {
+		req  *testReq
+		code codes.Code
+	}{
+		{&testReq{email: "alice@ex.com"}, codes.OK},
+		{&testReq{}, codes.InvalidArgument},
+		{&testReq{email: "alice@ex.com", err: errors.New("字段无效")}, codes.InvalidArgument},
+		// 校验函数返回的status错误原样返回
+		{&testReq{email: "locked@ex.com"}, codes.FailedPrecondition},
+	}
+	for _, c := range cases {
+		_, err := callUnary(b, context.Background(), c.req, ok)
+		if status.Code(err) != c.code {
+			t.Errorf("请求%+v返回%v, 期望%v", c.req, err, c.code)
+		}
+	}
+
+	// 没有注册校验函数的方法只执行Validate
+	_, err := b.Unary()(context.Background(), &testReq{}, &grpc.UnaryServerInfo{FullMethod: "/user.UserService/Login"}, ok)
+	if err != nil {
+		t.Fatalf("没有校验函数的方法不应被拒绝: %v", err)
+	}
+
+	// 未开启validate时不校验
+	if _, err = callUnary(newValidateBuilder(), context.Background(), &testReq{}, ok); err != nil {
+		t.Fatalf("未开启validate时不应校验: %v", err)
+	}
+}
+
+// testStream 依次返回msgs中的消息
+type testStream struct {
+	grpc.ServerStream
+	msgs []*testReq
+}
+
+func (s *testStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *testStream) RecvMsg(m any) error {
+	if len(s.msgs) == 0 {
+		return errors.New("没有更多消息")
+	}
+	*m.(*testReq) = *s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func TestStreamValidate(t *testing.T) {
+	b := newValidateBuilder(NameValidate)
+	ss := &testStream{msgs: []*testReq{{email: "alice@ex.com"}, {}}}
+
+	// 流中的每条消息都会校验
+	err := b.Stream()(nil, ss, &grpc.StreamServerInfo{FullMethod: testMethod}, func(srv any, ss grpc.ServerStream) error {
+		var req testReq
+		if err := ss.RecvMsg(&req); err != nil {
+			t.Fatalf("第一条消息应通过校验: %v", err)
+		}
+		return ss.RecvMsg(&req)
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("第二条消息应返回InvalidArgument, 实际: %v", err)
+	}
+}
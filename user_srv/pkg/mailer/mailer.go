@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// NewMailer 未配置smtp地址时只把邮件写到日志中
+func NewMailer(cfg config.MailConfig, logger *logger.Logger) Mailer {
+	if cfg.Host == "" {
+		return &logMailer{logger: logger}
+	}
+	return &smtpMailer{cfg: cfg}
+}
+
+type smtpMailer struct {
+	cfg config.MailConfig
+}
+
+func (s *smtpMailer) Send(ctx context.Context, to, subject, body string) error {
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + s.cfg.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+	addr := fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)
+	return smtp.SendMail(addr, auth, s.cfg.From, []string{to}, []byte(msg))
+}
+
+type logMailer struct {
+	logger *logger.Logger
+}
+
+func (l *logMailer) Send(ctx context.Context, to, subject, body string) error {
+	l.logger.Sugar().Infof("未配置邮件服务, 收件人: %s, 主题: %s", to, subject)
+	return nil
+}
@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const (
+	lockName = "tk_user_srv_migrate"
+	// postgres的advisory lock只接受整数, 与其他业务的锁区分开即可
+	pgLockId = 7264937715249873
+	// mysql等待锁的秒数
+	lockTimeout = 300
+)
+
+var errLockTimeout = errors.New("等待迁移锁超时")
+
+// locker 跨进程的迁移锁, 必须在同一个连接上加锁和解锁
+type locker interface {
+	Lock(db *gorm.DB) error
+	Unlock(db *gorm.DB) error
+}
+
+func newLocker(dialect string) locker {
+	switch dialect {
+	case "mysql":
+		return mysqlLocker{}
+	case "postgres":
+		return postgresLocker{}
+	default:
+		// sqlite只在单机使用, 写事务本身是串行的
+		return noopLocker{}
+	}
+}
+
+type mysqlLocker struct{}
+
+func (mysqlLocker) Lock(db *gorm.DB) error {
+	var got sql.NullInt64
+	if err := db.Raw("SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&got).Error; err != nil {
+		return err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return errLockTimeout
+	}
+	return nil
+}
+
+func (mysqlLocker) Unlock(db *gorm.DB) error {
+	return db.Exec("SELECT RELEASE_LOCK(?)", lockName).Error
+}
+
+type postgresLocker struct{}
+
+func (postgresLocker) Lock(db *gorm.DB) error {
+	return db.Exec("SELECT pg_advisory_lock(?)", pgLockId).Error
+}
+
+func (postgresLocker) Unlock(db *gorm.DB) error {
+	return db.Exec("SELECT pg_advisory_unlock(?)", pgLockId).Error
+}
+
+type noopLocker struct{}
+
+func (noopLocker) Lock(*gorm.DB) error {
+	return nil
+}
+
+func (noopLocker) Unlock(*gorm.DB) error {
+	return nil
+}
@@ -0,0 +1,363 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/Numsina/tk_users/user_srv/logger"
+)
+
+var (
+	ErrDirty        = errors.New("存在未完成的迁移, 请人工处理后再执行")
+	ErrMissingDown  = errors.New("迁移缺少回滚脚本")
+	ErrUnknownApply = errors.New("数据库中存在迁移文件里没有的版本")
+)
+
+// 迁移文件名: 000001_init.up.sql / 000001_init.down.sql
+var fileRegexp = regexp.MustCompile(`^(\d+)_([\w-]+)\.(up|down)\.sql$`)
+
+// Migration 一个版本的迁移, 语句之间以行尾的分号分隔
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status 迁移版本及其执行情况
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	Dirty     bool
+	AppliedAt int64
+}
+
+// SchemaMigration 已执行的迁移版本, dirty表示执行到一半失败
+type SchemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"type:varchar(255)"`
+	Dirty     bool
+	AppliedAt int64
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	locker     locker
+	logger     *logger.Logger
+}
+
+// New 从fsys中读取迁移文件, fsys中只包含当前数据库方言的迁移
+func New(db *gorm.DB, fsys fs.FS, logger *logger.Logger) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		locker:     newLocker(db.Dialector.Name()),
+		logger:     logger,
+	}, nil
+}
+
+// Load 读取并按版本排序迁移文件
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		m := fileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("迁移版本%d存在多个名称: %s, %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("迁移版本%d缺少up脚本", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up 执行未执行的迁移, steps为0时执行全部
+func (m *Migrator) Up(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if steps > 0 && n >= steps {
+				break
+			}
+			if err = m.run(db, mig, true); err != nil {
+				return err
+			}
+			n++
+		}
+		if n == 0 {
+			m.logger.Info("数据库已是最新版本")
+		}
+		return nil
+	})
+}
+
+// Down 回滚最近执行的迁移, steps为0时回滚一个版本
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		steps = 1
+	}
+	return m.withLock(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrMissingDown, mig.Version, mig.Name)
+			}
+			if err = m.run(db, mig, false); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	db := m.db.WithContext(ctx)
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	applied, err := m.appliedAll(db)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if sm, ok := applied[mig.Version]; ok {
+			s.Applied = !sm.Dirty
+			s.Dirty = sm.Dirty
+			s.AppliedAt = sm.AppliedAt
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// run 执行一个版本的迁移. 先标记为dirty, 全部语句成功后再更新状态,
+// mysql的DDL不支持事务, 中途失败时需要根据dirty标记人工处理
+func (m *Migrator) run(db *gorm.DB, mig Migration, up bool) error {
+	script, action := mig.Up, "执行"
+	if !up {
+		script, action = mig.Down, "回滚"
+	}
+	m.logger.Sugar().Infof("%s迁移: %d_%s", action, mig.Version, mig.Name)
+
+	var err error
+	if up {
+		err = db.Create(&SchemaMigration{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			Dirty:     true,
+			AppliedAt: time.Now().UnixMilli(),
+		}).Error
+	} else {
+		err = db.Model(&SchemaMigration{}).Where("version = ?", mig.Version).Update("dirty", true).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range Split(script) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("%s迁移%d_%s失败: %w", action, mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !up {
+		return db.Where("version = ?", mig.Version).Delete(&SchemaMigration{}).Error
+	}
+	return db.Model(&SchemaMigration{}).Where("version = ?", mig.Version).
+		Updates(map[string]any{
+			"dirty":      false,
+			"applied_at": time.Now().UnixMilli(),
+		}).Error
+}
+
+// applied 返回已执行的版本, 存在dirty或未知版本时拒绝继续
+func (m *Migrator) applied(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	applied, err := m.appliedAll(db)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]bool, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+	}
+	for v, sm := range applied {
+		if sm.Dirty {
+			return nil, fmt.Errorf("%w: %d_%s", ErrDirty, sm.Version, sm.Name)
+		}
+		if !known[v] {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownApply, v)
+		}
+	}
+	return applied, nil
+}
+
+func (m *Migrator) appliedAll(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// withLock 在同一个连接上持有迁移锁, 多个副本同时启动时只有一个在执行迁移
+func (m *Migrator) withLock(ctx context.Context, fn func(db *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// 新建会话, 避免多次调用之间共享查询条件
+		db := conn.Session(&gorm.Session{})
+		if err := m.locker.Lock(db); err != nil {
+			return fmt.Errorf("获取迁移锁失败: %w", err)
+		}
+		defer func() {
+			if err := m.locker.Unlock(db); err != nil {
+				m.logger.Sugar().Warnf("释放迁移锁失败, 失败原因: %s", err)
+			}
+		}()
+
+		if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+		return fn(db)
+	})
+}
+
+// Split 按行尾的分号拆分语句, 并忽略--开头的注释行
+func Split(script string) []string {
+	var stmts []string
+	var buf strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(buf.String()))
+			buf.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(buf.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
+
+// Create 在每个方言目录下创建下一个版本的空迁移文件, 返回创建的文件
+func Create(dir string, dialects []string, name string) ([]string, error) {
+	if !regexp.MustCompile(`^[\w-]+$`).MatchString(name) {
+		return nil, fmt.Errorf("迁移名称只能包含字母、数字、下划线和中划线: %s", name)
+	}
+
+	var next int64 = 1
+	for _, dialect := range dialects {
+		migrations, err := Load(os.DirFS(filepath.Join(dir, dialect)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if len(migrations) > 0 {
+			next = max(next, migrations[len(migrations)-1].Version+1)
+		}
+	}
+
+	var files []string
+	for _, dialect := range dialects {
+		if err := os.MkdirAll(filepath.Join(dir, dialect), 0o755); err != nil {
+			return nil, err
+		}
+		for _, direction := range []string{"up", "down"} {
+			file := filepath.Join(dir, dialect, fmt.Sprintf("%06d_%s.%s.sql", next, name, direction))
+			content := "-- 每条语句以分号结尾, 分号需位于行尾\n"
+			if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
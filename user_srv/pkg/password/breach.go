@@ -0,0 +1,243 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+var (
+	ErrBreached         = errors.New("密码出现在已泄露的密码库中")
+	ErrBreachFileFormat = errors.New("泄露密码库文件格式错误")
+)
+
+const ReasonBreached = "breached"
+
+const (
+	BreachTypeHashFile = "hashfile"
+	BreachTypeBloom    = "bloom"
+)
+
+// BreachChecker 离线检查密码是否出现在已泄露的密码库中, 不发起任何网络请求
+type BreachChecker interface {
+	Breached(pwd string) (bool, error)
+}
+
+// NewBreachChecker 在启动时加载本地泄露密码库, 未配置路径时不做检查
+func NewBreachChecker(cfg config.PasswordBreachConfig) (BreachChecker, error) {
+	if cfg.Path == "" {
+		return noopChecker{}, nil
+	}
+
+	switch cfg.Type {
+	case BreachTypeBloom:
+		return LoadBloomFilter(cfg.Path)
+	case BreachTypeHashFile, "":
+		return LoadHashFile(cfg.Path)
+	default:
+		return nil, fmt.Errorf("不支持的泄露密码库类型: %s", cfg.Type)
+	}
+}
+
+type noopChecker struct{}
+
+func (noopChecker) Breached(string) (bool, error) {
+	return false, nil
+}
+
+const (
+	// 与HIBP的k-匿名接口一致, 按SHA-1十六进制的前5位分区
+	prefixLen   = 5
+	prefixCount = 1 << (4 * prefixLen)
+)
+
+// HashFile 按SHA-1排序的"HASH:COUNT"文本文件(HIBP的ordered-by-hash格式),
+// 启动时只建立前缀分区的偏移索引, 查询时读取对应分区
+type HashFile struct {
+	f       *os.File
+	offsets []int64
+}
+
+func LoadHashFile(path string) (*HashFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int64, prefixCount+1)
+	next := 0
+	var pos int64
+	r := bufio.NewReaderSize(f, 1<<20)
+	for {
+		line, err := r.ReadSlice('\n')
+		if len(line) > 0 {
+			if len(line) < prefixLen {
+				f.Close()
+				return nil, ErrBreachFileFormat
+			}
+			prefix, perr := strconv.ParseUint(string(line[:prefixLen]), 16, 32)
+			if perr != nil || int(prefix) < next-1 {
+				f.Close()
+				return nil, ErrBreachFileFormat
+			}
+			for ; next <= int(prefix); next++ {
+				offsets[next] = pos
+			}
+			pos += int64(len(line))
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	for ; next <= prefixCount; next++ {
+		offsets[next] = pos
+	}
+	return &HashFile{f: f, offsets: offsets}, nil
+}
+
+func (h *HashFile) Breached(pwd string) (bool, error) {
+	sum := sha1.Sum([]byte(pwd))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, _ := strconv.ParseUint(digest[:prefixLen], 16, 32)
+
+	start, end := h.offsets[prefix], h.offsets[prefix+1]
+	if start == end {
+		return false, nil
+	}
+
+	buf := make([]byte, end-start)
+	if _, err := h.f.ReadAt(buf, start); err != nil && err != io.EOF {
+		return false, err
+	}
+
+	for _, line := range bytes.Split(buf, []byte{'\n'}) {
+		hash, _, _ := bytes.Cut(bytes.TrimSpace(line), []byte{':'})
+		if bytes.EqualFold(hash, []byte(digest)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (h *HashFile) Close() error {
+	return h.f.Close()
+}
+
+// bloom文件格式: "TKBF" | k(uint32) | m(uint64, 位数) | 位图, 均为小端序
+var bloomMagic = []byte("TKBF")
+
+const (
+	bloomHeaderLen = 4 + 4 + 8
+	// 误判率为1e-9时k约为30, 超过该值的文件视为损坏, 避免每次检查计算过多哈希
+	bloomMaxHashes = 64
+)
+
+// BloomFilter 以SHA-1摘要为元素的布隆过滤器, 体积远小于原始哈希文件, 存在一定误判率
+type BloomFilter struct {
+	k    uint32
+	m    uint64
+	bits []byte
+}
+
+func NewBloomFilter(n uint64, fpRate float64) *BloomFilter {
+	n = max(n, 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &BloomFilter{k: k, m: m, bits: make([]byte, (m+7)/8)}
+}
+
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadBloomFilter(bufio.NewReader(f), info.Size())
+}
+
+// ReadBloomFilter 读取size字节的bloom文件, 位图大小必须与文件头中的m一致,
+// 避免损坏的文件头导致启动时分配过多内存
+func ReadBloomFilter(r io.Reader, size int64) (*BloomFilter, error) {
+	header := make([]byte, bloomHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrBreachFileFormat
+	}
+	if !bytes.Equal(header[:len(bloomMagic)], bloomMagic) {
+		return nil, ErrBreachFileFormat
+	}
+
+	b := &BloomFilter{
+		k: binary.LittleEndian.Uint32(header[4:8]),
+		m: binary.LittleEndian.Uint64(header[8:16]),
+	}
+	if b.k == 0 || b.k > bloomMaxHashes || b.m == 0 || (b.m+7)/8 != uint64(size-bloomHeaderLen) {
+		return nil, ErrBreachFileFormat
+	}
+
+	b.bits = make([]byte, (b.m+7)/8)
+	if _, err := io.ReadFull(r, b.bits); err != nil {
+		return nil, ErrBreachFileFormat
+	}
+	return b, nil
+}
+
+func (b *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, 0, bloomHeaderLen)
+	header = append(header, bloomMagic...)
+	header = binary.LittleEndian.AppendUint32(header, b.k)
+	header = binary.LittleEndian.AppendUint64(header, b.m)
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(b.bits)
+	return int64(n + m), err
+}
+
+// AddDigest 加入一个SHA-1摘要
+func (b *BloomFilter) AddDigest(digest []byte) {
+	h1, h2 := b.hashes(digest)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		idx := (h1 + i*h2) % b.m
+		b.bits[idx/8] |= 1 << (idx % 8)
+	}
+}
+
+func (b *BloomFilter) Breached(pwd string) (bool, error) {
+	sum := sha1.Sum([]byte(pwd))
+	h1, h2 := b.hashes(sum[:])
+	for i := uint64(0); i < uint64(b.k); i++ {
+		idx := (h1 + i*h2) % b.m
+		if b.bits[idx/8]&(1<<(idx%8)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// hashes SHA-1摘要本身分布均匀, 直接取前16字节做双重哈希
+func (b *BloomFilter) hashes(digest []byte) (uint64, uint64) {
+	return binary.LittleEndian.Uint64(digest[0:8]), binary.LittleEndian.Uint64(digest[8:16]) | 1
+}
@@ -0,0 +1,202 @@
+package password
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+func digestOf(pwd string) string {
+	sum := sha1.Sum([]byte(pwd))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// hashFile 按HIBP格式生成排序后的哈希文件
+func hashFile(t *testing.T, pwds []string, lineEnd string) string {
+	t.Helper()
+	var lines []string
+	for i, pwd := range pwds {
+		lines = append(lines, fmt.Sprintf("%s:%d", digestOf(pwd), i+1))
+	}
+	slices.Sort(lines)
+	return writeFile(t, "pwned.txt", []byte(strings.Join(lines, lineEnd)+lineEnd))
+}
+
+func TestHashFile(t *testing.T) {
+	breached := []string{"123456", "password", "qwerty", "iloveyou", "dragon"}
+	for _, lineEnd := range []string{"\n", "\r\n"} {
+		h, err := LoadHashFile(hashFile(t, breached, lineEnd))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, pwd := range breached {
+			if ok, err := h.Breached(pwd); err != nil || !ok {
+				t.Errorf("%s应在泄露库中: %v, %v", pwd, ok, err)
+			}
+		}
+		for _, pwd := range []string{"N3w#Secret!", "Password", ""} {
+			if ok, err := h.Breached(pwd); err != nil || ok {
+				t.Errorf("%s不应在泄露库中: %v, %v", pwd, ok, err)
+			}
+		}
+		h.Close()
+	}
+}
+
+func TestHashFileIndex(t *testing.T) {
+	// 分区偏移覆盖首尾分区以及相邻分区, 空分区的起止偏移相同
+	lines := []string{
+		"00000" + strings.Repeat("A", 35) + ":1",
+		"00000" + strings.Repeat("B", 35) + ":1",
+		"00001" + strings.Repeat("A", 35) + ":1",
+		"ABCDE" + strings.Repeat("0", 35) + ":1",
+		"FFFFF" + strings.Repeat("F", 35) + ":1",
+	}
+	h, err := LoadHashFile(writeFile(t, "pwned.txt", []byte(strings.Join(lines, "\n"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// 每行40个十六进制字符加":1\n", 最后一行没有换行
+	const n = 43
+	want := map[int]int64{0: 0, 1: 2 * n, 2: 3 * n, 0xABCDE: 3 * n, 0xABCDF: 4 * n, 0xFFFFF: 4 * n, prefixCount: 5*n - 1}
+	for prefix, offset := range want {
+		if h.offsets[prefix] != offset {
+			t.Errorf("分区%05X的偏移为%d, 期望%d", prefix, h.offsets[prefix], offset)
+		}
+	}
+}
+
+func TestHashFileFormat(t *testing.T) {
+	cases := map[string]string{
+		"未排序":   "FFFFF" + strings.Repeat("0", 35) + ":1\n00000" + strings.Repeat("0", 35) + ":1\n",
+		"非十六进制": "XYZ12" + strings.Repeat("0", 35) + ":1\n",
+		"行过短":   "ABC\n",
+	}
+	for name, content := range cases {
+		if _, err := LoadHashFile(writeFile(t, "pwned.txt", []byte(content))); !errors.Is(err, ErrBreachFileFormat) {
+			t.Errorf("%s: 应返回ErrBreachFileFormat, 实际: %v", name, err)
+		}
+	}
+
+	h, err := LoadHashFile(writeFile(t, "empty.txt", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if ok, err := h.Breached("123456"); err != nil || ok {
+		t.Fatalf("空文件不应命中: %v, %v", ok, err)
+	}
+}
+
+func bloomFile(t *testing.T, pwds []string) []byte {
+	t.Helper()
+	b := NewBloomFilter(uint64(len(pwds)), 0.001)
+	for _, pwd := range pwds {
+		sum := sha1.Sum([]byte(pwd))
+		b.AddDigest(sum[:])
+	}
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBloomFilter(t *testing.T) {
+	var breached []string
+	for i := 0; i < 1000; i++ {
+		breached = append(breached, fmt.Sprintf("leaked-%d", i))
+	}
+	b, err := LoadBloomFilter(writeFile(t, "breach.bloom", bloomFile(t, breached)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pwd := range breached {
+		if ok, _ := b.Breached(pwd); !ok {
+			t.Fatalf("%s应在泄露库中", pwd)
+		}
+	}
+
+	// 误判率按0.001生成, 1000次检查的误判应远少于50次
+	var falsePositives int
+	for i := 0; i < 1000; i++ {
+		if ok, _ := b.Breached(fmt.Sprintf("safe-%d", i)); ok {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Fatalf("误判次数过多: %d", falsePositives)
+	}
+}
+
+func TestBloomFilterFormat(t *testing.T) {
+	valid := bloomFile(t, []string{"123456"})
+	header := func(k uint32, m uint64) []byte {
+		h := append([]byte(nil), bloomMagic...)
+		h = binary.LittleEndian.AppendUint32(h, k)
+		return binary.LittleEndian.AppendUint64(h, m)
+	}
+
+	cases := map[string][]byte{
+		"空文件":      nil,
+		"文件头不完整":   valid[:10],
+		"魔数错误":     append([]byte("XXXX"), valid[4:]...),
+		"k为0":      append(header(0, 8), 0),
+		"k过大":      append(header(1<<20, 8), 0),
+		"m为0":      header(3, 0),
+		"位图被截断":    valid[:len(valid)-1],
+		"文件尾有多余数据": append(append([]byte(nil), valid...), 0),
+		// 文件头声明了约2EB的位图, 必须在分配内存前拒绝
+		"m超过文件大小": append(header(3, 1<<64-1), 0, 0, 0, 0),
+	}
+	for name, data := range cases {
+		if _, err := LoadBloomFilter(writeFile(t, "breach.bloom", data)); !errors.Is(err, ErrBreachFileFormat) {
+			t.Errorf("%s: 应返回ErrBreachFileFormat, 实际: %v", name, err)
+		}
+	}
+}
+
+func TestNewBreachChecker(t *testing.T) {
+	b, err := NewBreachChecker(config.PasswordBreachConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.Breached("123456"); err != nil || ok {
+		t.Fatalf("未配置泄露库时不应命中: %v, %v", ok, err)
+	}
+
+	path := hashFile(t, []string{"123456"}, "\n")
+	if _, err = NewBreachChecker(config.PasswordBreachConfig{Path: path, Type: "csv"}); err == nil {
+		t.Fatal("不支持的类型应返回错误")
+	}
+	b, err = NewBreachChecker(config.PasswordBreachConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.Breached("123456"); err != nil || !ok {
+		t.Fatalf("默认按哈希文件加载: %v, %v", ok, err)
+	}
+}
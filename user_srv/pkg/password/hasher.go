@@ -0,0 +1,229 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+var ErrUnknownHash = errors.New("无法识别的密码哈希格式")
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// Algorithm 一种密码哈希算法, 生成的哈希需要自描述算法和参数
+type Algorithm interface {
+	Name() string
+	Hash(pwd string) (string, error)
+	// Match 判断哈希是否由该算法生成且格式完整, 参数损坏的哈希视为无法识别
+	Match(encoded string) bool
+	Verify(encoded, pwd string) (bool, error)
+	// Weaker 判断哈希使用的参数是否弱于当前配置
+	Weaker(encoded string) bool
+}
+
+// Hasher 使用配置的算法生成哈希, 并能校验所有已注册算法生成的哈希
+type Hasher struct {
+	primary    Algorithm
+	algorithms []Algorithm
+}
+
+func NewHasher(cfg config.PasswordHashConfig) *Hasher {
+	if cfg.BcryptCost <= 0 {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
+	if cfg.Argon2Memory == 0 {
+		cfg.Argon2Memory = 64 * 1024
+	}
+	if cfg.Argon2Time == 0 {
+		cfg.Argon2Time = 3
+	}
+	if cfg.Argon2Threads == 0 {
+		cfg.Argon2Threads = 4
+	}
+
+	algorithms := []Algorithm{
+		&argon2id{memory: cfg.Argon2Memory, time: cfg.Argon2Time, threads: cfg.Argon2Threads},
+		&bcryptAlgo{cost: cfg.BcryptCost},
+	}
+	h := &Hasher{
+		primary:    algorithms[0],
+		algorithms: algorithms,
+	}
+	for _, algo := range algorithms {
+		if algo.Name() == cfg.Algorithm {
+			h.primary = algo
+		}
+	}
+	return h
+}
+
+func (h *Hasher) Hash(pwd string) (string, error) {
+	return h.primary.Hash(pwd)
+}
+
+// Known 是否为支持的算法生成的哈希, 导入已有哈希时使用
+func (h *Hasher) Known(encoded string) bool {
+	for _, algo := range h.algorithms {
+		if algo.Match(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify 校验密码, rehash表示校验通过但哈希需要使用当前配置重新生成
+func (h *Hasher) Verify(encoded, pwd string) (ok bool, rehash bool, err error) {
+	for _, algo := range h.algorithms {
+		if !algo.Match(encoded) {
+			continue
+		}
+
+		ok, err = algo.Verify(encoded, pwd)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, algo != h.primary || algo.Weaker(encoded), nil
+	}
+	return false, false, ErrUnknownHash
+}
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// argon2id 哈希格式: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+type argon2id struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (a *argon2id) Name() string {
+	return AlgorithmArgon2id
+}
+
+func (a *argon2id) Hash(pwd string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(pwd), salt, a.time, a.memory, a.threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.memory, a.time, a.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *argon2id) Match(encoded string) bool {
+	if !strings.HasPrefix(encoded, "$argon2id$") {
+		return false
+	}
+	_, err := a.decode(encoded)
+	return err == nil
+}
+
+func (a *argon2id) Verify(encoded, pwd string) (bool, error) {
+	p, err := a.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(pwd), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (a *argon2id) Weaker(encoded string) bool {
+	p, err := a.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory < a.memory || p.time < a.time || p.threads < a.threads || len(p.key) < argon2KeyLen
+}
+
+func (a *argon2id) decode(encoded string) (argon2Params, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return argon2Params{}, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, ErrUnknownHash
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return argon2Params{}, ErrUnknownHash
+	}
+	// 与argon2的参数要求一致, 否则计算时会panic
+	if p.time < 1 || p.threads < 1 || p.memory < 8*uint32(p.threads) {
+		return argon2Params{}, ErrUnknownHash
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(p.salt) == 0 {
+		return argon2Params{}, ErrUnknownHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return argon2Params{}, ErrUnknownHash
+	}
+	return p, nil
+}
+
+// bcrypt哈希的固定长度: 版本和cost共7个字符, 加上22个字符的salt和31个字符的哈希
+const bcryptHashLen = 60
+
+// bcryptAlgo bcrypt哈希自带版本和cost, 例如 $2a$10$...
+type bcryptAlgo struct {
+	cost int
+}
+
+func (b *bcryptAlgo) Name() string {
+	return AlgorithmBcrypt
+}
+
+func (b *bcryptAlgo) Hash(pwd string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), b.cost)
+	return string(hash), err
+}
+
+func (b *bcryptAlgo) Match(encoded string) bool {
+	if !strings.HasPrefix(encoded, "$2a$") && !strings.HasPrefix(encoded, "$2b$") &&
+		!strings.HasPrefix(encoded, "$2y$") {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && len(encoded) == bcryptHashLen
+}
+
+func (b *bcryptAlgo) Verify(encoded, pwd string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(pwd))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *bcryptAlgo) Weaker(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < b.cost
+}
@@ -0,0 +1,153 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+// 测试使用最低的计算成本, 线上参数见NewHasher中的默认值
+var (
+	testArgon2 = config.PasswordHashConfig{
+		Algorithm:     AlgorithmArgon2id,
+		Argon2Memory:  64,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+	}
+	testBcrypt = config.PasswordHashConfig{
+		Algorithm:  AlgorithmBcrypt,
+		BcryptCost: bcrypt.MinCost,
+	}
+)
+
+func mustHash(t *testing.T, h *Hasher, pwd string) string {
+	t.Helper()
+	encoded, err := h.Hash(pwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestHasherRoundTrip(t *testing.T) {
+	cases := map[string]struct {
+		cfg    config.PasswordHashConfig
+		prefix string
+	}{
+		AlgorithmArgon2id: {testArgon2, "$argon2id$v=19$m=64,t=1,p=1$"},
+		AlgorithmBcrypt:   {testBcrypt, "$2a$04$"},
+	}
+	for name, c := range cases {
+		h := NewHasher(c.cfg)
+		encoded := mustHash(t, h, "S3cret!pwd")
+		if !strings.HasPrefix(encoded, c.prefix) {
+			t.Fatalf("%s哈希格式不正确: %s", name, encoded)
+		}
+		if again := mustHash(t, h, "S3cret!pwd"); again == encoded {
+			t.Fatalf("%s两次哈希相同, 没有使用随机salt", name)
+		}
+		if !h.Known(encoded) {
+			t.Fatalf("%s哈希应能识别", name)
+		}
+
+		ok, rehash, err := h.Verify(encoded, "S3cret!pwd")
+		if err != nil || !ok || rehash {
+			t.Fatalf("%s校验正确密码: ok=%v rehash=%v err=%v", name, ok, rehash, err)
+		}
+		ok, rehash, err = h.Verify(encoded, "s3cret!pwd")
+		if err != nil || ok || rehash {
+			t.Fatalf("%s校验错误密码: ok=%v rehash=%v err=%v", name, ok, rehash, err)
+		}
+	}
+}
+
+func TestHasherRehash(t *testing.T) {
+	argon := mustHash(t, NewHasher(testArgon2), "pwd")
+	bcryptHash := mustHash(t, NewHasher(testBcrypt), "pwd")
+
+	stronger := func(cfg config.PasswordHashConfig, f func(*config.PasswordHashConfig)) *Hasher {
+		f(&cfg)
+		return NewHasher(cfg)
+	}
+	cases := []struct {
+		name    string
+		hasher  *Hasher
+		encoded string
+		rehash  bool
+	}{
+		{"相同参数", NewHasher(testArgon2), argon, false},
+		{"内存更大", stronger(testArgon2, func(c *config.PasswordHashConfig) { c.Argon2Memory = 128 }), argon, true},
+		{"迭代次数更多", stronger(testArgon2, func(c *config.PasswordHashConfig) { c.Argon2Time = 2 }), argon, true},
+		{"并行度更高", stronger(testArgon2, func(c *config.PasswordHashConfig) { c.Argon2Threads = 2 }), argon, true},
+		{"配置弱于哈希", stronger(testArgon2, func(c *config.PasswordHashConfig) { c.Argon2Memory = 32 }), argon, false},
+		{"bcrypt相同cost", NewHasher(testBcrypt), bcryptHash, false},
+		{"bcrypt cost更高", stronger(testBcrypt, func(c *config.PasswordHashConfig) { c.BcryptCost = 5 }), bcryptHash, true},
+		{"切换到argon2id", NewHasher(testArgon2), bcryptHash, true},
+		{"切换到bcrypt", NewHasher(testBcrypt), argon, true},
+	}
+	for _, c := range cases {
+		ok, rehash, err := c.hasher.Verify(c.encoded, "pwd")
+		if err != nil || !ok {
+			t.Fatalf("%s: 校验失败 ok=%v err=%v", c.name, ok, err)
+		}
+		if rehash != c.rehash {
+			t.Errorf("%s: rehash=%v, 期望%v", c.name, rehash, c.rehash)
+		}
+	}
+}
+
+func TestHasherDefaultAlgorithm(t *testing.T) {
+	// 未配置或配置了不支持的算法时使用argon2id
+	for _, algo := range []string{"", "md5"} {
+		h := NewHasher(config.PasswordHashConfig{Algorithm: algo, Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 1})
+		if encoded := mustHash(t, h, "pwd"); !strings.HasPrefix(encoded, "$argon2id$") {
+			t.Fatalf("算法%q生成了%s", algo, encoded)
+		}
+	}
+}
+
+func TestHasherMalformed(t *testing.T) {
+	h := NewHasher(testArgon2)
+	valid := mustHash(t, h, "pwd")
+	parts := strings.Split(valid, "$")
+	with := func(i int, v string) string {
+		p := append([]string(nil), parts...)
+		p[i] = v
+		return strings.Join(p, "$")
+	}
+
+	cases := map[string]string{
+		"空字符串":     "",
+		"明文":       "pwd",
+		"md5":      "5f4dcc3b5aa765d61d8327deb882cf99",
+		"缺少字段":     strings.Join(parts[:5], "$"),
+		"多余字段":     valid + "$x",
+		"版本不支持":    with(2, "v=16"),
+		"版本格式错误":   with(2, "version"),
+		"参数格式错误":   with(3, "m=64,t=1"),
+		"并行度为0":    with(3, "m=64,t=1,p=0"),
+		"并行度溢出":    with(3, "m=64,t=1,p=256"),
+		"迭代次数为0":   with(3, "m=64,t=0,p=1"),
+		"内存过小":     with(3, "m=7,t=1,p=1"),
+		"salt为空":   with(4, ""),
+		"salt非法":   with(4, "!!!"),
+		"key为空":    with(5, ""),
+		"key非法":    with(5, "!!!"),
+		"bcrypt截断": "$2a$04$abc",
+		"bcrypt损坏": "$2a$xx$" + strings.Repeat("a", 53),
+		"未知算法":     "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5",
+	}
+	for name, encoded := range cases {
+		if h.Known(encoded) {
+			t.Errorf("%s: 不应识别%q", name, encoded)
+		}
+		ok, rehash, err := h.Verify(encoded, "pwd")
+		if !errors.Is(err, ErrUnknownHash) || ok || rehash {
+			t.Errorf("%s: Verify应返回ErrUnknownHash, 实际: ok=%v rehash=%v err=%v", name, ok, rehash, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package password
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nbutton23/zxcvbn-go"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// 密码策略校验失败的原因, 供调用方机器识别
+const (
+	ReasonTooShort      = "too_short"
+	ReasonTooLong       = "too_long"
+	ReasonMissingUpper  = "missing_upper"
+	ReasonMissingLower  = "missing_lower"
+	ReasonMissingDigit  = "missing_digit"
+	ReasonMissingSymbol = "missing_symbol"
+	ReasonTooFewClasses = "too_few_classes"
+	ReasonContainsEmail = "contains_email"
+	ReasonContainsNick  = "contains_nickname"
+	ReasonContainsWord  = "contains_banned_word"
+	ReasonTooWeak       = "too_weak"
+)
+
+const (
+	defaultMinLength = 8
+	defaultMaxLength = 64
+	// 用户信息中短于该长度的片段不参与包含检查
+	minInputLength = 3
+)
+
+type PolicyError struct {
+	Reasons []string
+}
+
+func (e *PolicyError) Error() string {
+	return "密码不符合安全策略: " + strings.Join(e.Reasons, ",")
+}
+
+// UserInputs 不允许出现在密码中的用户信息
+type UserInputs struct {
+	Email    string
+	NickName string
+}
+
+type Policy struct {
+	cfg config.PasswordPolicyConfig
+}
+
+func NewPolicy(cfg config.PasswordPolicyConfig) *Policy {
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = defaultMinLength
+	}
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = defaultMaxLength
+	}
+	return &Policy{cfg: cfg}
+}
+
+// Policies 各租户的密码策略, 没有单独配置的租户使用默认策略
+type Policies struct {
+	def     *Policy
+	tenants map[string]*Policy
+}
+
+func NewPolicies(def config.PasswordPolicyConfig, tenants []config.TenantConfig) *Policies {
+	p := &Policies{
+		def:     NewPolicy(def),
+		tenants: make(map[string]*Policy),
+	}
+	for _, t := range tenants {
+		if t.PasswordPolicy != nil {
+			p.tenants[tenant.Normalize(t.Id)] = NewPolicy(*t.PasswordPolicy)
+		}
+	}
+	return p
+}
+
+// For 返回租户的密码策略
+func (p *Policies) For(id string) *Policy {
+	if policy, ok := p.tenants[id]; ok {
+		return policy
+	}
+	return p.def
+}
+
+// Check 校验密码, 不符合时返回包含全部原因的*PolicyError
+func (p *Policy) Check(pwd string, inputs UserInputs) error {
+	var reasons []string
+	n := utf8.RuneCountInString(pwd)
+	if n < p.cfg.MinLength {
+		reasons = append(reasons, ReasonTooShort)
+	}
+	if n > p.cfg.MaxLength {
+		reasons = append(reasons, ReasonTooLong)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range pwd {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.cfg.RequireUpper && !upper {
+		reasons = append(reasons, ReasonMissingUpper)
+	}
+	if p.cfg.RequireLower && !lower {
+		reasons = append(reasons, ReasonMissingLower)
+	}
+	if p.cfg.RequireDigit && !digit {
+		reasons = append(reasons, ReasonMissingDigit)
+	}
+	if p.cfg.RequireSymbol && !symbol {
+		reasons = append(reasons, ReasonMissingSymbol)
+	}
+	if classes := count(upper, lower, digit, symbol); classes < p.cfg.MinClasses {
+		reasons = append(reasons, ReasonTooFewClasses)
+	}
+
+	lowered := strings.ToLower(pwd)
+	var userInputs []string
+	if p.cfg.BanUserInputs {
+		local, _, _ := strings.Cut(inputs.Email, "@")
+		if contains(lowered, local) {
+			reasons = append(reasons, ReasonContainsEmail)
+		}
+		if contains(lowered, inputs.NickName) {
+			reasons = append(reasons, ReasonContainsNick)
+		}
+		userInputs = append(userInputs, local, inputs.NickName)
+	}
+
+	for _, word := range p.cfg.BannedWords {
+		if contains(lowered, word) {
+			reasons = append(reasons, ReasonContainsWord)
+			break
+		}
+	}
+
+	// 长度超限时跳过强度评估, 避免超长输入消耗过多CPU
+	if p.cfg.MinScore > 0 && n <= p.cfg.MaxLength {
+		if zxcvbn.PasswordStrength(pwd, userInputs).Score < p.cfg.MinScore {
+			reasons = append(reasons, ReasonTooWeak)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &PolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+func contains(lowered, part string) bool {
+	if utf8.RuneCountInString(part) < minInputLength {
+		return false
+	}
+	return strings.Contains(lowered, strings.ToLower(part))
+}
+
+func count(flags ...bool) int {
+	var n int
+	for _, f := range flags {
+		if f {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,147 @@
+package password
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+// reasons 返回Check的全部失败原因, 通过时返回nil
+func reasons(t *testing.T, p *Policy, pwd string, inputs UserInputs) []string {
+	t.Helper()
+	err := p.Check(pwd, inputs)
+	if err == nil {
+		return nil
+	}
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Check应返回*PolicyError, 实际: %v", err)
+	}
+	return policyErr.Reasons
+}
+
+func TestPolicyCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		cfg    config.PasswordPolicyConfig
+		pwd    string
+		inputs UserInputs
+		want   []string
+	}{
+		{"默认最短长度", config.PasswordPolicyConfig{}, "Ab1!xyz", UserInputs{}, []string{ReasonTooShort}},
+		{"默认长度通过", config.PasswordPolicyConfig{}, "abcdefgh", UserInputs{}, nil},
+		{"按字符计算长度", config.PasswordPolicyConfig{MinLength: 4}, "密码密码", UserInputs{}, nil},
+		{"超长", config.PasswordPolicyConfig{MaxLength: 10}, strings.Repeat("a", 11), UserInputs{}, []string{ReasonTooLong}},
+		{
+			"缺少字符类别",
+			config.PasswordPolicyConfig{RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true},
+			"abcdefgh",
+			UserInputs{},
+			[]string{ReasonMissingUpper, ReasonMissingDigit, ReasonMissingSymbol},
+		},
+		{
+			"字符类别齐全",
+			config.PasswordPolicyConfig{RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true},
+			"Abcdef1!",
+			UserInputs{},
+			nil,
+		},
+		{"类别数不足", config.PasswordPolicyConfig{MinClasses: 3}, "abcdefg1", UserInputs{}, []string{ReasonTooFewClasses}},
+		{"类别数足够", config.PasswordPolicyConfig{MinClasses: 3}, "Abcdefg1", UserInputs{}, nil},
+		{
+			"包含邮箱和昵称, 不区分大小写",
+			config.PasswordPolicyConfig{BanUserInputs: true},
+			"ALICE-wonderland",
+			UserInputs{Email: "alice@ex.com", NickName: "Wonderland"},
+			[]string{ReasonContainsEmail, ReasonContainsNick},
+		},
+		{
+			"过短的用户信息不参与检查",
+			config.PasswordPolicyConfig{BanUserInputs: true},
+			"al-bo-secret",
+			UserInputs{Email: "al@ex.com", NickName: "bo"},
+			nil,
+		},
+		{
+			"未开启时不检查用户信息",
+			config.PasswordPolicyConfig{},
+			"alice-secret",
+			UserInputs{Email: "alice@ex.com"},
+			nil,
+		},
+		{
+			"禁用词只报告一次",
+			config.PasswordPolicyConfig{BannedWords: []string{"Company", "secret"}},
+			"company-secret",
+			UserInputs{},
+			[]string{ReasonContainsWord},
+		},
+		{
+			"同时报告全部原因",
+			config.PasswordPolicyConfig{RequireDigit: true, BanUserInputs: true},
+			"alice",
+			UserInputs{Email: "alice@ex.com"},
+			[]string{ReasonTooShort, ReasonMissingDigit, ReasonContainsEmail},
+		},
+	}
+	for _, c := range cases {
+		if got := reasons(t, NewPolicy(c.cfg), c.pwd, c.inputs); !slices.Equal(got, c.want) {
+			t.Errorf("%s: 失败原因为%q, 期望%q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPolicyScore(t *testing.T) {
+	p := NewPolicy(config.PasswordPolicyConfig{MinScore: 3, MaxLength: 40})
+
+	for _, pwd := range []string{"password", "12345678", "qwertyuiop"} {
+		if got := reasons(t, p, pwd, UserInputs{}); !slices.Equal(got, []string{ReasonTooWeak}) {
+			t.Errorf("弱密码%s的失败原因为%q", pwd, got)
+		}
+	}
+	if got := reasons(t, p, "correct-Horse-battery-staple-93", UserInputs{}); got != nil {
+		t.Errorf("强密码被拒绝: %q", got)
+	}
+
+	// 超长时不做强度评估
+	if got := reasons(t, p, strings.Repeat("a", 41), UserInputs{}); !slices.Equal(got, []string{ReasonTooLong}) {
+		t.Errorf("超长密码的失败原因为%q", got)
+	}
+}
+
+func TestPolicyScoreUserInputs(t *testing.T) {
+	// 开启BanUserInputs时强度评估也把用户信息当作可猜测的词
+	cfg := config.PasswordPolicyConfig{MinScore: 3}
+	pwd := "Zorblaxian1987"
+	inputs := UserInputs{Email: "zorblaxian1987@ex.com"}
+	if got := reasons(t, NewPolicy(cfg), pwd, inputs); got != nil {
+		t.Fatalf("未开启BanUserInputs时不应拒绝: %q", got)
+	}
+
+	cfg.BanUserInputs = true
+	got := reasons(t, NewPolicy(cfg), pwd, inputs)
+	if !slices.Contains(got, ReasonContainsEmail) || !slices.Contains(got, ReasonTooWeak) {
+		t.Fatalf("包含邮箱的密码的失败原因为%q", got)
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	strict := config.PasswordPolicyConfig{MinLength: 12}
+	p := NewPolicies(config.PasswordPolicyConfig{}, []config.TenantConfig{
+		{Id: " Acme "},
+		{Id: "Strict", PasswordPolicy: &strict},
+	})
+
+	pwd := "abcdefghij"
+	for _, id := range []string{"acme", "unknown", ""} {
+		if err := p.For(id).Check(pwd, UserInputs{}); err != nil {
+			t.Errorf("租户%q应使用默认策略, 实际: %v", id, err)
+		}
+	}
+	if got := reasons(t, p.For("strict"), pwd, UserInputs{}); !slices.Equal(got, []string{ReasonTooShort}) {
+		t.Errorf("租户strict应使用自己的策略, 失败原因为%q", got)
+	}
+}
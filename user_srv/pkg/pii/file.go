@@ -0,0 +1,111 @@
+package pii
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+// fileKeys 本地密钥文件, 密钥为base64编码的32字节随机数:
+//
+//	{"current": "k2", "keys": {"k1": "...", "k2": "..."}, "index_key": "..."}
+//
+// 轮换时新增一个密钥并修改current, 旧密钥需要保留到后台重新加密完成
+type fileKeys struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+const ProviderFile = "file"
+
+// New 按配置创建Cipher, 未配置key_provider时不加密
+func New(cfg config.PiiConfig) (Cipher, error) {
+	switch cfg.KeyProvider {
+	case "":
+		return NewPlain(), nil
+	case ProviderFile:
+		kms, err := NewFileKMS(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewEnvelope(kms), nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥服务: %s", cfg.KeyProvider)
+	}
+}
+
+var _ KeyProvider = &FileKMS{}
+
+// FileKMS 用本地文件代替KMS, 只用于开发和测试环境
+type FileKMS struct {
+	current  string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+func NewFileKMS(path string) (*FileKMS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f fileKeys
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+
+	k := &FileKMS{current: f.Current, keys: make(map[string][]byte, len(f.Keys))}
+	for id, val := range f.Keys {
+		key, err := decodeKey(val)
+		if err != nil {
+			return nil, fmt.Errorf("密钥%s无效: %w", id, err)
+		}
+		k.keys[id] = key
+	}
+	if _, ok := k.keys[k.current]; !ok {
+		return nil, fmt.Errorf("当前密钥%s不存在", k.current)
+	}
+	if k.indexKey, err = decodeKey(f.IndexKey); err != nil {
+		return nil, fmt.Errorf("盲索引密钥无效: %w", err)
+	}
+	return k, nil
+}
+
+func decodeKey(val string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("密钥长度应为32字节, 实际为%d", len(key))
+	}
+	return key, nil
+}
+
+func (k *FileKMS) CurrentKey() string {
+	return k.current
+}
+
+func (k *FileKMS) Wrap(ctx context.Context, keyId string, dek []byte) ([]byte, error) {
+	kek, ok := k.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("密钥%s不存在", keyId)
+	}
+	return seal(kek, dek, []byte(keyId))
+}
+
+func (k *FileKMS) Unwrap(ctx context.Context, keyId string, wrapped []byte) ([]byte, error) {
+	kek, ok := k.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("密钥%s不存在", keyId)
+	}
+	return open(kek, wrapped, []byte(keyId))
+}
+
+func (k *FileKMS) IndexKey() []byte {
+	return k.indexKey
+}
@@ -0,0 +1,234 @@
+package pii
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 密文格式: enc:<主密钥id>:<被主密钥加密的数据密钥>:<被数据密钥加密的明文>, 均为base64.
+// 每个值都带着自己的数据密钥, 只修改部分字段时不需要读取整行
+const prefix = "enc:"
+
+var ErrMalformed = errors.New("密文格式错误")
+
+// Cipher 加密敏感字段. 没有enc:前缀的值视为加密之前写入的明文, 解密时原样返回.
+// aad绑定密文所属的行和列(见Field), 解密时必须相同, 密文被复制到其他行或列时无法解密
+type Cipher interface {
+	Encrypt(ctx context.Context, plaintext, aad string) (string, error)
+	Decrypt(ctx context.Context, value, aad string) (string, error)
+	// BlindIndex 带密钥的确定性摘要, 用于按值查找和唯一约束, 不区分大小写和首尾空白
+	BlindIndex(value string) string
+	// Stale 值不是用当前主密钥加密的, 需要重新加密
+	Stale(value string) bool
+}
+
+// KeyProvider 管理主密钥, 主密钥只用来加解密数据密钥
+type KeyProvider interface {
+	// CurrentKey 新数据密钥使用的主密钥id
+	CurrentKey() string
+	Wrap(ctx context.Context, keyId string, dek []byte) ([]byte, error)
+	Unwrap(ctx context.Context, keyId string, wrapped []byte) ([]byte, error)
+	// IndexKey 计算盲索引的密钥, 更换后需要重建所有盲索引
+	IndexKey() []byte
+}
+
+// Field 密文的附加数据, 由行id和列名组成
+func Field(id int64, column string) string {
+	return strconv.FormatInt(id, 10) + ":" + column
+}
+
+// Normalize 盲索引按小写、去掉首尾空白后的值计算, 按邮箱比较时使用相同的规则
+func Normalize(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+var _ Cipher = &envelope{}
+
+// envelope 每个进程为当前主密钥生成一个数据密钥, 解开的数据密钥缓存在内存中
+type envelope struct {
+	kp       KeyProvider
+	indexKey []byte
+
+	mu      sync.Mutex
+	keyId   string
+	dek     []byte
+	wrapped string
+	cache   map[string][]byte
+}
+
+func NewEnvelope(kp KeyProvider) Cipher {
+	return &envelope{
+		kp:       kp,
+		indexKey: kp.IndexKey(),
+		cache:    make(map[string][]byte),
+	}
+}
+
+func (e *envelope) Encrypt(ctx context.Context, plaintext, aad string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	keyId, dek, wrapped, err := e.current(ctx)
+	if err != nil {
+		return "", err
+	}
+	ct, err := seal(dek, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return prefix + keyId + ":" + wrapped + ":" + base64.RawStdEncoding.EncodeToString(ct), nil
+}
+
+func (e *envelope) Decrypt(ctx context.Context, value, aad string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 3)
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	dek, err := e.unwrap(ctx, parts[0], parts[1])
+	if err != nil {
+		return "", err
+	}
+	ct, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	pt, err := open(dek, ct, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+func (e *envelope) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, e.indexKey)
+	mac.Write([]byte(Normalize(value)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (e *envelope) Stale(value string) bool {
+	if value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, prefix+e.kp.CurrentKey()+":")
+}
+
+// current 返回当前主密钥下的数据密钥, 主密钥变化后重新生成
+func (e *envelope) current(ctx context.Context) (string, []byte, string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	keyId := e.kp.CurrentKey()
+	if e.keyId == keyId && e.dek != nil {
+		return e.keyId, e.dek, e.wrapped, nil
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", nil, "", err
+	}
+	wrapped, err := e.kp.Wrap(ctx, keyId, dek)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("加密数据密钥失败: %w", err)
+	}
+	e.keyId, e.dek = keyId, dek
+	e.wrapped = base64.RawStdEncoding.EncodeToString(wrapped)
+	e.cache[keyId+":"+e.wrapped] = dek
+	return e.keyId, e.dek, e.wrapped, nil
+}
+
+func (e *envelope) unwrap(ctx context.Context, keyId, wrapped string) ([]byte, error) {
+	e.mu.Lock()
+	dek, ok := e.cache[keyId+":"+wrapped]
+	e.mu.Unlock()
+	if ok {
+		return dek, nil
+	}
+
+	raw, err := base64.RawStdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	dek, err = e.kp.Unwrap(ctx, keyId, raw)
+	if err != nil {
+		return nil, fmt.Errorf("解密数据密钥失败: %w", err)
+	}
+
+	e.mu.Lock()
+	e.cache[keyId+":"+wrapped] = dek
+	e.mu.Unlock()
+	return dek, nil
+}
+
+// seal AES-256-GCM加密, 随机nonce放在密文前面
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, ciphertext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ct := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, aad)
+}
+
+var _ Cipher = plain{}
+
+// plain 未配置密钥时不加密, 盲索引即为规范化后的原值
+type plain struct{}
+
+func NewPlain() Cipher {
+	return plain{}
+}
+
+func (plain) Encrypt(ctx context.Context, plaintext, aad string) (string, error) {
+	return plaintext, nil
+}
+
+func (plain) Decrypt(ctx context.Context, value, aad string) (string, error) {
+	return value, nil
+}
+
+func (plain) BlindIndex(value string) string {
+	return Normalize(value)
+}
+
+func (plain) Stale(value string) bool {
+	return false
+}
@@ -0,0 +1,220 @@
+package pii
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+// keyFile 写入密钥文件并返回路径
+func keyFile(t *testing.T, f fileKeys) string {
+	t.Helper()
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestEnvelope(t *testing.T, current string) Cipher {
+	t.Helper()
+	c, err := New(config.PiiConfig{
+		KeyProvider: ProviderFile,
+		KeyFile: keyFile(t, fileKeys{
+			Current:  current,
+			Keys:     map[string]string{"k1": testKey(1), "k2": testKey(2)},
+			IndexKey: testKey(9),
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	c := newTestEnvelope(t, "k1")
+	ctx := context.Background()
+	aad := Field(1, "email")
+
+	value, err := c.Encrypt(ctx, "alice@ex.com", aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, "enc:k1:") || strings.Contains(value, "alice") {
+		t.Fatalf("密文格式不正确: %s", value)
+	}
+	if again, _ := c.Encrypt(ctx, "alice@ex.com", aad); again == value {
+		t.Fatal("两次加密的密文相同, 没有使用随机nonce")
+	}
+	if pt, err := c.Decrypt(ctx, value, aad); err != nil || pt != "alice@ex.com" {
+		t.Fatalf("解密结果: %q, %v", pt, err)
+	}
+
+	// 空值不加密, 没有前缀的值视为加密之前写入的明文
+	if value, err = c.Encrypt(ctx, "", aad); err != nil || value != "" {
+		t.Fatalf("空值加密结果: %q, %v", value, err)
+	}
+	if pt, err := c.Decrypt(ctx, "legacy@ex.com", aad); err != nil || pt != "legacy@ex.com" {
+		t.Fatalf("明文解密结果: %q, %v", pt, err)
+	}
+}
+
+// 密文复制到其他行或列时无法解密
+func TestEnvelopeAAD(t *testing.T) {
+	c := newTestEnvelope(t, "k1")
+	ctx := context.Background()
+
+	value, err := c.Encrypt(ctx, "alice@ex.com", Field(1, "email"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, aad := range []string{Field(2, "email"), Field(1, "address"), ""} {
+		if _, err = c.Decrypt(ctx, value, aad); err == nil {
+			t.Errorf("附加数据为%q时不应解密成功", aad)
+		}
+	}
+}
+
+func TestEnvelopeStale(t *testing.T) {
+	ctx := context.Background()
+	old := newTestEnvelope(t, "k1")
+	value, err := old.Encrypt(ctx, "alice@ex.com", Field(1, "email"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Stale(value) || old.Stale("") {
+		t.Fatal("当前密钥加密的值和空值不需要重新加密")
+	}
+
+	// 轮换后旧密文仍能解密, 但需要重新加密
+	rotated := newTestEnvelope(t, "k2")
+	if !rotated.Stale(value) || !rotated.Stale("alice@ex.com") {
+		t.Fatal("旧密钥加密的值和明文需要重新加密")
+	}
+	if pt, err := rotated.Decrypt(ctx, value, Field(1, "email")); err != nil || pt != "alice@ex.com" {
+		t.Fatalf("轮换后解密旧密文: %q, %v", pt, err)
+	}
+	value, err = rotated.Encrypt(ctx, "alice@ex.com", Field(1, "email"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, "enc:k2:") || rotated.Stale(value) {
+		t.Fatalf("轮换后应使用新密钥加密: %s", value)
+	}
+}
+
+func TestEnvelopeMalformed(t *testing.T) {
+	c := newTestEnvelope(t, "k1")
+	ctx := context.Background()
+	value, err := c.Encrypt(ctx, "alice@ex.com", Field(1, "email"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+
+	cases := map[string]string{
+		"缺少字段":      prefix + parts[0] + ":" + parts[1],
+		"数据密钥非法":    prefix + parts[0] + ":!!!:" + parts[2],
+		"密文非法":      prefix + parts[0] + ":" + parts[1] + ":!!!",
+		"密文短于nonce": prefix + parts[0] + ":" + parts[1] + ":" + base64.RawStdEncoding.EncodeToString([]byte("x")),
+	}
+	for name, v := range cases {
+		if _, err = c.Decrypt(ctx, v, Field(1, "email")); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: 应返回ErrMalformed, 实际: %v", name, err)
+		}
+	}
+
+	// 主密钥不存在或数据密钥被篡改时解密失败
+	for _, v := range []string{
+		prefix + "k9:" + parts[1] + ":" + parts[2],
+		prefix + parts[0] + ":" + base64.RawStdEncoding.EncodeToString(make([]byte, 60)) + ":" + parts[2],
+	} {
+		if _, err = c.Decrypt(ctx, v, Field(1, "email")); err == nil {
+			t.Errorf("%s不应解密成功", v)
+		}
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	for name, c := range map[string]Cipher{"envelope": newTestEnvelope(t, "k1"), "plain": NewPlain()} {
+		index := c.BlindIndex("alice@ex.com")
+		for _, v := range []string{"Alice@Ex.com", " alice@ex.com\t"} {
+			if c.BlindIndex(v) != index {
+				t.Errorf("%s: %q的盲索引与规范化后的值不同", name, v)
+			}
+		}
+		if c.BlindIndex("bob@ex.com") == index {
+			t.Errorf("%s: 不同邮箱的盲索引相同", name)
+		}
+	}
+
+	// 盲索引与主密钥无关, 轮换主密钥不需要重建索引
+	if newTestEnvelope(t, "k1").BlindIndex("alice@ex.com") != newTestEnvelope(t, "k2").BlindIndex("alice@ex.com") {
+		t.Fatal("轮换主密钥改变了盲索引")
+	}
+}
+
+func TestNewFileKMS(t *testing.T) {
+	valid := fileKeys{Current: "k1", Keys: map[string]string{"k1": testKey(1)}, IndexKey: testKey(9)}
+	cases := map[string]func(f *fileKeys){
+		"当前密钥不存在":   func(f *fileKeys) { f.Current = "k2" },
+		"未配置当前密钥":   func(f *fileKeys) { f.Current = "" },
+		"密钥非base64": func(f *fileKeys) { f.Keys = map[string]string{"k1": "!!!"} },
+		"密钥长度错误": func(f *fileKeys) {
+			f.Keys = map[string]string{"k1": base64.StdEncoding.EncodeToString(make([]byte, 16))}
+		},
+		"缺少盲索引密钥": func(f *fileKeys) { f.IndexKey = "" },
+		"盲索引密钥过短": func(f *fileKeys) { f.IndexKey = base64.StdEncoding.EncodeToString(make([]byte, 31)) },
+	}
+	for name, modify := range cases {
+		f := valid
+		modify(&f)
+		if _, err := NewFileKMS(keyFile(t, f)); err == nil {
+			t.Errorf("%s: 应返回错误", name)
+		}
+	}
+
+	if _, err := NewFileKMS(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("密钥文件不存在时应返回错误")
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileKMS(path); err == nil {
+		t.Error("密钥文件格式错误时应返回错误")
+	}
+	if _, err := NewFileKMS(keyFile(t, valid)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	c, err := New(config.PiiConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := c.Encrypt(context.Background(), "alice@ex.com", Field(1, "email")); value != "alice@ex.com" {
+		t.Fatalf("未配置密钥服务时不应加密: %s", value)
+	}
+	if _, err = New(config.PiiConfig{KeyProvider: "vault"}); err == nil {
+		t.Fatal("不支持的密钥服务应返回错误")
+	}
+}
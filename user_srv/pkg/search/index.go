@@ -0,0 +1,263 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// 前缀和模糊匹配的最短长度, 太短的词只做精确匹配
+	minPrefixLen = 2
+	minFuzzyLen  = 4
+
+	exactScore  = 1.0
+	prefixScore = 0.6
+	fuzzyScore  = 0.4
+)
+
+// Field 被索引的字段, Boost为命中该字段时的权重
+type Field struct {
+	Name  string
+	Boost float64
+}
+
+type Hit struct {
+	Id    int64
+	Score float64
+}
+
+// Index 文档索引, 查询中的每个词都需要在文档的某个字段中精确、前缀或模糊匹配
+type Index interface {
+	// Put 写入或替换文档, values为字段名到文本的映射
+	Put(id int64, values map[string]string)
+	Delete(id int64)
+	// Search 按得分从高到低返回第offset条开始的limit条结果和匹配的总数
+	Search(query string, offset, limit int) ([]Hit, int)
+	Len() int
+}
+
+var _ Index = &Memory{}
+
+// Memory 内存中的倒排索引, 每个词记录出现在哪些文档的哪些字段中
+type Memory struct {
+	mu       sync.RWMutex
+	fields   []Field
+	postings map[string]map[int64]uint32
+	docs     map[int64]map[string]uint32
+	// terms 排好序的词, 用于前缀和模糊匹配, 词有增减时重新排序
+	terms []string
+	dirty bool
+}
+
+// NewMemory 最多支持32个字段
+func NewMemory(fields ...Field) *Memory {
+	return &Memory{
+		fields:   fields,
+		postings: make(map[string]map[int64]uint32),
+		docs:     make(map[int64]map[string]uint32),
+	}
+}
+
+func (m *Memory) Put(id int64, values map[string]string) {
+	terms := make(map[string]uint32)
+	for n, f := range m.fields {
+		for _, t := range tokenize(values[f.Name], true) {
+			terms[t] |= 1 << n
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	if len(terms) == 0 {
+		return
+	}
+	for t, mask := range terms {
+		docs, ok := m.postings[t]
+		if !ok {
+			docs = make(map[int64]uint32)
+			m.postings[t] = docs
+			m.dirty = true
+		}
+		docs[id] = mask
+	}
+	m.docs[id] = terms
+}
+
+func (m *Memory) Delete(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+}
+
+func (m *Memory) remove(id int64) {
+	for t := range m.docs[id] {
+		docs := m.postings[t]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(m.postings, t)
+			m.dirty = true
+		}
+	}
+	delete(m.docs, id)
+}
+
+func (m *Memory) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.docs)
+}
+
+func (m *Memory) Search(query string, offset, limit int) ([]Hit, int) {
+	words := tokenize(query, false)
+	if len(words) == 0 {
+		return nil, 0
+	}
+
+	m.mu.Lock()
+	if m.dirty {
+		m.terms = m.terms[:0]
+		for t := range m.postings {
+			m.terms = append(m.terms, t)
+		}
+		sort.Strings(m.terms)
+		m.dirty = false
+	}
+	m.mu.Unlock()
+
+	m.mu.RLock()
+	var scores map[int64]float64
+	for _, w := range words {
+		matched := m.match(w)
+		if scores == nil {
+			scores = matched
+		} else {
+			for id, s := range scores {
+				if ms, ok := matched[id]; ok {
+					scores[id] = s + ms
+				} else {
+					delete(scores, id)
+				}
+			}
+		}
+		if len(scores) == 0 {
+			break
+		}
+	}
+	m.mu.RUnlock()
+
+	hits := make([]Hit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, Hit{Id: id, Score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Id < hits[j].Id
+	})
+
+	total := len(hits)
+	if offset >= total {
+		return nil, total
+	}
+	hits = hits[offset:]
+	if limit > 0 && limit < len(hits) {
+		hits = hits[:limit]
+	}
+	return hits, total
+}
+
+// match 返回匹配词w的文档和得分, 同一文档取最高的得分
+func (m *Memory) match(w string) map[int64]float64 {
+	res := make(map[int64]float64)
+	add := func(t string, score float64) {
+		for id, mask := range m.postings[t] {
+			if s := score * m.boost(mask); s > res[id] {
+				res[id] = s
+			}
+		}
+	}
+
+	add(w, exactScore)
+	n := utf8.RuneCountInString(w)
+	if n < minPrefixLen {
+		return res
+	}
+
+	start := sort.SearchStrings(m.terms, w)
+	for _, t := range m.terms[start:] {
+		if !strings.HasPrefix(t, w) {
+			break
+		}
+		if t != w {
+			add(t, prefixScore)
+		}
+	}
+	if n < minFuzzyLen {
+		return res
+	}
+
+	// 模糊匹配只考虑首字相同的词, 长词允许两处拼写错误
+	maxEdits := 1
+	if n >= 8 {
+		maxEdits = 2
+	}
+	first, size := utf8.DecodeRuneInString(w)
+	start = sort.SearchStrings(m.terms, w[:size])
+	for _, t := range m.terms[start:] {
+		if r, _ := utf8.DecodeRuneInString(t); r != first {
+			break
+		}
+		if strings.HasPrefix(t, w) {
+			continue
+		}
+		if d := utf8.RuneCountInString(t) - n; d > maxEdits || d < -maxEdits {
+			continue
+		}
+		if distance(w, t, maxEdits) <= maxEdits {
+			add(t, fuzzyScore)
+		}
+	}
+	return res
+}
+
+// boost 文档中出现该词的字段的最高权重
+func (m *Memory) boost(mask uint32) float64 {
+	var b float64
+	for n, f := range m.fields {
+		if mask&(1<<n) != 0 && f.Boost > b {
+			b = f.Boost
+		}
+	}
+	return b
+}
+
+// distance 编辑距离, 超过max时提前返回max+1
+func distance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			best = min(best, cur[j])
+		}
+		if best > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,108 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func newTestMemory() *Memory {
+	m := NewMemory(Field{Name: "name", Boost: 2}, Field{Name: "bio", Boost: 1})
+	m.Put(1, map[string]string{"name": "Alice Smith", "bio": "喜欢北京的秋天"})
+	m.Put(2, map[string]string{"name": "Alicia", "bio": "gopher"})
+	m.Put(3, map[string]string{"name": "Bob", "bio": "alice的朋友"})
+	m.Put(4, map[string]string{"name": "Christopher", "bio": "上海"})
+	return m
+}
+
+func ids(hits []Hit) []int64 {
+	res := make([]int64, 0, len(hits))
+	for _, h := range hits {
+		res = append(res, h.Id)
+	}
+	return res
+}
+
+func TestMemorySearch(t *testing.T) {
+	m := newTestMemory()
+	cases := []struct {
+		query string
+		want  []int64
+	}{
+		// 昵称中精确匹配的权重高于简介, alicia与alice相差两处, 短词不算模糊匹配
+		{"alice", []int64{1, 3}},
+		{"ali", []int64{1, 2, 3}},
+		// 拼写错误一处
+		{"alise", []int64{1, 3}},
+		// 长词允许两处拼写错误
+		{"christofer", []int64{4}},
+		{"kristopher", nil},
+		// 太短的词不做模糊匹配
+		{"bab", nil},
+		// 多个词都需要匹配
+		{"alice smith", []int64{1}},
+		{"alice gopher", nil},
+		{"alicesmith", []int64{1}},
+		{"北京", []int64{1}},
+		{"秋", []int64{1}},
+		{"", nil},
+	}
+	for _, c := range cases {
+		hits, total := m.Search(c.query, 0, 0)
+		if got := ids(hits); !slices.Equal(got, c.want) || total != len(c.want) {
+			t.Errorf("搜索%q返回%v, 总数%d, 期望%v", c.query, got, total, c.want)
+		}
+	}
+}
+
+func TestMemoryPage(t *testing.T) {
+	m := newTestMemory()
+	hits, total := m.Search("ali", 1, 1)
+	if total != 3 || !slices.Equal(ids(hits), []int64{2}) {
+		t.Fatalf("第二页返回%v, 总数%d", ids(hits), total)
+	}
+	if hits, total = m.Search("ali", 5, 1); hits != nil || total != 3 {
+		t.Fatalf("超出范围返回%v, 总数%d", ids(hits), total)
+	}
+}
+
+func TestMemoryPutDelete(t *testing.T) {
+	m := newTestMemory()
+	m.Put(2, map[string]string{"name": "Carol"})
+	if hits, _ := m.Search("alicia", 0, 0); len(hits) != 0 {
+		t.Fatalf("替换后仍然搜到旧的昵称: %v", ids(hits))
+	}
+	if hits, _ := m.Search("carol", 0, 0); !slices.Equal(ids(hits), []int64{2}) {
+		t.Fatalf("替换后搜不到新的昵称: %v", ids(hits))
+	}
+
+	m.Delete(1)
+	if hits, _ := m.Search("smith", 0, 0); len(hits) != 0 {
+		t.Fatalf("删除后仍然搜到: %v", ids(hits))
+	}
+	if m.Len() != 3 {
+		t.Fatalf("文档数为%d", m.Len())
+	}
+	// 删除后不再有文档的词也要从前缀匹配中去掉
+	if _, ok := m.postings["smith"]; ok {
+		t.Fatal("删除后词仍然在索引中")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"alice", "alise", 1, 1},
+		{"alice", "alcie", 2, 2},
+		{"alice", "bob", 2, 3},
+		{"北京市", "北京", 1, 1},
+		{"same", "same", 1, 0},
+	}
+	for _, c := range cases {
+		if got := distance(c.a, c.b, c.max); got != c.want {
+			t.Errorf("distance(%q, %q, %d) = %d, 期望%d", c.a, c.b, c.max, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxJoinWords 字段中的词不超过这个数时额外索引连起来的整词, 使xiaoming能匹配Xiao Ming和xiao.ming
+const maxJoinWords = 4
+
+// tokenize 把文本切分为小写的词. 字母和数字按非字母数字的字符切分,
+// 中日韩文字没有分隔符, 切分为每个字和相邻的两个字. join为false时不生成整词, 用于切分查询
+func tokenize(text string, join bool) []string {
+	var tokens, words []string
+	var word strings.Builder
+	var prev rune
+
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isIdeograph(r):
+			flush()
+			tokens = append(tokens, string(r))
+			if prev != 0 {
+				tokens = append(tokens, string([]rune{prev, r}))
+			}
+			prev = r
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+		prev = 0
+	}
+	flush()
+
+	tokens = append(tokens, words...)
+	if join && len(words) > 1 && len(words) <= maxJoinWords {
+		tokens = append(tokens, strings.Join(words, ""))
+	}
+	return tokens
+}
+
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -0,0 +1,28 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		text string
+		join bool
+		want []string
+	}{
+		{"Xiao Ming", true, []string{"xiao", "ming", "xiaoming"}},
+		{"xiao.ming", false, []string{"xiao", "ming"}},
+		{"a b c d e", true, []string{"a", "b", "c", "d", "e"}},
+		{"Bob_2024", true, []string{"bob", "2024", "bob2024"}},
+		{"北京市", false, []string{"北", "京", "北京", "市", "京市"}},
+		{"住在上海abc", false, []string{"住", "在", "住在", "上", "在上", "海", "上海", "abc"}},
+		{"上 海", false, []string{"上", "海"}},
+		{"  --  ", true, nil},
+	}
+	for _, c := range cases {
+		if got := tokenize(c.text, c.join); !slices.Equal(got, c.want) {
+			t.Errorf("tokenize(%q, %v) = %q, 期望%q", c.text, c.join, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Numsina/tk_users/user_srv/constant"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	logger "github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/password"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+)
+
+var (
+	ErrEmailInvalid    = errors.New("邮箱格式不正确")
+	ErrImportPassword  = errors.New("password和password_hash需要且只能提供一个")
+	ErrImportHash      = password.ErrUnknownHash
+	ErrImportDuplicate = errors.New("邮箱已存在")
+)
+
+// 导入时邮箱已存在的处理方式
+const (
+	DuplicateSkip   = "skip"
+	DuplicateUpdate = "update"
+	DuplicateFail   = "fail"
+)
+
+// 每条记录的导入结果
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+var importEmailRegexp = regexp.MustCompile("^" + constant.UserEmail + "$")
+
+type ImportOptions struct {
+	OnDuplicate string
+	// DryRun 只校验和检查重复, 不写入
+	DryRun bool
+}
+
+// ImportResult Status为空表示因为前面的记录中止了导入而没有处理
+type ImportResult struct {
+	Status string
+	Err    error
+}
+
+type UserImporter interface {
+	// Import 导入一批记录, 返回与records顺序一致的结果.
+	// on_duplicate为fail时遇到已存在的邮箱返回ErrImportDuplicate, 之后的记录不再处理
+	Import(ctx context.Context, records []domain.UserRecord, opts ImportOptions) ([]ImportResult, error)
+	// Export 分批导出ctx所属租户的所有用户, withHash为false时不导出密码哈希
+	Export(ctx context.Context, batch int, withHash bool, fn func(records []domain.UserRecord) error) error
+}
+
+var _ UserImporter = &userImporter{}
+
+// userImporter 与注册使用相同的校验规则, 已有的密码哈希原样保存, 登录时按当前配置升级
+type userImporter struct {
+	d      dao.UserI
+	svc    *userSvc
+	logger *logger.Logger
+}
+
+func NewUserImporter(d dao.UserI, policy *password.Policies, hasher *password.Hasher,
+	breach password.BreachChecker, logger *logger.Logger) UserImporter {
+	return &userImporter{
+		d: d,
+		svc: &userSvc{
+			d:      d,
+			policy: policy,
+			hasher: hasher,
+			breach: breach,
+			logger: logger,
+		},
+		logger: logger,
+	}
+}
+
+func (i *userImporter) Import(ctx context.Context, records []domain.UserRecord, opts ImportOptions) ([]ImportResult, error) {
+	results := make([]ImportResult, len(records))
+	users := make([]dao.User, len(records))
+	var emails []string
+	for n, r := range records {
+		ue, err := i.prepare(ctx, r)
+		if err != nil {
+			results[n] = ImportResult{Status: ImportFailed, Err: err}
+			continue
+		}
+		users[n] = ue
+		emails = append(emails, ue.Email)
+	}
+	if len(emails) == 0 {
+		return results, nil
+	}
+
+	existing, err := i.d.FindIdsByEmails(ctx, emails)
+	if err != nil {
+		return nil, err
+	}
+
+	// 文件中重复出现的邮箱, 第一次出现时创建, 之后按已存在处理. 邮箱不区分大小写
+	var creates, updates []int
+	seen := make(map[string]struct{}, len(emails))
+	for n := range records {
+		if results[n].Status != "" {
+			continue
+		}
+		key := pii.Normalize(users[n].Email)
+		_, dup := seen[key]
+		if _, ok := existing[key]; !ok && !dup {
+			seen[key] = struct{}{}
+			creates = append(creates, n)
+			continue
+		}
+
+		switch opts.OnDuplicate {
+		case DuplicateUpdate:
+			updates = append(updates, n)
+		case DuplicateFail:
+			results[n] = ImportResult{Status: ImportFailed, Err: ErrImportDuplicate}
+			return i.abort(ctx, results, users, creates, opts, n)
+		default:
+			results[n] = ImportResult{Status: ImportSkipped, Err: ErrImportDuplicate}
+		}
+	}
+
+	if err = i.create(ctx, results, users, creates, opts, existing); err != nil {
+		return nil, err
+	}
+	i.update(ctx, results, users, updates, opts, existing)
+	return results, nil
+}
+
+// abort 遇到重复邮箱中止时, 仍然导入之前已经确认可以创建的记录
+func (i *userImporter) abort(ctx context.Context, results []ImportResult, users []dao.User,
+	creates []int, opts ImportOptions, at int) ([]ImportResult, error) {
+	if err := i.create(ctx, results, users, creates, opts, map[string]int64{}); err != nil {
+		return nil, err
+	}
+	for n := at + 1; n < len(results); n++ {
+		results[n] = ImportResult{}
+	}
+	return results, ErrImportDuplicate
+}
+
+func (i *userImporter) create(ctx context.Context, results []ImportResult, users []dao.User,
+	creates []int, opts ImportOptions, ids map[string]int64) error {
+	if len(creates) == 0 {
+		return nil
+	}
+	if opts.DryRun {
+		for _, n := range creates {
+			results[n] = ImportResult{Status: ImportCreated}
+		}
+		return nil
+	}
+
+	batch := make([]dao.User, 0, len(creates))
+	for _, n := range creates {
+		batch = append(batch, users[n])
+	}
+	created, err := i.d.CreateUsers(ctx, batch)
+	if err == nil {
+		for k, n := range creates {
+			results[n] = ImportResult{Status: ImportCreated}
+			ids[pii.Normalize(users[n].Email)] = created[k]
+		}
+		return nil
+	}
+	i.logger.Sugar().Warnf("批量创建用户失败, 逐条重试, 失败原因: %v", err)
+
+	// 批量写入可能已经部分成功, 之前不存在、现在存在的邮箱就是这一批写入的
+	emails := make([]string, 0, len(creates))
+	for _, n := range creates {
+		emails = append(emails, users[n].Email)
+	}
+	found, err := i.d.FindIdsByEmails(ctx, emails)
+	if err != nil {
+		return err
+	}
+	for _, n := range creates {
+		key := pii.Normalize(users[n].Email)
+		if id, ok := found[key]; ok {
+			results[n] = ImportResult{Status: ImportCreated}
+			ids[key] = id
+			continue
+		}
+
+		id, err := i.d.CreateUser(ctx, users[n])
+		if err != nil {
+			results[n] = ImportResult{Status: ImportFailed, Err: err}
+			continue
+		}
+		results[n] = ImportResult{Status: ImportCreated}
+		ids[key] = id
+	}
+	return nil
+}
+
+func (i *userImporter) update(ctx context.Context, results []ImportResult, users []dao.User,
+	updates []int, opts ImportOptions, ids map[string]int64) {
+	for _, n := range updates {
+		id, ok := ids[pii.Normalize(users[n].Email)]
+		if !ok {
+			// 与文件中前面创建失败的记录重复
+			results[n] = ImportResult{Status: ImportFailed, Err: ErrRecordNotFound}
+			continue
+		}
+		if opts.DryRun {
+			results[n] = ImportResult{Status: ImportUpdated}
+			continue
+		}
+
+		ue := users[n]
+		ue.Id = id
+		// 不修改邮箱, 避免大小写不同的邮箱覆盖原来的写法.
+		// 也不修改密码, 导入文件中的密码可能早于用户自己修改的密码
+		ue.Email = ""
+		ue.Password = ""
+		if _, err := i.d.UpdateUserInfoByUid(ctx, ue); err != nil {
+			results[n] = ImportResult{Status: ImportFailed, Err: err}
+			continue
+		}
+		results[n] = ImportResult{Status: ImportUpdated}
+	}
+}
+
+// prepare 按注册的规则校验, 明文密码在这里生成哈希
+func (i *userImporter) prepare(ctx context.Context, r domain.UserRecord) (dao.User, error) {
+	r.Email = strings.TrimSpace(r.Email)
+	if !importEmailRegexp.MatchString(r.Email) {
+		return dao.User{}, ErrEmailInvalid
+	}
+	if (r.Password == "") == (r.PasswordHash == "") {
+		return dao.User{}, ErrImportPassword
+	}
+
+	hash := r.PasswordHash
+	if hash != "" && !i.svc.hasher.Known(hash) {
+		return dao.User{}, ErrImportHash
+	}
+	if r.Password != "" {
+		err := i.svc.checkPassword(ctx, domain.User{Email: r.Email, NickName: r.NickName, Password: r.Password})
+		if err != nil {
+			return dao.User{}, err
+		}
+		if hash, err = i.svc.hasher.Hash(r.Password); err != nil {
+			return dao.User{}, err
+		}
+	}
+
+	return dao.User{
+		Email:       r.Email,
+		Password:    hash,
+		NickName:    r.NickName,
+		Description: r.Description,
+		Avatar:      r.Avatar,
+		Address:     r.Address,
+		BirthDay:    r.BirthDay,
+	}, nil
+}
+
+func (i *userImporter) Export(ctx context.Context, batch int, withHash bool, fn func(records []domain.UserRecord) error) error {
+	return i.d.ScanTenantUsers(ctx, batch, func(users []dao.User) error {
+		records := make([]domain.UserRecord, 0, len(users))
+		for _, ue := range users {
+			r := domain.UserRecord{
+				Email:       ue.Email,
+				NickName:    ue.NickName,
+				Description: ue.Description,
+				Avatar:      ue.Avatar,
+				Address:     ue.Address,
+				BirthDay:    ue.BirthDay,
+			}
+			if withHash {
+				r.PasswordHash = ue.Password
+			}
+			records = append(records, r)
+		}
+		return fn(records)
+	})
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/password"
+)
+
+func newTestImporter(t *testing.T) (UserImporter, dao.UserI, *password.Hasher) {
+	t.Helper()
+	d, _ := newTestUserDao(t)
+	l := logger.NewLogger(logger.WithWriteFile(false))
+	hasher := password.NewHasher(config.PasswordHashConfig{Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 1})
+	breach, err := password.NewBreachChecker(config.PasswordBreachConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUserImporter(d, password.NewPolicies(config.PasswordPolicyConfig{}, nil), hasher, breach, l), d, hasher
+}
+
+func mustImport(t *testing.T, i UserImporter, records []domain.UserRecord, opts ImportOptions) []ImportResult {
+	t.Helper()
+	results, err := i.Import(context.Background(), records, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+// 大小写不同的邮箱按同一个邮箱处理, 不会在写入时才因为唯一约束失败
+func TestImportEmailCase(t *testing.T) {
+	i, d, hasher := newTestImporter(t)
+	ctx := context.Background()
+	hash, err := hasher.Hash("S3cret!pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, ctx, d, "alice@ex.com", "alice")
+
+	results := mustImport(t, i, []domain.UserRecord{
+		{Email: "Alice@Ex.com", PasswordHash: hash},
+		{Email: "ALICE@EX.COM", PasswordHash: hash},
+		{Email: "BOB@ex.com", PasswordHash: hash},
+		{Email: "bob@ex.com", PasswordHash: hash},
+	}, ImportOptions{OnDuplicate: DuplicateSkip})
+
+	want := []string{ImportSkipped, ImportSkipped, ImportCreated, ImportSkipped}
+	for n, res := range results {
+		if res.Status != want[n] {
+			t.Errorf("第%d条的结果为%s(%v), 期望%s", n, res.Status, res.Err, want[n])
+		}
+		if res.Status == ImportSkipped && !errors.Is(res.Err, ErrImportDuplicate) {
+			t.Errorf("第%d条应返回ErrImportDuplicate, 实际: %v", n, res.Err)
+		}
+	}
+
+	ids, err := d.FindIdsByEmails(ctx, []string{"ALICE@ex.com", "bob@EX.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids["alice@ex.com"] == 0 || ids["bob@ex.com"] == 0 {
+		t.Fatalf("按规范化后的邮箱查找的结果为%v", ids)
+	}
+}
+
+func TestImportUpdateKeepsPassword(t *testing.T) {
+	i, d, hasher := newTestImporter(t)
+	ctx := context.Background()
+	oldHash, err := hasher.Hash("Old#Passw0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, err := d.CreateUser(ctx, dao.User{Email: "alice@ex.com", Password: oldHash, NickName: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := mustImport(t, i, []domain.UserRecord{
+		{Email: "ALICE@ex.com", Password: "New#Passw0rd", NickName: "wonderland"},
+	}, ImportOptions{OnDuplicate: DuplicateUpdate})
+	if results[0].Status != ImportUpdated {
+		t.Fatalf("导入结果为%s(%v)", results[0].Status, results[0].Err)
+	}
+
+	ue, err := d.FindUserById(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ue.NickName != "wonderland" || ue.Email != "alice@ex.com" {
+		t.Fatalf("资料没有按导入文件修改, 或修改了邮箱: %+v", ue)
+	}
+	if pwd, err := d.FindPassword(ctx, uid); err != nil || pwd != oldHash {
+		t.Fatalf("导入覆盖了已存在用户的密码: %v", err)
+	}
+}
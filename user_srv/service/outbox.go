@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/events"
+	logger "github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/broker"
+)
+
+const (
+	outboxDefaultTopic     = "tk_users.user_events"
+	outboxDefaultInterval  = time.Second
+	outboxDefaultBatch     = 100
+	outboxDefaultRetention = time.Hour * 24 * 7
+	outboxPurgeInterval    = time.Hour
+)
+
+// OutboxRelay 把outbox中的领域事件投递到消息队列. 事件在投递成功后才标记为已投递,
+// 标记失败时会重复投递, 消费方按event-id去重
+type OutboxRelay interface {
+	// Run 定期投递直到ctx结束
+	Run(ctx context.Context)
+	// RelayOnce 投递所有库中当前未投递的事件, 返回投递的事件数
+	RelayOnce(ctx context.Context) (int, error)
+}
+
+var _ OutboxRelay = &outboxRelay{}
+
+type outboxRelay struct {
+	outboxes  []dao.OutboxI
+	broker    broker.Broker
+	topic     string
+	interval  time.Duration
+	batch     int
+	retention time.Duration
+	logger    *logger.Logger
+}
+
+func NewOutboxRelay(outboxes []dao.OutboxI, b broker.Broker, cfg config.OutboxConfig, logger *logger.Logger) OutboxRelay {
+	r := &outboxRelay{
+		outboxes:  outboxes,
+		broker:    b,
+		topic:     cfg.Topic,
+		interval:  time.Duration(cfg.Interval) * time.Millisecond,
+		batch:     cfg.Batch,
+		retention: time.Duration(cfg.Retention) * time.Hour,
+		logger:    logger,
+	}
+	if r.topic == "" {
+		r.topic = outboxDefaultTopic
+	}
+	if r.interval <= 0 {
+		r.interval = outboxDefaultInterval
+	}
+	if r.batch <= 0 {
+		r.batch = outboxDefaultBatch
+	}
+	if r.retention <= 0 {
+		r.retention = outboxDefaultRetention
+	}
+	return r
+}
+
+func (r *outboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := r.RelayOnce(ctx); err != nil {
+			r.logger.Sugar().Warnf("投递领域事件失败, 失败原因: %v", err)
+		}
+
+		if time.Since(lastPurge) >= outboxPurgeInterval {
+			lastPurge = time.Now()
+			r.purge(ctx)
+		}
+	}
+}
+
+func (r *outboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	var total int
+	for _, o := range r.outboxes {
+		for {
+			n, err := o.Relay(ctx, r.batch, func(evts []dao.OutboxEvent) error {
+				return r.broker.Publish(ctx, r.messages(evts)...)
+			})
+			total += n
+			if err != nil {
+				return total, err
+			}
+			if n < r.batch {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+func (r *outboxRelay) messages(evts []dao.OutboxEvent) []broker.Message {
+	msgs := make([]broker.Message, 0, len(evts))
+	for _, e := range evts {
+		msgs = append(msgs, broker.Message{
+			Topic: r.topic,
+			// 同一用户的事件进入同一分区, 保证按顺序消费
+			Key:   []byte(strconv.FormatInt(e.AggregateId, 10)),
+			Value: e.Payload,
+			Headers: map[string]string{
+				"event-id":       e.EventId,
+				"event-type":     e.EventType,
+				"schema-version": strconv.Itoa(events.SchemaVersion),
+				"content-type":   events.ContentType,
+				"tenant-id":      e.TenantId,
+			},
+		})
+	}
+	return msgs
+}
+
+// purge 删除超过保留时间的已投递事件
+func (r *outboxRelay) purge(ctx context.Context) {
+	before := time.Now().Add(-r.retention).UnixMilli()
+	for _, o := range r.outboxes {
+		n, err := o.Purge(ctx, before)
+		if err != nil {
+			r.logger.Sugar().Warnf("清理已投递的领域事件失败, 失败原因: %v", err)
+			continue
+		}
+		if n > 0 {
+			r.logger.Sugar().Infof("清理已投递的领域事件, 清理条数: %d", n)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Numsina/tk_users/user_srv/dao"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	logger "github.com/Numsina/tk_users/user_srv/logger"
+)
+
+var (
+	ErrInsufficientPoints = dao.ErrInsufficientPoints
+	ErrBizRefConflict     = dao.ErrBizRefConflict
+	ErrPointsInvalid      = errors.New("积分参数无效")
+)
+
+const (
+	pointsExpiringWindow  = time.Hour * 24 * 30
+	pointsDefaultPageSize = 20
+	pointsMaxPageSize     = 100
+	pointsExpireBatch     = 500
+)
+
+type PointsService interface {
+	Credit(ctx context.Context, t domain.PointsTx) (domain.PointsTx, error)
+	Debit(ctx context.Context, t domain.PointsTx) (domain.PointsTx, error)
+	Balance(ctx context.Context, uid int64) (domain.PointsBalance, error)
+	// History 返回一页流水以及下一页的游标, 游标为0表示没有更多数据
+	History(ctx context.Context, uid int64, cursor int64, size int) ([]domain.PointsTx, int64, error)
+	// ExpireDue 清理所有已过期的积分批次
+	ExpireDue(ctx context.Context) error
+}
+
+var _ PointsService = &pointsSvc{}
+
+type pointsSvc struct {
+	d      dao.PointsI
+	logger *logger.Logger
+}
+
+func NewPointsSvc(d dao.PointsI, logger *logger.Logger) PointsService {
+	return &pointsSvc{
+		d:      d,
+		logger: logger,
+	}
+}
+
+func (p *pointsSvc) Credit(ctx context.Context, t domain.PointsTx) (domain.PointsTx, error) {
+	if err := p.validate(t); err != nil {
+		return domain.PointsTx{}, err
+	}
+
+	if t.ExpireAt != 0 && t.ExpireAt <= time.Now().UnixMilli() {
+		return domain.PointsTx{}, ErrPointsInvalid
+	}
+
+	res, err := p.d.Credit(ctx, toPointsTxEntity(t))
+	if err != nil {
+		return domain.PointsTx{}, err
+	}
+	return toPointsTxDomain(res), nil
+}
+
+func (p *pointsSvc) Debit(ctx context.Context, t domain.PointsTx) (domain.PointsTx, error) {
+	if err := p.validate(t); err != nil {
+		return domain.PointsTx{}, err
+	}
+
+	res, err := p.d.Debit(ctx, toPointsTxEntity(t))
+	if err != nil {
+		return domain.PointsTx{}, err
+	}
+	return toPointsTxDomain(res), nil
+}
+
+func (p *pointsSvc) Balance(ctx context.Context, uid int64) (domain.PointsBalance, error) {
+	before := time.Now().Add(pointsExpiringWindow).UnixMilli()
+	balance, expiring, err := p.d.Balance(ctx, uid, before)
+	if err != nil {
+		return domain.PointsBalance{}, err
+	}
+	return domain.PointsBalance{
+		Balance:  balance,
+		Expiring: expiring,
+	}, nil
+}
+
+func (p *pointsSvc) History(ctx context.Context, uid int64, cursor int64, size int) ([]domain.PointsTx, int64, error) {
+	if size <= 0 {
+		size = pointsDefaultPageSize
+	}
+	size = min(size, pointsMaxPageSize)
+
+	txs, err := p.d.ListTransactions(ctx, uid, cursor, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]domain.PointsTx, 0, len(txs))
+	for _, t := range txs {
+		res = append(res, toPointsTxDomain(t))
+	}
+
+	var next int64
+	if len(txs) == size {
+		next = txs[len(txs)-1].Id
+	}
+	return res, next, nil
+}
+
+func (p *pointsSvc) ExpireDue(ctx context.Context) error {
+	for {
+		n, err := p.d.ExpireDue(ctx, pointsExpireBatch)
+		if err != nil {
+			return err
+		}
+		if n < pointsExpireBatch {
+			return nil
+		}
+	}
+}
+
+func (p *pointsSvc) validate(t domain.PointsTx) error {
+	if t.UserId <= 0 || t.Amount <= 0 || t.BizType == "" || t.BizRef == "" {
+		return ErrPointsInvalid
+	}
+	return nil
+}
+
+func toPointsTxEntity(t domain.PointsTx) dao.PointsTransaction {
+	return dao.PointsTransaction{
+		UserId:   t.UserId,
+		BizType:  t.BizType,
+		BizRef:   t.BizRef,
+		Amount:   t.Amount,
+		Remark:   t.Remark,
+		ExpireAt: t.ExpireAt,
+	}
+}
+
+func toPointsTxDomain(t dao.PointsTransaction) domain.PointsTx {
+	return domain.PointsTx{
+		Id:       t.Id,
+		UserId:   t.UserId,
+		Kind:     t.Kind,
+		BizType:  t.BizType,
+		BizRef:   t.BizRef,
+		Amount:   t.Amount,
+		Balance:  t.Balance,
+		Remark:   t.Remark,
+		ExpireAt: t.ExpireAt,
+		CreateAt: t.CreateAt,
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Numsina/tk_users/user_srv/cache"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	logger "github.com/Numsina/tk_users/user_srv/logger"
+)
+
+var (
+	ErrVersionConflict        = dao.ErrVersionConflict
+	ErrPreferenceKeyUnknown   = domain.ErrPreferenceKeyUnknown
+	ErrPreferenceValueInvalid = domain.ErrPreferenceValueInvalid
+)
+
+type PreferenceService interface {
+	Get(ctx context.Context, uid int64, key string) (domain.Preference, error)
+	// BatchGet keys为空时返回所有已声明的偏好
+	BatchGet(ctx context.Context, uid int64, keys []string) ([]domain.Preference, error)
+	Set(ctx context.Context, uid int64, pref domain.Preference) (domain.Preference, error)
+}
+
+var _ PreferenceService = &preferenceSvc{}
+
+type preferenceSvc struct {
+	d      dao.PreferenceI
+	cache  cache.PreferenceCache
+	logger *logger.Logger
+}
+
+func NewPreferenceSvc(d dao.PreferenceI, cache cache.PreferenceCache, logger *logger.Logger) PreferenceService {
+	return &preferenceSvc{
+		d:      d,
+		cache:  cache,
+		logger: logger,
+	}
+}
+
+func (p *preferenceSvc) Get(ctx context.Context, uid int64, key string) (domain.Preference, error) {
+	prefs, err := p.BatchGet(ctx, uid, []string{key})
+	if err != nil {
+		return domain.Preference{}, err
+	}
+	return prefs[0], nil
+}
+
+func (p *preferenceSvc) BatchGet(ctx context.Context, uid int64, keys []string) ([]domain.Preference, error) {
+	schemas := domain.PreferenceSchemas
+	if len(keys) > 0 {
+		schemas = make([]domain.PreferenceSchema, 0, len(keys))
+		for _, key := range keys {
+			s, ok := domain.FindPreferenceSchema(key)
+			if !ok {
+				return nil, ErrPreferenceKeyUnknown
+			}
+			schemas = append(schemas, s)
+		}
+	}
+
+	stored, err := p.load(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]domain.Preference, 0, len(schemas))
+	for _, s := range schemas {
+		pref, ok := stored[s.Key]
+		if !ok {
+			pref = s.DefaultPreference()
+		}
+		res = append(res, pref)
+	}
+	return res, nil
+}
+
+func (p *preferenceSvc) Set(ctx context.Context, uid int64, pref domain.Preference) (domain.Preference, error) {
+	s, ok := domain.FindPreferenceSchema(pref.Key)
+	if !ok {
+		return domain.Preference{}, ErrPreferenceKeyUnknown
+	}
+
+	if err := s.Validate(pref.Value); err != nil {
+		return domain.Preference{}, err
+	}
+
+	res, err := p.d.SavePreference(ctx, dao.Preference{
+		UserId: uid,
+		Key:    pref.Key,
+		Value:  pref.Value,
+	}, pref.Version)
+	if err != nil {
+		return domain.Preference{}, err
+	}
+
+	if err = p.cache.Del(ctx, uid); err != nil {
+		p.logger.Sugar().Warnf("删除偏好缓存失败, 用户: %d, 失败原因: %s", uid, err)
+	}
+
+	return domain.Preference{
+		Key:      res.Key,
+		Value:    res.Value,
+		Type:     s.Type,
+		Version:  res.Version,
+		UpdateAt: res.UpdateAt,
+	}, nil
+}
+
+// load 读取用户已设置过的偏好, 优先从缓存读取
+func (p *preferenceSvc) load(ctx context.Context, uid int64) (map[string]domain.Preference, error) {
+	prefs, err := p.cache.Get(ctx, uid)
+	if err != nil {
+		if err != cache.ErrKeyNotExist {
+			p.logger.Sugar().Warnf("读取偏好缓存失败, 用户: %d, 失败原因: %s", uid, err)
+		}
+
+		rows, err := p.d.FindPreferences(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+
+		prefs = make([]domain.Preference, 0, len(rows))
+		for _, row := range rows {
+			s, ok := domain.FindPreferenceSchema(row.Key)
+			if !ok {
+				// 已下线的偏好不再返回
+				continue
+			}
+			prefs = append(prefs, domain.Preference{
+				Key:      row.Key,
+				Value:    row.Value,
+				Type:     s.Type,
+				Version:  row.Version,
+				UpdateAt: row.UpdateAt,
+			})
+		}
+
+		if err = p.cache.Set(ctx, uid, prefs); err != nil {
+			p.logger.Sugar().Warnf("写入偏好缓存失败, 用户: %d, 失败原因: %s", uid, err)
+		}
+	}
+
+	res := make(map[string]domain.Preference, len(prefs))
+	for _, pref := range prefs {
+		res[pref.Key] = pref
+	}
+	return res, nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	"github.com/Numsina/tk_users/user_srv/events"
+	logger "github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/search"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+const (
+	searchDefaultInterval = time.Second
+	searchDefaultBatch    = 500
+)
+
+// SearchMaxPageSize 搜索每页最多返回的用户数, 也是不指定时的默认值
+const SearchMaxPageSize = 100
+
+// SearchMaxOffset 搜索结果最多翻到的位置, 更靠后的结果需要换用更精确的查询
+const SearchMaxOffset = 10000
+
+var ErrSearchUnavailable = errors.New("用户搜索索引尚未就绪")
+
+// 搜索的字段和权重, 邮箱只索引@之前的部分
+var searchFields = []search.Field{
+	{Name: "nick_name", Boost: 3},
+	{Name: "email", Boost: 2},
+	{Name: "address", Boost: 1.5},
+	{Name: "description", Boost: 1},
+}
+
+// UserSearch 按昵称、邮箱前缀、简介和地址模糊搜索用户, 供客服等内部工具使用.
+// 每个租户单独一个索引, 只能搜到ctx所属租户的用户
+type UserSearch interface {
+	// Search 返回按相关度排序的一页用户和匹配的总数
+	Search(ctx context.Context, query string, offset, limit int) ([]domain.User, int, error)
+	// Rebuild 从分表全量重建索引, 返回索引的用户数
+	Rebuild(ctx context.Context) (int, error)
+	// Run 先全量构建索引, 然后跟随outbox中的用户事件更新, 直到ctx结束
+	Run(ctx context.Context)
+}
+
+var _ UserSearch = &userSearch{}
+
+type userSearch struct {
+	// d 不经过缓存, 其他实例的写入可能还没有清理本地缓存
+	d        dao.UserI
+	outboxes []dao.OutboxI
+	// indexes 租户到索引的映射, 只在Run所在的协程中整体替换, 不原地修改
+	indexes atomic.Pointer[map[string]*search.Memory]
+	// cursors 各个outbox已经应用到索引的最后一个事件
+	cursors  []int64
+	interval time.Duration
+	batch    int
+	rebuild  time.Duration
+	logger   *logger.Logger
+}
+
+func NewUserSearch(d dao.UserI, outboxes []dao.OutboxI, cfg config.SearchConfig, logger *logger.Logger) UserSearch {
+	s := &userSearch{
+		d:        d,
+		outboxes: outboxes,
+		cursors:  make([]int64, len(outboxes)),
+		interval: time.Duration(cfg.Interval) * time.Millisecond,
+		batch:    cfg.Batch,
+		rebuild:  time.Duration(cfg.RebuildInterval) * time.Hour,
+		logger:   logger,
+	}
+	if s.interval <= 0 {
+		s.interval = searchDefaultInterval
+	}
+	if s.batch <= 0 {
+		s.batch = searchDefaultBatch
+	}
+	return s
+}
+
+func (s *userSearch) Search(ctx context.Context, query string, offset, limit int) ([]domain.User, int, error) {
+	indexes := s.indexes.Load()
+	if indexes == nil {
+		return nil, 0, ErrSearchUnavailable
+	}
+	idx, ok := (*indexes)[tenant.FromContext(ctx)]
+	if !ok {
+		return nil, 0, nil
+	}
+	if limit <= 0 || limit > SearchMaxPageSize {
+		limit = SearchMaxPageSize
+	}
+
+	hits, total := idx.Search(query, offset, limit)
+	uids := make([]int64, 0, len(hits))
+	for _, hit := range hits {
+		uids = append(uids, hit.Id)
+	}
+	// 索引中的数据可能稍有延迟, 以分表中的数据为准
+	users, err := s.d.FindUsersByIds(ctx, uids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]domain.User, 0, len(hits))
+	for _, hit := range hits {
+		user, ok := users[hit.Id]
+		if !ok {
+			// 已经注销、索引还没有跟随到的用户不计入总数
+			total--
+			continue
+		}
+		res = append(res, domain.User{
+			Id:          user.Id,
+			Email:       user.Email,
+			NickName:    user.NickName,
+			BirthDay:    user.BirthDay,
+			Address:     user.Address,
+			Description: user.Description,
+			Avatar:      user.Avatar,
+			Version:     user.Version,
+			UpdateAt:    user.UpdateAt,
+		})
+	}
+	return res, total, nil
+}
+
+// Rebuild 先记下各个outbox的位置再读取分表, 构建期间的写入之后从记下的位置重放.
+// 与Run在同一个协程中调用
+func (s *userSearch) Rebuild(ctx context.Context) (int, error) {
+	cursors := make([]int64, len(s.outboxes))
+	for n, o := range s.outboxes {
+		id, err := o.LastId(ctx)
+		if err != nil {
+			return 0, err
+		}
+		cursors[n] = id
+	}
+
+	indexes := make(map[string]*search.Memory)
+	var total int
+	err := s.d.ScanUsers(ctx, s.batch, func(users []dao.User) error {
+		for _, ue := range users {
+			idx, ok := indexes[ue.TenantId]
+			if !ok {
+				idx = search.NewMemory(searchFields...)
+				indexes[ue.TenantId] = idx
+			}
+			idx.Put(ue.Id, searchValues(ue))
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.indexes.Store(&indexes)
+	s.cursors = cursors
+	return total, nil
+}
+
+func (s *userSearch) Run(ctx context.Context) {
+	for {
+		n, err := s.Rebuild(ctx)
+		if err == nil {
+			s.logger.Sugar().Infof("构建用户搜索索引完成, 用户数: %d", n)
+			break
+		}
+		s.logger.Sugar().Warnf("构建用户搜索索引失败, 失败原因: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.interval * 10):
+		}
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	lastRebuild := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// 定期重建, 修复跟随事件时遗漏的变化, 例如事务提交顺序与事件id顺序不一致
+		if s.rebuild > 0 && time.Since(lastRebuild) >= s.rebuild {
+			n, err := s.Rebuild(ctx)
+			if err != nil {
+				s.logger.Sugar().Warnf("重建用户搜索索引失败, 失败原因: %v", err)
+			} else {
+				s.logger.Sugar().Infof("重建用户搜索索引完成, 用户数: %d", n)
+				lastRebuild = time.Now()
+			}
+		}
+
+		for n := range s.outboxes {
+			if err := s.follow(ctx, n); err != nil {
+				s.logger.Sugar().Warnf("更新用户搜索索引失败, 失败原因: %v", err)
+			}
+		}
+	}
+}
+
+// follow 把第n个outbox中新的事件应用到索引, 重新读取事件涉及的用户
+func (s *userSearch) follow(ctx context.Context, n int) error {
+	for {
+		evts, err := s.outboxes[n].After(ctx, s.cursors[n], s.batch)
+		if err != nil || len(evts) == 0 {
+			return err
+		}
+
+		seen := make(map[int64]struct{}, len(evts))
+		for _, e := range evts {
+			if _, ok := seen[e.AggregateId]; ok {
+				continue
+			}
+			seen[e.AggregateId] = struct{}{}
+			idx := s.tenantIndex(e.TenantId)
+			if e.EventType == events.TypeUserDeleted {
+				idx.Delete(e.AggregateId)
+				continue
+			}
+
+			ue, err := s.d.FindUserById(tenant.WithTenant(ctx, e.TenantId), e.AggregateId)
+			if errors.Is(err, ErrRecordNotFound) {
+				idx.Delete(e.AggregateId)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			idx.Put(ue.Id, searchValues(ue))
+		}
+		s.cursors[n] = evts[len(evts)-1].Id
+	}
+}
+
+// tenantIndex 返回租户的索引, 不存在时替换为加入了该租户的新映射
+func (s *userSearch) tenantIndex(id string) *search.Memory {
+	indexes := *s.indexes.Load()
+	if idx, ok := indexes[id]; ok {
+		return idx
+	}
+
+	next := make(map[string]*search.Memory, len(indexes)+1)
+	for k, v := range indexes {
+		next[k] = v
+	}
+	next[id] = search.NewMemory(searchFields...)
+	s.indexes.Store(&next)
+	return next[id]
+}
+
+func searchValues(ue dao.User) map[string]string {
+	local, _, _ := strings.Cut(ue.Email, "@")
+	return map[string]string{
+		"nick_name":   ue.NickName,
+		"email":       local,
+		"address":     ue.Address,
+		"description": ue.Description,
+	}
+}
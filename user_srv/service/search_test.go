@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/idgen"
+	"github.com/Numsina/tk_users/user_srv/pkg/pii"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
+)
+
+// newTestUserDao 在临时目录的sqlite上按两张分表创建用户dao和outbox
+func newTestUserDao(t *testing.T) (dao.UserI, dao.OutboxI) {
+	t.Helper()
+	l := logger.NewLogger(logger.WithWriteFile(false))
+	path := filepath.Join(t.TempDir(), "tk_user_srv.db")
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on&_txlock=immediate", path)), &gorm.Config{
+		Logger:                 gormlogger.Default.LogMode(gormlogger.Silent),
+		SkipDefaultTransaction: true,
+		TranslateError:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := dao.NewMigrator(db, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	s := dao.NewSharding([]*gorm.DB{db}, 2, 0)
+	if err = s.EnsureTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := idgen.NewSnowflake(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := pii.New(config.PiiConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dao.NewUserDao(s, ids, c, l), dao.NewOutboxDao(db, l)
+}
+
+func newTestSearch(t *testing.T) (*userSearch, dao.UserI) {
+	t.Helper()
+	d, o := newTestUserDao(t)
+	l := logger.NewLogger(logger.WithWriteFile(false))
+	return NewUserSearch(d, []dao.OutboxI{o}, config.SearchConfig{Batch: 2}, l).(*userSearch), d
+}
+
+func mustCreate(t *testing.T, ctx context.Context, d dao.UserI, email, nick string) int64 {
+	t.Helper()
+	uid, err := d.CreateUser(ctx, dao.User{Email: email, Password: "hash", NickName: nick})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uid
+}
+
+// searchIds 返回搜索到的用户id和总数
+func searchIds(t *testing.T, s *userSearch, ctx context.Context, query string) ([]int64, int) {
+	t.Helper()
+	users, total, err := s.Search(ctx, query, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []int64
+	for _, ue := range users {
+		res = append(res, ue.Id)
+	}
+	return res, total
+}
+
+func TestSearchRebuild(t *testing.T) {
+	s, d := newTestSearch(t)
+	acme := tenant.WithTenant(context.Background(), "acme")
+	other := tenant.WithTenant(context.Background(), "other")
+
+	if _, _, err := s.Search(acme, "alice", 0, 0); err != ErrSearchUnavailable {
+		t.Fatalf("构建之前应返回ErrSearchUnavailable, 实际: %v", err)
+	}
+
+	alice := mustCreate(t, acme, d, "alice@ex.com", "Alice")
+	mustCreate(t, acme, d, "bob@ex.com", "Bob")
+	mustCreate(t, other, d, "alice@ex.com", "Alice")
+
+	n, err := s.Rebuild(acme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("索引了%d个用户", n)
+	}
+	// 每个租户只能搜到自己的用户, 邮箱只索引@之前的部分
+	if got, total := searchIds(t, s, acme, "alise"); len(got) != 1 || got[0] != alice || total != 1 {
+		t.Fatalf("搜索到%v, 总数%d", got, total)
+	}
+	if got, _ := searchIds(t, s, acme, "ex"); len(got) != 0 {
+		t.Fatalf("搜索到了邮箱域名: %v", got)
+	}
+	if got, _ := searchIds(t, s, tenant.WithTenant(context.Background(), "none"), "alice"); len(got) != 0 {
+		t.Fatalf("没有用户的租户搜索到%v", got)
+	}
+}
+
+func TestSearchFollow(t *testing.T) {
+	s, d := newTestSearch(t)
+	acme := tenant.WithTenant(context.Background(), "acme")
+
+	alice := mustCreate(t, acme, d, "alice@ex.com", "Alice")
+	if _, err := s.Rebuild(acme); err != nil {
+		t.Fatal(err)
+	}
+
+	// 构建之后的注册、修改和注销都从outbox跟随
+	carol := mustCreate(t, acme, d, "carol@ex.com", "Carol")
+	dave := mustCreate(t, acme, d, "dave@ex.com", "Dave")
+	if _, err := d.UpdateUserInfoByUid(acme, dao.User{Id: alice, NickName: "Alicia"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteUser(acme, dave); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.follow(acme, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := searchIds(t, s, acme, "carol"); len(got) != 1 || got[0] != carol {
+		t.Fatalf("没有跟随到注册: %v", got)
+	}
+	if got, _ := searchIds(t, s, acme, "alicia"); len(got) != 1 || got[0] != alice {
+		t.Fatalf("没有跟随到修改: %v", got)
+	}
+	if idx := (*s.indexes.Load())["acme"]; idx.Len() != 2 {
+		t.Fatalf("没有跟随到注销, 索引中有%d个用户", idx.Len())
+	}
+
+	// 再次跟随时没有新的事件
+	cursor := s.cursors[0]
+	if err := s.follow(acme, 0); err != nil || s.cursors[0] != cursor {
+		t.Fatalf("重复跟随了事件: %d, %d, %v", cursor, s.cursors[0], err)
+	}
+}
+
+// 索引还没有跟随到注销时, 已注销的用户不返回也不计入总数
+func TestSearchSkipsDeleted(t *testing.T) {
+	s, d := newTestSearch(t)
+	acme := tenant.WithTenant(context.Background(), "acme")
+
+	var uids []int64
+	for i := 0; i < 3; i++ {
+		uids = append(uids, mustCreate(t, acme, d, fmt.Sprintf("user%d@ex.com", i), "Ming"))
+	}
+	if _, err := s.Rebuild(acme); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteUser(acme, uids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, total := searchIds(t, s, acme, "ming")
+	if len(got) != 2 || total != 2 {
+		t.Fatalf("搜索到%v, 总数%d", got, total)
+	}
+	for _, uid := range got {
+		if uid == uids[1] {
+			t.Fatal("搜索到了已注销的用户")
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Numsina/tk_users/user_srv/cache"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	"github.com/Numsina/tk_users/user_srv/pkg/eventbus"
+	"github.com/Numsina/tk_users/user_srv/pkg/mailer"
+)
+
+const (
+	welcomeSubject = "欢迎注册"
+	welcomeBody    = "%s, 你好:\n\n欢迎注册, 你的账号%s已经可以使用了."
+)
+
+// SubscribeWelcomeMail 注册成功后异步发送欢迎邮件
+func SubscribeWelcomeMail(bus *eventbus.Bus, m mailer.Mailer) {
+	eventbus.Subscribe(bus, "welcome_mail", func(ctx context.Context, e domain.UserRegistered) error {
+		name := e.NickName
+		if name == "" {
+			name = e.Email
+		}
+		return m.Send(ctx, e.Email, welcomeSubject, fmt.Sprintf(welcomeBody, name, e.Email))
+	}, eventbus.Async(0), eventbus.Retry(3, time.Second))
+}
+
+// SubscribeAudit 异步记录注册、修改资料、修改密码和注销的审计记录
+func SubscribeAudit(bus *eventbus.Bus, d dao.AuditI) {
+	opts := []eventbus.Option{eventbus.Async(0), eventbus.Retry(3, time.Millisecond*200)}
+	eventbus.Subscribe(bus, "audit", func(ctx context.Context, e domain.UserRegistered) error {
+		// 审计记录只保存用户id, 不保存邮箱等用户信息
+		return d.AddAuditLog(ctx, dao.AuditLog{UserId: e.Id, Action: "register", CreateAt: e.At})
+	}, opts...)
+	eventbus.Subscribe(bus, "audit", func(ctx context.Context, e domain.UserProfileUpdated) error {
+		return d.AddAuditLog(ctx, dao.AuditLog{
+			UserId:   e.User.Id,
+			Action:   "update_profile",
+			Detail:   fmt.Sprintf("version=%d", e.User.Version),
+			CreateAt: e.At,
+		})
+	}, opts...)
+	eventbus.Subscribe(bus, "audit", func(ctx context.Context, e domain.UserPasswordChanged) error {
+		return d.AddAuditLog(ctx, dao.AuditLog{UserId: e.Id, Action: "change_password", CreateAt: e.At})
+	}, opts...)
+	eventbus.Subscribe(bus, "audit", func(ctx context.Context, e domain.UserDeleted) error {
+		return d.AddAuditLog(ctx, dao.AuditLog{UserId: e.Id, Action: "delete", CreateAt: e.At})
+	}, opts...)
+}
+
+// SubscribePreferenceInvalidation 注销后同步删除用户偏好的缓存, 注销请求返回后不会再读到缓存中的偏好.
+// 重试在注销请求中进行, 最多增加150ms, 请求取消时停止重试
+func SubscribePreferenceInvalidation(bus *eventbus.Bus, pc cache.PreferenceCache) {
+	eventbus.Subscribe(bus, "preference_cache", func(ctx context.Context, e domain.UserDeleted) error {
+		return pc.Del(ctx, e.Id)
+	}, eventbus.Retry(2, time.Millisecond*50))
+}
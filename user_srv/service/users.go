@@ -2,50 +2,74 @@ package service
 
 import (
 	"context"
-
-	"golang.org/x/crypto/bcrypt"
+	"errors"
+	"time"
 
 	"github.com/Numsina/tk_users/user_srv/dao"
 	domain "github.com/Numsina/tk_users/user_srv/domian"
 	logger "github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/eventbus"
+	"github.com/Numsina/tk_users/user_srv/pkg/password"
+	"github.com/Numsina/tk_users/user_srv/pkg/tenant"
 )
 
 var (
 	ErrUniqueConflict = dao.ErrUniqueConflict
 	ErrRecordNotFound = dao.ErrRecordNotFound
+	ErrPasswordWrong  = errors.New("密码错误")
+	ErrBreached       = password.ErrBreached
 )
 
 type UserService interface {
-	SignUp(ctx context.Context, user domain.User) (int32, error)
+	SignUp(ctx context.Context, user domain.User) (int64, error)
 	Login(ctx context.Context, user domain.User) (domain.User, error)
-	Delele(ctx context.Context, uid int32) error
-	ModifyUserInfoById(ctx context.Context, user domain.User) (domain.User, error)
+	Delele(ctx context.Context, uid int64) error
+	// ModifyUserInfoById 只修改user中非空的字段; 指定fields时只修改这些字段, 用于清空字段.
+	// 不修改密码, 修改密码使用ChangePassword
+	ModifyUserInfoById(ctx context.Context, user domain.User, fields ...string) (domain.User, error)
+	// ChangePassword 校验旧密码后修改密码
+	ChangePassword(ctx context.Context, uid int64, oldPassword, newPassword string) error
 	GetUserInfoByEmail(ctx context.Context, email string) (domain.User, error)
+	GetUserInfoById(ctx context.Context, uid int64) (domain.User, error)
 }
 
 var _ UserService = &userSvc{}
 
 type userSvc struct {
 	d      dao.UserI
+	policy *password.Policies
+	hasher *password.Hasher
+	breach password.BreachChecker
+	bus    *eventbus.Bus
 	logger *logger.Logger
 }
 
-func NewUserSvc(d dao.UserI, logger *logger.Logger) UserService {
+func NewUserSvc(d dao.UserI, policy *password.Policies, hasher *password.Hasher,
+	breach password.BreachChecker, bus *eventbus.Bus, logger *logger.Logger) UserService {
 	return &userSvc{
 		d:      d,
+		policy: policy,
+		hasher: hasher,
+		breach: breach,
+		bus:    bus,
 		logger: logger,
 	}
 }
 
-func (u *userSvc) SignUp(ctx context.Context, user domain.User) (int32, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+func (u *userSvc) SignUp(ctx context.Context, user domain.User) (int64, error) {
+	err := u.checkPassword(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+
+	hash, err := u.hasher.Hash(user.Password)
 	if err != nil {
 		// 记录日志
-		u.logger.Sugar().Infof("bcrypt加密失败, 失败原因：%s", err)
+		u.logger.Sugar().Infof("密码加密失败, 失败原因：%s", err)
 		return 0, err
 	}
-	user.Password = string(hash)
-	return u.d.CreateUser(ctx, dao.User{
+	user.Password = hash
+	uid, err := u.d.CreateUser(ctx, dao.User{
 		Email:       user.Email,
 		Password:    user.Password,
 		NickName:    user.NickName,
@@ -54,6 +78,40 @@ func (u *userSvc) SignUp(ctx context.Context, user domain.User) (int32, error) {
 		Description: user.Description,
 		Avatar:      user.Avatar,
 	})
+	if err != nil {
+		return 0, err
+	}
+
+	u.bus.Publish(ctx, domain.UserRegistered{
+		Id:       uid,
+		Email:    user.Email,
+		NickName: user.NickName,
+		At:       time.Now().UnixMilli(),
+	})
+	return uid, nil
+}
+
+// checkPassword 校验新密码是否符合当前租户的密码策略且未出现在泄露密码库中
+func (u *userSvc) checkPassword(ctx context.Context, user domain.User) error {
+	err := u.policy.For(tenant.FromContext(ctx)).Check(user.Password, password.UserInputs{
+		Email:    user.Email,
+		NickName: user.NickName,
+	})
+	if err != nil {
+		return err
+	}
+
+	breached, err := u.breach.Breached(user.Password)
+	if err != nil {
+		// 密码库读取失败时不阻塞注册
+		u.logger.Sugar().Warnf("检查泄露密码库失败, 失败原因：%s", err)
+		return nil
+	}
+
+	if breached {
+		return ErrBreached
+	}
+	return nil
 }
 
 func (u *userSvc) Login(ctx context.Context, user domain.User) (domain.User, error) {
@@ -61,7 +119,32 @@ func (u *userSvc) Login(ctx context.Context, user domain.User) (domain.User, err
 	if err != nil {
 		return domain.User{}, err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(ue.Password), []byte(user.Password))
+	// 缓存中的用户不带密码哈希
+	hash, err := u.d.FindPassword(ctx, ue.Id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	ok, rehash, err := u.hasher.Verify(hash, user.Password)
+	if err != nil {
+		u.logger.Sugar().Warnf("校验密码失败, 用户: %d, 失败原因：%s", ue.Id, err)
+		return domain.User{}, err
+	}
+
+	if !ok {
+		return domain.User{}, ErrPasswordWrong
+	}
+
+	if rehash {
+		// 旧算法或弱参数的哈希在登录成功时升级, 失败不影响本次登录
+		hash, err := u.hasher.Hash(user.Password)
+		if err == nil {
+			err = u.d.UpdatePassword(ctx, ue.Id, hash)
+		}
+		if err != nil {
+			u.logger.Sugar().Warnf("升级密码哈希失败, 用户: %d, 失败原因：%s", ue.Id, err)
+		}
+	}
+
 	return domain.User{
 		Id:          ue.Id,
 		Email:       ue.Email,
@@ -70,23 +153,19 @@ func (u *userSvc) Login(ctx context.Context, user domain.User) (domain.User, err
 		Address:     ue.Address,
 		Description: ue.Description,
 		Avatar:      ue.Avatar,
-	}, err
+	}, nil
 }
 
-func (u *userSvc) Delele(ctx context.Context, uid int32) error {
-	return u.d.DeleteUser(ctx, uid)
+func (u *userSvc) Delele(ctx context.Context, uid int64) error {
+	if err := u.d.DeleteUser(ctx, uid); err != nil {
+		return err
+	}
+
+	u.bus.Publish(ctx, domain.UserDeleted{Id: uid, At: time.Now().UnixMilli()})
+	return nil
 }
 
-func (u *userSvc) ModifyUserInfoById(ctx context.Context, user domain.User) (domain.User, error) {
-	if user.Password != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-		if err != nil {
-			// 记录日志
-			u.logger.Sugar().Infof("修改密码加密失败, 失败原因：%s", err)
-			return domain.User{}, err
-		}
-		user.Password = string(hash)
-	}
+func (u *userSvc) ModifyUserInfoById(ctx context.Context, user domain.User, fields ...string) (domain.User, error) {
 	ue, err := u.d.UpdateUserInfoByUid(ctx, dao.User{
 		Id:          user.Id,
 		Email:       user.Email,
@@ -95,16 +174,61 @@ func (u *userSvc) ModifyUserInfoById(ctx context.Context, user domain.User) (dom
 		Address:     user.Address,
 		Description: user.Description,
 		Avatar:      user.Avatar,
+		Version:     user.Version,
+	}, fields...)
+	if err != nil {
+		return domain.User{}, err
+	}
+	// 只修改了部分字段, 重新读取完整的用户信息
+	res, err := u.GetUserInfoById(ctx, ue.Id)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	u.bus.Publish(ctx, domain.UserProfileUpdated{User: res, At: time.Now().UnixMilli()})
+	return res, nil
+}
+
+// ChangePassword 新密码按库中当前的邮箱和昵称检查密码策略, 请求中不需要带上这两项
+func (u *userSvc) ChangePassword(ctx context.Context, uid int64, oldPassword, newPassword string) error {
+	ue, err := u.d.FindUserById(ctx, uid)
+	if err != nil {
+		return err
+	}
+	hash, err := u.d.FindPassword(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := u.hasher.Verify(hash, oldPassword)
+	if err != nil {
+		u.logger.Sugar().Warnf("校验密码失败, 用户: %d, 失败原因：%s", uid, err)
+		return err
+	}
+	if !ok {
+		return ErrPasswordWrong
+	}
+
+	err = u.checkPassword(ctx, domain.User{
+		Email:    ue.Email,
+		NickName: ue.NickName,
+		Password: newPassword,
 	})
-	return domain.User{
-		Id:          ue.Id,
-		Email:       ue.Email,
-		NickName:    ue.NickName,
-		BirthDay:    ue.BirthDay,
-		Address:     ue.Address,
-		Description: ue.Description,
-		Avatar:      ue.Avatar,
-	}, err
+	if err != nil {
+		return err
+	}
+
+	hash, err = u.hasher.Hash(newPassword)
+	if err != nil {
+		u.logger.Sugar().Infof("修改密码加密失败, 失败原因：%s", err)
+		return err
+	}
+	if err = u.d.UpdatePassword(ctx, uid, hash); err != nil {
+		return err
+	}
+
+	u.bus.Publish(ctx, domain.UserPasswordChanged{Id: uid, At: time.Now().UnixMilli()})
+	return nil
 }
 
 func (u *userSvc) GetUserInfoByEmail(ctx context.Context, email string) (domain.User, error) {
@@ -120,5 +244,25 @@ func (u *userSvc) GetUserInfoByEmail(ctx context.Context, email string) (domain.
 		Address:     user.Address,
 		Description: user.Description,
 		Avatar:      user.Avatar,
+		Version:     user.Version,
+	}, nil
+}
+
+func (u *userSvc) GetUserInfoById(ctx context.Context, uid int64) (domain.User, error) {
+	user, err := u.d.FindUserById(ctx, uid)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return domain.User{
+		Id:          user.Id,
+		Email:       user.Email,
+		NickName:    user.NickName,
+		BirthDay:    user.BirthDay,
+		Address:     user.Address,
+		Description: user.Description,
+		Avatar:      user.Avatar,
+		Version:     user.Version,
+		UpdateAt:    user.UpdateAt,
 	}, nil
 }
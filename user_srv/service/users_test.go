@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Numsina/tk_users/user_srv/config"
+	"github.com/Numsina/tk_users/user_srv/dao"
+	domain "github.com/Numsina/tk_users/user_srv/domian"
+	"github.com/Numsina/tk_users/user_srv/logger"
+	"github.com/Numsina/tk_users/user_srv/pkg/eventbus"
+	"github.com/Numsina/tk_users/user_srv/pkg/password"
+)
+
+// memUserDao 只实现修改密码用到的方法
+type memUserDao struct {
+	dao.UserI
+	users map[int64]dao.User
+}
+
+func (m *memUserDao) FindUserById(ctx context.Context, uid int64) (dao.User, error) {
+	ue, ok := m.users[uid]
+	if !ok {
+		return dao.User{}, dao.ErrRecordNotFound
+	}
+	return ue, nil
+}
+
+// FindUserByEmail 与缓存一样返回不带密码哈希的用户
+func (m *memUserDao) FindUserByEmail(ctx context.Context, email string) (dao.User, error) {
+	for _, ue := range m.users {
+		if ue.Email == email {
+			ue.Password = ""
+			return ue, nil
+		}
+	}
+	return dao.User{}, dao.ErrRecordNotFound
+}
+
+func (m *memUserDao) FindPassword(ctx context.Context, uid int64) (string, error) {
+	ue, err := m.FindUserById(ctx, uid)
+	return ue.Password, err
+}
+
+func (m *memUserDao) UpdatePassword(ctx context.Context, uid int64, hash string) error {
+	ue := m.users[uid]
+	ue.Password = hash
+	m.users[uid] = ue
+	return nil
+}
+
+func newTestUserSvc(t *testing.T, oldPassword string) (UserService, *memUserDao, *password.Hasher) {
+	t.Helper()
+	l := logger.NewLogger(logger.WithWriteFile(false))
+	hasher := password.NewHasher(config.PasswordHashConfig{})
+	hash, err := hasher.Hash(oldPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &memUserDao{users: map[int64]dao.User{
+		1: {Id: 1, Email: "alice@ex.com", NickName: "wonderland", Password: hash},
+	}}
+	breach, err := password.NewBreachChecker(config.PasswordBreachConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies := password.NewPolicies(config.PasswordPolicyConfig{MinLength: 8, BanUserInputs: true}, nil)
+	return NewUserSvc(d, policies, hasher, breach, eventbus.New(l), l), d, hasher
+}
+
+func TestChangePassword(t *testing.T) {
+	const old = "Old#Passw0rd"
+	svc, d, hasher := newTestUserSvc(t, old)
+	ctx := context.Background()
+
+	if err := svc.ChangePassword(ctx, 1, "wrong", "N3w#Secret!"); !errors.Is(err, ErrPasswordWrong) {
+		t.Fatalf("旧密码错误时应返回ErrPasswordWrong, 实际: %v", err)
+	}
+	if err := svc.ChangePassword(ctx, 2, old, "N3w#Secret!"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("用户不存在时应返回ErrRecordNotFound, 实际: %v", err)
+	}
+
+	// 请求中没有邮箱和昵称, 策略使用库中保存的值
+	cases := map[string]string{
+		"Alice#12345":      password.ReasonContainsEmail,
+		"Wonderland#2024!": password.ReasonContainsNick,
+	}
+	for pwd, reason := range cases {
+		var policyErr *password.PolicyError
+		err := svc.ChangePassword(ctx, 1, old, pwd)
+		if !errors.As(err, &policyErr) || !slices.Contains(policyErr.Reasons, reason) {
+			t.Fatalf("密码%s应因%s被拒绝, 实际: %v", pwd, reason, err)
+		}
+	}
+
+	if err := svc.ChangePassword(ctx, 1, old, "N3w#Secret!"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, _ := hasher.Verify(d.users[1].Password, "N3w#Secret!"); !ok {
+		t.Fatal("密码没有修改")
+	}
+}
+
+func TestLoginReadsPassword(t *testing.T) {
+	const pwd = "Old#Passw0rd"
+	svc, _, _ := newTestUserSvc(t, pwd)
+	ctx := context.Background()
+
+	ue, err := svc.Login(ctx, domain.User{Email: "alice@ex.com", Password: pwd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ue.Id != 1 {
+		t.Fatalf("登录的用户为%d", ue.Id)
+	}
+	if _, err = svc.Login(ctx, domain.User{Email: "alice@ex.com", Password: "wrong"}); !errors.Is(err, ErrPasswordWrong) {
+		t.Fatalf("密码错误时应返回ErrPasswordWrong, 实际: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// 从HIBP的ordered-by-hash文件("SHA1:COUNT"每行一条)生成用户服务使用的布隆过滤器文件
+//
+//	go run ./tools/breach -in pwned-passwords-sha1-ordered-by-hash.txt -out breach.bloom -fp 0.001
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Numsina/tk_users/user_srv/pkg/password"
+)
+
+func main() {
+	var in, out string
+	var fp float64
+	var min int
+	flag.StringVar(&in, "in", "", "HIBP哈希文件")
+	flag.StringVar(&out, "out", "breach.bloom", "输出的布隆过滤器文件")
+	flag.Float64Var(&fp, "fp", 0.001, "误判率")
+	flag.IntVar(&min, "min", 1, "只收录泄露次数不少于该值的密码")
+	flag.Parse()
+
+	if in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	n, err := scan(in, min, func([]byte) {})
+	if err != nil {
+		log.Fatalf("读取哈希文件失败: %v", err)
+	}
+
+	bf := password.NewBloomFilter(n, fp)
+	if _, err = scan(in, min, bf.AddDigest); err != nil {
+		log.Fatalf("读取哈希文件失败: %v", err)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		log.Fatalf("创建输出文件失败: %v", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if _, err = bf.WriteTo(w); err != nil {
+		log.Fatalf("写入布隆过滤器失败: %v", err)
+	}
+	if err = w.Flush(); err != nil {
+		log.Fatalf("写入布隆过滤器失败: %v", err)
+	}
+	log.Printf("已写入%d条哈希到%s", n, out)
+}
+
+func scan(path string, min int, fn func(digest []byte)) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var n uint64
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		hash, count, _ := bytes.Cut(bytes.TrimSpace(s.Bytes()), []byte{':'})
+		if min > 1 && atoi(count) < min {
+			continue
+		}
+		digest, err := hex.DecodeString(string(hash))
+		if err != nil || len(digest) != 20 {
+			continue
+		}
+		fn(digest)
+		n++
+	}
+	return n, s.Err()
+}
+
+func atoi(b []byte) int {
+	var n int
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			break
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
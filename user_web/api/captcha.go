@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Numsina/tk_users/user_web/captcha"
+	"github.com/Numsina/tk_users/user_web/logger"
+	"github.com/Numsina/tk_users/user_web/tools"
+)
+
+// 客户端通过请求头提交验证码
+const (
+	captchaIdHeader     = "X-Captcha-Id"
+	captchaAnswerHeader = "X-Captcha-Answer"
+)
+
+type CaptchaHandler struct {
+	cpt    *captcha.Captcha
+	logger *logger.Logger
+}
+
+func NewCaptchaHandler(cpt *captcha.Captcha, logger *logger.Logger) *CaptchaHandler {
+	return &CaptchaHandler{
+		cpt:    cpt,
+		logger: logger,
+	}
+}
+
+func (c *CaptchaHandler) RegisterRouters(router *gin.Engine) {
+	router.GET("/v1/captcha", c.challenge)
+}
+
+func (c *CaptchaHandler) challenge(ctx *gin.Context) {
+	ch, err := c.cpt.New(ctx.Request.Context())
+	if err != nil {
+		c.logger.Sugar().Errorf("生成验证码失败, 失败原因: %s", err)
+		ctx.JSON(http.StatusInternalServerError, tools.Result{
+			Code: 13,
+			Msg:  "生成验证码失败",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tools.Result{
+		Code: 0,
+		Msg:  "获取成功",
+		Data: ch,
+	})
+}
+
+// verifyCaptcha 校验请求头中的验证码, 失败时直接写入响应
+func verifyCaptcha(ctx *gin.Context, cpt *captcha.Captcha) bool {
+	err := cpt.Verify(ctx.Request.Context(), ctx.GetHeader(captchaIdHeader), ctx.GetHeader(captchaAnswerHeader))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, tools.Result{
+			Code: 3,
+			Msg:  err.Error(),
+			Data: gin.H{"captcha_required": true},
+		})
+		return false
+	}
+	return true
+}
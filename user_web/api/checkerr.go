@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -39,6 +40,27 @@ func checkError(err error, ctx *gin.Context) {
 				ctx.JSON(http.StatusBadRequest, tools.Result{
 					Code: int(s.Code()),
 					Msg:  "请求参数错误",
+					Data: violations(s),
+				})
+			case codes.Unauthenticated:
+				ctx.JSON(http.StatusUnauthorized, tools.Result{
+					Code: int(s.Code()),
+					Msg:  s.Message(),
+				})
+			case codes.Aborted:
+				ctx.JSON(http.StatusConflict, tools.Result{
+					Code: int(s.Code()),
+					Msg:  s.Message(),
+				})
+			case codes.ResourceExhausted:
+				ctx.JSON(http.StatusTooManyRequests, tools.Result{
+					Code: int(s.Code()),
+					Msg:  s.Message(),
+				})
+			case codes.Unavailable:
+				ctx.JSON(http.StatusServiceUnavailable, tools.Result{
+					Code: int(s.Code()),
+					Msg:  "服务暂不可用, 请稍后再试",
 				})
 			default:
 				ctx.JSON(http.StatusInternalServerError, tools.Result{
@@ -50,3 +72,44 @@ func checkError(err error, ctx *gin.Context) {
 		return
 	}
 }
+
+type violation struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+	Msg    string `json:"msg,omitempty"`
+}
+
+// reasonMsgs 用户服务返回的校验失败原因对应的提示
+var reasonMsgs = map[string]string{
+	"too_short":            "密码长度过短",
+	"too_long":             "密码长度过长",
+	"missing_upper":        "密码需要包含大写字母",
+	"missing_lower":        "密码需要包含小写字母",
+	"missing_digit":        "密码需要包含数字",
+	"missing_symbol":       "密码需要包含特殊字符",
+	"too_few_classes":      "密码需要包含更多种类的字符",
+	"contains_email":       "密码不能包含邮箱",
+	"contains_nickname":    "密码不能包含昵称",
+	"contains_banned_word": "密码包含不允许使用的词语",
+	"too_weak":             "密码强度太弱, 请避免使用常见单词或简单规律",
+	"breached":             "该密码已出现在公开泄露的密码库中, 请更换一个从未使用过的密码",
+}
+
+// violations 取出用户服务返回的逐条校验失败原因, 没有时返回nil
+func violations(s *status.Status) []violation {
+	var res []violation
+	for _, d := range s.Details() {
+		br, ok := d.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		for _, v := range br.GetFieldViolations() {
+			res = append(res, violation{
+				Field:  v.GetField(),
+				Reason: v.GetDescription(),
+				Msg:    reasonMsgs[v.GetDescription()],
+			})
+		}
+	}
+	return res
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckErrorStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := map[codes.Code]int{
+		codes.NotFound:          http.StatusNotFound,
+		codes.InvalidArgument:   http.StatusBadRequest,
+		codes.Unauthenticated:   http.StatusUnauthorized,
+		codes.Aborted:           http.StatusConflict,
+		codes.DeadlineExceeded:  http.StatusRequestTimeout,
+		codes.ResourceExhausted: http.StatusTooManyRequests,
+		codes.Unavailable:       http.StatusServiceUnavailable,
+		codes.Internal:          http.StatusInternalServerError,
+		codes.Unknown:           http.StatusInternalServerError,
+	}
+	for code, want := range cases {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		checkError(status.Error(code, "错误"), ctx)
+		if w.Code != want {
+			t.Errorf("%v对应的状态码为%d, 期望%d", code, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// profileETag 用户信息的实体标签, 版本号每次修改加1
+func profileETag(uid int64, version int64) string {
+	return fmt.Sprintf(`"%d-%d"`, uid, version)
+}
+
+// matchETag 判断If-None-Match中是否包含etag, 按弱比较忽略W/前缀
+func matchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion 从If-Match中取出版本, 未携带或为*时返回0表示不检查,
+// 格式不正确或不属于该用户时返回false
+func ifMatchVersion(header string, uid int64) (int64, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, true
+	}
+
+	// If-Match使用强比较, 只接受单个带引号的标签, 不接受W/前缀和标签列表
+	tag, ok := strings.CutPrefix(header, `"`)
+	if !ok {
+		return 0, false
+	}
+	if tag, ok = strings.CutSuffix(tag, `"`); !ok {
+		return 0, false
+	}
+	idPart, versionPart, ok := strings.Cut(tag, "-")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id != uid {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(versionPart, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
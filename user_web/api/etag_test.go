@@ -0,0 +1,70 @@
+package api
+
+import "testing"
+
+func TestMatchETag(t *testing.T) {
+	etag := profileETag(1, 2)
+	cases := map[string]bool{
+		`"1-2"`:            true,
+		`*`:                true,
+		`W/"1-2"`:          true,
+		`"0-1", W/"1-2"`:   true,
+		` "1-1" ,"1-2" `:   true,
+		``:                 false,
+		`"1-1"`:            false,
+		`"2-2"`:            false,
+		`1-2`:              false,
+		`"1-2`:             false,
+		`W/`:               false,
+		`"1-2"junk`:        false,
+		`"1-20"`:           false,
+		`"1-2"W/`:          false,
+		`"*"`:              false,
+		`W/"1-1", "1-3"`:   false,
+		`,,`:               false,
+		`w/"1-2"`:          false,
+		`W/ "1-2"`:         false,
+		`"1-2" ; q=1`:      false,
+		`"11-2", "1-22"`:   false,
+		`W/"1-2", "bogus"`: true,
+	}
+	for header, want := range cases {
+		if got := matchETag(header, etag); got != want {
+			t.Errorf("If-None-Match %q: %v, 期望%v", header, got, want)
+		}
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	cases := []struct {
+		header  string
+		version int64
+		ok      bool
+	}{
+		{``, 0, true},
+		{`*`, 0, true},
+		{` * `, 0, true},
+		{`"1-2"`, 2, true},
+		{` "1-2" `, 2, true},
+		{`W/"1-2"`, 0, false},
+		{`"2-2"`, 0, false},
+		{`"1-0"`, 0, false},
+		{`"1--1"`, 0, false},
+		{`"1-2"junk`, 0, false},
+		{`"1-2", "1-3"`, 0, false},
+		{`"1-2-3"`, 0, false},
+		{`"1-"`, 0, false},
+		{`"-2"`, 0, false},
+		{`"1-x"`, 0, false},
+		{`1-2`, 0, false},
+		{`"1-2`, 0, false},
+		{`"`, 0, false},
+		{`"1-99999999999999999999"`, 0, false},
+	}
+	for _, c := range cases {
+		version, ok := ifMatchVersion(c.header, 1)
+		if version != c.version || ok != c.ok {
+			t.Errorf("If-Match %q: %d, %v, 期望%d, %v", c.header, version, ok, c.version, c.ok)
+		}
+	}
+}
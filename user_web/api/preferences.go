@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Numsina/tk_users/user_web/domain"
+	"github.com/Numsina/tk_users/user_web/logger"
+	"github.com/Numsina/tk_users/user_web/middleware"
+	"github.com/Numsina/tk_users/user_web/service"
+	"github.com/Numsina/tk_users/user_web/tools"
+)
+
+type PreferenceHandler struct {
+	svc    *service.PreferenceService
+	logger *logger.Logger
+}
+
+func NewPreferenceHandler(svc *service.PreferenceService, logger *logger.Logger) *PreferenceHandler {
+	return &PreferenceHandler{
+		svc:    svc,
+		logger: logger,
+	}
+}
+
+func (p *PreferenceHandler) RegisterRouters(router *gin.Engine) {
+	prefGroup := router.Group("/v1/users/me/preferences")
+	{
+		prefGroup.GET("", p.batchGet)
+		prefGroup.GET("/:key", p.get)
+		prefGroup.PUT("/:key", p.set)
+	}
+}
+
+// batchGet keys以逗号分隔, 不传时返回全部偏好
+func (p *PreferenceHandler) batchGet(ctx *gin.Context) {
+	claims := ctx.Value("claims").(*middleware.UserClaims)
+	var keys []string
+	if q := ctx.Query("keys"); q != "" {
+		keys = strings.Split(q, ",")
+	}
+
+	prefs, err := p.svc.BatchGet(ctx.Request.Context(), claims.UserId, keys)
+	if err != nil {
+		checkError(err, ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tools.Result{
+		Code: 0,
+		Msg:  "查询成功",
+		Data: prefs,
+	})
+}
+
+func (p *PreferenceHandler) get(ctx *gin.Context) {
+	claims := ctx.Value("claims").(*middleware.UserClaims)
+	pref, err := p.svc.Get(ctx.Request.Context(), claims.UserId, ctx.Param("key"))
+	if err != nil {
+		checkError(err, ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tools.Result{
+		Code: 0,
+		Msg:  "查询成功",
+		Data: pref,
+	})
+}
+
+func (p *PreferenceHandler) set(ctx *gin.Context) {
+	type set_req struct {
+		Value   string `json:"value"`
+		Version int64  `json:"version"`
+	}
+	var req set_req
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, tools.Result{
+			Code: 3,
+			Msg:  "参数错误",
+		})
+		return
+	}
+
+	claims := ctx.Value("claims").(*middleware.UserClaims)
+	pref, err := p.svc.Set(ctx.Request.Context(), claims.UserId, domain.Preference{
+		Key:     ctx.Param("key"),
+		Value:   req.Value,
+		Version: req.Version,
+	})
+	if err != nil {
+		checkError(err, ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tools.Result{
+		Code: 0,
+		Msg:  "设置成功",
+		Data: pref,
+	})
+}
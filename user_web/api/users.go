@@ -6,7 +6,10 @@ import (
 	regexp "github.com/dlclark/regexp2"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"github.com/Numsina/tk_users/user_web/captcha"
 	"github.com/Numsina/tk_users/user_web/constant"
 	"github.com/Numsina/tk_users/user_web/domain"
 	"github.com/Numsina/tk_users/user_web/logger"
@@ -16,20 +19,23 @@ import (
 )
 
 type UserHandler struct {
-	emailRegexp    *regexp.Regexp
-	passwordRegexp *regexp.Regexp
-	svc            *service.UserService
-	logger         *logger.Logger
-	jhl            *middleware.JWT
+	emailRegexp *regexp.Regexp
+	svc         *service.UserService
+	logger      *logger.Logger
+	jhl         *middleware.JWT
+	cpt         *captcha.Captcha
+	failures    *captcha.FailureCounter
 }
 
-func NewUserHandler(svc *service.UserService, logger *logger.Logger, jhl *middleware.JWT) *UserHandler {
+func NewUserHandler(svc *service.UserService, logger *logger.Logger, jhl *middleware.JWT,
+	cpt *captcha.Captcha, failures *captcha.FailureCounter) *UserHandler {
 	return &UserHandler{
-		emailRegexp:    regexp.MustCompile(constant.UserEmail, regexp.None),
-		passwordRegexp: regexp.MustCompile(constant.UserPassword, regexp.None),
-		svc:            svc,
-		logger:         logger,
-		jhl:            jhl,
+		emailRegexp: regexp.MustCompile(constant.UserEmail, regexp.None),
+		svc:         svc,
+		logger:      logger,
+		jhl:         jhl,
+		cpt:         cpt,
+		failures:    failures,
 	}
 }
 
@@ -41,6 +47,8 @@ func (u *UserHandler) RegisterRouters(router *gin.Engine) {
 		userGroup.POST("/login", u.login)
 		userGroup.POST("/logout", u.logout)
 		userGroup.GET("/info", u.getUserByEmail)
+		userGroup.GET("/me", u.profile)
+		userGroup.PUT("/me", u.updateProfile)
 	}
 }
 
@@ -63,15 +71,7 @@ func (u *UserHandler) signup(ctx *gin.Context) {
 		return
 	}
 
-	if ok, _ := u.passwordRegexp.MatchString(user.Password); !ok {
-		ctx.JSON(http.StatusBadRequest, tools.Result{
-			Code: 3,
-			Msg:  "密码格式有误!!!",
-			Data: nil,
-		})
-		return
-	}
-
+	// 密码强度由用户服务按配置的密码策略校验
 	if user.Password != user.ConfirmPassword {
 		ctx.JSON(http.StatusOK, tools.Result{
 			Code: 3,
@@ -81,6 +81,11 @@ func (u *UserHandler) signup(ctx *gin.Context) {
 		return
 	}
 
+	// 注册始终需要验证码
+	if !verifyCaptcha(ctx, u.cpt) {
+		return
+	}
+
 	uid, err := u.svc.Signup(ctx.Request.Context(), domain.User{
 		Email:           user.Email,
 		Password:        user.Password,
@@ -119,7 +124,7 @@ func (u *UserHandler) login(ctx *gin.Context) {
 		return
 	}
 
-	if ok, _ := u.passwordRegexp.MatchString(req.Password); !ok {
+	if req.Password == "" {
 		ctx.JSON(http.StatusBadRequest, tools.Result{
 			Code: 3,
 			Msg:  "邮箱或密码不正确",
@@ -128,16 +133,31 @@ func (u *UserHandler) login(ctx *gin.Context) {
 		return
 	}
 
+	// 同一IP或同一账号连续登录失败后需要验证码
+	ip := ctx.ClientIP()
+	if u.failures.Required(ctx.Request.Context(), ip, req.Email) && !verifyCaptcha(ctx, u.cpt) {
+		return
+	}
+
 	id, err := u.svc.Login(ctx.Request.Context(), domain.User{
 		Email:    req.Email,
 		Password: req.Password,
 	})
 
 	if err != nil {
+		if s, ok := status.FromError(err); ok && (s.Code() == codes.Unauthenticated || s.Code() == codes.NotFound) {
+			if err := u.failures.Incr(ctx.Request.Context(), ip, req.Email); err != nil {
+				u.logger.Sugar().Warnf("记录登录失败次数失败, 原因: %s", err)
+			}
+		}
 		checkError(err, ctx)
 		return
 	}
 
+	if err = u.failures.Reset(ctx.Request.Context(), req.Email); err != nil {
+		u.logger.Sugar().Warnf("重置登录失败次数失败, 原因: %s", err)
+	}
+
 	// 设置token或者cookie
 	// 生成session，并设置token
 	uid := uuid.New()
@@ -191,3 +211,70 @@ func (u *UserHandler) getUserByEmail(ctx *gin.Context) {
 	})
 	return
 }
+
+// profile 返回ETag, If-None-Match命中时返回304
+func (u *UserHandler) profile(ctx *gin.Context) {
+	claims := ctx.Value("claims").(*middleware.UserClaims)
+	user, err := u.svc.GetProfile(ctx.Request.Context(), claims.UserId)
+	if err != nil {
+		checkError(err, ctx)
+		return
+	}
+
+	etag := profileETag(user.Id, user.Version)
+	ctx.Header("ETag", etag)
+	if inm := ctx.GetHeader("If-None-Match"); inm != "" && matchETag(inm, etag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tools.Result{
+		Code: 0,
+		Msg:  "查询成功",
+		Data: user,
+	})
+}
+
+// updateProfile If-Match与当前版本不一致时返回412
+func (u *UserHandler) updateProfile(ctx *gin.Context) {
+	var user domain.User
+	if err := ctx.BindJSON(&user); err != nil {
+		ctx.JSON(http.StatusBadRequest, tools.Result{
+			Code: 3,
+			Msg:  "参数错误",
+		})
+		return
+	}
+
+	claims := ctx.Value("claims").(*middleware.UserClaims)
+	version, ok := ifMatchVersion(ctx.GetHeader("If-Match"), claims.UserId)
+	if !ok {
+		ctx.JSON(http.StatusPreconditionFailed, tools.Result{
+			Code: int(codes.FailedPrecondition),
+			Msg:  "用户信息已被修改, 请刷新后重试",
+		})
+		return
+	}
+
+	user.Id = claims.UserId
+	res, err := u.svc.UpdateProfile(ctx.Request.Context(), user, version)
+	if s, ok := status.FromError(err); ok && s.Code() == codes.Aborted {
+		ctx.JSON(http.StatusPreconditionFailed, tools.Result{
+			Code: int(codes.FailedPrecondition),
+			Msg:  s.Message(),
+		})
+		return
+	}
+
+	if err != nil {
+		checkError(err, ctx)
+		return
+	}
+
+	ctx.Header("ETag", profileETag(res.Id, res.Version))
+	ctx.JSON(http.StatusOK, tools.Result{
+		Code: 0,
+		Msg:  "修改成功",
+		Data: res,
+	})
+}
@@ -0,0 +1,85 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCaptchaRequired = errors.New("请先完成验证码")
+	ErrCaptchaWrong    = errors.New("验证码错误或已过期")
+)
+
+// Challenge 下发给客户端的验证码, Content为题目文本或图片的data URI
+type Challenge struct {
+	Id       string `json:"captcha_id"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	ExpireAt int64  `json:"expire_at"`
+}
+
+// Provider 生成一道验证码题目及其答案, 可按配置替换
+type Provider interface {
+	Type() string
+	Generate() (content string, answer string, err error)
+}
+
+// Store 保存验证码答案, Take取出后即删除, 保证一个验证码只能使用一次
+type Store interface {
+	Set(ctx context.Context, id, answer string, expiration time.Duration) error
+	Take(ctx context.Context, id string) (string, error)
+}
+
+type Captcha struct {
+	provider   Provider
+	store      Store
+	expiration time.Duration
+}
+
+func NewCaptcha(provider Provider, store Store, expiration time.Duration) *Captcha {
+	return &Captcha{
+		provider:   provider,
+		store:      store,
+		expiration: expiration,
+	}
+}
+
+func (c *Captcha) New(ctx context.Context) (Challenge, error) {
+	content, answer, err := c.provider.Generate()
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	id := uuid.New().String()
+	if err = c.store.Set(ctx, id, answer, c.expiration); err != nil {
+		return Challenge{}, err
+	}
+
+	return Challenge{
+		Id:       id,
+		Type:     c.provider.Type(),
+		Content:  content,
+		ExpireAt: time.Now().Add(c.expiration).UnixMilli(),
+	}, nil
+}
+
+// Verify 校验答案, 无论对错验证码都会失效
+func (c *Captcha) Verify(ctx context.Context, id, answer string) error {
+	if id == "" || answer == "" {
+		return ErrCaptchaRequired
+	}
+
+	expected, err := c.store.Take(ctx, id)
+	if err != nil {
+		return ErrCaptchaWrong
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(answer), expected) {
+		return ErrCaptchaWrong
+	}
+	return nil
+}
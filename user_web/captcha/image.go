@@ -0,0 +1,134 @@
+package captcha
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand/v2"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const TypeImage = "image"
+
+const (
+	imageScale = 3
+	imageNoise = 6
+)
+
+// ImageProvider 将内部Provider生成的题目绘制成带干扰的PNG图片
+type ImageProvider struct {
+	inner Provider
+}
+
+func NewImageProvider(inner Provider) *ImageProvider {
+	return &ImageProvider{inner: inner}
+}
+
+func (i *ImageProvider) Type() string {
+	return TypeImage
+}
+
+func (i *ImageProvider) Generate() (string, string, error) {
+	question, answer, err := i.inner.Generate()
+	if err != nil {
+		return "", "", err
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, render(question)); err != nil {
+		return "", "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), answer, nil
+}
+
+func render(text string) image.Image {
+	// 内置点阵字体只包含ASCII字符
+	text = strings.ReplaceAll(text, "×", "x")
+	face := basicfont.Face7x13
+	w, h := len(text)*(face.Advance+1)+8, face.Height+8
+
+	small := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(small, small.Bounds(), image.Transparent, image.Point{}, draw.Src)
+	for idx, r := range text {
+		d := font.Drawer{
+			Dst:  small,
+			Src:  image.NewUniform(randColor(0, 120)),
+			Face: face,
+			Dot:  fixed.P(4+idx*(face.Advance+1), face.Ascent+2+rand.IntN(5)),
+		}
+		d.DrawString(string(r))
+	}
+
+	big := image.NewRGBA(image.Rect(0, 0, w*imageScale, h*imageScale))
+	draw.Draw(big, big.Bounds(), image.NewUniform(randColor(220, 255)), image.Point{}, draw.Src)
+	for n := 0; n < imageNoise; n++ {
+		line(big, rand.IntN(big.Bounds().Dx()), rand.IntN(big.Bounds().Dy()),
+			rand.IntN(big.Bounds().Dx()), rand.IntN(big.Bounds().Dy()), randColor(100, 200))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := small.RGBAAt(x, y)
+			if c.A == 0 {
+				continue
+			}
+			for dy := 0; dy < imageScale; dy++ {
+				for dx := 0; dx < imageScale; dx++ {
+					big.SetRGBA(x*imageScale+dx, y*imageScale+dy, c)
+				}
+			}
+		}
+	}
+
+	for n := 0; n < big.Bounds().Dx()*big.Bounds().Dy()/30; n++ {
+		big.Set(rand.IntN(big.Bounds().Dx()), rand.IntN(big.Bounds().Dy()), randColor(0, 255))
+	}
+	return big
+}
+
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := sign(x1-x0), sign(y1-y0)
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func randColor(lo, hi int) color.RGBA {
+	n := func() uint8 { return uint8(lo + rand.IntN(hi-lo+1)) }
+	return color.RGBA{R: n(), G: n(), B: n(), A: 255}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,39 @@
+package captcha
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+)
+
+const TypeMath = "math"
+
+// MathProvider 生成两位数以内的四则运算题, 结果均为非负整数
+type MathProvider struct{}
+
+func NewMathProvider() *MathProvider {
+	return &MathProvider{}
+}
+
+func (m *MathProvider) Type() string {
+	return TypeMath
+}
+
+func (m *MathProvider) Generate() (string, string, error) {
+	a, b := rand.IntN(20)+1, rand.IntN(20)+1
+	var op string
+	var res int
+	switch rand.IntN(3) {
+	case 0:
+		op, res = "+", a+b
+	case 1:
+		if a < b {
+			a, b = b, a
+		}
+		op, res = "-", a-b
+	default:
+		a, b = rand.IntN(9)+1, rand.IntN(9)+1
+		op, res = "×", a*b
+	}
+	return fmt.Sprintf("%d %s %d = ?", a, op, b), strconv.Itoa(res), nil
+}
@@ -0,0 +1,94 @@
+package captcha
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_web/tenant"
+)
+
+var _ Store = &RedisStore{}
+
+type RedisStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (r *RedisStore) key(id string) string {
+	return fmt.Sprintf("captcha:answer:%s", id)
+}
+
+func (r *RedisStore) Set(ctx context.Context, id, answer string, expiration time.Duration) error {
+	return r.client.Set(ctx, r.key(id), answer, expiration).Err()
+}
+
+func (r *RedisStore) Take(ctx context.Context, id string) (string, error) {
+	return r.client.GetDel(ctx, r.key(id)).Result()
+}
+
+// FailureCounter 统计同一IP或同一账号在窗口期内的登录失败次数
+type FailureCounter struct {
+	client    redis.Cmdable
+	threshold int64
+	window    time.Duration
+}
+
+func NewFailureCounter(client redis.Cmdable, threshold int, window time.Duration) *FailureCounter {
+	return &FailureCounter{
+		client:    client,
+		threshold: int64(threshold),
+		window:    window,
+	}
+}
+
+func (f *FailureCounter) ipKey(ip string) string {
+	return fmt.Sprintf("captcha:fail:ip:%s", ip)
+}
+
+// accountKey 不同租户的同名账号分别计数, 邮箱不区分大小写, 改变大小写或加空格不能绕过计数
+func (f *FailureCounter) accountKey(ctx context.Context, account string) string {
+	account = strings.ToLower(strings.TrimSpace(account))
+	return fmt.Sprintf("captcha:fail:account:%s", tenant.Key(ctx, account))
+}
+
+// Required 任一维度的失败次数达到阈值时需要验证码, redis异常时从严处理
+func (f *FailureCounter) Required(ctx context.Context, ip, account string) bool {
+	vals, err := f.client.MGet(ctx, f.ipKey(ip), f.accountKey(ctx, account)).Result()
+	if err != nil {
+		return true
+	}
+
+	for _, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var n int64
+		if _, err = fmt.Sscan(s, &n); err == nil && n >= f.threshold {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FailureCounter) Incr(ctx context.Context, ip, account string) error {
+	pipe := f.client.TxPipeline()
+	for _, key := range []string{f.ipKey(ip), f.accountKey(ctx, account)} {
+		pipe.Incr(ctx, key)
+		pipe.ExpireNX(ctx, key, f.window)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Reset 登录成功后清除账号维度的计数, IP维度仍需等待窗口期结束
+func (f *FailureCounter) Reset(ctx context.Context, account string) error {
+	return f.client.Del(ctx, f.accountKey(ctx, account)).Err()
+}
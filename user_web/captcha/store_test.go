@@ -0,0 +1,18 @@
+package captcha
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFailureCounterAccountKey(t *testing.T) {
+	f := NewFailureCounter(nil, 3, 0)
+	ctx := context.Background()
+
+	want := f.accountKey(ctx, "alice@ex.com")
+	for _, account := range []string{"Alice@Ex.com", " alice@ex.com", "ALICE@EX.COM\t"} {
+		if got := f.accountKey(ctx, account); got != want {
+			t.Fatalf("%q的计数key为%s, 期望%s", account, got, want)
+		}
+	}
+}
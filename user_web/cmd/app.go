@@ -16,6 +16,7 @@ import (
 	"github.com/google/uuid"
 	consul "github.com/hashicorp/consul/api"
 	_ "github.com/mbobakov/grpc-consul-resolver"
+	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel"
@@ -31,8 +32,11 @@ import (
 	"github.com/Numsina/tk_users/user_web/initialize/tracing"
 	"github.com/Numsina/tk_users/user_web/logger"
 	"github.com/Numsina/tk_users/user_web/middleware"
+	"github.com/Numsina/tk_users/user_web/middleware/idempotency"
 	"github.com/Numsina/tk_users/user_web/middleware/metrics"
+	"github.com/Numsina/tk_users/user_web/middleware/ratelimit"
 	"github.com/Numsina/tk_users/user_web/service"
+	"github.com/Numsina/tk_users/user_web/tenant"
 	"github.com/Numsina/tk_users/user_web/tools"
 )
 
@@ -40,18 +44,23 @@ type App struct {
 	conf       *config.Config
 	logger     *logger.Logger
 	client     users.UserServiceClient
+	prefClient users.PreferenceServiceClient
 	jhl        *middleware.JWT
+	tenants    *middleware.Tenants
 	instanceId string
 	consulApi  *consul.Client
 	port       int
 	conn       *grpc.ClientConn
+	rdb        redis.Cmdable
 }
 
 func (a *App) Init() {
 	a.conf = initialize.InitConfig()
-	initialize.InitRedis()
+	a.rdb = initialize.InitRedis()
 	a.logger = initialize.InitLogger()
+	a.tenants = middleware.NewTenants(a.conf.Tenants)
 	a.jhl = middleware.NewJWT([]byte(a.conf.JwtInfo.Key))
+	a.jhl.Tenants = a.tenants
 
 }
 
@@ -80,7 +89,7 @@ func Run() {
 
 	}()
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP, os.Interrupt)
 	<-quit
 	a.stopConsul()
@@ -99,6 +108,7 @@ func (a *App) dial() {
 			md := metadata.Pairs(
 				"timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10),
 				"client_id", "tk_user_web",
+				tenant.MetadataKey, tenant.FromContext(ctx),
 			)
 			ctx = metadata.NewOutgoingContext(ctx, md)
 			tracer := otel.Tracer("conn tk_user_srv")
@@ -113,6 +123,7 @@ func (a *App) dial() {
 	}
 
 	a.client = users.NewUserServiceClient(a.conn)
+	a.prefClient = users.NewPreferenceServiceClient(a.conn)
 }
 
 func (a *App) registerConsul() {
@@ -161,17 +172,25 @@ func (a *App) stopConsul() {
 }
 
 func (a *App) ioc(r *gin.Engine) {
+	cpt, failures := initialize.InitCaptcha(a.rdb)
 	svc := service.NewService(a.client)
-	userhandler := api.NewUserHandler(svc, a.logger, a.jhl)
+	userhandler := api.NewUserHandler(svc, a.logger, a.jhl, cpt, failures)
 	userhandler.RegisterRouters(r)
+	api.NewCaptchaHandler(cpt, a.logger).RegisterRouters(r)
+
+	prefhandler := api.NewPreferenceHandler(service.NewPreferenceService(a.prefClient), a.logger)
+	prefhandler.RegisterRouters(r)
 
 }
 
 func (a *App) use(r *gin.Engine) {
 
 	r.Use(middleware.Cors(),
-		middleware.NewLoginJWTMiddleWareBuilder(a.jhl).IngorePaths("/v1/users/login", "/v1/users/signup", "/metrics", "/health").Build(),
+		a.tenants.Build(),
+		middleware.NewLoginJWTMiddleWareBuilder(a.jhl).IngorePaths("/v1/users/login", "/v1/users/signup", "/v1/captcha", "/metrics", "/health").Build(),
 		metrics.NewMetrics(a.conf.NacosInfo.DataId, a.instanceId, a.conf.ConsuleInfo.Name, "tk_user_web", "统计请求的响应，请求的活跃数， 请求总数").Build(),
+		ratelimit.NewBuilder(ratelimit.NewLimiter(a.rdb), a.conf.RateLimit.Rules, a.logger).Build(),
+		idempotency.NewBuilder(a.rdb, a.conf.Idempotency, a.logger).Build(),
 		//trace.Trace(),
 		otelgin.Middleware("tk_user_web", otelgin.WithFilter(func(request *http.Request) bool {
 			if strings.Contains(request.URL.Path, "health") {
@@ -40,10 +40,60 @@ type JaegerConfig struct {
 	LogSpans bool    `mapstructure:"log_spans" json:"log_spans"`
 }
 
+// CaptchaConfig 验证码配置, 登录失败次数达到login_threshold后需要验证码
+type CaptchaConfig struct {
+	Provider       string `mapstructure:"provider" json:"provider"`
+	Expire         int    `mapstructure:"expire" json:"expire"` // 单位秒
+	LoginThreshold int    `mapstructure:"login_threshold" json:"login_threshold"`
+	FailureWindow  int    `mapstructure:"failure_window" json:"failure_window"` // 单位秒
+}
+
+// RateLimitRule 单个路由的限流规则, path为gin的路由模板, key为ip、user或email
+type RateLimitRule struct {
+	Method    string `mapstructure:"method" json:"method"`
+	Path      string `mapstructure:"path" json:"path"`
+	Algorithm string `mapstructure:"algorithm" json:"algorithm"`
+	Key       string `mapstructure:"key" json:"key"`
+	Limit     int    `mapstructure:"limit" json:"limit"`
+	Window    int    `mapstructure:"window" json:"window"` // 单位秒
+}
+
+type RateLimitConfig struct {
+	Rules []RateLimitRule `mapstructure:"rules" json:"rules"`
+}
+
+// IdempotencyRoute 启用幂等键的路由, path为gin的路由模板
+type IdempotencyRoute struct {
+	Method string `mapstructure:"method" json:"method"`
+	Path   string `mapstructure:"path" json:"path"`
+}
+
+// IdempotencyConfig 幂等记录的保存时间以及首次请求处理中的锁定时间.
+// 只有routes中的路由处理Idempotency-Key, secret用于计算请求指纹, 多实例必须配置相同的值
+type IdempotencyConfig struct {
+	Expire     int                `mapstructure:"expire" json:"expire"`           // 单位秒
+	LockExpire int                `mapstructure:"lock_expire" json:"lock_expire"` // 单位秒
+	Secret     string             `mapstructure:"secret" json:"secret"`
+	Routes     []IdempotencyRoute `mapstructure:"routes" json:"routes"`
+}
+
+// TenantConfig 一个租户, 请求通过X-Tenant-Id头或者hosts中的域名指定租户.
+// jwt_issuer为该租户签发令牌的iss, 校验令牌时要求与请求所属租户的一致
+type TenantConfig struct {
+	Id        string   `mapstructure:"id" json:"id"`
+	Hosts     []string `mapstructure:"hosts" json:"hosts"`
+	JwtIssuer string   `mapstructure:"jwt_issuer" json:"jwt_issuer"`
+}
+
 type Config struct {
 	RedisInfo   RedisConfig  `mapstructure:"redis" json:"redis"`
 	JwtInfo     JWTConfig    `mapstructure:"jwt" json:"jwt"`
 	ConsuleInfo ConsulConfig `mapstructure:"consul" json:"consul"`
 	NacosInfo   NacosConfig  `mapstructure:"nacos" json:"nacos"`
 	JaegerInfo  JaegerConfig `mapstructure:"jaeger" json:"jaeger"`
+
+	Captcha     CaptchaConfig     `mapstructure:"captcha" json:"captcha"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit" json:"rate_limit"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency" json:"idempotency"`
+	Tenants     []TenantConfig    `mapstructure:"tenants" json:"tenants"`
 }
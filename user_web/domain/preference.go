@@ -0,0 +1,9 @@
+package domain
+
+type Preference struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Type     string `json:"type"`
+	Version  int64  `json:"version"`
+	UpdateAt int64  `json:"update_at"`
+}
@@ -1,7 +1,7 @@
 package domain
 
 type User struct {
-	Id              int32  `json:"id"`
+	Id              int64  `json:"id"`
 	Email           string `json:"email"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirm_password"`
@@ -13,7 +13,7 @@ type User struct {
 }
 
 type UserResp struct {
-	Id          int32  `json:"id"`
+	Id          int64  `json:"id"`
 	Email       string `json:"email"`
 	NickName    string `json:"nick_name"`
 	Description string `json:"description"`
@@ -21,4 +21,6 @@ type UserResp struct {
 	BirthDay    int64  `json:"birth_day"`
 	Address     string `json:"address"`
 	CreateAt    int64  `json:"create_at"`
+	Version     int64  `json:"version"`
+	UpdateAt    int64  `json:"update_at"`
 }
@@ -0,0 +1,31 @@
+package initialize
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_web/captcha"
+)
+
+func InitCaptcha(client redis.Cmdable) (*captcha.Captcha, *captcha.FailureCounter) {
+	cfg := Conf.Captcha
+	if cfg.Expire <= 0 {
+		cfg.Expire = 300
+	}
+	if cfg.LoginThreshold <= 0 {
+		cfg.LoginThreshold = 3
+	}
+	if cfg.FailureWindow <= 0 {
+		cfg.FailureWindow = 900
+	}
+
+	var provider captcha.Provider = captcha.NewMathProvider()
+	if cfg.Provider == captcha.TypeImage {
+		provider = captcha.NewImageProvider(provider)
+	}
+
+	c := captcha.NewCaptcha(provider, captcha.NewRedisStore(client), time.Duration(cfg.Expire)*time.Second)
+	counter := captcha.NewFailureCounter(client, cfg.LoginThreshold, time.Duration(cfg.FailureWindow)*time.Second)
+	return c, counter
+}
@@ -10,8 +10,8 @@ import (
 
 func Cors() gin.HandlerFunc {
 	return cors.New(cors.Config{
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"x-jwt-token"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Captcha-Id", "X-Captcha-Answer", "Idempotency-Key", "If-Match", "If-None-Match", TenantHeader},
+		ExposeHeaders:    []string{"x-jwt-token", "Idempotent-Replayed", "ETag"},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
 			if strings.HasPrefix(origin, "http://127.0.0.1") {
@@ -0,0 +1,337 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_web/config"
+	"github.com/Numsina/tk_users/user_web/logger"
+	"github.com/Numsina/tk_users/user_web/middleware"
+	"github.com/Numsina/tk_users/user_web/tenant"
+	"github.com/Numsina/tk_users/user_web/tools"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	defaultExpire     = 24 * time.Hour
+	defaultLockExpire = 30 * time.Second
+	maxKeyLength      = 255
+	// maxBodyBytes 计算指纹时读取的请求体上限
+	maxBodyBytes = 1 << 20
+)
+
+const (
+	stateProcessing = "processing"
+	stateCompleted  = "completed"
+)
+
+var (
+	//go:embed save.lua
+	saveLua string
+	//go:embed release.lua
+	releaseLua string
+
+	saveScript    = redis.NewScript(saveLua)
+	releaseScript = redis.NewScript(releaseLua)
+)
+
+// 不保存也不重放的响应头: 限流头由其他中间件按本次请求重新生成, 令牌类的头不能写入redis
+var skipHeaders = map[string]bool{
+	"Ratelimit-Limit":     true,
+	"Ratelimit-Remaining": true,
+	"Ratelimit-Reset":     true,
+	"Retry-After":         true,
+	"X-Jwt-Token":         true,
+	"Authorization":       true,
+	"Set-Cookie":          true,
+	HeaderReplayed:        true,
+}
+
+// record 保存在redis中的首次请求及其响应
+type record struct {
+	State       string              `json:"state"`
+	Fingerprint string              `json:"fingerprint"`
+	Token       string              `json:"token,omitempty"` // 处理中记录的持有者
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+}
+
+// Builder 配置了幂等的路由上, 带有Idempotency-Key的请求只会被执行一次, 重试时直接返回第一次的响应
+type Builder struct {
+	client     redis.Cmdable
+	logger     *logger.Logger
+	secret     []byte
+	routes     map[string]bool
+	expire     time.Duration
+	lockExpire time.Duration
+}
+
+func NewBuilder(client redis.Cmdable, cfg config.IdempotencyConfig, logger *logger.Logger) *Builder {
+	b := &Builder{
+		client:     client,
+		logger:     logger,
+		secret:     []byte(cfg.Secret),
+		routes:     make(map[string]bool, len(cfg.Routes)),
+		expire:     time.Duration(cfg.Expire) * time.Second,
+		lockExpire: time.Duration(cfg.LockExpire) * time.Second,
+	}
+	for _, route := range cfg.Routes {
+		if !mutating(strings.ToUpper(route.Method)) {
+			logger.Sugar().Warnf("幂等只支持修改类请求, 忽略路由: %s %s", route.Method, route.Path)
+			continue
+		}
+		b.routes[routeKey(route.Method, route.Path)] = true
+	}
+	if len(b.secret) == 0 {
+		// 随机密钥只在本实例内有效, 多实例部署时其他实例会把重试当作不同的请求
+		logger.Sugar().Warn("未配置幂等指纹密钥, 使用随机密钥")
+		b.secret = make([]byte, 32)
+		rand.Read(b.secret)
+	}
+	if b.expire <= 0 {
+		b.expire = defaultExpire
+	}
+	if b.lockExpire <= 0 {
+		b.lockExpire = defaultLockExpire
+	}
+	return b
+}
+
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		idemKey := ctx.GetHeader(HeaderKey)
+		if idemKey == "" || !b.routes[routeKey(ctx.Request.Method, ctx.FullPath())] {
+			return
+		}
+
+		if len(idemKey) > maxKeyLength {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, tools.Result{
+				Code: 3,
+				Msg:  "Idempotency-Key过长",
+			})
+			return
+		}
+
+		fingerprint, err := b.fingerprint(ctx)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, tools.Result{
+				Code: 3,
+				Msg:  "请求体过大",
+			})
+			return
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, tools.Result{
+				Code: 3,
+				Msg:  "参数错误",
+			})
+			return
+		}
+
+		key := b.key(ctx, idemKey)
+		c := ctx.Request.Context()
+		held, acquired, err := b.lock(c, key, fingerprint)
+		if err != nil {
+			// 无法确认是否已经执行过, 不能按普通请求处理
+			b.logger.Sugar().Warnf("幂等键加锁失败, key: %s, 原因: %s", key, err)
+			unavailable(ctx)
+			return
+		}
+
+		if !acquired {
+			b.replay(ctx, key, fingerprint)
+			return
+		}
+
+		w := &responseWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = w
+		ctx.Next()
+
+		b.save(c, key, held, fingerprint, w)
+	}
+}
+
+// lock 抢占幂等键, 首次请求处理完之前重试会收到409.
+// 返回写入的处理中记录, 其中的token保证每个请求写入的值不同, 保存和释放时据此确认仍持有幂等键
+func (b *Builder) lock(ctx context.Context, key, fingerprint string) (string, bool, error) {
+	val, _ := json.Marshal(record{
+		State:       stateProcessing,
+		Fingerprint: fingerprint,
+		Token:       uuid.New().String(),
+	})
+	acquired, err := b.client.SetNX(ctx, key, val, b.lockExpire).Result()
+	return string(val), acquired, err
+}
+
+func (b *Builder) replay(ctx *gin.Context, key, fingerprint string) {
+	val, err := b.client.Get(ctx.Request.Context(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// 首次请求恰好失败并释放了幂等键
+		ctx.AbortWithStatusJSON(http.StatusConflict, tools.Result{
+			Code: 10,
+			Msg:  "相同Idempotency-Key的请求正在处理中, 请稍后重试",
+		})
+		return
+	}
+	if err != nil {
+		b.logger.Sugar().Warnf("读取幂等记录失败, key: %s, 原因: %s", key, err)
+		unavailable(ctx)
+		return
+	}
+
+	var rec record
+	if err = json.Unmarshal(val, &rec); err != nil {
+		b.logger.Sugar().Errorf("幂等记录格式错误, key: %s, 原因: %s", key, err)
+		ctx.AbortWithStatusJSON(http.StatusConflict, tools.Result{
+			Code: 10,
+			Msg:  "Idempotency-Key的记录异常, 请更换后重试",
+		})
+		return
+	}
+
+	if rec.Fingerprint != fingerprint {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, tools.Result{
+			Code: 3,
+			Msg:  "Idempotency-Key已被其他请求使用",
+		})
+		return
+	}
+
+	if rec.State != stateCompleted {
+		ctx.AbortWithStatusJSON(http.StatusConflict, tools.Result{
+			Code: 10,
+			Msg:  "相同Idempotency-Key的请求正在处理中, 请稍后重试",
+		})
+		return
+	}
+
+	header := ctx.Writer.Header()
+	for k, v := range rec.Header {
+		if !skipHeaders[k] {
+			header[k] = v
+		}
+	}
+	header.Set(HeaderReplayed, "true")
+	ctx.Writer.WriteHeader(rec.Status)
+	ctx.Writer.Write(rec.Body)
+	ctx.Abort()
+}
+
+// save 只保存成功的响应, 其他情况释放幂等键, 允许客户端修正后使用同一个key重试.
+// 处理时间超过锁定时间后幂等键可能已被其他请求抢占, 此时既不覆盖也不删除
+func (b *Builder) save(ctx context.Context, key, held, fingerprint string, w *responseWriter) {
+	status := w.Status()
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		if err := releaseScript.Run(ctx, b.client, []string{key}, held).Err(); err != nil {
+			b.logger.Sugar().Warnf("释放幂等键失败, key: %s, 原因: %s", key, err)
+		}
+		return
+	}
+
+	header := make(map[string][]string, len(w.Header()))
+	for k, v := range w.Header() {
+		if !skipHeaders[k] {
+			header[k] = v
+		}
+	}
+	val, _ := json.Marshal(record{
+		State:       stateCompleted,
+		Fingerprint: fingerprint,
+		Status:      status,
+		Header:      header,
+		Body:        w.body.Bytes(),
+	})
+	saved, err := saveScript.Run(ctx, b.client, []string{key}, held, string(val), b.expire.Milliseconds()).Int()
+	if err != nil {
+		b.logger.Sugar().Warnf("保存幂等记录失败, key: %s, 原因: %s", key, err)
+		return
+	}
+	if saved == 0 {
+		b.logger.Sugar().Warnf("幂等键已过期或被其他请求持有, 未保存响应, key: %s", key)
+	}
+}
+
+// key 已登录用户的幂等键互相隔离, 未登录的请求按租户隔离
+func (b *Builder) key(ctx *gin.Context, idemKey string) string {
+	subject := tenant.Key(ctx.Request.Context(), "anonymous")
+	if claims, ok := ctx.Value("claims").(*middleware.UserClaims); ok {
+		subject = strconv.FormatInt(claims.UserId, 10)
+	}
+	return fmt.Sprintf("idempotency:%s:%s:%s:%s", ctx.Request.Method, ctx.FullPath(), subject, idemKey)
+}
+
+// fingerprint 请求路径和请求体的HMAC, 用于识别同一个key下的不同请求, 不在redis中留下可比对的请求体摘要.
+// 请求体超过maxBodyBytes时返回*http.MaxBytesError
+func (b *Builder) fingerprint(ctx *gin.Context) (string, error) {
+	var body []byte
+	if ctx.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBodyBytes))
+		if err != nil {
+			return "", err
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	h := hmac.New(sha256.New, b.secret)
+	h.Write([]byte(ctx.Request.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func routeKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+func unavailable(ctx *gin.Context) {
+	ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, tools.Result{
+		Code: 14,
+		Msg:  "服务暂不可用, 请稍后再试",
+	})
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// responseWriter 在写出响应的同时保留一份响应体
+type responseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
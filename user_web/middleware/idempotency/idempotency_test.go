@@ -0,0 +1,333 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_web/config"
+	"github.com/Numsina/tk_users/user_web/logger"
+)
+
+// fakeRedis 只实现中间件用到的命令, 脚本按save.lua和release.lua的语义在内存中执行
+type fakeRedis struct {
+	redis.Cmdable
+	mu   sync.Mutex
+	vals map[string]string
+	err  error
+	// getErr 只影响Get, 模拟加锁之后读取记录失败
+	getErr error
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{vals: make(map[string]string)}
+}
+
+func (f *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, _ time.Duration) *redis.BoolCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cmd := redis.NewBoolCmd(ctx)
+	if f.err != nil {
+		cmd.SetErr(f.err)
+		return cmd
+	}
+	if _, ok := f.vals[key]; ok {
+		cmd.SetVal(false)
+		return cmd
+	}
+	f.vals[key] = string(value.([]byte))
+	cmd.SetVal(true)
+	return cmd
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cmd := redis.NewStringCmd(ctx)
+	val, ok := f.vals[key]
+	switch {
+	case f.err != nil:
+		cmd.SetErr(f.err)
+	case f.getErr != nil:
+		cmd.SetErr(f.getErr)
+	case !ok:
+		cmd.SetErr(redis.Nil)
+	default:
+		cmd.SetVal(val)
+	}
+	return cmd
+}
+
+func (f *fakeRedis) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) *redis.Cmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cmd := redis.NewCmd(ctx)
+	if f.err != nil {
+		cmd.SetErr(f.err)
+		return cmd
+	}
+	if f.vals[keys[0]] != args[0].(string) {
+		cmd.SetVal(int64(0))
+		return cmd
+	}
+	switch sha {
+	case saveScript.Hash():
+		f.vals[keys[0]] = args[1].(string)
+	case releaseScript.Hash():
+		delete(f.vals, keys[0])
+	}
+	cmd.SetVal(int64(1))
+	return cmd
+}
+
+func (f *fakeRedis) only() (string, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for k, v := range f.vals {
+		return k, v
+	}
+	return "", ""
+}
+
+func newTestRouter(t *testing.T, client redis.Cmdable, secret string, calls *int) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	b := NewBuilder(client, config.IdempotencyConfig{
+		Secret: secret,
+		Routes: []config.IdempotencyRoute{
+			{Method: "post", Path: "/signup"},
+			{Method: http.MethodGet, Path: "/users"},
+		},
+	}, logger.NewLogger(logger.WithWriteFile(false)))
+
+	r := gin.New()
+	r.Use(b.Build())
+	handler := func(ctx *gin.Context) {
+		*calls++
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.Status(http.StatusBadRequest)
+			return
+		}
+		if string(body) == "fail" {
+			ctx.String(http.StatusBadRequest, "fail")
+			return
+		}
+		ctx.Header("X-Jwt-Token", "token")
+		ctx.Header("X-Request-Id", "req-1")
+		ctx.String(http.StatusCreated, "%s", body)
+	}
+	r.POST("/signup", handler)
+	r.POST("/users", handler)
+	r.GET("/users", handler)
+	return r
+}
+
+func do(r *gin.Engine, method, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestReplay(t *testing.T) {
+	client := newFakeRedis()
+	var calls int
+	r := newTestRouter(t, client, "secret", &calls)
+
+	body := `{"email":"alice@ex.com"}`
+	first := do(r, http.MethodPost, "/signup", "key-1", body)
+	if first.Code != http.StatusCreated || first.Body.String() != body {
+		t.Fatalf("首次请求: %d %s", first.Code, first.Body.String())
+	}
+
+	// 保存的记录不包含令牌类的响应头
+	_, val := client.only()
+	var rec record
+	if err := json.Unmarshal([]byte(val), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.State != stateCompleted || rec.Header["X-Jwt-Token"] != nil || rec.Header["X-Request-Id"] == nil {
+		t.Fatalf("保存的记录不正确: %+v", rec)
+	}
+
+	again := do(r, http.MethodPost, "/signup", "key-1", body)
+	if calls != 1 {
+		t.Fatalf("重试时再次执行了请求, 执行次数: %d", calls)
+	}
+	if again.Code != http.StatusCreated || again.Body.String() != body || again.Header().Get(HeaderReplayed) != "true" {
+		t.Fatalf("重放的响应不正确: %d %s %v", again.Code, again.Body.String(), again.Header())
+	}
+	if again.Header().Get("X-Jwt-Token") != "" || again.Header().Get("X-Request-Id") != "req-1" {
+		t.Fatalf("重放的响应头不正确: %v", again.Header())
+	}
+
+	if w := do(r, http.MethodPost, "/signup", "key-1", `{"email":"bob@ex.com"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("同一个key的不同请求应返回422, 实际: %d", w.Code)
+	}
+}
+
+func TestOptInRoutes(t *testing.T) {
+	client := newFakeRedis()
+	var calls int
+	r := newTestRouter(t, client, "secret", &calls)
+
+	// 未配置的路由、读请求以及没有幂等键的请求都按普通请求处理
+	for i := 0; i < 2; i++ {
+		do(r, http.MethodPost, "/users", "key-1", "x")
+		do(r, http.MethodGet, "/users", "key-1", "")
+		do(r, http.MethodPost, "/signup", "", "x")
+	}
+	if calls != 6 {
+		t.Fatalf("执行次数为%d, 期望6", calls)
+	}
+	if key, _ := client.only(); key != "" {
+		t.Fatalf("写入了幂等记录: %s", key)
+	}
+}
+
+func TestReleaseOnFailure(t *testing.T) {
+	client := newFakeRedis()
+	var calls int
+	r := newTestRouter(t, client, "secret", &calls)
+
+	if w := do(r, http.MethodPost, "/signup", "key-1", "fail"); w.Code != http.StatusBadRequest {
+		t.Fatalf("首次请求: %d", w.Code)
+	}
+	if key, _ := client.only(); key != "" {
+		t.Fatalf("失败的请求没有释放幂等键: %s", key)
+	}
+	do(r, http.MethodPost, "/signup", "key-1", "fail")
+	if calls != 2 {
+		t.Fatalf("释放后应允许重试, 执行次数: %d", calls)
+	}
+}
+
+// withStatus 返回已写出状态码的responseWriter
+func withStatus(status int) *responseWriter {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Writer.WriteHeader(status)
+	return &responseWriter{ResponseWriter: ctx.Writer}
+}
+
+func TestSaveCompareAndSet(t *testing.T) {
+	client := newFakeRedis()
+	b := NewBuilder(client, config.IdempotencyConfig{Secret: "secret"}, logger.NewLogger(logger.WithWriteFile(false)))
+	ctx := context.Background()
+
+	held, ok, err := b.lock(ctx, "k", "fp")
+	if err != nil || !ok {
+		t.Fatalf("加锁失败: %v, %v", ok, err)
+	}
+	// 处理超过锁定时间, 幂等键过期后被另一个请求抢占
+	delete(client.vals, "k")
+	other, ok, err := b.lock(ctx, "k", "fp")
+	if err != nil || !ok || other == held {
+		t.Fatalf("再次加锁失败: %v, %v", ok, err)
+	}
+
+	b.save(ctx, "k", held, "fp", withStatus(http.StatusOK))
+	if client.vals["k"] != other {
+		t.Fatal("超时的请求覆盖了其他请求持有的幂等键")
+	}
+	b.save(ctx, "k", held, "fp", withStatus(http.StatusInternalServerError))
+	if client.vals["k"] != other {
+		t.Fatal("超时的请求删除了其他请求持有的幂等键")
+	}
+
+	b.save(ctx, "k", other, "fp", withStatus(http.StatusOK))
+	if !strings.Contains(client.vals["k"], stateCompleted) {
+		t.Fatalf("持有幂等键的请求没有保存响应: %s", client.vals["k"])
+	}
+}
+
+func TestFailClosed(t *testing.T) {
+	client := newFakeRedis()
+	var calls int
+	r := newTestRouter(t, client, "secret", &calls)
+
+	client.err = errors.New("connection refused")
+	if w := do(r, http.MethodPost, "/signup", "key-1", "x"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("加锁失败时应返回503, 实际: %d", w.Code)
+	}
+	client.err = nil
+
+	do(r, http.MethodPost, "/signup", "key-1", "x")
+	key, _ := client.only()
+
+	client.getErr = errors.New("connection reset")
+	if w := do(r, http.MethodPost, "/signup", "key-1", "x"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("读取记录失败时应返回503, 实际: %d", w.Code)
+	}
+	client.getErr = nil
+
+	client.vals[key] = "{"
+	if w := do(r, http.MethodPost, "/signup", "key-1", "x"); w.Code != http.StatusConflict {
+		t.Fatalf("记录格式错误时应返回409, 实际: %d", w.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("执行次数为%d, 期望1", calls)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	log := logger.NewLogger(logger.WithWriteFile(false))
+	fingerprint := func(b *Builder, uri, body string) string {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+		fp, err := b.fingerprint(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 请求体读取后放回, 后续处理器仍能读取
+		if rest, _ := io.ReadAll(ctx.Request.Body); string(rest) != body {
+			t.Fatalf("请求体没有放回: %s", rest)
+		}
+		return fp
+	}
+
+	b := NewBuilder(nil, config.IdempotencyConfig{Secret: "secret"}, log)
+	base := fingerprint(b, "/signup", "x")
+	if fingerprint(b, "/signup", "x") != base {
+		t.Fatal("相同请求的指纹不同")
+	}
+	if fingerprint(b, "/signup?a=1", "x") == base || fingerprint(b, "/signup", "y") == base {
+		t.Fatal("不同请求的指纹相同")
+	}
+	other := NewBuilder(nil, config.IdempotencyConfig{Secret: "other"}, log)
+	if fingerprint(other, "/signup", "x") == base {
+		t.Fatal("不同密钥的指纹相同")
+	}
+}
+
+func TestFingerprintBodyLimit(t *testing.T) {
+	// redis不可用时在加锁前就拒绝过大的请求体
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	var calls int
+	r := newTestRouter(t, client, "secret", &calls)
+
+	if w := do(r, http.MethodPost, "/signup", "key-1", strings.Repeat("a", maxBodyBytes+1)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("超过上限的请求体应返回413, 实际: %d", w.Code)
+	}
+	if w := do(r, http.MethodPost, "/signup", strings.Repeat("k", maxKeyLength+1), "x"); w.Code != http.StatusBadRequest {
+		t.Fatalf("过长的幂等键应返回400, 实际: %d", w.Code)
+	}
+	if w := do(r, http.MethodPost, "/signup", "key-1", "x"); w.Code != http.StatusServiceUnavailable || calls != 0 {
+		t.Fatalf("redis不可用时应返回503, 实际: %d, 执行次数: %d", w.Code, calls)
+	}
+}
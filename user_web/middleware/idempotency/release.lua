@@ -0,0 +1,6 @@
+-- 幂等键仍由本次请求持有时才删除
+-- KEYS[1]: 幂等键  ARGV[1]: 本次请求写入的处理中记录
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+return 0
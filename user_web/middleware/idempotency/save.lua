@@ -0,0 +1,7 @@
+-- 幂等键仍由本次请求持有时才写入响应, 锁过期后被其他请求抢占的key不会被覆盖
+-- KEYS[1]: 幂等键  ARGV[1]: 本次请求写入的处理中记录  ARGV[2]: 完成记录  ARGV[3]: 保存时间(毫秒)
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+    return 1
+end
+return 0
@@ -12,6 +12,7 @@ import (
 	"github.com/redis/go-redis/v9"
 
 	"github.com/Numsina/tk_users/user_web/initialize"
+	"github.com/Numsina/tk_users/user_web/tenant"
 )
 
 var (
@@ -24,13 +25,16 @@ var (
 	ErrSsidGenFailed          = errors.New("生成ssid失败")
 	ErrSsidValid              = errors.New("ssid无效")
 	ErrSsidExpired            = errors.New("ssid已过期")
+	ErrTokenTenant            = errors.New("令牌不属于当前租户")
 )
 
 type UserClaims struct {
 	jwt.RegisteredClaims
-	UserId    int32
+	UserId    int64
 	UserAgent string
 	Ssid      string
+	// TenantId 签发令牌的租户, 多租户之前签发的令牌为空, 属于默认租户
+	TenantId string
 }
 
 type JWT struct {
@@ -38,6 +42,8 @@ type JWT struct {
 	Expire      time.Duration
 	MaxRefresh  time.Duration
 	RedisClient redis.Cmdable
+	// Tenants 为nil时所有令牌属于默认租户
+	Tenants *Tenants
 }
 
 func NewJWT(key []byte) *JWT {
@@ -52,14 +58,17 @@ func NewJWT(key []byte) *JWT {
 	}
 }
 
-func (j *JWT) SetToken(ctx *gin.Context, id int32, ssid string) (string, error) {
+func (j *JWT) SetToken(ctx *gin.Context, id int64, ssid string) (string, error) {
+	tenantId := tenant.FromContext(ctx.Request.Context())
 	userClaims := UserClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.issuer(tenantId),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.Expire)),
 		},
 		UserId:    id,
 		UserAgent: ctx.GetHeader("User-Agent"),
 		Ssid:      ssid,
+		TenantId:  tenantId,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS512, userClaims)
@@ -69,7 +78,7 @@ func (j *JWT) SetToken(ctx *gin.Context, id int32, ssid string) (string, error)
 		return "", ErrTokenGenFailed
 	}
 
-	err = j.RedisClient.Set(ctx.Request.Context(), strconv.Itoa(int(id)), ssid, j.Expire).Err()
+	err = j.RedisClient.Set(ctx.Request.Context(), strconv.FormatInt(id, 10), ssid, j.Expire).Err()
 	if err != nil {
 		return "", ErrSsidGenFailed
 	}
@@ -90,7 +99,13 @@ func (j *JWT) ParseToken(ctx *gin.Context, tokenString string, claims *UserClaim
 		return nil, ErrTokenInvalid
 	}
 
-	val, err := j.RedisClient.Get(ctx, strconv.Itoa(int(claims.UserId))).Result()
+	// 一个租户签发的令牌不能在其他租户使用
+	tenantId := tenant.FromContext(ctx.Request.Context())
+	if tenant.Normalize(claims.TenantId) != tenantId || claims.Issuer != j.issuer(tenantId) {
+		return nil, ErrTokenTenant
+	}
+
+	val, err := j.RedisClient.Get(ctx, strconv.FormatInt(claims.UserId, 10)).Result()
 	if err != nil {
 		return nil, ErrSsidExpired
 	}
@@ -101,6 +116,13 @@ func (j *JWT) ParseToken(ctx *gin.Context, tokenString string, claims *UserClaim
 	return token, nil
 }
 
+func (j *JWT) issuer(tenantId string) string {
+	if j.Tenants == nil {
+		return ""
+	}
+	return j.Tenants.Issuer(tenantId)
+}
+
 func (j *JWT) RefreshToken(ctx *gin.Context, token *jwt.Token, claims *UserClaims) (*UserClaims, string, error) {
 	var tokenString string
 	var err error
@@ -111,7 +133,7 @@ func (j *JWT) RefreshToken(ctx *gin.Context, token *jwt.Token, claims *UserClaim
 		return nil, "", ErrRefreshToken
 	}
 
-	err = j.RedisClient.Expire(ctx, strconv.Itoa(int(claims.UserId)), j.Expire).Err()
+	err = j.RedisClient.Expire(ctx, strconv.FormatInt(claims.UserId, 10), j.Expire).Err()
 	if err != nil {
 		return nil, "", ErrSsidGenFailed
 	}
@@ -119,5 +141,5 @@ func (j *JWT) RefreshToken(ctx *gin.Context, token *jwt.Token, claims *UserClaim
 }
 
 func (j *JWT) DeleteSsid(ctx *gin.Context, claims *UserClaims) error {
-	return j.RedisClient.Del(ctx, strconv.Itoa(int(claims.UserId))).Err()
+	return j.RedisClient.Del(ctx, strconv.FormatInt(claims.UserId, 10)).Err()
 }
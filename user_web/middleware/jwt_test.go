@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_web/config"
+)
+
+// newTestJWT redis不可用, 通过租户校验的令牌在读取ssid时返回ErrSsidExpired
+func newTestJWT(t *testing.T) (*JWT, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	tenants := NewTenants([]config.TenantConfig{
+		{Id: "acme", JwtIssuer: "acme-iss"},
+		{Id: "other", JwtIssuer: "other-iss"},
+	})
+	j := &JWT{
+		Secret:      []byte("secret"),
+		Expire:      time.Hour,
+		MaxRefresh:  time.Hour,
+		RedisClient: client,
+		Tenants:     tenants,
+	}
+
+	r := gin.New()
+	r.Use(tenants.Build())
+	r.GET("/parse", func(ctx *gin.Context) {
+		var claims UserClaims
+		if _, err := j.ParseToken(ctx, ctx.GetHeader("Authorization"), &claims); err != nil {
+			ctx.String(http.StatusUnauthorized, err.Error())
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+	return j, r
+}
+
+func signToken(t *testing.T, j *JWT, tenantId, issuer string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, UserClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		UserId:   1,
+		Ssid:     "ssid",
+		TenantId: tenantId,
+	}).SignedString(j.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParseTokenTenant(t *testing.T) {
+	j, r := newTestJWT(t)
+	acme := signToken(t, j, "acme", "acme-iss")
+
+	cases := []struct {
+		name   string
+		token  string
+		tenant string
+		want   error
+	}{
+		{"本租户的令牌", acme, "acme", ErrSsidExpired},
+		{"租户大小写不同", acme, "ACME", ErrSsidExpired},
+		{"其他租户使用", acme, "other", ErrTokenTenant},
+		{"默认租户使用", acme, "", ErrTokenTenant},
+		{"多租户之前签发的令牌", signToken(t, j, "", ""), "acme", ErrTokenTenant},
+		{"多租户之前签发的令牌在默认租户使用", signToken(t, j, "", ""), "", ErrSsidExpired},
+		{"iss属于其他租户", signToken(t, j, "acme", "other-iss"), "acme", ErrTokenTenant},
+		{"租户属于其他租户", signToken(t, j, "other", "acme-iss"), "acme", ErrTokenTenant},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/parse", nil)
+		req.Header.Set("Authorization", c.token)
+		if c.tenant != "" {
+			req.Header.Set(TenantHeader, c.tenant)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized || w.Body.String() != c.want.Error() {
+			t.Errorf("%s: 返回%d %s, 期望%v", c.name, w.Code, w.Body.String(), c.want)
+		}
+	}
+
+	// 未知的租户在解析令牌之前被拒绝
+	req := httptest.NewRequest(http.MethodGet, "/parse", nil)
+	req.Header.Set("Authorization", acme)
+	req.Header.Set(TenantHeader, "unknown")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("未知的租户返回%d", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	AlgorithmSlidingWindow = "sliding_window"
+	AlgorithmTokenBucket   = "token_bucket"
+)
+
+var (
+	//go:embed sliding_window.lua
+	slidingWindowLua string
+	//go:embed token_bucket.lua
+	tokenBucketLua string
+
+	slidingWindowScript = redis.NewScript(slidingWindowLua)
+	tokenBucketScript   = redis.NewScript(tokenBucketLua)
+)
+
+var ErrUnknownAlgorithm = errors.New("未知的限流算法")
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Limiter 基于redis的限流器, 计数在lua脚本中原子完成, 多实例共享
+type Limiter struct {
+	client redis.Cmdable
+}
+
+func NewLimiter(client redis.Cmdable) *Limiter {
+	return &Limiter{client: client}
+}
+
+// Allow 对key消耗一次配额, limit为窗口内的请求数(令牌桶为桶容量)
+func (l *Limiter) Allow(ctx context.Context, algorithm, key string, limit int, window time.Duration) (Result, error) {
+	var res []int64
+	var err error
+	switch algorithm {
+	case AlgorithmSlidingWindow, "":
+		res, err = slidingWindowScript.Run(ctx, l.client, []string{key},
+			window.Milliseconds(), limit, uuid.New().String()).Int64Slice()
+	case AlgorithmTokenBucket:
+		res, err = tokenBucketScript.Run(ctx, l.client, []string{key},
+			limit, window.Milliseconds()).Int64Slice()
+	default:
+		return Result{}, ErrUnknownAlgorithm
+	}
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Limit:      limit,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		Reset:      time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
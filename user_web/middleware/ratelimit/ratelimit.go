@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Numsina/tk_users/user_web/config"
+	"github.com/Numsina/tk_users/user_web/logger"
+	"github.com/Numsina/tk_users/user_web/middleware"
+	"github.com/Numsina/tk_users/user_web/tenant"
+	"github.com/Numsina/tk_users/user_web/tools"
+)
+
+// 限流维度
+const (
+	KeyIP    = "ip"
+	KeyUser  = "user"
+	KeyEmail = "email"
+)
+
+// maxBodyBytes 按邮箱限流时读取的请求体上限, 登录注册等请求体远小于该值
+const maxBodyBytes = 1 << 20
+
+type Builder struct {
+	limiter *Limiter
+	rules   []config.RateLimitRule
+	logger  *logger.Logger
+}
+
+func NewBuilder(limiter *Limiter, rules []config.RateLimitRule, logger *logger.Logger) *Builder {
+	return &Builder{
+		limiter: limiter,
+		rules:   rules,
+		logger:  logger,
+	}
+}
+
+// Build 按路由匹配配置的规则, 一个路由可以同时配置多个维度, 任一规则超限即拒绝
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		path := ctx.FullPath()
+		if path == "" {
+			return
+		}
+
+		var tightest *Result
+		for _, rule := range b.rules {
+			if rule.Path != path || (rule.Method != "" && !strings.EqualFold(rule.Method, ctx.Request.Method)) {
+				continue
+			}
+
+			subject, err := b.keyOf(ctx, rule.Key)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, tools.Result{
+					Code: 3,
+					Msg:  "请求体过大",
+				})
+				return
+			}
+
+			key := fmt.Sprintf("ratelimit:%s:%s:%s:%s", ctx.Request.Method, path, rule.Key, subject)
+			res, err := b.limiter.Allow(ctx.Request.Context(), rule.Algorithm, key, rule.Limit,
+				time.Duration(rule.Window)*time.Second)
+			if err != nil {
+				// redis不可用时放行, 避免限流组件拖垮登录注册
+				b.logger.Sugar().Warnf("限流检查失败, 规则: %s %s, 原因: %s", rule.Method, rule.Path, err)
+				continue
+			}
+
+			if tightest == nil || !res.Allowed || (tightest.Allowed && res.Remaining < tightest.Remaining) {
+				tightest = &res
+			}
+			if !res.Allowed {
+				break
+			}
+		}
+
+		if tightest == nil {
+			return
+		}
+
+		setHeaders(ctx, *tightest)
+		if !tightest.Allowed {
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, tools.Result{
+				Code: 8,
+				Msg:  "请求过于频繁, 请稍后再试",
+			})
+		}
+	}
+}
+
+// keyOf 只有请求体超过上限时返回错误
+func (b *Builder) keyOf(ctx *gin.Context, typ string) (string, error) {
+	switch typ {
+	case KeyUser:
+		if claims, ok := ctx.Value("claims").(*middleware.UserClaims); ok {
+			return strconv.FormatInt(claims.UserId, 10), nil
+		}
+	case KeyEmail:
+		email, err := peekEmail(ctx)
+		if err != nil {
+			return "", err
+		}
+		if email != "" {
+			// 不同租户可以注册相同的邮箱
+			return tenant.Key(ctx.Request.Context(), email), nil
+		}
+	}
+	// 拿不到对应维度时按IP限流
+	return ctx.ClientIP(), nil
+}
+
+// peekEmail 读取请求体中的email字段, 并把请求体放回供后续处理.
+// 最多读取maxBodyBytes, 超过时返回*http.MaxBytesError, 其他读取或解析错误按没有邮箱处理
+func peekEmail(ctx *gin.Context) (string, error) {
+	if ctx.Request.Body == nil {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBodyBytes))
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return "", err
+	}
+	if err != nil {
+		return "", nil
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err = json.Unmarshal(body, &req); err != nil {
+		return "", nil
+	}
+	return strings.ToLower(strings.TrimSpace(req.Email)), nil
+}
+
+func setHeaders(ctx *gin.Context, res Result) {
+	ctx.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	ctx.Header("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+	if !res.Allowed {
+		ctx.Header("Retry-After", strconv.Itoa(max(1, seconds(res.RetryAfter))))
+	}
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Numsina/tk_users/user_web/config"
+	"github.com/Numsina/tk_users/user_web/logger"
+)
+
+// newTestRouter redis不可用时限流放行, 只检查请求体的处理
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	b := NewBuilder(NewLimiter(client), []config.RateLimitRule{
+		{Method: http.MethodPost, Path: "/login", Algorithm: "sliding_window", Key: KeyEmail, Limit: 5, Window: 60},
+	}, logger.NewLogger(logger.WithWriteFile(false)))
+
+	r := gin.New()
+	r.POST("/login", b.Build(), func(ctx *gin.Context) {
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.Status(http.StatusBadRequest)
+			return
+		}
+		ctx.String(http.StatusOK, "%s", body)
+	})
+	return r
+}
+
+func TestPeekEmailBodyLimit(t *testing.T) {
+	r := newTestRouter(t)
+
+	body := `{"email":"alice@ex.com","password":"x"}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body)))
+	if w.Code != http.StatusOK || w.Body.String() != body {
+		t.Fatalf("请求体没有放回: %d %s", w.Code, w.Body.String())
+	}
+
+	large := `{"email":"alice@ex.com","pad":"` + strings.Repeat("a", maxBodyBytes) + `"}`
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader([]byte(large))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("超过上限的请求体应返回413, 实际: %d", w.Code)
+	}
+}
@@ -0,0 +1,28 @@
+-- 滑动窗口日志: 有序集合中保存窗口内每次请求的时间戳
+-- KEYS[1]: 限流key  ARGV[1]: 窗口(毫秒)  ARGV[2]: 窗口内允许的请求数  ARGV[3]: 本次请求的唯一标识
+-- 返回 {是否允许, 剩余次数, 重试等待(毫秒), 窗口重置(毫秒)}
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+
+local function reset()
+    local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+    if #oldest == 0 then
+        return window
+    end
+    return tonumber(oldest[2]) + window - now
+end
+
+if count < limit then
+    redis.call('ZADD', key, now, ARGV[3])
+    redis.call('PEXPIRE', key, window)
+    return {1, limit - count - 1, 0, reset()}
+end
+
+local wait = reset()
+return {0, 0, wait, wait}
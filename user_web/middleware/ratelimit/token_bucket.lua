@@ -0,0 +1,26 @@
+-- 令牌桶: 哈希中保存剩余令牌数以及上次补充的时间
+-- KEYS[1]: 限流key  ARGV[1]: 桶容量  ARGV[2]: 补满整桶所需时间(毫秒)
+-- 返回 {是否允许, 剩余令牌, 重试等待(毫秒), 补满等待(毫秒)}
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local rate = capacity / tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(data[1]) or capacity
+local ts = tonumber(data[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+else
+    wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', key, math.ceil(capacity / rate))
+return {allowed, math.floor(tokens), wait, math.ceil((capacity - tokens) / rate)}
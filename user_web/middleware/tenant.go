@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Numsina/tk_users/user_web/config"
+	"github.com/Numsina/tk_users/user_web/tenant"
+	"github.com/Numsina/tk_users/user_web/tools"
+)
+
+// TenantHeader 指定租户的请求头, 优先于域名
+const TenantHeader = "X-Tenant-Id"
+
+// Tenants 解析请求所属的租户并放入请求的ctx, 之后调用用户服务时通过metadata传递.
+// 没有配置租户时只接受默认租户
+type Tenants struct {
+	issuers map[string]string
+	hosts   map[string]string
+}
+
+func NewTenants(cfgs []config.TenantConfig) *Tenants {
+	t := &Tenants{
+		issuers: map[string]string{tenant.Default: ""},
+		hosts:   make(map[string]string),
+	}
+	for _, cfg := range cfgs {
+		id := tenant.Normalize(cfg.Id)
+		t.issuers[id] = cfg.JwtIssuer
+		for _, host := range cfg.Hosts {
+			t.hosts[strings.ToLower(host)] = id
+		}
+	}
+	return t
+}
+
+func (t *Tenants) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := t.resolve(ctx)
+		if _, ok := t.issuers[id]; !ok {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, tools.Result{
+				Code: 3,
+				Msg:  "未知的租户",
+			})
+			return
+		}
+		ctx.Request = ctx.Request.WithContext(tenant.WithTenant(ctx.Request.Context(), id))
+	}
+}
+
+// Issuer 租户签发令牌时使用的iss
+func (t *Tenants) Issuer(id string) string {
+	return t.issuers[id]
+}
+
+func (t *Tenants) resolve(ctx *gin.Context) string {
+	if id := ctx.GetHeader(TenantHeader); id != "" {
+		return tenant.Normalize(id)
+	}
+
+	host := ctx.Request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if id, ok := t.hosts[strings.ToLower(host)]; ok {
+		return id
+	}
+	return tenant.Default
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Numsina/tk_users/user_web/domain"
+	"github.com/Numsina/tk_users/user_web/gen/users/v1"
+)
+
+type PreferenceService struct {
+	client users.PreferenceServiceClient
+}
+
+func NewPreferenceService(client users.PreferenceServiceClient) *PreferenceService {
+	return &PreferenceService{client: client}
+}
+
+func (p *PreferenceService) Get(ctx context.Context, uid int64, key string) (domain.Preference, error) {
+	resp, err := p.client.GetPreference(ctx, &users.GetPreferenceReq{
+		UserId: uid,
+		Key:    key,
+	})
+	if err != nil {
+		return domain.Preference{}, err
+	}
+	return toPreference(resp.GetPreference()), nil
+}
+
+func (p *PreferenceService) BatchGet(ctx context.Context, uid int64, keys []string) ([]domain.Preference, error) {
+	resp, err := p.client.BatchGetPreferences(ctx, &users.BatchGetPreferencesReq{
+		UserId: uid,
+		Keys:   keys,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := make([]domain.Preference, 0, len(resp.GetPreferences()))
+	for _, pref := range resp.GetPreferences() {
+		prefs = append(prefs, toPreference(pref))
+	}
+	return prefs, nil
+}
+
+func (p *PreferenceService) Set(ctx context.Context, uid int64, pref domain.Preference) (domain.Preference, error) {
+	resp, err := p.client.SetPreference(ctx, &users.SetPreferenceReq{
+		UserId:  uid,
+		Key:     pref.Key,
+		Value:   pref.Value,
+		Version: pref.Version,
+	})
+	if err != nil {
+		return domain.Preference{}, err
+	}
+	return toPreference(resp.GetPreference()), nil
+}
+
+func toPreference(pref *users.Preference) domain.Preference {
+	return domain.Preference{
+		Key:      pref.GetKey(),
+		Value:    pref.GetValue(),
+		Type:     pref.GetType(),
+		Version:  pref.GetVersion(),
+		UpdateAt: pref.GetUpdateAt(),
+	}
+}
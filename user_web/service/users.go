@@ -16,7 +16,7 @@ func NewService(client users.UserServiceClient) *UserService {
 	return &UserService{client: client}
 }
 
-func (u *UserService) Signup(ctx context.Context, user domain.User) (int32, error) {
+func (u *UserService) Signup(ctx context.Context, user domain.User) (int64, error) {
 	resp, err := u.client.Register(ctx, &users.RegisterReq{
 		Email:           user.Email,
 		Password:        user.Password,
@@ -29,7 +29,7 @@ func (u *UserService) Signup(ctx context.Context, user domain.User) (int32, erro
 	return resp.GetUserId(), nil
 }
 
-func (u *UserService) Login(ctx context.Context, user domain.User) (int32, error) {
+func (u *UserService) Login(ctx context.Context, user domain.User) (int64, error) {
 	resp, err := u.client.Login(ctx, &users.LoginReq{
 		Email:    user.Email,
 		Password: user.Password,
@@ -58,3 +58,44 @@ func (u *UserService) GetUserByEmail(ctx context.Context, email string) (domain.
 		Address:     resp.Address,
 	}, err
 }
+
+func (u *UserService) GetProfile(ctx context.Context, uid int64) (domain.UserResp, error) {
+	resp, err := u.client.GetUserById(ctx, &users.GetUserByIdReq{
+		UserId: uid,
+	})
+	if err != nil {
+		return domain.UserResp{}, err
+	}
+	return toUserResp(resp.GetProfile()), nil
+}
+
+// UpdateProfile version为读取时得到的版本, 0表示不检查
+func (u *UserService) UpdateProfile(ctx context.Context, user domain.User, version int64) (domain.UserResp, error) {
+	resp, err := u.client.UpdateProfile(ctx, &users.UpdateProfileReq{
+		UserId:      user.Id,
+		NickName:    user.NickName,
+		Description: user.Description,
+		Avatar:      user.Avatar,
+		BirthDay:    user.BirthDay,
+		Address:     user.Address,
+		Version:     version,
+	})
+	if err != nil {
+		return domain.UserResp{}, err
+	}
+	return toUserResp(resp.GetProfile()), nil
+}
+
+func toUserResp(p *users.Profile) domain.UserResp {
+	return domain.UserResp{
+		Id:          p.GetUserId(),
+		Email:       p.GetEmail(),
+		NickName:    p.GetNickName(),
+		Description: p.GetDescription(),
+		Avatar:      p.GetAvatar(),
+		BirthDay:    p.GetBirthDay(),
+		Address:     p.GetAddress(),
+		Version:     p.GetVersion(),
+		UpdateAt:    p.GetUpdateAt(),
+	}
+}
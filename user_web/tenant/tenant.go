@@ -0,0 +1,44 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+)
+
+// Default 没有指定租户的请求属于默认租户
+const Default = "default"
+
+// MetadataKey 调用用户服务时在grpc metadata中传递租户的键
+const MetadataKey = "x-tenant-id"
+
+type ctxKey struct{}
+
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext 返回请求所属的租户, 没有设置时为默认租户
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(ctxKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
+
+// Normalize 租户id不区分大小写
+func Normalize(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" {
+		return Default
+	}
+	return id
+}
+
+// Key 给非默认租户的redis键加上租户前缀, 默认租户沿用原来的键
+func Key(ctx context.Context, key string) string {
+	id := FromContext(ctx)
+	if id == Default {
+		return key
+	}
+	return id + ":" + key
+}
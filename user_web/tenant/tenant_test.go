@@ -0,0 +1,22 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	cases := []struct {
+		ctx  context.Context
+		want string
+	}{
+		{context.Background(), "captcha:1"},
+		{WithTenant(context.Background(), Default), "captcha:1"},
+		{WithTenant(context.Background(), "acme"), "acme:captcha:1"},
+	}
+	for _, c := range cases {
+		if got := Key(c.ctx, "captcha:1"); got != c.want {
+			t.Errorf("Key返回%q, 期望%q", got, c.want)
+		}
+	}
+}